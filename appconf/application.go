@@ -5,28 +5,257 @@ const Version string = "1.0.0"
 
 // Application 应用程序配置对象
 // 该对象用于持有配置文件出现的所有配置参数
+//
+// 配置加载优先级由低到高依次为：缺省配置、配置文件、环境变量（env标签）、命令行参数。
+// 标记了 secret 标签的字段在打印配置时会被隐藏。
 type Application struct {
-	Database       Database `yaml:"database"`       // 数据库连接配置，不同的数据库驱动连接配置不一样，见数据库驱动
-	Port           int      `yaml:"port"`           // 端口
-	SSOBaseUrl     string   `yaml:"SSOBaseUrl"`     // 单点登录基础路径
-	LogKeepMaxDays int      `yaml:"logKeepMaxDays"` // 操作日志最大保存天数，注意若该值小于等于0则表示不删除。
-	Debug          bool     `yaml:"debug"`          // 调试模式
+	Database        Database   `yaml:"database"`                                   // 数据库连接配置，不同的数据库驱动连接配置不一样，见数据库驱动
+	Port            int        `yaml:"port" env:"PDM_PORT"`                        // 端口
+	SSOBaseUrl      string     `yaml:"SSOBaseUrl" env:"PDM_SSO_BASE_URL"`          // 已废弃，保留以兼容旧版本配置文件，单点登录见 sso
+	LogKeepMaxDays  int        `yaml:"logKeepMaxDays" env:"PDM_LOG_KEEP_DAYS"`     // 操作日志最大保存天数，注意若该值小于等于0则表示不删除。
+	Debug           bool       `yaml:"debug" env:"PDM_DEBUG"`                      // 调试模式
+	TLS             TLS        `yaml:"tls"`                                        // HTTPS配置
+	ShutdownTimeout int        `yaml:"shutdownTimeout" env:"PDM_SHUTDOWN_TIMEOUT"` // 停机时等待处理中请求完成的最长时间（单位：秒）
+	Storage         Storage    `yaml:"storage"`                                    // 文件存储配置
+	Backup          Backup     `yaml:"backup"`                                     // 备份配置
+	JWT             JWT        `yaml:"jwt"`                                        // 登录token签名密钥配置
+	Password        Password   `yaml:"password"`                                   // 用户口令策略
+	TOTP            TOTP       `yaml:"totp"`                                       // 动态口令配置
+	Throttle        Throttle   `yaml:"throttle"`                                   // 登录失败限制
+	SSO             SSO        `yaml:"sso"`                                        // 单点登录配置
+	LDAP            LDAP       `yaml:"ldap"`                                       // 目录服务认证配置
+	Revocation      Revocation `yaml:"revocation"`                                 // 管理员证书吊销检查
 }
 
 // Database 数据库配置
 type Database struct {
-	Type string // 数据库类型：mysql、dm
-	DSN  string // 连接地址
+	Type string `env:"PDM_DB_TYPE"`             // 数据库类型：mysql、mariadb、sqlite
+	DSN  string `env:"PDM_DB_DSN" secret:"dsn"` // 连接地址，sqlite 为数据库文件路径，相对路径以可执行程序所在目录为基础
 }
 
+// TLS HTTPS配置
+// 标准证书（RSA/ECDSA）与SM2双证书可同时配置，此时同一端口根据客户端协议自动选择TLS或TLCP。
+// 证书与私钥均为PEM格式，相对路径以可执行程序所在目录为基础。
+type TLS struct {
+	Enable       bool   `yaml:"enable" env:"PDM_TLS_ENABLE"`               // 启用HTTPS
+	CertFile     string `yaml:"certFile" env:"PDM_TLS_CERT_FILE"`          // 标准服务器证书
+	KeyFile      string `yaml:"keyFile" env:"PDM_TLS_KEY_FILE"`            // 标准服务器证书私钥
+	SignCertFile string `yaml:"signCertFile" env:"PDM_TLS_SIGN_CERT_FILE"` // SM2签名证书
+	SignKeyFile  string `yaml:"signKeyFile" env:"PDM_TLS_SIGN_KEY_FILE"`   // SM2签名证书私钥
+	EncCertFile  string `yaml:"encCertFile" env:"PDM_TLS_ENC_CERT_FILE"`   // SM2加密证书
+	EncKeyFile   string `yaml:"encKeyFile" env:"PDM_TLS_ENC_KEY_FILE"`     // SM2加密证书私钥
+	RedirectPort int    `yaml:"redirectPort" env:"PDM_TLS_REDIRECT_PORT"`  // HTTP重定向端口，大于0时在该端口将HTTP请求重定向到HTTPS
+}
+
+// Standard 是否配置了标准证书
+func (t *TLS) Standard() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// SM2 是否配置了SM2双证书
+func (t *TLS) SM2() bool {
+	return t.SignCertFile != "" || t.SignKeyFile != "" || t.EncCertFile != "" || t.EncKeyFile != ""
+}
+
+// Storage 文件存储配置
+// 多个pdm实例同时运行时需要使用对象存储共享文档等业务文件。
+type Storage struct {
+	Type string `yaml:"type" env:"PDM_STORAGE_TYPE"` // 存储类型：local（本地文件系统，缺省）、s3（S3兼容的对象存储，如MinIO）
+	S3   S3     `yaml:"s3"`                          // 对象存储配置，存储类型为 s3 时有效
+}
+
+// S3 S3兼容的对象存储配置
+type S3 struct {
+	Endpoint         string `yaml:"endpoint" env:"PDM_S3_ENDPOINT"`                   // 服务地址，如 http://127.0.0.1:9000
+	Region           string `yaml:"region" env:"PDM_S3_REGION"`                       // 区域，MinIO 可使用缺省值 us-east-1
+	Bucket           string `yaml:"bucket" env:"PDM_S3_BUCKET"`                       // 存储桶，需预先创建
+	AccessKey        string `yaml:"accessKey" env:"PDM_S3_ACCESS_KEY"`                // 访问密钥ID
+	SecretKey        string `yaml:"secretKey" env:"PDM_S3_SECRET_KEY" secret:"true"`  // 访问密钥
+	Prefix           string `yaml:"prefix" env:"PDM_S3_PREFIX"`                       // 对象键前缀，用于多个系统共用存储桶
+	VirtualHostStyle bool   `yaml:"virtualHostStyle" env:"PDM_S3_VIRTUAL_HOST_STYLE"` // 使用虚拟主机风格访问存储桶，缺省使用路径风格
+}
+
+// Backup 备份配置
+// 备份文件包含数据库中所有表的数据以及对接文档、基础文档区、技术方案、头像、根证书等业务文件。
+type Backup struct {
+	Dir      string `yaml:"dir" env:"PDM_BACKUP_DIR"`           // 备份文件存储目录，相对路径以可执行程序所在目录为基础
+	Interval int    `yaml:"interval" env:"PDM_BACKUP_INTERVAL"` // 定时备份间隔（单位：小时），小于等于0表示不定时备份
+	Keep     int    `yaml:"keep" env:"PDM_BACKUP_KEEP"`         // 备份目录中最多保留的备份数量，超出时删除最早的备份，小于等于0表示不删除
+}
+
+// JWT 登录token签名密钥配置
+// 签名密钥按轮换周期更换，保存在数据库或由主密钥文件派生，程序重启后已签发的token仍然有效，
+// 多个实例共享同一数据库或主密钥文件即可互相认可对方签发的token。
+type JWT struct {
+	KeyFile  string `yaml:"keyFile" env:"PDM_JWT_KEY_FILE"`  // 主密钥文件，为空时密钥保存在数据库中；文件不存在时自动生成，相对路径以可执行程序所在目录为基础
+	Rotation int    `yaml:"rotation" env:"PDM_JWT_ROTATION"` // 密钥轮换周期（单位：小时）
+	Grace    int    `yaml:"grace" env:"PDM_JWT_GRACE"`       // 密钥轮换后继续用于验证的时间（单位：小时），应不小于token有效期8小时
+}
+
+// Password 用户口令策略
+// 创建用户、重置口令后用户首次登录需修改口令，口令过期后登录同样需修改口令。
+type Password struct {
+	MinLength   int      `yaml:"minLength" env:"PDM_PWD_MIN_LENGTH"`     // 口令最小长度
+	MinClasses  int      `yaml:"minClasses" env:"PDM_PWD_MIN_CLASSES"`   // 至少包含的字符类别数，类别包括大写字母、小写字母、数字、特殊字符，取值1~4
+	BannedWords []string `yaml:"bannedWords" env:"PDM_PWD_BANNED_WORDS"` // 禁用词，口令中不能包含（不区分大小写），环境变量中多个用","隔开
+	MaxAge      int      `yaml:"maxAge" env:"PDM_PWD_MAX_AGE"`           // 口令有效期（单位：天），小于等于0表示不过期
+	History     int      `yaml:"history" env:"PDM_PWD_HISTORY"`          // 新口令不能与最近使用过的几个口令相同，小于等于0表示不限制
+	Iterations  int      `yaml:"iterations" env:"PDM_PWD_ITERATIONS"`    // 口令摘要PBKDF2-HMAC-SM3迭代次数，不小于10000，调大后已有用户在下次登录时自动升级
+}
+
+// TOTP 动态口令（RFC 6238）配置
+// 哪些用户必须使用动态口令由管理员在系统中设置，见 /api/totp/policy。
+type TOTP struct {
+	Issuer string `yaml:"issuer" env:"PDM_TOTP_ISSUER"` // 签发者名称，显示在用户的身份验证器App中，不能包含":"
+}
+
+// Throttle 登录失败限制
+// 分别按账号与来源IP统计登录失败（口令或动态口令错误）次数，达到上限后锁定，
+// 锁定结束后再次达到上限时锁定时长加倍，直到最长锁定时长。失败记录保存在数据库中，重启后仍然有效，多个实例共享。
+type Throttle struct {
+	AccountFailures int `yaml:"accountFailures" env:"PDM_THROTTLE_ACCOUNT_FAILURES"` // 同一账号连续失败次数上限，登录成功后清零
+	IPFailures      int `yaml:"ipFailures" env:"PDM_THROTTLE_IP_FAILURES"`           // 同一IP失败次数上限，不因登录成功清零，用于限制对多个账号的口令猜测
+	Window          int `yaml:"window" env:"PDM_THROTTLE_WINDOW"`                    // 统计窗口（单位：分钟），超过该时间未再失败则失败次数清零
+	LockTime        int `yaml:"lockTime" env:"PDM_THROTTLE_LOCK_TIME"`               // 首次锁定时长（单位：分钟）
+	MaxLockTime     int `yaml:"maxLockTime" env:"PDM_THROTTLE_MAX_LOCK_TIME"`        // 最长锁定时长（单位：分钟），锁定结束后超过该时间未再锁定则锁定时长恢复为首次锁定时长
+}
+
+// Revocation 管理员证书吊销检查
+// 实体鉴别与证书绑定时检查证书是否被吊销。吊销列表（CRL）与根证书一同上传到根证书目录，
+// 没有该证书颁发者的有效吊销列表时，可向证书颁发机构信息访问扩展（AIA）中的OCSP服务查询。
+type Revocation struct {
+	Mode    string `yaml:"mode" env:"PDM_REVOCATION_MODE"`       // 检查模式：off - 不检查 soft - 无法确认证书状态时允许登录并记录日志（缺省） hard - 无法确认证书状态时拒绝登录
+	OCSP    bool   `yaml:"ocsp" env:"PDM_REVOCATION_OCSP"`       // 没有有效的吊销列表时查询OCSP服务
+	Timeout int    `yaml:"timeout" env:"PDM_REVOCATION_TIMEOUT"` // OCSP查询超时时间（单位：秒）
+}
+
+// SSO 单点登录配置
+// 支持多个 OAuth2/OpenID Connect 身份提供方，登录地址为 /api/sso/<name>/login，
+// 回调地址为 /api/sso/<name>/callback，需在身份提供方注册。
+type SSO struct {
+	Providers []SSOProvider `yaml:"providers"` // 身份提供方，仅支持在配置文件中配置
+}
+
+// SSOProvider 单点登录身份提供方
+// 配置 issuer 时按 OpenID Connect 处理，通过发现文档获取各端点地址并校验 ID Token；
+// 否则按普通 OAuth2 处理，需配置授权、令牌与用户信息端点，用户信息从用户信息端点获取。
+type SSOProvider struct {
+	Name             string   `yaml:"name"`                       // 标识，用于登录与回调地址，仅允许字母、数字、"-"、"_"
+	DisplayName      string   `yaml:"displayName"`                // 登录页面显示的名称，为空时使用标识
+	Issuer           string   `yaml:"issuer"`                     // OIDC签发者，如 https://idp.example.com/realms/pdm
+	ClientID         string   `yaml:"clientId"`                   // 客户端ID
+	ClientSecret     string   `yaml:"clientSecret" secret:"true"` // 客户端密钥，为空表示公开客户端
+	ClientSecretPost bool     `yaml:"clientSecretPost"`           // 在请求体中传递客户端密钥，缺省使用HTTP基本认证
+	RedirectURL      string   `yaml:"redirectUrl"`                // 回调地址，如 https://pdm.example.com/api/sso/<name>/callback
+	Scopes           []string `yaml:"scopes"`                     // 申请的权限范围，为空时OIDC使用 openid profile email
+	AuthURL          string   `yaml:"authUrl"`                    // 授权端点，OIDC为空时从发现文档获取
+	TokenURL         string   `yaml:"tokenUrl"`                   // 令牌端点，OIDC为空时从发现文档获取
+	UserInfoURL      string   `yaml:"userInfoUrl"`                // 用户信息端点，OIDC为空时从发现文档获取
+	JWKSURL          string   `yaml:"jwksUrl"`                    // 签名公钥集地址，OIDC为空时从发现文档获取
+	OpenidClaim      string   `yaml:"openidClaim"`                // 与用户工号（openid）对应的声明，支持"."分隔的嵌套路径如 data.openid，缺省 sub
+	NameClaim        string   `yaml:"nameClaim"`                  // 姓名声明，缺省 name
+	EmailClaim       string   `yaml:"emailClaim"`                 // 邮箱声明，缺省 email
+	PhoneClaim       string   `yaml:"phoneClaim"`                 // 手机号声明，缺省 phone_number
+	AutoCreate       bool     `yaml:"autoCreate"`                 // 自动创建不存在的用户，缺省仅允许已存在的用户登录
+}
+
+// LDAP 目录服务（LDAP/Active Directory）认证配置
+// 启用后，目录中的用户使用目录口令登录：先使用服务账号按 userFilter 查找用户，再以用户DN与口令绑定验证，
+// 验证通过后按目录属性创建或更新用户，并按组映射加入项目。非目录创建的本地用户仍使用系统口令登录。
+// 定时同步时更新目录中所有用户的信息，目录中已不存在的用户被删除（软删除）。
+type LDAP struct {
+	Enable             bool           `yaml:"enable" env:"PDM_LDAP_ENABLE"`                            // 启用目录服务认证
+	URL                string         `yaml:"url" env:"PDM_LDAP_URL"`                                  // 目录服务地址，如 ldap://dc.example.com:389、ldaps://dc.example.com:636
+	StartTLS           bool           `yaml:"startTls" env:"PDM_LDAP_START_TLS"`                       // ldap:// 连接后通过 StartTLS 升级为TLS
+	CAFile             string         `yaml:"caFile" env:"PDM_LDAP_CA_FILE"`                           // 校验目录服务证书的CA证书（PEM），为空时使用系统根证书，相对路径以可执行程序所在目录为基础
+	InsecureSkipVerify bool           `yaml:"insecureSkipVerify" env:"PDM_LDAP_INSECURE_SKIP_VERIFY"`  // 不校验目录服务证书，仅用于测试环境
+	Timeout            int            `yaml:"timeout" env:"PDM_LDAP_TIMEOUT"`                          // 连接与单个操作的超时时间（单位：秒）
+	BindDN             string         `yaml:"bindDn" env:"PDM_LDAP_BIND_DN"`                           // 查找用户使用的服务账号DN
+	BindPassword       string         `yaml:"bindPassword" env:"PDM_LDAP_BIND_PASSWORD" secret:"true"` // 服务账号口令
+	BaseDN             string         `yaml:"baseDn" env:"PDM_LDAP_BASE_DN"`                           // 查找用户与组的起点，如 ou=people,dc=example,dc=com
+	UserFilter         string         `yaml:"userFilter" env:"PDM_LDAP_USER_FILTER"`                   // 登录时查找用户的过滤器，{username} 替换为转义后的登录名
+	SyncFilter         string         `yaml:"syncFilter" env:"PDM_LDAP_SYNC_FILTER"`                   // 同步时查找所有用户的过滤器
+	GroupFilter        string         `yaml:"groupFilter" env:"PDM_LDAP_GROUP_FILTER"`                 // 查找用户所属组的过滤器，{dn} 替换为转义后的用户DN；为空时使用用户的组属性
+	Attributes         LDAPAttributes `yaml:"attributes"`                                              // 用户属性映射
+	Groups             []LDAPGroup    `yaml:"groups"`                                                  // 组与项目角色映射，仅支持在配置文件中配置
+	SyncInterval       int            `yaml:"syncInterval" env:"PDM_LDAP_SYNC_INTERVAL"`               // 定时同步间隔（单位：分钟），小于等于0表示不定时同步
+}
+
+// LDAPAttributes 目录属性与用户字段的映射
+type LDAPAttributes struct {
+	Openid string `yaml:"openid" env:"PDM_LDAP_ATTR_OPENID"` // 工号，唯一标识目录中的用户，AD可使用 sAMAccountName 或 employeeID
+	Name   string `yaml:"name" env:"PDM_LDAP_ATTR_NAME"`     // 姓名
+	Phone  string `yaml:"phone" env:"PDM_LDAP_ATTR_PHONE"`   // 手机号
+	Email  string `yaml:"email" env:"PDM_LDAP_ATTR_EMAIL"`   // 邮箱
+	Group  string `yaml:"group" env:"PDM_LDAP_ATTR_GROUP"`   // 用户所属组的DN，未配置 groupFilter 时使用
+}
+
+// LDAPGroup 组与项目角色映射
+// 组内用户登录或同步时加入项目，已是成员的开发者与对接者调整为映射的角色，项目负责人与管理员不受影响。
+// 用户离开组后不会自动移出项目。同一项目配置多个映射时使用第一个匹配的映射。
+type LDAPGroup struct {
+	DN        string `yaml:"dn"`        // 组DN，不区分大小写
+	ProjectId int    `yaml:"projectId"` // 项目ID
+	Role      int    `yaml:"role"`      // 项目角色 0 - 开发者 1 - 对接者
+}
+
+// defaultSQLiteDSN SQLite 未指定数据库文件时的缺省路径
+const defaultSQLiteDSN = "pdm.db"
+
 // 无法找到配置文件时候的缺省配置
+// 数据库没有缺省值，需在配置文件、环境变量或命令行参数中显式配置，
+// 避免配置文件缺失或命名错误时在新的空数据库上启动。
 var defaultConfig = Application{
-	Database: Database{
-		DSN:  "root:123qwe@tcp(127.0.0.1:3306)/pdm?charset=utf8mb4&parseTime=true",
-		Type: "mysql",
-	},
-	LogKeepMaxDays: 3 * 30, // 3月
-	Port:           8010,
-	SSOBaseUrl:     "http://nantemen.hzauth.com",
-	Debug:          true,
+	LogKeepMaxDays:  3 * 30, // 3月
+	Port:            8010,
+	SSOBaseUrl:      "http://nantemen.hzauth.com",
+	Debug:           false,
+	ShutdownTimeout: 30,
+	Storage: Storage{
+		Type: "local",
+		S3:   S3{Region: "us-east-1"},
+	},
+	Backup: Backup{
+		Dir:  "backups",
+		Keep: 7,
+	},
+	JWT: JWT{
+		Rotation: 12,
+		Grace:    8,
+	},
+	Password: Password{
+		MinLength:   8,
+		MinClasses:  3,
+		BannedWords: []string{"password", "qwerty", "123456", "admin"},
+		MaxAge:      90,
+		History:     5,
+		Iterations:  100000,
+	},
+	TOTP: TOTP{
+		Issuer: "PDM",
+	},
+	Throttle: Throttle{
+		AccountFailures: 5,
+		IPFailures:      20,
+		Window:          15,
+		LockTime:        10,
+		MaxLockTime:     24 * 60, // 1天
+	},
+	LDAP: LDAP{
+		Timeout:    10,
+		UserFilter: "(&(objectClass=person)(uid={username}))",
+		SyncFilter: "(objectClass=person)",
+		Attributes: LDAPAttributes{
+			Openid: "uid",
+			Name:   "cn",
+			Phone:  "mobile",
+			Email:  "mail",
+			Group:  "memberOf",
+		},
+		SyncInterval: 60,
+	},
+	Revocation: Revocation{
+		Mode:    "soft",
+		Timeout: 5,
+	},
 }
@@ -49,3 +49,11 @@ func Init() {
 	log.Println("对接文档文件存储目录:", DocDir)
 
 }
+
+// Abs 将相对路径转换为以程序运行目录为基础的绝对路径
+func Abs(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(base, p)
+}
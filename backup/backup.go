@@ -0,0 +1,324 @@
+// Package backup 数据库与业务文件的备份与恢复
+//
+// 备份文件为 tar.gz 格式，包含以下内容：
+//   - db/<表名>.jsonl 数据表的逻辑导出，每行一条记录，字段名为数据库列名；
+//   - files/<存储名>/ 对接文档、基础文档区、技术方案、头像、根证书等业务文件；
+//   - manifest.json 备份清单，位于备份文件末尾，记录程序与数据库版本以及其余各项的大小与SM3摘要。
+//
+// 恢复前先完整校验备份清单，校验通过后才会修改数据库与业务文件。
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"io"
+	"os"
+	"pdm/appconf"
+	"pdm/repo"
+	"pdm/storage"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatVersion 备份文件格式版本
+	FormatVersion = 1
+
+	manifestName = "manifest.json" // 备份清单
+	dbDir        = "db/"           // 数据表导出目录
+	filesDir     = "files/"        // 业务文件目录
+	batchSize    = 200             // 数据表分批导出导入的记录数
+)
+
+// Manifest 备份清单
+type Manifest struct {
+	Format     int       `json:"format"`     // 备份文件格式版本
+	AppVersion string    `json:"appVersion"` // 程序版本
+	DBVersion  string    `json:"dbVersion"`  // 数据库版本
+	CreatedAt  time.Time `json:"createdAt"`  // 备份时间
+	Tables     []Table   `json:"tables"`     // 导出的数据表
+	Entries    []Entry   `json:"entries"`    // 备份文件中除清单外的所有项
+}
+
+// Table 导出的数据表
+type Table struct {
+	Name string `json:"name"` // 表名
+	Rows int64  `json:"rows"` // 记录数
+}
+
+// Entry 备份文件中的项
+type Entry struct {
+	Path string `json:"path"`          // 备份文件中的路径，目录以 "/" 结尾
+	Size int64  `json:"size"`          // 文件大小（单位 B），目录为0
+	SM3  string `json:"sm3,omitempty"` // 文件内容的SM3摘要（Hex），目录为空
+}
+
+// Files 业务文件数量
+func (m *Manifest) Files() int {
+	n := 0
+	for _, e := range m.Entries {
+		if e.SM3 != "" && strings.HasPrefix(e.Path, filesDir) {
+			n++
+		}
+	}
+	return n
+}
+
+// Rows 所有数据表的记录总数
+func (m *Manifest) Rows() int64 {
+	var n int64
+	for _, t := range m.Tables {
+		n += t.Rows
+	}
+	return n
+}
+
+// area 需要备份的业务文件存储
+type area struct {
+	name string
+	s    storage.Storage
+}
+
+// areas 所有需要备份的业务文件存储，name 为备份文件中的目录名
+func areas() []area {
+	return []area{
+		{"doc", storage.Doc},
+		{"baseDocArea", storage.BaseDocArea},
+		{"technicalProposal", storage.TechnicalProposal},
+		{"avatar", storage.Avatar},
+		{"rootCerts", storage.RootCert},
+	}
+}
+
+// parseSchema 解析实体模型对应的数据表结构
+func parseSchema(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// Write 将数据库与业务文件备份写入 w
+// 所有数据表在同一个事务中导出，MySQL缺省的可重复读隔离级别与SQLite的WAL模式下事务内读取的是同一快照。
+// 数据库版本须与程序版本一致，否则需要先执行数据库迁移。
+func Write(w io.Writer) (*Manifest, error) {
+	version, err := repo.CurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version != repo.LatestVersion() {
+		return nil, fmt.Errorf("backup: 数据库版本 %s 与程序版本 %s 不一致，请先执行数据库迁移", version, repo.LatestVersion())
+	}
+	m := &Manifest{
+		Format:     FormatVersion,
+		AppVersion: appconf.Version,
+		DBVersion:  version,
+		CreatedAt:  time.Now(),
+	}
+	gw := gzip.NewWriter(w)
+	aw := &archiveWriter{tw: tar.NewWriter(gw), m: m}
+
+	err = repo.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range repo.Models {
+			if err := aw.table(tx, model); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range areas() {
+		if err = aw.area(a); err != nil {
+			return nil, fmt.Errorf("backup: 备份 %s 文件失败，%w", a.name, err)
+		}
+	}
+
+	bin, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = aw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     manifestName,
+		Mode:     0644,
+		Size:     int64(len(bin)),
+		ModTime:  m.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = aw.tw.Write(bin); err != nil {
+		return nil, err
+	}
+	if err = aw.tw.Close(); err != nil {
+		return nil, err
+	}
+	if err = gw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// archiveWriter 写入备份文件并记录清单
+type archiveWriter struct {
+	tw *tar.Writer
+	m  *Manifest
+}
+
+// dir 写入目录
+func (w *archiveWriter) dir(name string, modTime time.Time) error {
+	if modTime.IsZero() {
+		modTime = w.m.CreatedAt
+	}
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	w.m.Entries = append(w.m.Entries, Entry{Path: name})
+	return nil
+}
+
+// file 写入文件，内容长度必须与 size 一致
+func (w *archiveWriter) file(name string, r io.Reader, size int64, modTime time.Time) error {
+	if modTime.IsZero() {
+		modTime = w.m.CreatedAt
+	}
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	h := sm3.New()
+	if _, err = io.CopyN(io.MultiWriter(w.tw, h), r, size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("backup: %s 在备份过程中被修改", name)
+		}
+		return err
+	}
+	w.m.Entries = append(w.m.Entries, Entry{Path: name, Size: size, SM3: hex.EncodeToString(h.Sum(nil))})
+	return nil
+}
+
+// table 导出数据表
+// 记录先写入临时文件，得到内容长度后再写入备份文件。
+func (w *archiveWriter) table(tx *gorm.DB, model interface{}) error {
+	sch, err := parseSchema(tx, model)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp("", "pdm-backup-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	bw := bufio.NewWriter(temp)
+	enc := json.NewEncoder(bw)
+	var rows int64
+	batch := reflect.New(reflect.SliceOf(sch.ModelType))
+	err = tx.Unscoped().FindInBatches(batch.Interface(), batchSize, func(b *gorm.DB, _ int) error {
+		list := batch.Elem()
+		for i := 0; i < list.Len(); i++ {
+			record := make(map[string]interface{}, len(sch.DBNames))
+			for _, name := range sch.DBNames {
+				value, _ := sch.FieldsByDBName[name].ValueOf(b.Statement.Context, list.Index(i))
+				record[name] = plain(value)
+			}
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+			rows++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("backup: 导出数据表 %s 失败，%w", sch.Table, err)
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	size, err := temp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = w.file(dbDir+sch.Table+".jsonl", temp, size, time.Time{}); err != nil {
+		return err
+	}
+	w.m.Tables = append(w.m.Tables, Table{Name: sch.Table, Rows: rows})
+	return nil
+}
+
+// basicTypes 基础类型，实体字段的自定义类型（如口令）按其基础类型导出导入，不使用自定义的JSON序列化
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.String:  reflect.TypeOf(""),
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int64(0)),
+	reflect.Int8:    reflect.TypeOf(int64(0)),
+	reflect.Int16:   reflect.TypeOf(int64(0)),
+	reflect.Int32:   reflect.TypeOf(int64(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint64(0)),
+	reflect.Uint8:   reflect.TypeOf(uint64(0)),
+	reflect.Uint16:  reflect.TypeOf(uint64(0)),
+	reflect.Uint32:  reflect.TypeOf(uint64(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float64(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+}
+
+// plain 将基础类型的字段值转换为对应的基础类型
+func plain(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return nil
+	}
+	if t, ok := basicTypes[rv.Kind()]; ok {
+		return rv.Convert(t).Interface()
+	}
+	return value
+}
+
+// area 备份业务文件存储，空目录同样保留
+func (w *archiveWriter) area(a area) error {
+	root := filesDir + a.name + "/"
+	if err := w.dir(root, time.Time{}); err != nil {
+		return err
+	}
+	return storage.Walk(a.s, "", func(info storage.FileInfo) error {
+		if info.IsDir {
+			return w.dir(root+info.Path+"/", info.ModTime)
+		}
+		r, err := a.s.Open(info.Path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return w.file(root+info.Path, r, info.Size, info.ModTime)
+	})
+}
@@ -0,0 +1,322 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"pdm/appconf"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setup 初始化测试用的SQLite数据库与本地文件存储
+func setup(t *testing.T) {
+	cfg := &appconf.Application{Database: appconf.Database{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "pdm.db"),
+	}}
+	if err := repo.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	olds := []storage.Storage{storage.Doc, storage.BaseDocArea, storage.TechnicalProposal, storage.Avatar, storage.RootCert}
+	t.Cleanup(func() {
+		storage.Doc, storage.BaseDocArea, storage.TechnicalProposal, storage.Avatar, storage.RootCert =
+			olds[0], olds[1], olds[2], olds[3], olds[4]
+	})
+	for _, s := range []*storage.Storage{&storage.Doc, &storage.BaseDocArea, &storage.TechnicalProposal, &storage.Avatar, &storage.RootCert} {
+		local, err := storage.NewLocal(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		*s = local
+	}
+}
+
+// writeFile 写入备份文件
+func writeFile(t *testing.T) string {
+	p := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// rewrite 重新打包备份文件，fn 可修改项的头信息，返回 nil 时删除该项
+func rewrite(t *testing.T, src string, fn func(hdr *tar.Header, content []byte) []byte) string {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	err := readArchive(src, func(hdr *tar.Header, r io.Reader) error {
+		content, _ := io.ReadAll(r)
+		if content = fn(hdr, content); content == nil {
+			return nil
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tw.Close()
+	_ = gw.Close()
+	p := filepath.Join(t.TempDir(), "rewrite.tar.gz")
+	if err = os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBackupRestore(t *testing.T) {
+	setup(t)
+	created := time.Date(2023, 1, 5, 10, 30, 0, 0, time.Local)
+	users := []entity.User{
+		{Username: "zhangsan", Name: "张三", Password: "p1", Salt: "s1", CreatedAt: created, UpdatedAt: created},
+		{Username: "lisi", Name: "李四", Phone: "13800000000", Password: "p2", Salt: "s2", CreatedAt: created, UpdatedAt: created},
+	}
+	if err := repo.DB.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DB.Create(&entity.Document{Title: "对接文档", Filename: "a.png", ProjectId: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 超过单批数量的记录
+	logs := make([]entity.Log, batchSize*2+50)
+	for i := range logs {
+		logs[i] = entity.Log{OpId: i, OpName: "登录"}
+	}
+	if err := repo.DB.CreateInBatches(logs, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	_ = storage.WriteFile(storage.Doc, "1/a.png", []byte("png"))
+	_ = storage.WriteFile(storage.BaseDocArea, "标准/国密 标准(1).pdf", []byte("pdf"))
+	_ = storage.BaseDocArea.MkdirAll("空目录")
+	_ = storage.WriteFile(storage.RootCert, "根证书.crt", []byte("cert"))
+	_ = storage.WriteFile(storage.Avatar, "1.png", []byte{})
+
+	p := writeFile(t)
+	m, err := Verify(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DBVersion != repo.LatestVersion() || len(m.Tables) != len(repo.Models) || m.Files() != 4 {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+
+	// 备份之后的修改
+	repo.DB.Model(&entity.User{}).Where("username = ?", "zhangsan").Update("name", "张三丰")
+	repo.DB.Create(&entity.User{Username: "wangwu"})
+	repo.DB.Where("1 = 1").Delete(&entity.Document{})
+	repo.DB.Where("op_id < ?", 100).Delete(&entity.Log{})
+	_ = storage.WriteFile(storage.Doc, "2/b.png", []byte("b"))
+	_ = storage.BaseDocArea.Remove("标准")
+	_ = storage.WriteFile(storage.RootCert, "根证书.crt", []byte("changed"))
+
+	if _, err = Restore(p); err != nil {
+		t.Fatal(err)
+	}
+	var restored []entity.User
+	repo.DB.Order("id").Find(&restored)
+	if len(restored) != 2 {
+		t.Fatalf("expect 2 users, got %d", len(restored))
+	}
+	for i, u := range restored {
+		if u.ID != users[i].ID || u.Name != users[i].Name || u.Phone != users[i].Phone ||
+			u.Password != users[i].Password || u.Salt != users[i].Salt || !u.CreatedAt.Equal(created) {
+			t.Fatalf("user not match: %+v", u)
+		}
+	}
+	var doc entity.Document
+	if err = repo.DB.First(&doc).Error; err != nil || doc.Title != "对接文档" {
+		t.Fatalf("document not restored: %+v %v", doc, err)
+	}
+	var admins, total int64
+	repo.DB.Model(&entity.Admin{}).Count(&admins)
+	repo.DB.Model(&entity.Log{}).Count(&total)
+	if admins != 2 || total != int64(len(logs)) {
+		t.Fatalf("expect 2 admins and %d logs, got %d %d", len(logs), admins, total)
+	}
+	if version, _ := repo.CurrentVersion(); version != repo.LatestVersion() {
+		t.Fatalf("unexpected db version %s", version)
+	}
+	// 自增主键从备份中的最大值继续
+	next := entity.User{Username: "zhaoliu"}
+	repo.DB.Create(&next)
+	if next.ID != users[1].ID+1 {
+		t.Fatalf("unexpected next id %d", next.ID)
+	}
+
+	for name, expect := range map[string]string{"1/a.png": "png", "标准/国密 标准(1).pdf": "pdf"} {
+		s := storage.Doc
+		if strings.HasPrefix(name, "标准") {
+			s = storage.BaseDocArea
+		}
+		if bin, err := storage.ReadFile(s, name); err != nil || string(bin) != expect {
+			t.Fatalf("%s not restored: %q %v", name, bin, err)
+		}
+	}
+	if bin, _ := storage.ReadFile(storage.RootCert, "根证书.crt"); string(bin) != "cert" {
+		t.Fatalf("root cert not restored: %q", bin)
+	}
+	if info, err := storage.BaseDocArea.Stat("空目录"); err != nil || !info.IsDir {
+		t.Fatalf("empty dir not restored: %v", err)
+	}
+	if exist, _ := storage.Exist(storage.Doc, "2"); exist {
+		t.Fatal("files created after backup should be removed")
+	}
+}
+
+func TestVerify_Corrupted(t *testing.T) {
+	setup(t)
+	_ = storage.WriteFile(storage.Doc, "1/a.md", []byte("hello"))
+	repo.DB.Create(&entity.User{Username: "zhangsan"})
+	p := writeFile(t)
+
+	cases := map[string]func(hdr *tar.Header, content []byte) []byte{
+		"文件被篡改": func(hdr *tar.Header, content []byte) []byte {
+			if hdr.Name == "files/doc/1/a.md" {
+				return []byte("hacked")
+			}
+			return content
+		},
+		"数据被篡改": func(hdr *tar.Header, content []byte) []byte {
+			if hdr.Name == "db/users.jsonl" {
+				return bytes.Replace(content, []byte("zhangsan"), []byte("admin123"), 1)
+			}
+			return content
+		},
+		"缺少文件": func(hdr *tar.Header, content []byte) []byte {
+			if hdr.Name == "files/doc/1/a.md" {
+				return nil
+			}
+			return content
+		},
+		"缺少清单": func(hdr *tar.Header, content []byte) []byte {
+			if hdr.Name == manifestName {
+				return nil
+			}
+			return content
+		},
+		"数据库版本过高": func(hdr *tar.Header, content []byte) []byte {
+			if hdr.Name == manifestName {
+				return bytes.Replace(content, []byte(repo.LatestVersion()), []byte("9999999999"), 1)
+			}
+			return content
+		},
+		"越界路径": func(hdr *tar.Header, content []byte) []byte {
+			if hdr.Name == manifestName {
+				return bytes.Replace(content, []byte("files/doc/1/a.md"), []byte("files/doc/../a.md"), 1)
+			}
+			if hdr.Name == "files/doc/1/a.md" {
+				hdr.Name = "files/doc/../a.md"
+			}
+			return content
+		},
+	}
+	for name, fn := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Verify(rewrite(t, p, fn)); err == nil {
+				t.Fatal("expect verify error")
+			}
+		})
+	}
+
+	// 追加一个未记录在清单中的文件
+	t.Run("多余的文件", func(t *testing.T) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "files/doc/evil.sh", Size: 2, Mode: 0644})
+		_, _ = tw.Write([]byte("rm"))
+		_ = readArchive(p, func(hdr *tar.Header, r io.Reader) error {
+			_ = tw.WriteHeader(hdr)
+			_, err := io.Copy(tw, r)
+			return err
+		})
+		_ = tw.Close()
+		_ = gw.Close()
+		extra := filepath.Join(t.TempDir(), "extra.tar.gz")
+		_ = os.WriteFile(extra, buf.Bytes(), 0644)
+		if _, err := Verify(extra); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("expect ErrCorrupted, got %v", err)
+		}
+	})
+
+	// 校验失败时不修改任何数据
+	tampered := rewrite(t, p, cases["文件被篡改"])
+	repo.DB.Create(&entity.User{Username: "lisi"})
+	_ = storage.WriteFile(storage.Doc, "1/a.md", []byte("new"))
+	if _, err := Restore(tampered); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expect ErrCorrupted, got %v", err)
+	}
+	var total int64
+	repo.DB.Model(&entity.User{}).Count(&total)
+	if bin, _ := storage.ReadFile(storage.Doc, "1/a.md"); total != 2 || string(bin) != "new" {
+		t.Fatalf("data modified by failed restore: users %d file %q", total, bin)
+	}
+}
+
+func TestManager(t *testing.T) {
+	setup(t)
+	m := NewManager(&appconf.Backup{Dir: t.TempDir(), Keep: 2})
+	var names []string
+	for i := 0; i < 3; i++ {
+		archive, _, err := m.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, archive.Name)
+	}
+	list, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != names[2] || list[1].Name != names[1] {
+		t.Fatalf("unexpected list %v, created %v", list, names)
+	}
+	if _, err = Verify(filepath.Join(m.dir, list[0].Name)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一时间只允许一个备份
+	m.mu.Lock()
+	if _, _, err = m.Create(); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expect ErrBusy, got %v", err)
+	}
+	m.mu.Unlock()
+
+	for _, name := range []string{"", "../pdm.db", names[0], list[0].Name + "/..", "manifest.json"} {
+		if _, err = m.Path(name); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("path %q: expect ErrNotFound, got %v", name, err)
+		}
+	}
+	if err = m.Remove(list[1].Name); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ = m.List(); len(list) != 1 {
+		t.Fatalf("expect 1 backup after remove, got %d", len(list))
+	}
+}
@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"pdm/appconf"
+	"pdm/appconf/dir"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "pdm-backup-" // 备份文件名前缀
+	fileExt    = ".tar.gz"     // 备份文件扩展名
+)
+
+var (
+	// ErrBusy 已有备份正在进行
+	ErrBusy = errors.New("backup: 备份正在进行中，请稍后再试")
+	// ErrNotFound 备份文件不存在
+	ErrNotFound = errors.New("backup: 备份文件不存在")
+)
+
+// Archive 备份目录中的备份文件
+type Archive struct {
+	Name    string    // 文件名
+	Size    int64     // 文件大小（单位 B）
+	ModTime time.Time // 备份完成时间
+}
+
+// Manager 备份目录管理
+// 负责在备份目录中创建备份、按保留数量清理过期备份以及定时备份。
+type Manager struct {
+	dir      string        // 备份目录
+	keep     int           // 最多保留的备份数量，小于等于0表示不删除
+	interval time.Duration // 定时备份间隔，小于等于0表示不定时备份
+
+	mu   sync.Mutex    // 同一时间只允许一个备份
+	stop chan struct{} // 停止定时备份
+	done chan struct{} // 定时备份精灵退出信号
+}
+
+// NewManager 创建备份目录管理
+func NewManager(cfg *appconf.Backup) *Manager {
+	return &Manager{
+		dir:      dir.Abs(cfg.Dir),
+		keep:     cfg.Keep,
+		interval: time.Duration(cfg.Interval) * time.Hour,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Create 在备份目录中创建备份，完成后清理超出保留数量的备份
+func (m *Manager) Create() (*Archive, *Manifest, error) {
+	if !m.mu.TryLock() {
+		return nil, nil, ErrBusy
+	}
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, os.ModePerm); err != nil {
+		return nil, nil, err
+	}
+	// 写入临时文件，完成后再重命名，避免列表中出现不完整的备份
+	temp, err := os.CreateTemp(m.dir, ".pdm-backup-*.tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(temp.Name())
+	bw := bufio.NewWriter(temp)
+	manifest, err := Write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	if e := temp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := filePrefix + manifest.CreatedAt.Format("20060102-150405") + fileExt
+	for i := 2; ; i++ {
+		if _, err = os.Stat(filepath.Join(m.dir, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s%s-%d%s", filePrefix, manifest.CreatedAt.Format("20060102-150405"), i, fileExt)
+	}
+	if err = os.Rename(temp.Name(), filepath.Join(m.dir, name)); err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(filepath.Join(m.dir, name))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = m.prune(); err != nil {
+		zap.L().Warn("清理过期备份失败", zap.Error(err))
+	}
+	return &Archive{Name: name, Size: info.Size(), ModTime: info.ModTime()}, manifest, nil
+}
+
+// List 备份目录中的所有备份，按时间由新到旧排序
+func (m *Manager) List() ([]Archive, error) {
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return []Archive{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := []Archive{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), filePrefix) || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		res = append(res, Archive{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].ModTime.Equal(res[j].ModTime) {
+			return res[i].ModTime.After(res[j].ModTime)
+		}
+		return res[i].Name > res[j].Name
+	})
+	return res, nil
+}
+
+// Path 备份文件的完整路径，name 只能是备份目录中的备份文件名
+func (m *Manager) Path(name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) ||
+		!strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileExt) {
+		return "", ErrNotFound
+	}
+	p := filepath.Join(m.dir, name)
+	if info, err := os.Stat(p); err != nil || info.IsDir() {
+		return "", ErrNotFound
+	}
+	return p, nil
+}
+
+// Remove 删除备份文件
+func (m *Manager) Remove(name string) error {
+	p, err := m.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// prune 删除超出保留数量的最早的备份
+func (m *Manager) prune() error {
+	if m.keep <= 0 {
+		return nil
+	}
+	list, err := m.List()
+	if err != nil {
+		return err
+	}
+	for i := m.keep; i < len(list); i++ {
+		if err = os.Remove(filepath.Join(m.dir, list[i].Name)); err != nil {
+			return err
+		}
+		zap.L().Info("删除过期备份", zap.String("name", list[i].Name))
+	}
+	return nil
+}
+
+// schedule 定时备份精灵
+// 注意该函数不应抛出任何错误，备份失败时打印日志，继续下一个循环。
+func (m *Manager) schedule() {
+	defer close(m.done)
+	if m.interval <= 0 {
+		return
+	}
+	zap.L().Info("定时备份精灵 [启动]", zap.Duration("interval", m.interval))
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			zap.L().Info("定时备份精灵 [退出]")
+			return
+		}
+		archive, _, err := m.Create()
+		if err != nil {
+			zap.L().Error("定时备份失败", zap.Error(err))
+			continue
+		}
+		zap.L().Info("定时备份完成", zap.String("name", archive.Name), zap.Int64("size", archive.Size))
+	}
+}
+
+// shutdown 停止定时备份，等待进行中的备份完成
+func (m *Manager) shutdown() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+}
+
+var _global *Manager
+
+// Init 初始化全局备份管理并启动定时备份
+func Init(cfg *appconf.Backup) {
+	if _global != nil {
+		return
+	}
+	_global = NewManager(cfg)
+	go _global.schedule()
+}
+
+// Default 全局备份管理，未初始化时返回 nil
+func Default() *Manager {
+	return _global
+}
+
+// Close 停止全局备份管理的定时备份
+func Close() {
+	if _global == nil {
+		return
+	}
+	_global.shutdown()
+}
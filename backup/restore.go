@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"io"
+	"os"
+	"pdm/repo"
+	"pdm/storage"
+	"reflect"
+	"strings"
+)
+
+// ErrCorrupted 备份文件损坏或被篡改
+var ErrCorrupted = errors.New("backup: 备份文件校验失败")
+
+// maxManifestSize 备份清单的最大长度
+const maxManifestSize = 64 << 20
+
+// readArchive 依次读取备份文件中的各项，仅允许普通文件与目录
+func readArchive(name string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w，%s", ErrCorrupted, err.Error())
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w，%s", ErrCorrupted, err.Error())
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			return fmt.Errorf("%w，不支持的文件类型 %s", ErrCorrupted, hdr.Name)
+		}
+		if err = fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// tables 表名与实体模型的对应关系
+func tables() (map[string]*schema.Schema, error) {
+	res := make(map[string]*schema.Schema, len(repo.Models))
+	for _, model := range repo.Models {
+		sch, err := parseSchema(repo.DB, model)
+		if err != nil {
+			return nil, err
+		}
+		res[sch.Table] = sch
+	}
+	return res, nil
+}
+
+// target 备份文件中的业务文件对应的存储与相对路径，rel 为空表示存储根目录
+func target(p string) (a area, rel string, ok bool) {
+	if !strings.HasPrefix(p, filesDir) {
+		return a, "", false
+	}
+	name, rel, _ := strings.Cut(strings.TrimPrefix(p, filesDir), "/")
+	for _, item := range areas() {
+		if item.name == name {
+			a = item
+			break
+		}
+	}
+	if a.s == nil {
+		return a, "", false
+	}
+	rel = strings.TrimSuffix(rel, "/")
+	if clean, valid := storage.Clean(rel); !valid || clean != rel {
+		return a, "", false
+	}
+	return a, rel, true
+}
+
+// Verify 校验备份文件，返回备份清单
+// 校验备份文件格式与数据库版本、各项的大小与SM3摘要，并确认备份文件中的项与清单一一对应。
+func Verify(name string) (*Manifest, error) {
+	type actual struct {
+		size int64
+		sum  string
+	}
+	found := map[string]actual{}
+	var bin []byte
+	err := readArchive(name, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == manifestName {
+			var err error
+			bin, err = io.ReadAll(io.LimitReader(r, maxManifestSize))
+			return err
+		}
+		if _, ok := found[hdr.Name]; ok {
+			return fmt.Errorf("%w，%s 重复", ErrCorrupted, hdr.Name)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			found[hdr.Name] = actual{}
+			return nil
+		}
+		h := sm3.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return fmt.Errorf("%w，%s", ErrCorrupted, err.Error())
+		}
+		found[hdr.Name] = actual{size: n, sum: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bin == nil {
+		return nil, fmt.Errorf("%w，缺少备份清单", ErrCorrupted)
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(bin, m); err != nil {
+		return nil, fmt.Errorf("%w，备份清单格式错误", ErrCorrupted)
+	}
+	if m.Format != FormatVersion {
+		return nil, fmt.Errorf("backup: 不支持的备份文件格式版本 %d", m.Format)
+	}
+	if m.DBVersion == "" || m.DBVersion > repo.LatestVersion() {
+		return nil, fmt.Errorf("%w，备份数据库版本: %s 程序版本: %s", repo.ErrDBVersionTooNew, m.DBVersion, repo.LatestVersion())
+	}
+
+	// 清单中的项与备份文件中的项一一对应
+	for _, e := range m.Entries {
+		a, ok := found[e.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w，缺少 %s", ErrCorrupted, e.Path)
+		}
+		if a.size != e.Size || a.sum != e.SM3 {
+			return nil, fmt.Errorf("%w，%s 摘要不一致", ErrCorrupted, e.Path)
+		}
+		delete(found, e.Path)
+	}
+	for p := range found {
+		return nil, fmt.Errorf("%w，%s 未记录在备份清单中", ErrCorrupted, p)
+	}
+
+	// 清单内容合法
+	schemas, err := tables()
+	if err != nil {
+		return nil, err
+	}
+	exported := map[string]bool{}
+	for _, t := range m.Tables {
+		if schemas[t.Name] == nil {
+			return nil, fmt.Errorf("%w，未知的数据表 %s", ErrCorrupted, t.Name)
+		}
+		exported[dbDir+t.Name+".jsonl"] = true
+	}
+	roots := map[string]bool{}
+	for _, e := range m.Entries {
+		if exported[e.Path] {
+			delete(exported, e.Path)
+			continue
+		}
+		a, rel, ok := target(e.Path)
+		if !ok || (rel == "") != (e.Path == filesDir+a.name+"/") {
+			return nil, fmt.Errorf("%w，非法的路径 %s", ErrCorrupted, e.Path)
+		}
+		if rel == "" {
+			roots[a.name] = true
+		}
+	}
+	for p := range exported {
+		return nil, fmt.Errorf("%w，缺少 %s", ErrCorrupted, p)
+	}
+	for _, a := range areas() {
+		if !roots[a.name] {
+			return nil, fmt.Errorf("%w，缺少 %s", ErrCorrupted, filesDir+a.name+"/")
+		}
+	}
+	return m, nil
+}
+
+// Restore 从备份文件恢复数据库与业务文件
+// 校验通过后在同一个事务中清空并导入所有数据表，再以备份中的文件替换各业务文件存储，
+// 最后将数据库从备份时的版本升级到当前版本。
+// 恢复前需停止服务，数据表需已创建（见 repo.Migrate）。
+func Restore(name string) (*Manifest, error) {
+	m, err := Verify(name)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := tables()
+	if err != nil {
+		return nil, err
+	}
+
+	// 恢复数据库
+	err = repo.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range repo.Models {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return readArchive(name, func(hdr *tar.Header, r io.Reader) error {
+			if !strings.HasPrefix(hdr.Name, dbDir) {
+				return nil
+			}
+			sch := schemas[strings.TrimSuffix(strings.TrimPrefix(hdr.Name, dbDir), ".jsonl")]
+			if err := importTable(tx, sch, r); err != nil {
+				return fmt.Errorf("backup: 导入数据表 %s 失败，%w", sch.Table, err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 恢复业务文件
+	for _, a := range areas() {
+		list, err := a.s.List("")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			if err = a.s.Remove(item.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = readArchive(name, func(hdr *tar.Header, r io.Reader) error {
+		a, rel, ok := target(hdr.Name)
+		if !ok || rel == "" {
+			return nil
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			return a.s.MkdirAll(rel)
+		}
+		return a.s.Put(rel, r, hdr.Size)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup: 恢复业务文件失败，%w", err)
+	}
+
+	if err = repo.Migrate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// importTable 导入数据表，记录中不存在于当前表结构的字段将被忽略
+func importTable(tx *gorm.DB, sch *schema.Schema, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	batch := reflect.MakeSlice(reflect.SliceOf(sch.ModelType), 0, batchSize)
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		list := reflect.New(batch.Type())
+		list.Elem().Set(batch)
+		if err := tx.Session(&gorm.Session{SkipHooks: true}).Create(list.Interface()).Error; err != nil {
+			return err
+		}
+		batch = batch.Slice(0, 0)
+		return nil
+	}
+	for {
+		var record map[string]json.RawMessage
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		item := reflect.New(sch.ModelType).Elem()
+		for _, name := range sch.DBNames {
+			raw, ok := record[name]
+			if !ok {
+				continue
+			}
+			field := sch.FieldsByDBName[name]
+			typ, basic := basicTypes[field.FieldType.Kind()]
+			if !basic {
+				typ = field.FieldType
+			}
+			value := reflect.New(typ).Elem()
+			if err = json.Unmarshal(raw, value.Addr().Interface()); err != nil {
+				return fmt.Errorf("字段 %s 格式错误，%w", name, err)
+			}
+			if basic {
+				value = value.Convert(field.FieldType)
+			}
+			if err = field.Set(tx.Statement.Context, item, value.Interface()); err != nil {
+				return err
+			}
+		}
+		batch = reflect.Append(batch, item)
+		if batch.Len() >= batchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
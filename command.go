@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"pdm/appconf"
+	"pdm/backup"
+	"pdm/directory"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"strconv"
+	"time"
+)
+
+// Command 命令行子命令
+// 子命令在持久层初始化完成后执行，执行完毕后程序退出
+type Command func(cfg *appconf.Application, args []string) error
+
+// commands 子命令列表
+var commands = map[string]Command{
+	"migrate":  migrateCommand,
+	"backup":   backupCommand,
+	"restore":  restoreCommand,
+	"ldapsync": ldapSyncCommand,
+	"admin":    adminCommand,
+}
+
+// migrateCommand 执行数据库迁移
+// 用法: pdm migrate [status]
+func migrateCommand(_ *appconf.Application, args []string) error {
+	current, err := repo.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] == "status" {
+		fmt.Printf("数据库版本: %s\n程序版本: %s\n", current, repo.LatestVersion())
+		return nil
+	}
+	if err = repo.Migrate(); err != nil {
+		return err
+	}
+	fmt.Printf("数据库迁移完成: %s -> %s\n", current, repo.LatestVersion())
+	return nil
+}
+
+// backupCommand 备份数据库与业务文件
+// 用法: pdm backup [文件]，未指定文件时备份到配置的备份目录并按保留数量清理过期备份
+func backupCommand(cfg *appconf.Application, args []string) error {
+	if len(args) == 0 {
+		archive, m, err := backup.NewManager(&cfg.Backup).Create()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("备份完成: %s\n", archive.Name)
+		printManifest(m)
+		return nil
+	}
+
+	f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	m, err := backup.Write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(args[0])
+		return err
+	}
+	fmt.Printf("备份完成: %s\n", args[0])
+	printManifest(m)
+	return nil
+}
+
+// restoreCommand 从备份文件恢复数据库与业务文件
+// 用法: pdm restore [-check] 文件
+// 恢复将覆盖数据库中的所有数据与所有业务文件，执行前需停止服务；-check 仅校验备份文件。
+func restoreCommand(_ *appconf.Application, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	check := fs.Bool("check", false, "仅校验备份文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("用法: pdm restore [-check] 文件")
+	}
+	if *check {
+		m, err := backup.Verify(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Println("备份文件校验通过")
+		printManifest(m)
+		return nil
+	}
+
+	// 确保数据表已创建
+	if err := repo.Migrate(); err != nil {
+		return err
+	}
+	m, err := backup.Restore(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println("恢复完成")
+	printManifest(m)
+	return nil
+}
+
+// ldapSyncCommand 立即同步目录用户
+// 用法: pdm ldapsync
+func ldapSyncCommand(cfg *appconf.Application, _ []string) error {
+	if !cfg.LDAP.Enable {
+		return errors.New("目录服务认证未启用，见配置 ldap.enable")
+	}
+	d, err := directory.New(&cfg.LDAP)
+	if err != nil {
+		return err
+	}
+	res, err := d.Sync(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("目录同步完成: 目录用户 %d 个，新建 %d 个，更新 %d 个，删除 %d 个，失败 %d 个\n",
+		res.Total, res.Created, res.Updated, len(res.Deleted), len(res.Failed))
+	for _, item := range res.Deleted {
+		fmt.Printf("删除: %s\n", item)
+	}
+	for _, item := range res.Failed {
+		fmt.Printf("失败: %s\n", item)
+	}
+	return nil
+}
+
+// adminUsage 管理员账号命令用法
+const adminUsage = `用法: pdm admin 子命令
+  list                       查看管理员与审计员账号
+  create 用户名 [admin|audit] 创建账号并生成证书绑定码，缺省为管理员
+  bindcode 用户名            重新生成证书绑定码，用于首次部署或无其他管理员时绑定证书
+  disable 用户名             禁用账号并注销其会话
+  enable 用户名              启用账号
+  orphancases                查看不属于任何项目的根接口用例
+  movecase 用例ID 项目ID      将不属于任何项目的根接口用例移入项目`
+
+// adminCommand 管理员与审计员账号管理
+// 用法: pdm admin list|create|bindcode|disable|enable|orphancases|movecase
+// 用于首次部署时为管理员生成证书绑定码，或在没有可登录的管理员时恢复管理；
+// 以及将升级时无法确定所属项目的根接口用例移入项目。
+func adminCommand(_ *appconf.Application, args []string) error {
+	if len(args) == 0 {
+		return errors.New(adminUsage)
+	}
+	if err := repo.Migrate(); err != nil {
+		return err
+	}
+	admins := repo.NewAdminRepository()
+	if args[0] == "list" {
+		var list []entity.Admin
+		if err := repo.DB.Order("id").Find(&list).Error; err != nil {
+			return err
+		}
+		for _, a := range list {
+			certs, err := admins.Certs(a.ID)
+			if err != nil {
+				return err
+			}
+			role, status := "管理员", "启用"
+			if a.Role == entity.AdminRoleAudit {
+				role = "审计员"
+			}
+			if a.Disabled == 1 {
+				status = "禁用"
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t证书 %d 个\n", a.ID, a.Username, role, status, len(certs))
+		}
+		return nil
+	}
+	switch args[0] {
+	case "orphancases":
+		return orphanCases()
+	case "movecase":
+		return moveCase(args[1:])
+	}
+	if len(args) < 2 {
+		return errors.New(adminUsage)
+	}
+	username := args[1]
+	if args[0] == "create" {
+		role := entity.AdminRoleAdmin
+		if len(args) > 2 {
+			switch args[2] {
+			case "admin":
+			case "audit":
+				role = entity.AdminRoleAudit
+			default:
+				return errors.New(adminUsage)
+			}
+		}
+		admin, code, err := admins.Create(username, role)
+		if err != nil {
+			return err
+		}
+		cliLog("命令行创建管理员账号", map[string]interface{}{"username": username, "role": role})
+		printBindCode(admin.Username, code, *admin.BindCodeExpiresAt)
+		return nil
+	}
+
+	admin, err := admins.FindByUsername(username)
+	if err != nil {
+		return err
+	}
+	if admin == nil {
+		return fmt.Errorf("账号 %s 不存在", username)
+	}
+	switch args[0] {
+	case "bindcode":
+		if admin.Disabled == 1 {
+			return fmt.Errorf("账号 %s 已禁用", username)
+		}
+		code, expiresAt, err := admins.IssueBindCode(admin.ID)
+		if err != nil {
+			return err
+		}
+		cliLog("命令行生成证书绑定码", map[string]interface{}{"username": username})
+		printBindCode(admin.Username, code, expiresAt)
+	case "disable", "enable":
+		if err = admins.SetDisabled(admin.ID, args[0] == "disable"); err != nil {
+			return err
+		}
+		if args[0] == "disable" {
+			cliLog("命令行禁用管理员账号", map[string]interface{}{"username": username})
+			fmt.Printf("账号 %s 已禁用\n", username)
+		} else {
+			cliLog("命令行启用管理员账号", map[string]interface{}{"username": username})
+			fmt.Printf("账号 %s 已启用\n", username)
+		}
+	default:
+		return errors.New(adminUsage)
+	}
+	return nil
+}
+
+// orphanCases 打印不属于任何项目的根接口用例
+func orphanCases() error {
+	list, err := repo.NewCaseRepository().Orphans()
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		fmt.Printf("%d\t%s\t创建人 %d\t%s\n", c.ID, c.Name, c.UserId, c.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("共 %d 个用例\n", len(list))
+	return nil
+}
+
+// moveCase 将不属于任何项目的根接口用例移入项目
+func moveCase(args []string) error {
+	if len(args) != 2 {
+		return errors.New(adminUsage)
+	}
+	id, err1 := strconv.Atoi(args[0])
+	projectId, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil {
+		return errors.New(adminUsage)
+	}
+	if err := repo.NewCaseRepository().MoveOrphan(id, projectId); err != nil {
+		return err
+	}
+	cliLog("命令行移动根接口用例", map[string]interface{}{"id": id, "projectId": projectId})
+	fmt.Printf("用例 %d 已移入项目 %d\n", id, projectId)
+	return nil
+}
+
+// cliLog 记录命令行操作日志，命令行未启动日志记录器，直接写入数据库
+func cliLog(name string, param interface{}) {
+	if err := repo.DB.Create(applog.Init(entity.Log{}, "", 0, name, param)).Error; err != nil {
+		zap.L().Warn("操作日志写入失败", zap.String("name", name), zap.Error(err))
+	}
+}
+
+// printBindCode 打印证书绑定码
+func printBindCode(username, code string, expiresAt time.Time) {
+	fmt.Printf("账号: %s\n证书绑定码: %s\n有效期至: %s\n请通过证书绑定接口使用该绑定码绑定证书，绑定码仅显示一次。\n",
+		username, code, expiresAt.Format("2006-01-02 15:04:05"))
+}
+
+// printManifest 打印备份清单摘要
+func printManifest(m *backup.Manifest) {
+	fmt.Printf("备份时间: %s\n程序版本: %s\n数据库版本: %s\n数据表: %d 个，共 %d 条记录\n文件: %d 个\n",
+		m.CreatedAt.Format("2006-01-02 15:04:05"), m.AppVersion, m.DBVersion, len(m.Tables), m.Rows(), m.Files())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+)
+
+func TestAdminCommand(t *testing.T) {
+	cfg := controllertest.Setup(t)
+	for _, args := range [][]string{nil, {"create"}, {"create", "boot", "root"}, {"unknown", "admin"}, {"movecase", "1"}, {"movecase", "x", "1"}} {
+		if err := adminCommand(cfg, args); err == nil || err.Error() != adminUsage {
+			t.Fatalf("%v: expect usage, got %v", args, err)
+		}
+	}
+	for _, args := range [][]string{{"create", "boot"}, {"create", "auditor", "audit"}, {"bindcode", "boot"}, {"list"}, {"orphancases"}} {
+		if err := adminCommand(cfg, args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	admins := repo.NewAdminRepository()
+	auditor, _ := admins.FindByUsername("auditor")
+	if auditor == nil || auditor.Role != entity.AdminRoleAudit {
+		t.Fatalf("unexpected auditor: %+v", auditor)
+	}
+	if err := adminCommand(cfg, []string{"bindcode", "nobody"}); err == nil {
+		t.Fatal("expect error for unknown admin")
+	}
+	if err := adminCommand(cfg, []string{"movecase", "1", "1"}); err != repo.ErrCaseNotOrphan {
+		t.Fatalf("expect ErrCaseNotOrphan, got %v", err)
+	}
+
+	// 初始化的缺省管理员禁用后 boot 为唯一启用的管理员
+	if err := adminCommand(cfg, []string{"disable", "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := adminCommand(cfg, []string{"disable", "boot"}); !errors.Is(err, repo.ErrLastAdmin) {
+		t.Fatalf("expect ErrLastAdmin, got %v", err)
+	}
+	if err := adminCommand(cfg, []string{"bindcode", "admin"}); err == nil {
+		t.Fatal("expect error for disabled admin")
+	}
+	if err := adminCommand(cfg, []string{"enable", "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if admin, _ := admins.FindByUsername("admin"); admin.Disabled != 0 {
+		t.Fatalf("admin not enabled: %+v", admin)
+	}
+}
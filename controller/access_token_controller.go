@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"pdm/controller/dto"
+	"pdm/controller/middle"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// accessTokenMaxAge 个人访问令牌的最长有效期
+	accessTokenMaxAge = 365 * 24 * time.Hour
+	// accessTokenMaxCount 每个用户最多持有的个人访问令牌数量
+	accessTokenMaxCount = 20
+)
+
+// NewAccessTokenController 创建个人访问令牌控制器
+func NewAccessTokenController(router gin.IRouter) *AccessTokenController {
+	res := &AccessTokenController{}
+	r := router.Group("/token")
+	// 创建令牌
+	r.POST("/create", User, res.create)
+	// 令牌列表
+	r.GET("/list", Authenticate([]string{UserTypeUser, UserTypeAdmin}), res.list)
+	// 撤销令牌
+	r.DELETE("/revoke", Authenticate([]string{UserTypeUser, UserTypeAdmin}), res.revoke)
+	return res
+}
+
+// AccessTokenController 个人访问令牌控制器
+// 用户为脚本、CI等自动化调用创建令牌，调用接口时通过请求头 Authorization: Bearer <令牌> 认证。
+type AccessTokenController struct {
+}
+
+/**
+@api {POST} /api/token/create 创建令牌
+@apiDescription 创建个人访问令牌，令牌仅在创建时返回一次，服务端只保存令牌的摘要。
+令牌仅能访问指定的项目，且仅能调用权限范围内的接口：
+<ul>
+	<li>read - 只读，可调用所有查询（GET）接口</li>
+	<li>docs:write - 编辑对接文档，可调用 /api/doc/ 下的写接口</li>
+	<li>cases:run - 维护与执行接口测试用例，可调用 /api/case/ 下的写接口</li>
+</ul>
+令牌无法调用令牌与会话管理接口。令牌的项目角色与用户在项目中的角色相同，用户被删除或移出项目后令牌失效。
+每个用户最多持有20个令牌，有效期最长一年。
+@apiName TokenCreate
+@apiGroup Token
+
+@apiPermission 用户
+
+@apiParam {String} name 令牌名称，不超过64个字符。
+@apiParam {String[]} scopes 权限范围：read、docs:write、cases:run。
+@apiParam {Integer} projectId 可访问的项目ID，需为该项目成员。
+@apiParam {Integer} expiresAt 过期时间，单位Unix时间戳毫秒（ms）。
+
+@apiParamExample {json} 请求示例
+{
+    "name": "CI",
+    "scopes": ["read", "cases:run"],
+    "projectId": 1,
+    "expiresAt": 1792224000000
+}
+
+@apiSuccess {Integer} id 令牌ID。
+@apiSuccess {String} name 令牌名称。
+@apiSuccess {String} token 令牌，仅在创建时返回一次。
+@apiSuccess {String} scopes 权限范围，多个用","隔开。
+@apiSuccess {Integer} projectId 可访问的项目ID。
+@apiSuccess {String} expiresAt 过期时间。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "id": 1,
+    "name": "CI",
+    "token": "pdm_2Zk6U0hJ1m1n6h0f8mWqX0n0b5gF3Vt1yQk9sZ7c1aE",
+    "scopes": "read,cases:run",
+    "projectId": 1,
+    "expiresAt": "2026-10-17 08:00:00"
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+不是项目成员
+*/
+
+// create 创建令牌
+func (c *AccessTokenController) create(ctx *gin.Context) {
+	var info dto.AccessTokenCreateDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	applog.L(ctx, "创建个人访问令牌", map[string]interface{}{
+		"name":      info.Name,
+		"scopes":    info.Scopes,
+		"projectId": info.ProjectID,
+	})
+
+	info.Name = strings.TrimSpace(info.Name)
+	if info.Name == "" || utf8.RuneCountInString(info.Name) > 64 {
+		ErrIllegal(ctx, "令牌名称不能为空且不超过64个字符")
+		return
+	}
+	var scopes []string
+	for _, s := range info.Scopes {
+		switch s {
+		case entity.ScopeRead, entity.ScopeDocsWrite, entity.ScopeCasesRun:
+		default:
+			ErrIllegal(ctx, "未知的权限范围"+s)
+			return
+		}
+		if !isTypeContain(s, scopes) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		ErrIllegal(ctx, "请选择权限范围")
+		return
+	}
+	expiresAt := time.UnixMilli(info.ExpiresAt)
+	if !expiresAt.After(time.Now()) || expiresAt.After(time.Now().Add(accessTokenMaxAge)) {
+		ErrIllegal(ctx, "过期时间需在一年以内")
+		return
+	}
+
+	// 仅能创建可访问自己所在项目的令牌
+	var members int64
+	err := repo.DB.Model(&entity.ProjectMember{}).
+		Joins("JOIN projects ON projects.id = project_members.project_id AND projects.is_delete = 0").
+		Where("project_members.project_id = ? AND project_members.user_id = ?", info.ProjectID, claims.Sub).
+		Count(&members).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if members == 0 {
+		ErrIllegal(ctx, "不是项目成员")
+		return
+	}
+	var total int64
+	if err = repo.DB.Model(&entity.AccessToken{}).Where("user_id = ?", claims.Sub).Count(&total).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if total >= accessTokenMaxCount {
+		ErrIllegal(ctx, "令牌数量已达上限，请撤销不再使用的令牌")
+		return
+	}
+
+	at := &entity.AccessToken{
+		UserID:    claims.Sub,
+		Name:      info.Name,
+		Scopes:    strings.Join(scopes, ","),
+		ProjectID: info.ProjectID,
+		ExpiresAt: expiresAt,
+	}
+	token, err := repo.NewAccessTokenRepository().Create(at)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.AccessTokenResultDto{
+		ID:        at.ID,
+		Name:      at.Name,
+		Token:     token,
+		Scopes:    at.Scopes,
+		ProjectID: at.ProjectID,
+		ExpiresAt: entity.DateTime(at.ExpiresAt),
+	})
+}
+
+/**
+@api {GET} /api/token/list 令牌列表
+@apiDescription 用户查看自己的个人访问令牌，管理员查看所有用户或指定用户的令牌，按创建时间由新到旧排序。
+列表中不包含令牌本身，仅包含用于识别令牌的前缀。
+@apiName TokenList
+@apiGroup Token
+
+@apiPermission 用户,管理员
+
+@apiParam {Integer} [userId] 用户ID，仅管理员有效，为空表示所有用户。
+
+@apiParamExample 请求示例
+GET /api/token/list
+
+@apiSuccess {AccessToken[]} Body 令牌列表。
+
+@apiSuccess (AccessToken) {Integer} id 令牌ID。
+@apiSuccess (AccessToken) {String} createdAt 创建时间。
+@apiSuccess (AccessToken) {Integer} userId 所属用户ID。
+@apiSuccess (AccessToken) {String} name 令牌名称。
+@apiSuccess (AccessToken) {String} prefix 令牌前缀。
+@apiSuccess (AccessToken) {String} scopes 权限范围，多个用","隔开。
+@apiSuccess (AccessToken) {Integer} projectId 可访问的项目ID。
+@apiSuccess (AccessToken) {String} expiresAt 过期时间。
+@apiSuccess (AccessToken) {String} lastUsedAt 最近使用时间，未使用过为null。
+@apiSuccess (AccessToken) {String} lastUsedIp 最近使用的IP。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "id": 1,
+        "createdAt": "2026-10-17 09:00:00",
+        "userId": 1,
+        "name": "CI",
+        "prefix": "pdm_2Zk6U0hJ",
+        "scopes": "read,cases:run",
+        "projectId": 1,
+        "expiresAt": "2027-10-17 08:00:00",
+        "lastUsedAt": null,
+        "lastUsedIp": ""
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// list 令牌列表
+func (c *AccessTokenController) list(ctx *gin.Context) {
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	db := repo.DB.Order("created_at desc")
+	if claims.Type == UserTypeUser {
+		db = db.Where("user_id = ?", claims.Sub)
+	} else if userId, _ := strconv.Atoi(ctx.Query("userId")); userId > 0 {
+		db = db.Where("user_id = ?", userId)
+	}
+	res := []entity.AccessToken{}
+	if err := db.Find(&res).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {DELETE} /api/token/revoke 撤销令牌
+@apiDescription 撤销个人访问令牌，撤销后令牌立即失效。用户仅能撤销自己的令牌，管理员可以撤销所有用户的令牌。
+@apiName TokenRevoke
+@apiGroup Token
+
+@apiPermission 用户,管理员
+
+@apiParam {Integer} id 令牌ID。
+
+@apiParamExample 请求示例
+DELETE /api/token/revoke?id=1
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+令牌不存在
+*/
+
+// revoke 撤销令牌
+func (c *AccessTokenController) revoke(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	applog.L(ctx, "撤销个人访问令牌", map[string]interface{}{"id": id})
+
+	db := repo.DB.Where("id = ?", id)
+	if claims.Type == UserTypeUser {
+		db = db.Where("user_id = ?", claims.Sub)
+	}
+	res := db.Delete(&entity.AccessToken{})
+	if res.Error != nil {
+		ErrSys(ctx, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		ErrIllegal(ctx, "令牌不存在")
+		return
+	}
+}
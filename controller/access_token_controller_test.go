@@ -0,0 +1,121 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessTokens(t *testing.T) {
+	s := controllertest.NewServer(t)
+	user := entity.User{Openid: "1001", Name: "张三", Username: "zhangsan"}
+	s.CreateUser(&user, "Passw0rd")
+	project := entity.Project{Name: "测试项目", Manager: user.ID}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: user.ID, Role: 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	cookie := s.Login("1001", "Passw0rd")
+	create := func(body string) (int, string) {
+		w := s.Do(http.MethodPost, "/api/token/create", body, cookie)
+		var res struct {
+			ID    int    `json:"id"`
+			Token string `json:"token"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, res.Token
+	}
+	bearer := func(method, p, body, token string) int {
+		return s.Do(method, p, body, "", controllertest.Bearer(token)).Code
+	}
+	expires := time.Now().Add(24 * time.Hour).UnixMilli()
+
+	// 参数校验
+	for _, body := range []string{
+		fmt.Sprintf(`{"name":"","scopes":["read"],"projectId":%d,"expiresAt":%d}`, project.ID, expires),
+		fmt.Sprintf(`{"name":"CI","scopes":["admin"],"projectId":%d,"expiresAt":%d}`, project.ID, expires),
+		fmt.Sprintf(`{"name":"CI","scopes":["read"],"projectId":%d,"expiresAt":%d}`, project.ID, time.Now().UnixMilli()-1),
+		fmt.Sprintf(`{"name":"CI","scopes":["read"],"projectId":%d,"expiresAt":%d}`, project.ID+1, expires),
+	} {
+		if code, _ := create(body); code != http.StatusBadRequest {
+			t.Fatalf("create %s: %d", body, code)
+		}
+	}
+
+	code, token := create(fmt.Sprintf(`{"name":"CI","scopes":["read","read"],"projectId":%d,"expiresAt":%d}`, project.ID, expires))
+	if code != http.StatusOK || !strings.HasPrefix(token, entity.AccessTokenPrefix) {
+		t.Fatalf("create: %d %s", code, token)
+	}
+
+	// 只读令牌可以调用查询接口，不能调用写接口与令牌管理接口
+	if code = bearer(http.MethodGet, "/api/project/search", "", token); code != http.StatusOK {
+		t.Fatalf("read: %d", code)
+	}
+	for _, p := range []string{"/api/doc/create", "/api/project/create"} {
+		if code = bearer(http.MethodPost, p, "{}", token); code != http.StatusForbidden {
+			t.Fatalf("write %s: %d", p, code)
+		}
+	}
+	if code = bearer(http.MethodGet, "/api/token/list", "", token); code != http.StatusForbidden {
+		t.Fatalf("token list by bearer: %d", code)
+	}
+	if code = bearer(http.MethodGet, "/api/project/search", "", token+"x"); code != http.StatusUnauthorized {
+		t.Fatalf("invalid token: %d", code)
+	}
+	w := s.Do(http.MethodGet, "/api/project/search", "", "", func(r *http.Request) { r.Header.Set("Authorization", "Basic "+token) })
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("invalid scheme: %d", w.Code)
+	}
+
+	// 列表中不包含令牌本身，记录最近使用时间
+	w = s.Do(http.MethodGet, "/api/token/list", "", cookie)
+	var list []struct {
+		ID         int     `json:"id"`
+		Prefix     string  `json:"prefix"`
+		Scopes     string  `json:"scopes"`
+		LastUsedAt *string `json:"lastUsedAt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), token) || !strings.HasPrefix(token, list[0].Prefix) ||
+		list[0].Scopes != "read" || list[0].LastUsedAt == nil {
+		t.Fatalf("unexpected list: %s", w.Body.String())
+	}
+
+	// 撤销后令牌立即失效
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/token/revoke?id=%d", list[0].ID), "", cookie), http.StatusOK, "")
+	if code = bearer(http.MethodGet, "/api/project/search", "", token); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: %d", code)
+	}
+
+	// 过期令牌无效
+	_, token = create(fmt.Sprintf(`{"name":"CI","scopes":["read"],"projectId":%d,"expiresAt":%d}`, project.ID, expires))
+	if err := repo.DB.Model(&entity.AccessToken{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if code = bearer(http.MethodGet, "/api/project/search", "", token); code != http.StatusUnauthorized {
+		t.Fatalf("expired token: %d", code)
+	}
+
+	// 用户移出项目后令牌失效
+	_, token = create(fmt.Sprintf(`{"name":"CI","scopes":["read"],"projectId":%d,"expiresAt":%d}`, project.ID, expires))
+	if err := repo.DB.Where("user_id = ?", user.ID).Delete(&entity.ProjectMember{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if code = bearer(http.MethodGet, "/api/project/search", "", token); code != http.StatusUnauthorized {
+		t.Fatalf("token of removed member: %d", code)
+	}
+}
@@ -0,0 +1,510 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pdm/controller/dto"
+	"pdm/controller/middle"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// NewAdminController 创建管理员与审计员账号管理控制器
+func NewAdminController(router gin.IRouter) *AdminController {
+	res := &AdminController{}
+	r := router.Group("/admin")
+	// 账号列表
+	r.GET("/search", Admin, res.search)
+	// 创建账号
+	r.POST("/create", Admin, res.create)
+	// 禁用账号
+	r.POST("/disable", Admin, res.disable)
+	// 启用账号
+	r.POST("/enable", Admin, res.enable)
+	// 生成证书绑定码
+	r.POST("/bindCode", Admin, res.bindCode)
+	// 绑定的证书列表
+	r.GET("/certs", Admin, res.certs)
+	// 解除证书绑定
+	r.DELETE("/unbind", Admin, res.unbind)
+	return res
+}
+
+// AdminController 管理员与审计员账号管理控制器
+// 管理员与审计员通过证书登录，账号的证书绑定、解绑等操作需由其他管理员执行，以便相互监督。
+type AdminController struct {
+}
+
+/**
+@api {GET} /api/admin/search 账号列表
+@apiDescription 查询所有管理员与审计员账号，按创建时间排序。
+@apiName AdminSearch
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParamExample 请求示例
+GET /api/admin/search
+
+@apiSuccess {AdminItem[]} Body 账号列表。
+
+@apiSuccess (AdminItem) {Integer} id 账号ID。
+@apiSuccess (AdminItem) {String} createdAt 创建时间。
+@apiSuccess (AdminItem) {String} username 用户名。
+@apiSuccess (AdminItem) {Integer} role 角色类型 0 - 管理员 1 - 审计员。
+@apiSuccess (AdminItem) {Integer} disabled 是否禁用 0 - 启用 1 - 禁用。
+@apiSuccess (AdminItem) {Integer} certs 绑定的证书数量。
+@apiSuccess (AdminItem) {Boolean} binding 是否有未使用且未过期的证书绑定码。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "id": 1,
+        "createdAt": "2022-11-07 09:19:44",
+        "username": "admin",
+        "role": 0,
+        "disabled": 0,
+        "certs": 2,
+        "binding": false
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// search 账号列表
+func (c *AdminController) search(ctx *gin.Context) {
+	var admins []entity.Admin
+	if err := repo.DB.Order("id").Find(&admins).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	var counts []struct {
+		AdminID int
+		Total   int
+	}
+	err := repo.DB.Model(&entity.AdminCert{}).Select("admin_id, COUNT(*) AS total").Group("admin_id").Scan(&counts).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	certs := map[int]int{}
+	for _, item := range counts {
+		certs[item.AdminID] = item.Total
+	}
+	now := time.Now()
+	res := make([]dto.AdminItemDto, 0, len(admins))
+	for _, a := range admins {
+		res = append(res, dto.AdminItemDto{
+			ID:        a.ID,
+			CreatedAt: entity.DateTime(a.CreatedAt),
+			Username:  a.Username,
+			Role:      a.Role,
+			Disabled:  a.Disabled,
+			Certs:     certs[a.ID],
+			Binding:   a.BindCode != "" && a.BindCodeExpiresAt != nil && a.BindCodeExpiresAt.After(now),
+		})
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {POST} /api/admin/create 创建账号
+@apiDescription 创建管理员或审计员账号，返回一次性证书绑定码，绑定码24小时内有效，仅返回一次。
+账号持有人使用绑定码通过 证书绑定 接口绑定证书后即可登录。
+@apiName AdminCreate
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParam {String} username 用户名，不超过64个字符。
+@apiParam {Integer=0,1} role 角色类型 0 - 管理员 1 - 审计员。
+
+@apiParamExample {json} 请求示例
+{
+    "username": "audit2",
+    "role": 1
+}
+
+@apiSuccess {Integer} id 账号ID。
+@apiSuccess {String} username 用户名。
+@apiSuccess {String} bindCode 证书绑定码，仅返回一次。
+@apiSuccess {String} expiresAt 绑定码过期时间。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "id": 3,
+    "username": "audit2",
+    "bindCode": "abcd-efgh-jkmn-pqrs",
+    "expiresAt": "2022-11-08 09:19:44"
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+用户名已存在
+*/
+
+// create 创建账号
+func (c *AdminController) create(ctx *gin.Context) {
+	var info dto.AdminCreateDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	applog.L(ctx, "创建管理员账号", map[string]interface{}{"username": info.Username, "role": info.Role})
+
+	info.Username = strings.TrimSpace(info.Username)
+	if info.Username == "" || utf8.RuneCountInString(info.Username) > 64 {
+		ErrIllegal(ctx, "用户名不能为空且不超过64个字符")
+		return
+	}
+	if info.Role != entity.AdminRoleAdmin && info.Role != entity.AdminRoleAudit {
+		ErrIllegal(ctx, "角色类型错误")
+		return
+	}
+	admin, code, err := repo.NewAdminRepository().Create(info.Username, info.Role)
+	if err == repo.ErrAdminExists {
+		ErrIllegal(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.AdminBindCodeDto{
+		ID:        admin.ID,
+		Username:  admin.Username,
+		BindCode:  code,
+		ExpiresAt: entity.DateTime(*admin.BindCodeExpiresAt),
+	})
+}
+
+/**
+@api {POST} /api/admin/disable 禁用账号
+@apiDescription 禁用管理员或审计员账号，禁用后无法登录，已登录的会话立即注销，未使用的证书绑定码失效。
+不能禁用自己的账号，且至少保留一个启用的管理员。
+@apiName AdminDisable
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 账号ID。
+
+@apiParamExample {json} 请求示例
+{
+    "id": 3
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+至少保留一个启用的管理员
+*/
+
+// disable 禁用账号
+func (c *AdminController) disable(ctx *gin.Context) {
+	c.setDisabled(ctx, true)
+}
+
+/**
+@api {POST} /api/admin/enable 启用账号
+@apiDescription 启用已禁用的管理员或审计员账号。
+@apiName AdminEnable
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 账号ID。
+
+@apiParamExample {json} 请求示例
+{
+    "id": 3
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+账号不存在
+*/
+
+// enable 启用账号
+func (c *AdminController) enable(ctx *gin.Context) {
+	c.setDisabled(ctx, false)
+}
+
+// setDisabled 禁用或启用账号
+func (c *AdminController) setDisabled(ctx *gin.Context, disabled bool) {
+	var info dto.AdminIdDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	if disabled {
+		applog.L(ctx, "禁用管理员账号", map[string]interface{}{"id": info.ID})
+	} else {
+		applog.L(ctx, "启用管理员账号", map[string]interface{}{"id": info.ID})
+	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	if disabled && info.ID == claims.Sub {
+		ErrIllegal(ctx, "不能禁用自己的账号")
+		return
+	}
+	err := repo.NewAdminRepository().SetDisabled(info.ID, disabled)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ErrIllegal(ctx, "账号不存在")
+		return
+	}
+	if err == repo.ErrLastAdmin {
+		ErrIllegal(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {POST} /api/admin/bindCode 生成证书绑定码
+@apiDescription 为管理员或审计员重新生成一次性证书绑定码，用于更换或新增证书（如USB Key更换、证书续期），
+原有的绑定码失效，已绑定的证书仍然有效，如需停用旧证书请使用 解除证书绑定。
+绑定码需由其他管理员生成，不能为自己的账号生成。绑定码24小时内有效，仅返回一次。
+@apiName AdminBindCode
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 账号ID。
+
+@apiParamExample {json} 请求示例
+{
+    "id": 3
+}
+
+@apiSuccess {Integer} id 账号ID。
+@apiSuccess {String} username 用户名。
+@apiSuccess {String} bindCode 证书绑定码，仅返回一次。
+@apiSuccess {String} expiresAt 绑定码过期时间。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "id": 3,
+    "username": "audit2",
+    "bindCode": "abcd-efgh-jkmn-pqrs",
+    "expiresAt": "2022-11-08 09:19:44"
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+不能为自己的账号生成绑定码，请联系其他管理员
+*/
+
+// bindCode 生成证书绑定码
+func (c *AdminController) bindCode(ctx *gin.Context) {
+	var info dto.AdminIdDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	applog.L(ctx, "生成证书绑定码", map[string]interface{}{"id": info.ID})
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	if info.ID == claims.Sub {
+		ErrIllegal(ctx, "不能为自己的账号生成绑定码，请联系其他管理员")
+		return
+	}
+	var admin entity.Admin
+	err := repo.DB.First(&admin, info.ID).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "账号不存在")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if admin.Disabled == 1 {
+		ErrIllegal(ctx, "账号已禁用")
+		return
+	}
+	code, expiresAt, err := repo.NewAdminRepository().IssueBindCode(admin.ID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.AdminBindCodeDto{
+		ID:        admin.ID,
+		Username:  admin.Username,
+		BindCode:  code,
+		ExpiresAt: entity.DateTime(expiresAt),
+	})
+}
+
+/**
+@api {GET} /api/admin/certs 绑定的证书列表
+@apiDescription 查看账号绑定的所有证书，按绑定时间由新到旧排序。
+@apiName AdminCerts
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 账号ID。
+
+@apiParamExample 请求示例
+GET /api/admin/certs?id=1
+
+@apiSuccess {AdminCert[]} Body 证书列表。
+
+@apiSuccess (AdminCert) {Integer} id 证书绑定记录ID。
+@apiSuccess (AdminCert) {String} createdAt 绑定时间。
+@apiSuccess (AdminCert) {Integer} adminId 账号ID。
+@apiSuccess (AdminCert) {String} fingerprint 证书SM3指纹Hex。
+@apiSuccess (AdminCert) {String} serial 证书序列号Hex。
+@apiSuccess (AdminCert) {String} subject 证书主题。
+@apiSuccess (AdminCert) {String} issuer 证书颁发者。
+@apiSuccess (AdminCert) {String} notAfter 证书有效期截止时间。
+@apiSuccess (AdminCert) {String} lastUsedAt 最近登录时间，未使用过为空。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "id": 2,
+        "createdAt": "2023-01-10 15:37:45",
+        "adminId": 1,
+        "fingerprint": "1f8ac10f23c5b5bc1167bda84b833e5c057a77d2d8d0d6c2b3e9f0a1c4d5e6f7",
+        "serial": "2ceb7c7aecf67be",
+        "subject": "CN=wly测试,OU=研发,O=蓉蔻,L=杭州,ST=浙江,C=中国",
+        "issuer": "CN=测试CA,L=杭州,ST=浙江,C=CN",
+        "notAfter": "2024-01-10 15:37:45",
+        "lastUsedAt": "2023-06-01 09:00:00"
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// certs 绑定的证书列表
+func (c *AdminController) certs(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	list, err := repo.NewAdminRepository().Certs(id)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, list)
+}
+
+/**
+@api {DELETE} /api/admin/unbind 解除证书绑定
+@apiDescription 解除账号绑定的证书，解除后该证书无法登录。
+解除其他账号的证书时注销该账号的所有会话，用于USB Key丢失或更换；
+解除自己的证书时需保留至少一个证书，用于证书续期后停用旧证书。
+@apiName AdminUnbind
+@apiGroup Admin
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 账号ID。
+@apiParam {Integer} certId 证书绑定记录ID。
+
+@apiParamExample 请求示例
+DELETE /api/admin/unbind?id=3&certId=5
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+不能解除自己唯一的证书
+*/
+
+// unbind 解除证书绑定
+func (c *AdminController) unbind(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	certID, err := strconv.Atoi(ctx.Query("certId"))
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	applog.L(ctx, "解除证书绑定", map[string]interface{}{"id": id, "certId": certID})
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	admins := repo.NewAdminRepository()
+	if id == claims.Sub {
+		list, err := admins.Certs(id)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		if len(list) <= 1 {
+			ErrIllegal(ctx, "不能解除自己唯一的证书")
+			return
+		}
+	}
+	ok, err := admins.Unbind(id, certID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if !ok {
+		ErrIllegal(ctx, "证书不存在")
+		return
+	}
+	if id == claims.Sub {
+		return
+	}
+	// 证书可能已丢失，注销使用该证书登录的会话
+	var admin entity.Admin
+	if err = repo.DB.First(&admin, id).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	typ := UserTypeAdmin
+	if admin.Role == entity.AdminRoleAudit {
+		typ = UserTypeAudit
+	}
+	if _, err = repo.NewSessionRepository().RevokeUser(typ, id); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package controller_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+	"net/http"
+	"net/http/httptest"
+	"pdm/controller/controllertest"
+	"pdm/controller/dto"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/storage"
+	"testing"
+	"time"
+)
+
+func TestAdminAccounts(t *testing.T) {
+	s := controllertest.NewServer(t)
+	admins := repo.NewAdminRepository()
+	root, rootKey := newSM2Cert(t, "测试根证书", nil, nil)
+	if err := storage.WriteFile(storage.RootCert, "root.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, p string, body interface{}, token string) *httptest.ResponseRecorder {
+		bin, _ := json.Marshal(body)
+		return s.Do(method, p, string(bin), token)
+	}
+	bind := func(username, code string, cert *smx509.Certificate, key *sm2.PrivateKey) *httptest.ResponseRecorder {
+		token := newTokenAB(t, key, username, authRandom(t, s), entity.B, time.Now())
+		token["cert"], token["code"] = base64.StdEncoding.EncodeToString(cert.Raw), code
+		return do(http.MethodPost, "/api/certBinding", token, "")
+	}
+	login := func(username string, key *sm2.PrivateKey) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/api/entityAuth", newTokenAB(t, key, username, authRandom(t, s), entity.B, time.Now()), "")
+	}
+	sessionOf := func(w *httptest.ResponseRecorder) string {
+		token := controllertest.Cookie(w)
+		if token == "" {
+			t.Fatalf("no session: %d %s", w.Code, w.Body.String())
+		}
+		return token
+	}
+	var created dto.AdminBindCodeDto
+	create := func(token, username string, role int) {
+		w := do(http.MethodPost, "/api/admin/create", map[string]interface{}{"username": username, "role": role}, token)
+		s.Expect(w, http.StatusOK, `"bindCode"`)
+		_ = json.Unmarshal(w.Body.Bytes(), &created)
+	}
+
+	// 创建首个管理员，通过绑定码绑定证书
+	boot, code, err := admins.Create("boot", entity.AdminRoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootCert, bootKey := newSM2Cert(t, "boot", root, rootKey)
+	s.Expect(bind("boot", "wrong-code", bootCert, bootKey), http.StatusBadRequest, "绑定码无效")
+	s.Expect(bind("nobody", code, bootCert, bootKey), http.StatusBadRequest, "绑定码无效")
+	s.Expect(bind("boot", code, bootCert, bootKey), http.StatusOK, "")
+	// 绑定码仅能使用一次
+	other, otherKey := newSM2Cert(t, "other", root, rootKey)
+	s.Expect(bind("boot", code, other, otherKey), http.StatusBadRequest, "绑定码无效")
+	token := sessionOf(login("boot", bootKey))
+
+	// 管理员创建审计员，审计员使用绑定码绑定证书
+	create(token, "auditor", entity.AdminRoleAudit)
+	s.Expect(do(http.MethodPost, "/api/admin/create", map[string]interface{}{"username": "auditor", "role": 1}, token), http.StatusBadRequest, "用户名已存在")
+	auditID := created.ID
+	auditCert, auditKey := newSM2Cert(t, "auditor", root, rootKey)
+	// 同一证书只能绑定一个账号
+	s.Expect(bind("auditor", created.BindCode, bootCert, bootKey), http.StatusBadRequest, "证书已被绑定")
+	w := do(http.MethodPost, "/api/admin/bindCode", map[string]interface{}{"id": auditID}, token)
+	s.Expect(w, http.StatusOK, `"bindCode"`)
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	s.Expect(bind("auditor", created.BindCode, auditCert, auditKey), http.StatusOK, "")
+	w = login("auditor", auditKey)
+	s.Expect(w, http.StatusOK, `"type":"audit"`)
+	auditToken := sessionOf(w)
+	s.Expect(do(http.MethodGet, "/api/admin/search", nil, auditToken), http.StatusForbidden, "")
+	w = do(http.MethodGet, "/api/admin/search", nil, token)
+	s.Expect(w, http.StatusOK, `"username":"auditor","role":1,"disabled":0,"certs":1,"binding":false`)
+
+	// 证书续期：不能为自己生成绑定码，由其他管理员生成后绑定新证书，新旧证书均可登录
+	s.Expect(do(http.MethodPost, "/api/admin/bindCode", map[string]interface{}{"id": boot.ID}, token), http.StatusBadRequest, "不能为自己的账号生成绑定码")
+	create(token, "second", entity.AdminRoleAdmin)
+	secondCert, secondKey := newSM2Cert(t, "second", root, rootKey)
+	s.Expect(bind("second", created.BindCode, secondCert, secondKey), http.StatusOK, "")
+	secondToken := sessionOf(login("second", secondKey))
+	w = do(http.MethodPost, "/api/admin/bindCode", map[string]interface{}{"id": boot.ID}, secondToken)
+	s.Expect(w, http.StatusOK, `"bindCode"`)
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	renewed, renewedKey := newSM2Cert(t, "boot-2", root, rootKey)
+	s.Expect(bind("boot", created.BindCode, renewed, renewedKey), http.StatusOK, "")
+	s.Expect(login("boot", bootKey), http.StatusOK, `"type":"admin"`)
+	token = sessionOf(login("boot", renewedKey))
+
+	var certs []entity.AdminCert
+	w = do(http.MethodGet, fmt.Sprintf("/api/admin/certs?id=%d", boot.ID), nil, token)
+	s.Expect(w, http.StatusOK, "")
+	_ = json.Unmarshal(w.Body.Bytes(), &certs)
+	if len(certs) != 2 || certs[0].Subject != "CN=boot-2" {
+		t.Fatalf("certs: %s", w.Body.String())
+	}
+	// 自己解除旧证书，但不能解除唯一的证书
+	s.Expect(do(http.MethodDelete, fmt.Sprintf("/api/admin/unbind?id=%d&certId=%d", boot.ID, certs[1].ID), nil, token), http.StatusOK, "")
+	s.Expect(login("boot", bootKey), http.StatusBadRequest, "身份认证失败")
+	s.Expect(do(http.MethodDelete, fmt.Sprintf("/api/admin/unbind?id=%d&certId=%d", boot.ID, certs[0].ID), nil, token), http.StatusBadRequest, "不能解除自己唯一的证书")
+
+	// USB Key丢失：解除审计员的证书后其会话立即失效
+	var auditCerts []entity.AdminCert
+	w = do(http.MethodGet, fmt.Sprintf("/api/admin/certs?id=%d", auditID), nil, token)
+	_ = json.Unmarshal(w.Body.Bytes(), &auditCerts)
+	s.Expect(do(http.MethodDelete, fmt.Sprintf("/api/admin/unbind?id=%d&certId=%d", auditID, auditCerts[0].ID), nil, token), http.StatusOK, "")
+	s.Expect(do(http.MethodGet, "/api/admin/search", nil, auditToken), http.StatusUnauthorized, "")
+	s.Expect(login("auditor", auditKey), http.StatusBadRequest, "未绑定证书")
+
+	// 禁用与启用
+	s.Expect(do(http.MethodPost, "/api/admin/disable", map[string]interface{}{"id": boot.ID}, token), http.StatusBadRequest, "不能禁用自己的账号")
+	s.Expect(do(http.MethodPost, "/api/admin/disable", map[string]interface{}{"id": boot.ID}, secondToken), http.StatusOK, "")
+	s.Expect(do(http.MethodGet, "/api/admin/search", nil, token), http.StatusUnauthorized, "")
+	s.Expect(login("boot", renewedKey), http.StatusBadRequest, "账号已禁用")
+	// 初始化的缺省管理员禁用后 second 为唯一启用的管理员
+	initial, _ := admins.FindByUsername("admin")
+	if err = admins.SetDisabled(initial.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := admins.FindByUsername("second")
+	if err = admins.SetDisabled(second.ID, true); !errors.Is(err, repo.ErrLastAdmin) {
+		t.Fatalf("expect ErrLastAdmin, got %v", err)
+	}
+	if err = admins.SetDisabled(boot.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	s.Expect(login("boot", renewedKey), http.StatusOK, `"type":"admin"`)
+}
@@ -8,6 +8,7 @@ import (
 	"pdm/controller/dto"
 	"pdm/controller/middle"
 	"pdm/logg/applog"
+	"pdm/metrics"
 	"pdm/repo"
 	"pdm/repo/entity"
 	"pdm/reuint"
@@ -21,15 +22,15 @@ func NewCasesController(router gin.IRouter) *CasesController {
 	res := &CasesController{}
 	r := router.Group("/case")
 	// 接口用例创建
-	r.POST("/create", ExceptProjectInterConnector, res.create)
+	r.POST("/create", Require(entity.PermCaseWrite), res.create)
 	// 查询接口用例具体信息
-	r.GET("/info", ProjectMember, res.info)
+	r.GET("/info", Require(entity.PermProjectRead), res.info)
 	// 编辑接口用例
-	r.POST("/edit", ExceptProjectInterConnector, res.edit)
+	r.POST("/edit", Require(entity.PermCaseWrite), res.edit)
 	// 删除接口用例
-	r.DELETE("/delete", ExceptProjectInterConnector, res.delete)
+	r.DELETE("/delete", Require(entity.PermCaseWrite), res.delete)
 	// 发送测试请求
-	r.POST("/send", res.send)
+	r.POST("/send", Require(entity.PermCaseRun), res.send)
 	return res
 }
 
@@ -37,6 +38,14 @@ func NewCasesController(router gin.IRouter) *CasesController {
 type CasesController struct {
 }
 
+// sendClient 发送测试请求的HTTP客户端，统计外部请求数、耗时与响应状态码
+var sendClient = &http.Client{
+	Transport: &metrics.Transport{
+		Requests: metrics.CaseSendRequests,
+		Duration: metrics.CaseSendDuration,
+	},
+}
+
 /**
 @api {POST} /api/case/create 创建接口用例
 @apiDescription 创建接口用例
@@ -45,7 +54,7 @@ type CasesController struct {
 @apiName CaseCreate
 @apiGroup Case
 
-@apiPermission 项目成员
+@apiPermission 具有 case.write 权限的项目成员
 
 @apiParam {String} name 接口用例名称。
 @apiParam {Integer} [categorizeId] 所属分类ID。
@@ -102,8 +111,16 @@ func (c *CasesController) create(ctx *gin.Context) {
 		ErrIllegal(ctx, "用例名称不能为空")
 		return
 	}
+	if info.CategorizeId > 0 && !owned(ctx, repo.ResourceCategorize, info.CategorizeId) {
+		return
+	}
+	// 创建人ID与所属项目ID
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	info.UserId = claims.Sub
+	info.ProjectId = middle.ProjectID(ctx)
 	// 用例名称唯一
-	exist, err := repo.CaseRepo.ExistName(info.Name, info.CategorizeId)
+	exist, err := repo.CaseRepo.ExistName(info.Name, info.ProjectId, info.CategorizeId)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -112,10 +129,6 @@ func (c *CasesController) create(ctx *gin.Context) {
 		ErrIllegal(ctx, "用例名称已经存在")
 		return
 	}
-	// 创建人ID
-	claimsValue, _ := ctx.Get(middle.FlagClaims)
-	claims := claimsValue.(*jwt.Claims)
-	info.UserId = claims.Sub
 
 	if err = repo.DB.Create(&info).Error; err != nil {
 		ErrSys(ctx, err)
@@ -134,7 +147,7 @@ func (c *CasesController) create(ctx *gin.Context) {
 @apiName CaseInfo
 @apiGroup Case
 
-@apiPermission 项目成员
+@apiPermission 具有 project.read 权限的项目成员
 
 @apiParam {Integer} id 接口用例ID。
 
@@ -192,6 +205,9 @@ func (c *CasesController) info(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !owned(ctx, repo.ResourceCase, id) {
+		return
+	}
 	caseInfo := entity.ApiCase{}
 	err := repo.DB.First(&caseInfo, "id = ?", id).Error
 	if err == gorm.ErrRecordNotFound {
@@ -212,7 +228,7 @@ func (c *CasesController) info(ctx *gin.Context) {
 @apiName CaseEdit
 @apiGroup Case
 
-@apiPermission 项目成员
+@apiPermission 具有 case.write 权限的项目成员
 
 
 @apiParam {Integer} id 用例ID。
@@ -285,6 +301,12 @@ func (c *CasesController) edit(ctx *gin.Context) {
 		ErrIllegal(ctx, "用例名称不能为空")
 		return
 	}
+	if !owned(ctx, repo.ResourceCase, info.ID) {
+		return
+	}
+	if info.CategorizeId > 0 && !owned(ctx, repo.ResourceCategorize, info.CategorizeId) {
+		return
+	}
 	// 获取数据库用例信息
 	caseInfo := entity.ApiCase{}
 	err := repo.DB.First(&caseInfo, "id = ?", info.ID).Error
@@ -298,7 +320,7 @@ func (c *CasesController) edit(ctx *gin.Context) {
 	}
 	// 用例名称唯一
 	if info.Name != caseInfo.Name {
-		exist, err := repo.CaseRepo.ExistName(info.Name, caseInfo.CategorizeId)
+		exist, err := repo.CaseRepo.ExistName(info.Name, caseInfo.ProjectId, caseInfo.CategorizeId)
 		if err != nil {
 			ErrSys(ctx, err)
 			return
@@ -314,6 +336,7 @@ func (c *CasesController) edit(ctx *gin.Context) {
 	if info.CategorizeId <= 0 {
 		info.CategorizeId = caseInfo.CategorizeId
 	}
+	info.ProjectId = caseInfo.ProjectId
 	info.CreatedAt = caseInfo.CreatedAt
 	if err = repo.DB.Save(&info).Error; err != nil {
 		ErrSys(ctx, err)
@@ -329,7 +352,7 @@ func (c *CasesController) edit(ctx *gin.Context) {
 @apiName CaseDelete
 @apiGroup Case
 
-@apiPermission 项目负责人、接口用例创建者
+@apiPermission 具有 case.write 权限的项目成员
 
 @apiParam {String} ids 待删除的ID序列，多个ID用","隔开，如：ids=1,99。
 
@@ -355,6 +378,12 @@ func (c *CasesController) delete(ctx *gin.Context) {
 	applog.L(ctx, "删除接口用例", map[string]interface{}{
 		"ids": ids,
 	})
+	if len(idArray) == 0 {
+		return
+	}
+	if !owned(ctx, repo.ResourceCase, idArray...) {
+		return
+	}
 	if err := repo.DB.Delete(&entity.ApiCase{}, "id in ?", idArray).Error; err != nil {
 		ErrSys(ctx, err)
 		return
@@ -368,7 +397,7 @@ func (c *CasesController) delete(ctx *gin.Context) {
 @apiName CaseSend
 @apiGroup Case
 
-@apiPermission 项目成员
+@apiPermission 具有 case.run 权限的项目成员
 
 
 @apiParam {Integer} id 用例ID。
@@ -452,7 +481,7 @@ func (c *CasesController) send(ctx *gin.Context) {
 			return
 		}
 		// 发送请求
-		resp, err = http.DefaultClient.Do(request)
+		resp, err = sendClient.Do(request)
 		if err != nil {
 			ErrIllegal(ctx, "发送请求失败")
 			return
@@ -480,13 +509,13 @@ func (c *CasesController) send(ctx *gin.Context) {
 				ErrSys(ctx, err)
 				return
 			}
-			resp, err = http.DefaultClient.Do(request)
+			resp, err = sendClient.Do(request)
 			if err != nil {
 				ErrIllegal(ctx, "发送请求失败")
 				return
 			}
 		} else if info.BodyType == entity.BodyTypeForm {
-			resp, err = http.PostForm(info.Path, bodyForm)
+			resp, err = sendClient.PostForm(info.Path, bodyForm)
 			if err != nil {
 				ErrIllegal(ctx, "发送请求失败")
 				return
@@ -515,13 +544,13 @@ func (c *CasesController) send(ctx *gin.Context) {
 				ErrSys(ctx, err)
 				return
 			}
-			resp, err = http.DefaultClient.Do(request)
+			resp, err = sendClient.Do(request)
 			if err != nil {
 				ErrIllegal(ctx, "发送请求失败")
 				return
 			}
 		} else if info.BodyType == entity.BodyTypeForm {
-			resp, err = http.PostForm(info.Path, bodyForm)
+			resp, err = sendClient.PostForm(info.Path, bodyForm)
 			if err != nil {
 				ErrIllegal(ctx, "发送请求失败")
 				return
@@ -546,7 +575,7 @@ func (c *CasesController) send(ctx *gin.Context) {
 			return
 		}
 		// 发送请求
-		resp, err = http.DefaultClient.Do(request)
+		resp, err = sendClient.Do(request)
 		if err != nil {
 			ErrIllegal(ctx, "发送请求失败")
 			return
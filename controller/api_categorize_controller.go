@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"pdm/controller/dto"
@@ -8,6 +9,7 @@ import (
 	"pdm/logg/applog"
 	"pdm/repo"
 	"pdm/repo/entity"
+	"pdm/reuint"
 	"pdm/reuint/jwt"
 	"strconv"
 	"strings"
@@ -18,15 +20,15 @@ func NewCategorizeController(router gin.IRouter) *CategorizeController {
 	res := &CategorizeController{}
 	r := router.Group("/categorize")
 	// 创建分类
-	r.POST("/create", ExceptProjectInterConnector, res.create)
+	r.POST("/create", Require(entity.PermCaseWrite), res.create)
 	// 关键字查询分类或接口
-	r.GET("/search", ProjectMember, res.search)
+	r.GET("/search", Require(entity.PermProjectRead), res.search)
 	// 查询出分类下的子分类和接口列表
-	r.GET("/list", ProjectMember, res.list)
+	r.GET("/list", Require(entity.PermProjectRead), res.list)
 	// 编辑分类
-	r.POST("/edit", ExceptProjectInterConnector, res.edit)
+	r.POST("/edit", Require(entity.PermCaseWrite), res.edit)
 	// 删除分类
-	r.DELETE("/delete", ExceptProjectInterConnector, res.delete)
+	r.DELETE("/delete", Require(entity.PermCaseWrite), res.delete)
 
 	return res
 }
@@ -42,7 +44,7 @@ type CategorizeController struct {
 @apiName CategorizeCreate
 @apiGroup Categorize
 
-@apiPermission 项目成员
+@apiPermission 具有 case.write 权限的项目成员
 
 @apiParam {String} name 接口分类名称。
 @apiParam {Integer} [parentId] 父分类ID。
@@ -90,6 +92,9 @@ func (c *CategorizeController) create(ctx *gin.Context) {
 		ErrIllegal(ctx, "分类名称不能为空")
 		return
 	}
+	if info.ParentId > 0 && !owned(ctx, repo.ResourceCategorize, info.ParentId) {
+		return
+	}
 	// 分类名称唯一
 	exist, err := repo.CategorizeRepo.ExistName(ctx, info.Name, info.ParentId)
 	if err != nil {
@@ -105,7 +110,7 @@ func (c *CategorizeController) create(ctx *gin.Context) {
 	claimsValue, _ := ctx.Get(middle.FlagClaims)
 	claims := claimsValue.(*jwt.Claims)
 	info.UserId = claims.Sub
-	info.ProjectId = claims.PID
+	info.ProjectId = middle.ProjectID(ctx)
 
 	if err = repo.DB.Create(&info).Error; err != nil {
 		ErrSys(ctx, err)
@@ -118,47 +123,81 @@ func (c *CategorizeController) create(ctx *gin.Context) {
 
 /**
 @api {GET} /api/categorize/search 查找接口分类
-@apiDescription 根据关键字查询分类。
+@apiDescription 根据关键字查询项目中名称包含关键字的分类和接口用例。
 @apiName CategorizeSearch
 @apiGroup Categorize
 
-@apiPermission 项目成员
+@apiPermission 具有 project.read 权限的项目成员
 
-@apiParam {String} [keyword] 接口分类名称。
+@apiParam {String} keyword 关键字。
 
 @apiParamExample {get} 请求示例
 GET /api/categorize/search?keyword=pdm
 
-@apiSuccess {Categorize[]} Categorize 查询结果列表。
+@apiSuccess {List[]} Body 查询结果列表，分类在前，接口用例在后。
 
-@apiSuccess {Categorize} Categorize 分类数据结构。
-@apiSuccess {Integer} Categorize.id 分类ID。
-@apiSuccess {String} Categorize.name 分类名称。
-@apiSuccess {String} User.createdAt 创建时间。
-@apiSuccess {String} User.updatedAt 更新时间。
+@apiSuccess (List) {Integer} id 分类ID或用例ID。
+@apiSuccess (List) {String} name 分类名称或用例名称。
+@apiSuccess (List) {String} createdAt 创建时间。
+@apiSuccess (List) {String} updatedAt 更新时间。
+@apiSuccess (List) {String} type 结果类型。
+<ul>
+	    <li>categorize</li>
+	    <li>case</li>
+</ul>
 
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
-{
-	[
-		{
-		    "id": 5,
-		    "createdAt": "2020-09-26 11:29:44",
-		    "updatedAt": "2020-09-26 11:29:44",
-		    "name": "测试",
-		}
-    ]
-}
+[
+    {
+        "id": 5,
+        "createdAt": "2020-09-26 11:29:44",
+        "updatedAt": "2020-09-26 11:29:44",
+        "name": "pdm测试",
+        "type": "categorize",
+        "method": 255
+    }
+]
 
 @apiErrorExample 失败响应
 HTTP/1.1 400 Bad Request
 
-分类不存在
+关键字不能为空
 */
 
 // search 关键字查询
 func (c *CategorizeController) search(ctx *gin.Context) {
-	// TODO 关键字查询
+	keyword := strings.TrimSpace(ctx.Query("keyword"))
+	if keyword == "" {
+		ErrIllegal(ctx, "关键字不能为空")
+		return
+	}
+	projectId := middle.ProjectID(ctx)
+	like := fmt.Sprintf("%%%s%%", keyword)
+
+	categorize := []entity.ApiCategorize{}
+	if err := repo.DB.Order("id").Find(&categorize, "project_id = ? AND name like ?", projectId, like).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	reqInfo := make([]dto.CategorizeListDto, 0)
+	for _, val := range categorize {
+		temp := dto.CategorizeListDto{}
+		temp.Transform(&val, &entity.ApiCase{}, "categorize")
+		reqInfo = append(reqInfo, temp)
+	}
+
+	cases := []entity.ApiCase{}
+	if err := repo.DB.Order("id").Find(&cases, "project_id = ? AND name like ?", projectId, like).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	for _, val := range cases {
+		temp := dto.CategorizeListDto{}
+		temp.Transform(&entity.ApiCategorize{}, &val, "case")
+		reqInfo = append(reqInfo, temp)
+	}
+	ctx.JSON(200, reqInfo)
 }
 
 /**
@@ -169,7 +208,7 @@ func (c *CategorizeController) search(ctx *gin.Context) {
 @apiName CategorizeList
 @apiGroup Categorize
 
-@apiPermission 项目成员
+@apiPermission 具有 project.read 权限的项目成员
 
 @apiParam {Integer} [parentId] 父分类ID。
 
@@ -207,13 +246,15 @@ HTTP/1.1 500
 // list 分类列表
 func (c *CategorizeController) list(ctx *gin.Context) {
 	id, _ := strconv.Atoi(ctx.Query("parentId"))
+	if id > 0 && !owned(ctx, repo.ResourceCategorize, id) {
+		return
+	}
 
-	claimsValue, _ := ctx.Get(middle.FlagClaims)
-	claims := claimsValue.(*jwt.Claims)
+	projectId := middle.ProjectID(ctx)
 
 	// 获取分类列表
 	categorize := []entity.ApiCategorize{}
-	if err := repo.DB.Find(&categorize, "parent_id = ? AND project_id = ?", id, claims.PID).Error; err != nil {
+	if err := repo.DB.Find(&categorize, "parent_id = ? AND project_id = ?", id, projectId).Error; err != nil {
 		ErrSys(ctx, err)
 		return
 	}
@@ -226,7 +267,7 @@ func (c *CategorizeController) list(ctx *gin.Context) {
 
 	// 获取用例列表
 	cases := []entity.ApiCase{}
-	if err := repo.DB.Find(&cases, "categorize_id = ?", id).Error; err != nil {
+	if err := repo.DB.Find(&cases, "categorize_id = ? AND project_id = ?", id, projectId).Error; err != nil {
 		ErrSys(ctx, err)
 		return
 	}
@@ -245,7 +286,7 @@ func (c *CategorizeController) list(ctx *gin.Context) {
 @apiName CategorizeEdit
 @apiGroup Categorize
 
-@apiPermission 项目负责人，创建者
+@apiPermission 具有 case.write 权限的项目成员
 
 @apiParam {Integer} id 分类ID。
 @apiParam {String} name 接口分类名称。
@@ -299,6 +340,9 @@ func (c *CategorizeController) edit(ctx *gin.Context) {
 		ErrIllegal(ctx, "分类名称不能为空")
 		return
 	}
+	if !owned(ctx, repo.ResourceCategorize, info.ID) {
+		return
+	}
 	reqInfo := entity.ApiCategorize{}
 	err := repo.DB.First(&reqInfo, "id = ?", info.ID).Error
 	if err == gorm.ErrRecordNotFound {
@@ -336,7 +380,7 @@ func (c *CategorizeController) edit(ctx *gin.Context) {
 @apiName CategorizeDelete
 @apiGroup Categorize
 
-@apiPermission 项目负责人、接口分类创建者
+@apiPermission 具有 case.write 权限的项目成员
 
 @apiParam {String} ids 待删除的ID序列，多个ID用","隔开，如：ids=1,99。
 
@@ -354,5 +398,20 @@ HTTP/1.1 500
 
 // delete 删除接口分类
 func (c *CategorizeController) delete(ctx *gin.Context) {
-	// TODO 删除接口分类
+	ids := ctx.Query("ids")
+	idArray := reuint.StrToIntSlice(ids)
+
+	applog.L(ctx, "删除接口分类", map[string]interface{}{
+		"ids": ids,
+	})
+	if len(idArray) == 0 {
+		return
+	}
+	if !owned(ctx, repo.ResourceCategorize, idArray...) {
+		return
+	}
+	if err := repo.CategorizeRepo.Delete(middle.ProjectID(ctx), idArray); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 }
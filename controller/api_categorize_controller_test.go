@@ -0,0 +1,100 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+)
+
+func TestCategorizeSearchDelete(t *testing.T) {
+	s := controllertest.NewServer(t)
+	var users []entity.User
+	for _, openid := range []string{"1001", "1002"} {
+		user := entity.User{Openid: openid, Name: "用户" + openid, Username: "u" + openid}
+		s.CreateUser(&user, "Passw0rd")
+		users = append(users, user)
+	}
+	project := entity.Project{Name: "分类项目", Manager: users[0].ID}
+	other := entity.Project{Name: "其他项目", Manager: users[0].ID}
+	for _, p := range []*entity.Project{&project, &other} {
+		if err := repo.DB.Create(p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, role := range []int{entity.RoleLeader, entity.RoleInterConnector} {
+		if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: users[i].ID, Role: role}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 支付接口 > 退款 > 退款接口 > 查询接口(用例)，以及同项目的其他分类与其他项目中同名的分类
+	pay := entity.ApiCategorize{ProjectId: project.ID, Name: "支付接口"}
+	refund := entity.ApiCategorize{ProjectId: project.ID, Name: "退款"}
+	leaf := entity.ApiCategorize{ProjectId: project.ID, Name: "退款接口"}
+	keep := entity.ApiCategorize{ProjectId: project.ID, Name: "用户"}
+	foreign := entity.ApiCategorize{ProjectId: other.ID, Name: "支付接口"}
+	for _, c := range []struct {
+		cat    *entity.ApiCategorize
+		parent *entity.ApiCategorize
+	}{{&pay, nil}, {&refund, &pay}, {&leaf, &refund}, {&keep, nil}, {&foreign, nil}} {
+		if c.parent != nil {
+			c.cat.ParentId = c.parent.ID
+		}
+		if err := repo.DB.Create(c.cat).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []entity.ApiCase{
+		{ProjectId: project.ID, CategorizeId: leaf.ID, Name: "查询接口", Method: 1},
+		{ProjectId: project.ID, CategorizeId: keep.ID, Name: "登录"},
+		{ProjectId: other.ID, CategorizeId: foreign.ID, Name: "查询接口"},
+	}
+	if err := repo.DB.Create(&cases).Error; err != nil {
+		t.Fatal(err)
+	}
+	leader := s.EnterProject(s.Login("1001", "Passw0rd"), project.ID)
+	member := s.EnterProject(s.Login("1002", "Passw0rd"), project.ID)
+
+	// 查询当前项目中名称包含关键字的分类与用例，分类在前
+	s.Expect(s.Do(http.MethodGet, "/api/categorize/search?keyword=%20", "", leader), http.StatusBadRequest, "关键字不能为空")
+	w := s.Do(http.MethodGet, "/api/categorize/search?keyword=接口", "", member)
+	var res []struct {
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Method int    `json:"method"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &res) != nil || len(res) != 3 {
+		t.Fatalf("search: %d %s", w.Code, w.Body.String())
+	}
+	for i, expect := range []struct {
+		id        int
+		typ, name string
+	}{{pay.ID, "categorize", "支付接口"}, {leaf.ID, "categorize", "退款接口"}, {cases[0].ID, "case", "查询接口"}} {
+		if res[i].ID != expect.id || res[i].Type != expect.typ || res[i].Name != expect.name {
+			t.Fatalf("search %d: %+v", i, res[i])
+		}
+	}
+	if res[2].Method != 1 {
+		t.Fatalf("search case method: %+v", res[2])
+	}
+
+	// 删除分类时同时删除所有子分类与用例，其他项目的分类不可删除
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/categorize/delete?ids=%d", pay.ID), "", member), http.StatusForbidden, "")
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/categorize/delete?ids=%d,%d", pay.ID, foreign.ID), "", leader), http.StatusForbidden, "")
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/categorize/delete?ids=%d", pay.ID), "", leader), http.StatusOK, "")
+	var ids []int
+	repo.DB.Model(&entity.ApiCategorize{}).Order("id").Pluck("id", &ids)
+	if fmt.Sprint(ids) != fmt.Sprint([]int{keep.ID, foreign.ID}) {
+		t.Fatalf("categorizes after delete: %v", ids)
+	}
+	repo.DB.Model(&entity.ApiCase{}).Order("id").Pluck("id", &ids)
+	if fmt.Sprint(ids) != fmt.Sprint([]int{cases[1].ID, cases[2].ID}) {
+		t.Fatalf("cases after delete: %v", ids)
+	}
+	// 已删除的分类不存在，同样响应403
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/categorize/delete?ids=%d", refund.ID), "", leader), http.StatusForbidden, "")
+}
@@ -4,27 +4,51 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/sm3"
 	"github.com/emmansun/gmsm/smx509"
 	"github.com/gin-gonic/gin"
-	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
-	"log"
 	"pdm/controller/dto"
+	"pdm/controller/middle"
+	"pdm/directory"
+	"pdm/logg/applog"
 	"pdm/repo"
 	"pdm/repo/entity"
 	"pdm/reuint"
 	"pdm/reuint/jwt"
+	"pdm/reuint/revocation"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// totpPendingTTL 口令验证通过后完成动态口令验证的时限
+	totpPendingTTL = 5 * time.Minute
+	// challengeTTL 服务端签发的随机数Rb的有效期
+	challengeTTL = 2 * time.Minute
+	// tokenABSkew 令牌TokenAB中的时间戳与服务端时间允许的最大偏差
+	tokenABSkew = 5 * time.Minute
+)
+
 // NewLoginController 创建登录控制器
-func NewLoginController(r gin.IRouter) *LoginController {
-	res := &LoginController{}
+// policy: 用户口令策略，口令过期的用户登录后需修改口令
+// issuer: 动态口令签发者名称
+// throttle: 登录失败限制策略
+// revoke: 管理员证书吊销状态检查
+func NewLoginController(r gin.IRouter, policy *reuint.PasswordPolicy, issuer string, throttle *repo.ThrottlePolicy, revoke *revocation.Checker) *LoginController {
+	res := &LoginController{policy: policy, issuer: issuer, throttle: repo.NewLoginThrottleRepository(throttle), revoke: revoke}
 	// 登录
 	r.POST("/login", res.login)
+	// 登录第二步，验证动态口令
+	r.POST("/login/totp", res.loginTotp)
+	// 登录时绑定动态口令
+	r.POST("/login/totpSetup", res.loginTotpSetup)
 	// 登出
 	r.DELETE("/logout", Authed, res.logout)
 	// 验证登录token
@@ -35,41 +59,131 @@ func NewLoginController(r gin.IRouter) *LoginController {
 	r.POST("/entityAuth", res.entityAuth)
 	// 证书绑定
 	r.POST("/certBinding", res.certBinding)
-	res.userCache = cache.New(cache.NoExpiration, 10*time.Minute)
-
-	// 初始化证书池
-	reuint.LoadCertsPool()
 	return res
 }
 
 // LoginController 登录控制器
 type LoginController struct {
-	userCache *cache.Cache // cache 判断用户口令错误次数
+	throttle *repo.LoginThrottleRepository // 登录失败记录
+	policy   *reuint.PasswordPolicy        // 用户口令策略
+	issuer   string                        // 动态口令签发者名称
+	revoke   *revocation.Checker           // 管理员证书吊销状态检查
 }
 
-// userName string 传入用户名
-// pwdAttempts 判断错误口令尝试次数，如果达到5次则锁定10分钟
-func (c *LoginController) pwdAttempts(userName string) {
-	var usrTry = 1
-	userTry, found := c.userCache.Get(userName)
-	if found {
-		usrTry = userTry.(int)
-		usrTry++
-	}
-	if usrTry >= 5 {
-		// 错误尝试达到5次，设置10分钟后清除缓存
-		c.userCache.Set(userName, usrTry, 10*time.Minute)
+// locked 判断账号或来源IP是否被锁定，锁定时返还提示信息
+// kind: 统计对象类型，见 entity.ThrottleKindUser 等
+// target: 用户ID、用户名或IP
+func (c *LoginController) locked(ctx *gin.Context, kind, target string) bool {
+	until, err := c.throttle.LockedUntil(kind, target)
+	if err != nil {
+		ErrSys(ctx, err)
+		return true
+	}
+	if until == nil {
+		return false
+	}
+	msg := "用户锁定"
+	if kind == entity.ThrottleKindIP {
+		msg = "登录失败次数过多"
+	}
+	if d := time.Until(*until); d.Minutes() > 1 {
+		msg = fmt.Sprintf("%s，请%.0f分钟后再尝试", msg, d.Minutes())
 	} else {
-		// 将缓存中的userName对应值更新
-		c.userCache.Set(userName, usrTry, cache.NoExpiration)
+		msg = fmt.Sprintf("%s，请%.0f秒后再尝试", msg, d.Seconds())
+	}
+	ErrIllegal(ctx, msg)
+	return true
+}
+
+// fail 记录登录失败，账号与来源IP分别计数，达到上限时锁定，失败与锁定均记录操作日志
+// kind、target: 账号的统计对象类型与用户ID或用户名
+// reason: 失败原因
+func (c *LoginController) fail(ctx *gin.Context, kind, target, reason string) error {
+	ip := ctx.ClientIP()
+	applog.A("登录失败", map[string]interface{}{"kind": kind, "target": target, "ip": ip, "reason": reason})
+	for _, item := range [][2]string{{kind, target}, {entity.ThrottleKindIP, ip}} {
+		record, err := c.throttle.Fail(item[0], item[1])
+		if err != nil {
+			return err
+		}
+		if record.Failures == 0 {
+			applog.A("登录锁定", map[string]interface{}{
+				"kind":        item[0],
+				"target":      item[1],
+				"ip":          ip,
+				"locks":       record.Locks,
+				"lockedUntil": entity.DateTime(*record.LockedUntil),
+			})
+		}
 	}
+	return nil
+}
+
+// rehash 重新计算用户的口令摘要，不影响口令修改时间与历史口令
+// 失败时仅记录日志，下次登录时重试。
+func (c *LoginController) rehash(usr *entity.User, password string) {
+	pwd, salt, err := reuint.GenPasswordSalt(password)
+	if err == nil {
+		err = repo.DB.Model(&entity.User{}).Where("id = ?", usr.ID).
+			Updates(map[string]interface{}{"password": pwd, "salt": salt}).Error
+	}
+	if err != nil {
+		zap.L().Warn("口令摘要升级失败", zap.Int("userId", usr.ID), zap.Error(err))
+	}
+}
+
+// directoryLogin 使用目录口令认证，认证通过后按目录属性创建或更新用户
+// 目录中不存在、口令错误以及已在系统中删除的用户与本地口令错误同样计数与锁定。
+// userId: 本地已存在的目录用户ID，不存在时为0，按用户名计数
+// return: 用户, 是否认证通过，未通过时已响应错误
+func (c *LoginController) directoryLogin(ctx *gin.Context, d *directory.Directory, username, password string, userId int) (*entity.User, bool) {
+	kind, target := entity.ThrottleKindUser, strconv.Itoa(userId)
+	if userId == 0 {
+		name := []rune(username)
+		if len(name) > 128 {
+			name = name[:128]
+		}
+		kind, target = entity.ThrottleKindUsername, string(name)
+	}
+	if c.locked(ctx, kind, target) {
+		return nil, false
+	}
+	usr, err := d.Login(ctx.Request.Context(), username, password)
+	if err == nil {
+		return usr, true
+	}
+	reason := ""
+	switch err {
+	case directory.ErrNotFound:
+		reason = "目录中不存在该用户"
+	case directory.ErrInvalidCredentials:
+		reason = "目录口令错误"
+	case directory.ErrDeleted:
+		reason = "用户已删除"
+	default:
+		ErrNormal(ctx, "目录服务不可用，请稍后重试", err)
+		return nil, false
+	}
+	if err = c.fail(ctx, kind, target, reason); err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	ErrIllegal(ctx, "用户名或口令错误")
+	return nil, false
 }
 
 /**
 @api {POST} /api/login 登录
 @apiDescription 用户登录，登录后在cookies加入token字段，并用户信息和类型。
-对于单一用户口令错误次数不能超过5次，超过则锁定不允许登录10分钟。
-注意：除了系统内部错误，以及超过尝试次数外，其他用户名或口令错误都返还固定错误“用户名或口令错误”。
+同一账号连续登录失败次数（缺省5次）或同一IP登录失败次数（缺省20次）达到上限后锁定（缺省10分钟），
+锁定结束后再次达到上限时锁定时长加倍，见配置 throttle。登录失败与锁定均记录操作日志，管理员可以通过 解除登录锁定 接口提前解锁。
+新创建或被管理员重置口令的用户首次登录，以及口令超过有效期的用户登录时，返回的 mustChgPwd 为true，
+此时token仅能调用修改口令、获取口令策略与登出接口，修改口令后恢复正常。
+已启用动态口令或策略要求使用动态口令的用户，口令验证通过后不设置token，而是返回登录凭证（5分钟内有效），
+需使用登录凭证调用 验证动态口令 接口完成登录，未绑定动态口令的用户需先调用 登录时绑定动态口令 接口。
+启用目录服务认证（见配置 ldap）时，目录用户以及本地不存在的用户名使用目录口令认证，认证通过后按目录属性创建或更新用户，
+并按组映射加入项目；目录用户不受口令有效期约束，mustChgPwd 始终为false。本地用户仍使用本地口令登录。
+注意：除了系统内部错误、目录服务不可用，以及超过尝试次数外，其他用户名或口令错误都返还固定错误“用户名或口令错误”。
 @apiName AuthLogin
 @apiGroup Auth
 
@@ -84,11 +198,12 @@ func (c *LoginController) pwdAttempts(userName string) {
 @apiSuccess {String} openid 工号
 @apiSuccess {String} name 姓名
 @apiSuccess {Integer} exp 会话过期时间，单位Unix时间戳毫秒（ms）
+@apiSuccess {Boolean} mustChgPwd 是否需修改口令
 
 @apiParamExample {json} 请求示例
 {
     "username": "22001",
-    "password": "Gm123qwe"
+    "password": "Xk7#pQ2mWz9a"
 }
 
 @apiSuccessExample 成功响应
@@ -99,7 +214,18 @@ HTTP/1.1 200 OK
     "id": 1,
 	"openid":22001,
     "name": "张三",
-    "exp": 1668523424095
+    "exp": 1668523424095,
+    "mustChgPwd": false
+}
+
+@apiSuccessExample 需验证动态口令
+HTTP/1.1 200 OK
+
+{
+    "totpRequired": true,
+    "enrolled": true,
+    "pendingToken": "eyJhbGciOiJITUFDLVNNMyIsInR5cCI6IkpXVCJ9...",
+    "exp": 1668495224095
 }
 
 @apiErrorExample 失败响应1
@@ -111,6 +237,11 @@ HTTP/1.1 500
 HTTP/1.1 400
 
 用户名或口令错误
+
+@apiErrorExample 失败响应3
+HTTP/1.1 406
+
+目录服务不可用，请稍后重试
 */
 
 // login 认证登录
@@ -128,34 +259,60 @@ func (c *LoginController) login(ctx *gin.Context) {
 		ErrIllegal(ctx, "请输入用户名")
 		return
 	}
-	// 判断用户是否被锁定
-	// userTry：尝试次数， date：锁定时间， found：是否找到值
-	userTry, date, found := c.userCache.GetWithExpiration(info.Username)
-	if found && userTry.(int) >= 5 {
-		if date.Sub(time.Now()).Minutes() > 1 {
-			ErrIllegal(ctx, fmt.Sprintf("用户锁定，请%.0f分钟后再尝试", date.Sub(time.Now()).Minutes()))
-		} else {
-			ErrIllegal(ctx, fmt.Sprintf("用户锁定，请%.0f秒后再尝试", date.Sub(time.Now()).Seconds()))
-		}
+	// 判断来源IP是否被锁定
+	if c.locked(ctx, entity.ThrottleKindIP, ctx.ClientIP()) {
 		return
 	}
 	// 判断是否为用户
 	usr := &entity.User{}
 	err = repo.DB.First(usr, "(openid = ? OR phone = ? OR email = ?)AND is_delete = ?", info.Username, info.Username, info.Username, 0).Error
-	// 用户表找到记录，判断为用户
-	if err == nil {
+	// 目录用户以及本地不存在的用户名，启用目录服务认证时使用目录口令认证
+	if d := directory.Default(); d != nil && (err == gorm.ErrRecordNotFound || (err == nil && usr.Source == entity.UserSourceLDAP)) {
+		var ok bool
+		if usr, ok = c.directoryLogin(ctx, d, info.Username, info.Password.String(), usr.ID); !ok {
+			return
+		}
+		err = nil
+		userSub = usr.ID
+		reqInfo.Name = usr.Name
+		reqInfo.Openid = usr.Openid
+	} else if err == nil {
+		// 用户表找到记录，判断为用户
+		// 判断用户是否被锁定
+		account := strconv.Itoa(usr.ID)
+		if c.locked(ctx, entity.ThrottleKindUser, account) {
+			return
+		}
 		if reuint.VerifyPasswordSalt(info.Password.String(), usr.Password.String(), usr.Salt) == false {
+			// 记录错误口令尝试次数，达到上限则锁定
+			if err = c.fail(ctx, entity.ThrottleKindUser, account, "口令错误"); err != nil {
+				ErrSys(ctx, err)
+				return
+			}
 			ErrIllegal(ctx, "用户名或口令错误")
-			// 判断错误口令尝试次数，如果达到5次则锁定10分钟
-			c.pwdAttempts(info.Username)
 			return
 		}
 		userSub = usr.ID
 		reqInfo.Name = usr.Name
 		reqInfo.Openid = usr.Openid
+		// 早期版本格式或迭代次数不足的口令摘要，在验证通过后使用当前算法重新计算
+		if reuint.NeedsRehash(usr.Password.String()) {
+			c.rehash(usr, info.Password.String())
+		}
 	}
-	// 用户表未找到记录，抛出异常
+	// 用户表未找到记录，与口令错误同样计数与锁定，避免通过是否锁定判断用户名是否存在
 	if err == gorm.ErrRecordNotFound {
+		name := []rune(info.Username)
+		if len(name) > 128 {
+			name = name[:128]
+		}
+		if c.locked(ctx, entity.ThrottleKindUsername, string(name)) {
+			return
+		}
+		if err = c.fail(ctx, entity.ThrottleKindUsername, string(name), "用户不存在"); err != nil {
+			ErrSys(ctx, err)
+			return
+		}
 		ErrIllegal(ctx, "用户名或口令错误")
 		return
 	}
@@ -169,18 +326,256 @@ func (c *LoginController) login(ctx *gin.Context) {
 		ErrIllegal(ctx, "用户名或口令错误")
 		return
 	}
-	c.userCache.Delete(info.Username)
 	claims := jwt.Claims{Type: "user", Sub: userSub, Exp: time.Now().Add(8 * time.Hour).UnixMilli()}
-	token := tokenManager.GenToken(&claims)
+	// 首次登录或口令过期需修改口令，此时token仅能用于修改口令
+	// 目录用户的口令由目录服务管理，不受口令策略约束
+	claims.MustChgPwd = usr.Source != entity.UserSourceLDAP &&
+		(usr.MustChgPwd == 1 || c.policy.Expired(usr.PwdChangedAt, time.Now()))
+
+	// 已启用动态口令或策略要求使用动态口令的用户，需在第二步验证动态口令后完成登录
+	required, err := totpRequired(usr)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if required {
+		pending, err := tokenManager.IssuePending(ctx, claims, totpPendingTTL)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		ctx.JSON(200, dto.LoginPendingDto{
+			TotpRequired: true,
+			Enrolled:     usr.TotpEnabled == 1,
+			PendingToken: pending,
+			Exp:          time.Now().Add(totpPendingTTL).UnixMilli(),
+		})
+		return
+	}
+
+	// 完成登录后清除账号的失败记录，需验证动态口令的用户在第二步完成后清除
+	if err = c.throttle.Succeed(entity.ThrottleKindUser, strconv.Itoa(userSub)); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	// 创建会话，设置头部 Cookies 有效时间为8小时
+	if _, err = tokenManager.Issue(ctx, &claims); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	reqInfo.Transform(&claims)
+	ctx.JSON(200, reqInfo)
+}
+
+// pendingUser 验证登录凭证，返还待完成登录的用户信息与用户
+func (c *LoginController) pendingUser(ctx *gin.Context, pendingToken string) (*jwt.Claims, *entity.User, bool) {
+	claims, err := tokenManager.ParsePending(pendingToken)
+	if errors.Is(err, middle.ErrInvalidToken) {
+		ErrIllegal(ctx, "登录已过期，请重新登录")
+		return nil, nil, false
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return nil, nil, false
+	}
+	usr := &entity.User{}
+	err = repo.DB.First(usr, "id = ? AND is_delete = 0", claims.Sub).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "登录已过期，请重新登录")
+		return nil, nil, false
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return nil, nil, false
+	}
+	return claims, usr, true
+}
+
+/**
+@api {POST} /api/login/totp 验证动态口令
+@apiDescription 登录第二步，使用第一步返回的登录凭证与动态口令完成登录，登录后在cookies加入token字段。
+未绑定动态口令的用户需先调用 登录时绑定动态口令 接口，使用身份验证器App扫描后在此验证动态口令，
+验证通过即完成绑定，同时返回10个恢复码（仅返回一次）。
+无法使用身份验证器时可以使用恢复码代替动态口令，每个恢复码仅能使用一次。
+动态口令错误与口令错误一同计入账号的登录失败次数，达到上限后锁定。
+@apiName AuthLoginTotp
+@apiGroup Auth
+
+@apiPermission 匿名
+
+@apiParam {String} pendingToken 第一步返回的登录凭证，登录时绑定动态口令后为绑定接口返回的凭证，凭证仅能成功使用一次。
+@apiParam {String} [code] 动态口令。
+@apiParam {String} [recoveryCode] 恢复码，无法使用身份验证器时代替动态口令。
+
+@apiParamExample {json} 请求示例
+{
+    "pendingToken": "eyJhbGciOiJITUFDLVNNMyIsInR5cCI6IkpXVCJ9...",
+    "code": "287082"
+}
+
+@apiSuccess {String="user"} type 用户类型
+@apiSuccess {Integer} id 用户记录ID
+@apiSuccess {String} openid 工号
+@apiSuccess {String} name 姓名
+@apiSuccess {Integer} exp 会话过期时间，单位Unix时间戳毫秒（ms）
+@apiSuccess {Boolean} mustChgPwd 是否需修改口令
+@apiSuccess {String[]} [recoveryCodes] 登录时完成绑定生成的恢复码
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+	"type": "user",
+    "id": 1,
+	"openid": "22001",
+    "name": "张三",
+    "exp": 1668523424095,
+    "mustChgPwd": false
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+动态口令错误
+*/
+
+// loginTotp 登录第二步，验证动态口令
+func (c *LoginController) loginTotp(ctx *gin.Context) {
+	var info dto.LoginTotpDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	pending, usr, ok := c.pendingUser(ctx, info.PendingToken)
+	if !ok {
+		return
+	}
+	account := strconv.Itoa(usr.ID)
+	if c.locked(ctx, entity.ThrottleKindIP, ctx.ClientIP()) || c.locked(ctx, entity.ThrottleKindUser, account) {
+		return
+	}
+
+	var err error
+	var codes []string
+	totpRepo := repo.NewTotpRepository()
+	switch {
+	case usr.TotpEnabled == 1 && info.RecoveryCode != "":
+		ok, err = totpRepo.UseRecoveryCode(usr.ID, info.RecoveryCode)
+	case usr.TotpEnabled == 1:
+		ok, err = verifyTotpCode(usr, info.Code)
+	case usr.TotpSecret != "":
+		// 登录时完成绑定
+		var step int64
+		if step, ok = reuint.VerifyTotp(usr.TotpSecret, info.Code, time.Now(), 0); ok {
+			codes, err = totpRepo.Enable(usr.ID, step)
+		}
+	default:
+		ErrIllegal(ctx, "请先绑定动态口令")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if !ok {
+		if err = c.fail(ctx, entity.ThrottleKindUser, account, "动态口令错误"); err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		ErrIllegal(ctx, "动态口令错误")
+		return
+	}
+	if err = c.throttle.Succeed(entity.ThrottleKindUser, account); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	// 登录凭证仅能使用一次
+	if err = tokenManager.RevokePending(pending); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+
+	claims := jwt.Claims{Type: "user", Sub: usr.ID, Exp: time.Now().Add(8 * time.Hour).UnixMilli(), MustChgPwd: pending.MustChgPwd}
+	if _, err = tokenManager.Issue(ctx, &claims); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	reqInfo := dto.LoginToDto{Name: usr.Name, Openid: usr.Openid, RecoveryCodes: codes}
 	reqInfo.Transform(&claims)
-	// 设置头部 Cookies 有效时间为8小时
-	ctx.SetCookie("token", token, 8*3600, "", "", false, true)
 	ctx.JSON(200, reqInfo)
 }
 
+/**
+@api {POST} /api/login/totpSetup 登录时绑定动态口令
+@apiDescription 策略要求使用动态口令但尚未绑定的用户，在登录第一步后调用该接口生成动态口令密钥，
+前端将返回的 uri 生成二维码供身份验证器App扫描，然后调用 验证动态口令 接口完成绑定与登录。
+@apiName AuthLoginTotpSetup
+@apiGroup Auth
+
+@apiPermission 匿名
+
+@apiParam {String} pendingToken 第一步返回的登录凭证。
+
+@apiParamExample {json} 请求示例
+{
+    "pendingToken": "eyJhbGciOiJITUFDLVNNMyIsInR5cCI6IkpXVCJ9..."
+}
+
+@apiSuccess {String} secret 动态口令密钥Base32，无法扫码时手动输入。
+@apiSuccess {String} uri 配置URI。
+@apiSuccess {String} pendingToken 新的登录凭证，原登录凭证作废，验证动态口令时使用该凭证。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "secret": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+    "uri": "otpauth://totp/PDM:22001?algorithm=SHA1&digits=6&issuer=PDM&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+    "pendingToken": "eyJhbGciOiJITUFDLVNNMyIsInR5cCI6IkpXVCJ9..."
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+已启用动态口令
+*/
+
+// loginTotpSetup 登录时绑定动态口令
+func (c *LoginController) loginTotpSetup(ctx *gin.Context) {
+	var info dto.LoginTotpDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	pending, usr, ok := c.pendingUser(ctx, info.PendingToken)
+	if !ok {
+		return
+	}
+	res, err := totpSetup(usr, c.issuer)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if res == nil {
+		ErrIllegal(ctx, "已启用动态口令")
+		return
+	}
+	// 原登录凭证作废，签发有效期不变的新凭证用于完成绑定
+	if err = tokenManager.RevokePending(pending); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if res.PendingToken, err = tokenManager.IssuePending(ctx, *pending, time.Until(time.UnixMilli(pending.Exp))); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, res)
+}
+
 /**
 @api {DELETE} /api/logout 登出
-@apiDescription 退出登录，无论登出操作是否成功均返回200状态码无任何信息。
+@apiDescription 退出登录，撤销当前会话并清除Cookie中的token，撤销后该token无法再使用。
+除系统内部错误外均返回200状态码无任何信息。
 @apiName AuthLogout
 @apiGroup Auth
 
@@ -198,7 +593,12 @@ HTTP/1.1 200 OK
 
 // logout 登出
 func (c *LoginController) logout(ctx *gin.Context) {
-	ctx.SetCookie("token", "", -1, "", "", false, true)
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	if err := tokenManager.Revoke(ctx, claims); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 }
 
 /**
@@ -214,6 +614,7 @@ func (c *LoginController) logout(ctx *gin.Context) {
 @apiSuccess {String} openid 工号
 @apiSuccess {String} name 姓名
 @apiSuccess {Integer} exp 会话过期时间，单位Unix时间戳毫秒（ms）
+@apiSuccess {Boolean} mustChgPwd 是否需修改口令
 
 @apiParamExample {HTTP} 请求示例
 GET /api/check
@@ -223,7 +624,8 @@ GET /api/check
     "id": 1,
 	"openid":22001,
     "name": "张三",
-    "exp": 1668523424095
+    "exp": 1668523424095,
+    "mustChgPwd": false
 }
 
 @apiSuccessExample 成功响应
@@ -243,11 +645,15 @@ func (c *LoginController) check(ctx *gin.Context) {
 	if token == "" {
 		return
 	}
-	claims, err := reuint.VerifyToken(token)
-	if err != nil {
+	claims, err := tokenManager.Parse(token)
+	if errors.Is(err, middle.ErrInvalidToken) {
 		ErrForbidden(ctx, "权限错误")
 		return
 	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 	user := entity.User{}
 	if err = repo.DB.First(&user, "id = ? AND is_delete = 0", claims.Sub).Error; err != nil {
 		ErrSys(ctx, err)
@@ -262,7 +668,8 @@ func (c *LoginController) check(ctx *gin.Context) {
 
 /**
 @api {GET} /api/random 获取随机数
-@apiDescription 获取32字节随机数。
+@apiDescription 获取服务端签发的32字节随机数Rb，用于 实体鉴别 与 证书绑定。
+随机数2分钟内有效，仅能使用一次，无论认证是否通过，使用后都需重新获取。
 @apiName AuthRandom
 @apiGroup Auth
 
@@ -283,7 +690,7 @@ HTTP/1.1 500
 系统内部错误
 */
 
-// random 获取随机数
+// random 签发随机数Rb，服务端仅保存其摘要
 func (c *LoginController) random(ctx *gin.Context) {
 	buf := make([]byte, 32)
 	n, err := rand.Reader.Read(buf)
@@ -291,23 +698,124 @@ func (c *LoginController) random(ctx *gin.Context) {
 		ErrSys(ctx, err)
 		return
 	}
+	sum := sm3.Sum(buf)
+	err = repo.NewAuthChallengeRepository().Create(&entity.AuthChallenge{
+		ID:        hex.EncodeToString(sum[:]),
+		ExpiresAt: time.Now().Add(challengeTTL),
+	})
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 	ctx.String(200, base64.StdEncoding.EncodeToString(buf))
 }
 
+// verifyCert 验证证书链与吊销状态，未通过时响应错误
+// 证书需由根证书目录中的根证书签发，且证书链中的证书均未被吊销，无法确认吊销状态时按配置 revocation.mode 处理。
+func (c *LoginController) verifyCert(ctx *gin.Context, cert *smx509.Certificate) bool {
+	roots, intermediates := reuint.LoadCertsPool()
+	chains, err := cert.Verify(smx509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny}})
+	if err != nil {
+		ErrIllegal(ctx, "证书不可用")
+		return false
+	}
+	// 证书链中除信任锚外的每个证书均以其上级证书检查吊销状态，信任锚本身不检查
+	chain := chains[0]
+	for i := 0; i < len(chain)-1; i++ {
+		if err = c.revoke.Verify(ctx.Request.Context(), chain[i], chain[i+1]); err == nil {
+			continue
+		}
+		applog.A("证书吊销检查未通过", map[string]interface{}{
+			"subject": chain[i].Subject.String(),
+			"serial":  chain[i].SerialNumber.Text(16),
+			"ip":      ctx.ClientIP(),
+			"reason":  err.Error(),
+		})
+		if errors.Is(err, revocation.ErrRevoked) {
+			ErrIllegal(ctx, "证书已吊销")
+		} else {
+			ErrIllegal(ctx, "无法确认证书状态")
+		}
+		return false
+	}
+	return true
+}
+
+// verifyTokenAB 校验令牌TokenAB（GM/T 0003 两次传递单向鉴别）
+// 依次消耗服务端签发的随机数Rb、校验可区分标识符B与时间戳TA，最后以证书公钥验证签名，
+// 签名原文为 Ra || Rb || B || TA，其中TA为Unix时间戳毫秒的十进制字符串。
+// 随机数Rb在校验开始时即被消耗，校验不通过时同样失效。
+// return: 是否通过, 系统内部错误
+func (c *LoginController) verifyTokenAB(cert *smx509.Certificate, ra, rb, b string, ta int64, signature string) (bool, error) {
+	msg, sig, err := c.parseTokenAB(ra, rb, b, ta, signature)
+	if err != nil || msg == nil {
+		return false, err
+	}
+	return verifySM2(cert, msg, sig), nil
+}
+
+// parseTokenAB 消耗随机数Rb，校验可区分标识符B与时间戳TA，返还签名原文与签名值
+// return: 签名原文（令牌无效时为空）, 签名值, 系统内部错误
+func (c *LoginController) parseTokenAB(ra, rb, b string, ta int64, signature string) ([]byte, []byte, error) {
+	rB, err := base64.StdEncoding.DecodeString(rb)
+	if err != nil || len(rB) != 32 {
+		return nil, nil, nil
+	}
+	sum := sm3.Sum(rB)
+	ok, err := repo.NewAuthChallengeRepository().Consume(hex.EncodeToString(sum[:]))
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+	if b != entity.B {
+		return nil, nil, nil
+	}
+	if d := time.Since(time.UnixMilli(ta)); d > tokenABSkew || d < -tokenABSkew {
+		return nil, nil, nil
+	}
+	rA, err := base64.StdEncoding.DecodeString(ra)
+	if err != nil || len(rA) != 32 {
+		return nil, nil, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, nil, nil
+	}
+	// 签名原文
+	msg := make([]byte, 0, len(rA)+len(rB)+len(b)+20)
+	msg = append(append(append(msg, rA...), rB...), b...)
+	msg = strconv.AppendInt(msg, ta, 10)
+	return msg, sig, nil
+}
+
+// verifySM2 使用证书公钥验证SM2签名
+func verifySM2(cert *smx509.Certificate, msg, sig []byte) bool {
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	return sm2.VerifyASN1WithSM2(pub, nil, msg, sig)
+}
+
 /**
 @api {POST} /api/entityAuth 实体鉴别
 @apiDescription 管理员验证登录，登录后在cookies加入token字段，并携带管理员信息和类型。
-注意：除了系统内部错误外，其他都返还固定错误“身份认证失败”。
+采用GM/T 0003两次传递单向鉴别：客户端先通过 获取随机数 接口获取随机数Rb，生成32字节随机数Ra，
+使用证书私钥对 Ra || Rb || B || TA 进行SM2签名，其中B为可区分标识符“pdm”，TA为当前Unix时间戳毫秒的十进制字符串，
+与服务端时间的偏差不能超过5分钟。随机数Rb仅能使用一次，重放的令牌无法通过验证。
+证书需由根证书签发且未被吊销，吊销状态依据根证书目录中的吊销列表或证书中的OCSP服务，见配置 revocation。
+账号可绑定多个证书，使用其中任意一个有效的证书签名即可登录，已禁用的账号无法登录。
+注意：除了系统内部错误、证书不可用、证书已吊销与无法确认证书状态外，其他都返还固定错误“身份认证失败”。
 @apiName AuthEntityAuth
 @apiGroup Auth
 
 @apiPermission 匿名
 
-@apiParam {String} RA 随机数RA base64编码
-@apiParam {String} RB 随机数RB base64编码
+@apiParam {String} Ra 随机数Ra base64编码，32字节
+@apiParam {String} Rb 服务端签发的随机数Rb base64编码
 @apiParam {String} B 可区分标识符B
+@apiParam {Integer} Ta 时间戳TA，单位Unix时间戳毫秒（ms）
 @apiParam {String} text3 tokenAB所携带自定义文本，这里指用户名
-@apiParam {String} signature 签名值 base64编码
+@apiParam {String} signature 签名值 base64编码，对 Ra || Rb || B || TA 的SM2签名（ASN.1）
 
 
 @apiSuccess {String="admin","audit"} type 用户类型
@@ -325,7 +833,8 @@ func (c *LoginController) random(ctx *gin.Context) {
 {
     "Ra": "c+20947+I0eDR8Ce6uj7ciPH+9WimuPlSZBC5YgozA0=",
     "Rb": "cGn7JKJzxoFPDsV0N/5n2/OhAHo7rMDkF+2EKxF2/+4=",
-    "B": "dpm",
+    "B": "pdm",
+    "Ta": 1668495224095,
     "text3": "admin",
     "signature": "MEYCIQD5VxRH+jEpPOjfBD2DqCJKirNOCLlNNkZkpPfHa+EwtQIhAMRlQI1c4NYuWJCyphtwI6uM2W8JAiB+L2NffhSaSHtH"
 }
@@ -350,6 +859,11 @@ HTTP/1.1 500
 HTTP/1.1 400
 
 身份认证失败
+
+@apiErrorExample 失败响应3
+HTTP/1.1 400
+
+证书已吊销
 */
 
 // entityAuth 验证
@@ -360,101 +874,113 @@ func (c *LoginController) entityAuth(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数异常，无法解析")
 		return
 	}
-	// 2. 从数据库里获得证书
-	var info entity.Admin
-	err := repo.DB.First(&info, "username = ?", tokenAB.Text3).Error
-	if err == gorm.ErrRecordNotFound {
-		ErrIllegal(ctx, "用户不存在")
-		return
-	}
+	// 2. 从数据库里获得绑定的证书
+	info, err := repo.NewAdminRepository().FindByUsername(tokenAB.Text3)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	if len(info.Cert) <= 0 {
-		ErrIllegal(ctx, "未绑定证书")
+	if info == nil {
+		ErrIllegal(ctx, "用户不存在")
 		return
 	}
-	// 3. 解析证书，验证证书可用
-	cert, err := reuint.ParseCert(info.Cert)
-	if err != nil {
-		ErrSys(ctx, err)
+	if info.Disabled == 1 {
+		ErrIllegal(ctx, "账号已禁用")
 		return
 	}
-	// 证书链验证可用性
-	_, err = cert.Verify(smx509.VerifyOptions{Roots: reuint.CertPool, KeyUsages: []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny}})
+	certs, err := repo.NewAdminRepository().Certs(info.ID)
 	if err != nil {
-		ErrIllegal(ctx, "证书不可用")
+		ErrSys(ctx, err)
 		return
 	}
-
-	// 4. 验签，对比随机数是否相同，检验Token中的标识符B是否等于B的可区分标识符
-	rA, err := base64.StdEncoding.DecodeString(tokenAB.Ra)
-	if err != nil {
-		ErrSys(ctx, err)
+	if len(certs) == 0 {
+		ErrIllegal(ctx, "未绑定证书")
 		return
 	}
-	rB, err := base64.StdEncoding.DecodeString(tokenAB.Rb)
+	// 3. 校验随机数Rb、可区分标识符B与时间戳
+	msg, sig, err := c.parseTokenAB(tokenAB.Ra, tokenAB.Rb, tokenAB.B, tokenAB.Ta, tokenAB.Signature)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	// 签名原文
-	msg := append(rA, rB...)
-	// 解析签名值
-	sig, err := base64.StdEncoding.DecodeString(tokenAB.Signature)
-	if err != nil {
-		ErrSys(ctx, err)
+	if msg == nil {
+		ErrIllegal(ctx, "身份认证失败")
 		return
 	}
-	// 验签
-	verify := sm2.VerifyASN1WithSM2(cert.PublicKey.(*ecdsa.PublicKey), nil, msg, sig)
-	log.Println("验签结果 = ", verify)
-
-	// 验签不通过，或tokenAB中的标识符B不等于B的可区分标识符
-	if !verify || tokenAB.B != entity.B {
+	// 4. 在绑定的证书中查找签名证书，验签
+	var bound *entity.AdminCert
+	var cert *smx509.Certificate
+	for i := range certs {
+		item, err := reuint.ParseCert(certs[i].Cert)
+		if err != nil || item == nil {
+			continue
+		}
+		if verifySM2(item, msg, sig) {
+			bound, cert = &certs[i], item
+			break
+		}
+	}
+	if cert == nil {
 		ErrIllegal(ctx, "身份认证失败")
 		return
 	}
+	// 证书链与吊销状态验证可用性
+	if !c.verifyCert(ctx, cert) {
+		return
+	}
 	// 5. 检验成功，允许登录
+	if err = repo.NewAdminRepository().TouchCert(bound.ID); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 	reqInfo := dto.AdminLoginDto{}
 	role := ""
-	if info.Role == 0 {
+	if info.Role == entity.AdminRoleAdmin {
 		role = "admin"
-	} else if info.Role == 1 {
+	} else if info.Role == entity.AdminRoleAudit {
 		role = "audit"
 	}
 	claims := jwt.Claims{Type: role, Sub: info.ID, Exp: time.Now().Add(8 * time.Hour).UnixMilli()}
-	token := tokenManager.GenToken(&claims)
-	reqInfo.Transform(&claims, &info)
-	// 设置头部 Cookies 有效时间为8小时
-	ctx.SetCookie("token", token, 8*3600, "", "", false, true)
+	// 创建会话，设置头部 Cookies 有效时间为8小时
+	if _, err = tokenManager.Issue(ctx, &claims); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	reqInfo.Transform(&claims, info)
 	ctx.JSON(200, reqInfo)
 }
 
 /**
 @api {POST} /api/certBinding 证书绑定
-@apiDescription 将证书与用户绑定，若用户以绑定证书，则重新绑定
+@apiDescription 使用一次性证书绑定码为管理员或审计员绑定证书，每个账号可绑定多个证书，使用其中任意一个登录。
+绑定码在创建账号时生成，或由其他管理员为该账号重新生成（见 管理员-生成证书绑定码），24小时内有效，绑定成功后失效。
+首个管理员的绑定码通过命令行 pdm admin bindcode 用户名 生成。
+令牌的生成与 实体鉴别 相同，需使用待绑定证书的私钥签名，随机数Rb仅能使用一次。
+证书需由根证书签发且未被吊销，同一证书只能绑定一个账号。
 @apiName AuthCertBinding
 @apiGroup Auth
 
 @apiPermission 匿名
 
 @apiParam {String} cert 证书
-@apiParam {String} RA 随机数RA base64编码
-@apiParam {String} RB 随机数RB base64编码
+@apiParam {String} code 证书绑定码
+@apiParam {String} Ra 随机数Ra base64编码，32字节
+@apiParam {String} Rb 服务端签发的随机数Rb base64编码
 @apiParam {String} B 可区分标识符B
+@apiParam {Integer} Ta 时间戳TA，单位Unix时间戳毫秒（ms）
 @apiParam {String} text3 tokenAB所携带自定义文本，这里指用户名
-@apiParam {String} signature 签名值 base64编码
+@apiParam {String} signature 签名值 base64编码，对 Ra || Rb || B || TA 的SM2签名（ASN.1）
 
 
 
 @apiParamExample {json} 请求示例
 {
     "cert": "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUNBakNDQWFlZ0F3SUJBZ0lJQXM2M3g2N1BaNzR3Q2dZSUtvRWN6MVVCZzNVd1FqRUxNQWtHQTFVRUJoTUMKUTA0eER6QU5CZ05WQkFnTUJ1YTFtZWF4bnpFUE1BMEdBMVVFQnd3RzVwMnQ1YmVlTVJFd0R3WURWUVFLREFqbQp0WXZvcjVWRFFUQWVGdzB5TXpBeE1UQXdOek0zTkRWYUZ3MHlOREF4TVRBd056TTNORFZhTUdreER6QU5CZ05WCkJBWU1CdVM0cmVXYnZURVBNQTBHQTFVRUNBd0c1cldaNXJHZk1ROHdEUVlEVlFRSERBYm1uYTNsdDU0eER6QU4KQmdOVkJBb01CdWlFaWVpdXJ6RVBNQTBHQTFVRUN3d0c1NkNVNVkrUk1SSXdFQVlEVlFRRERBbDNiSG5tdFl2bwpyNVV3V1RBVEJnY3Foa2pPUFFJQkJnZ3FnUnpQVlFHQ0xRTkNBQVJyeXQvbk9ZeXNVRmdRRWZ4WVpGUVRUcDY5Cjg2YnIrWTVYRDhrb3U2MnllcVFJM1ZidFMxcXluKzgyWkE4dFVJOFBBWlkyTEp2SWJKMmROZzVwT0F0Z28yQXcKWGpBT0JnTlZIUThCQWY4RUJBTUNCc0F3REFZRFZSMFRBUUgvQkFJd0FEQWRCZ05WSFE0RUZnUVU4SXFoYVl0cwp6bWFyWFVueXhoSFA2QXE3aGRZd0h3WURWUjBqQkJnd0ZvQVVOcFBqRk9kRkNmclY3K292RWkzVG9aWTh3cVF3CkNnWUlLb0VjejFVQmczVURTUUF3UmdJaEFNY0tQa09pTTg4YjhoZWY4ZHlPOHdiMGtpeDFMYXVxc1owOUE4WmMKVUFVMUFpRUEyeFdYMURwUE55cDVtVkdqY25LaDZDT2JpOXF5Q0tNbFRlYUgzdWhpTHJvPQotLS0tLUVORCBDRVJUSUZJQ0FURS0tLS0tCgo=",
+    "code": "abcd-efgh-jkmn-pqrs",
     "Ra": "c+20947+I0eDR8Ce6uj7ciPH+9WimuPlSZBC5YgozA0=",
     "Rb": "cGn7JKJzxoFPDsV0N/5n2/OhAHo7rMDkF+2EKxF2/+4=",
-    "B": "dpm",
+    "B": "pdm",
+    "Ta": 1668495224095,
     "text3": "admin",
     "signature": "MEYCIQD5VxRH+jEpPOjfBD2DqCJKirNOCLlNNkZkpPfHa+EwtQIhAMRlQI1c4NYuWJCyphtwI6uM2W8JAiB+L2NffhSaSHtH"
 }
@@ -473,6 +999,11 @@ HTTP/1.1 500
 HTTP/1.1 400
 
 证书绑定失败
+
+@apiErrorExample 失败响应3
+HTTP/1.1 400
+
+绑定码无效
 */
 
 // certBinding 证书绑定
@@ -483,67 +1014,55 @@ func (c *LoginController) certBinding(ctx *gin.Context) {
 		return
 	}
 
-	var info entity.Admin
-	err := repo.DB.First(&info, "username = ?", params.Text3).Error
-	if err == gorm.ErrRecordNotFound {
-		ErrIllegal(ctx, "用户不存在")
-		return
-	}
+	// 用户不存在、已禁用与绑定码错误返还相同的错误，避免枚举用户名
+	admins := repo.NewAdminRepository()
+	info, err := admins.FindByUsername(params.Text3)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	// 用户绑定证书后，无法再次绑定
-	if len(info.Cert) > 0 {
-		ErrIllegal(ctx, "用户已绑定证书")
+	if info == nil || info.Disabled == 1 || !admins.CheckBindCode(info, params.Code) {
+		applog.A("证书绑定失败", map[string]interface{}{"username": params.Text3, "ip": ctx.ClientIP(), "reason": "绑定码无效"})
+		ErrIllegal(ctx, "绑定码无效")
 		return
 	}
 
 	// 解析证书，验证可用性
-
 	cert, err := reuint.ParseCert(params.Cert)
-	if err != nil {
+	if err != nil || cert == nil {
 		ErrIllegal(ctx, "证书无法解析")
 		return
 	}
-	_, err = cert.Verify(smx509.VerifyOptions{Roots: reuint.CertPool, KeyUsages: []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny}})
-	if err != nil {
-		ErrIllegal(ctx, "证书不可用")
+	if !c.verifyCert(ctx, cert) {
 		return
 	}
 
-	rA, err := base64.StdEncoding.DecodeString(params.Ra)
-	if err != nil {
-		ErrSys(ctx, err)
-		return
-	}
-	rB, err := base64.StdEncoding.DecodeString(params.Rb)
+	// 校验随机数Rb、可区分标识符B与时间戳，验签
+	ok, err := c.verifyTokenAB(cert, params.Ra, params.Rb, params.B, params.Ta, params.Signature)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	// 签名原文
-	msg := append(rA, rB...)
-	// 解析签名值
-	sig, err := base64.StdEncoding.DecodeString(params.Signature)
-	if err != nil {
-		ErrSys(ctx, err)
+	if !ok {
+		ErrIllegal(ctx, "证书绑定失败")
 		return
 	}
-	// 验签
-	verify := sm2.VerifyASN1WithSM2(cert.PublicKey.(*ecdsa.PublicKey), nil, msg, sig)
-	log.Println("验签结果 = ", verify)
-
-	// 验签不通过
-	if !verify {
-		ErrIllegal(ctx, "证书绑定失败")
+	// 验签成功，绑定证书，绑定码失效
+	item := repo.NewAdminCert(params.Cert, cert)
+	err = admins.Bind(info.ID, params.Code, item)
+	if err == repo.ErrBindCode || err == repo.ErrCertBound {
+		ErrIllegal(ctx, err.Error())
 		return
 	}
-	// 验签成功，绑定证书
-	info.Cert = params.Cert
-	if err = repo.DB.Save(info).Error; err != nil {
+	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-
+	applog.A("证书绑定", map[string]interface{}{
+		"username": info.Username,
+		"certId":   item.ID,
+		"subject":  item.Subject,
+		"serial":   item.Serial,
+		"ip":       ctx.ClientIP(),
+	})
 }
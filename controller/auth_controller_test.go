@@ -0,0 +1,272 @@
+package controller_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/sm3"
+	"github.com/emmansun/gmsm/smx509"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"pdm/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordRehash(t *testing.T) {
+	s := controllertest.NewServer(t)
+	// 早期版本的口令摘要 SM3(口令 || 盐值)
+	salt := []byte("0123456789abcdef")
+	digest := sm3.Sum(append([]byte("Legacy#Pass1"), salt...))
+	user := entity.User{Openid: "1001", Name: "张三", Username: "zhangsan",
+		Password: entity.Pwd(hex.EncodeToString(digest[:])), Salt: hex.EncodeToString(salt)}
+	if err := repo.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	login := func(password string) int {
+		return s.Do(http.MethodPost, "/api/login", `{"username":"1001","password":"`+password+`"}`, "").Code
+	}
+	if code := login("Wrong#Pass1"); code != http.StatusBadRequest {
+		t.Fatalf("wrong password: %d", code)
+	}
+	if err := repo.DB.First(&user, user.ID).Error; err != nil || !reuint.NeedsRehash(user.Password.String()) {
+		t.Fatalf("hash upgraded without valid login: %s %v", user.Password, err)
+	}
+
+	// 登录成功后口令摘要升级为PBKDF2格式，仍可使用原口令登录
+	if code := login("Legacy#Pass1"); code != http.StatusOK {
+		t.Fatalf("legacy login: %d", code)
+	}
+	if err := repo.DB.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(user.Password.String(), "pbkdf2-sm3$") || reuint.NeedsRehash(user.Password.String()) {
+		t.Fatalf("hash not upgraded: %s", user.Password)
+	}
+	if code := login("Legacy#Pass1"); code != http.StatusOK {
+		t.Fatalf("login after upgrade: %d", code)
+	}
+}
+
+// newSM2Cert 签发SM2测试证书，parent 为空时生成自签名的根证书
+func newSM2Cert(t *testing.T, cn string, parent *smx509.Certificate, parentKey *sm2.PrivateKey) (*smx509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	return issueSM2Cert(t, cn, parent, parentKey, parent == nil)
+}
+
+// newSM2CA 签发SM2测试中间证书
+func newSM2CA(t *testing.T, cn string, parent *smx509.Certificate, parentKey *sm2.PrivateKey) (*smx509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	return issueSM2Cert(t, cn, parent, parentKey, true)
+}
+
+func issueSM2Cert(t *testing.T, cn string, parent *smx509.Certificate, parentKey *sm2.PrivateKey, ca bool) (*smx509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &smx509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              smx509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	if ca {
+		tmpl.IsCA, tmpl.KeyUsage = true, smx509.KeyUsageCertSign|smx509.KeyUsageCRLSign
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := smx509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := smx509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// newSM2CRL 签发吊销列表
+func newSM2CRL(t *testing.T, issuer *smx509.Certificate, issuerKey *sm2.PrivateKey, revoked ...*smx509.Certificate) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{Number: big.NewInt(time.Now().UnixNano()), ThisUpdate: time.Now().Add(-time.Minute), NextUpdate: time.Now().Add(time.Hour)}
+	for _, c := range revoked {
+		tmpl.RevokedCertificates = append(tmpl.RevokedCertificates, pkix.RevokedCertificate{SerialNumber: c.SerialNumber, RevocationTime: time.Now()})
+	}
+	der, err := smx509.CreateRevocationList(rand.Reader, tmpl, issuer, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+// uploadRootCert 上传根证书或吊销列表
+func uploadRootCert(s *controllertest.Server, name string, data []byte) *httptest.ResponseRecorder {
+	var buf strings.Builder
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("files", name)
+	_, _ = fw.Write(data)
+	_ = mw.Close()
+	return s.Do(http.MethodPost, "/api/rootCerts/upload", buf.String(), s.AdminToken(0), func(r *http.Request) {
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+	})
+}
+
+// authRandom 获取服务端签发的随机数Rb
+func authRandom(t *testing.T, s *controllertest.Server) []byte {
+	t.Helper()
+	w := s.Do(http.MethodGet, "/api/random", "", "")
+	rb, err := base64.StdEncoding.DecodeString(w.Body.String())
+	if w.Code != http.StatusOK || err != nil || len(rb) != 32 {
+		t.Fatalf("random: %d %s", w.Code, w.Body.String())
+	}
+	return rb
+}
+
+// newTokenAB 生成令牌，签名原文为 Ra || Rb || B || TA
+func newTokenAB(t *testing.T, key *sm2.PrivateKey, username string, rb []byte, b string, ta time.Time) map[string]interface{} {
+	t.Helper()
+	ra := make([]byte, 32)
+	_, _ = rand.Read(ra)
+	msg := append(append(append([]byte{}, ra...), rb...), b...)
+	msg = append(msg, fmt.Sprint(ta.UnixMilli())...)
+	sig, err := key.Sign(rand.Reader, msg, sm2.NewSM2SignerOption(true, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"Ra":        base64.StdEncoding.EncodeToString(ra),
+		"Rb":        base64.StdEncoding.EncodeToString(rb),
+		"B":         b,
+		"Ta":        ta.UnixMilli(),
+		"text3":     username,
+		"signature": base64.StdEncoding.EncodeToString(sig),
+	}
+}
+
+func TestEntityAuth(t *testing.T) {
+	s := controllertest.NewServer(t)
+	root, rootKey := newSM2Cert(t, "测试根证书", nil, nil)
+	if err := storage.WriteFile(storage.RootCert, "root.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})); err != nil {
+		t.Fatal(err)
+	}
+	cert, key := newSM2Cert(t, "管理员", root, rootKey)
+	_, code, err := repo.NewAdminRepository().Create("sec", entity.AdminRoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := func() []byte {
+		return authRandom(t, s)
+	}
+	tokenAB := func(rb []byte, b string, ta time.Time) map[string]interface{} {
+		return newTokenAB(t, key, "sec", rb, b, ta)
+	}
+	post := func(p string, token map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(token)
+		return s.Do(http.MethodPost, p, string(body), "")
+	}
+
+	// 证书绑定同样需要服务端签发的随机数
+	bind := tokenAB(random(), entity.B, time.Now())
+	bind["cert"] = base64.StdEncoding.EncodeToString(cert.Raw)
+	bind["code"] = code
+	rb := make([]byte, 32)
+	_, _ = rand.Read(rb)
+	forged := tokenAB(rb, entity.B, time.Now())
+	forged["cert"], forged["code"] = bind["cert"], code
+	s.Expect(post("/api/certBinding", forged), http.StatusBadRequest, "证书绑定失败")
+	s.Expect(post("/api/certBinding", bind), http.StatusOK, "")
+
+	// 登录成功后令牌不能重放
+	token := tokenAB(random(), entity.B, time.Now())
+	w := post("/api/entityAuth", token)
+	s.Expect(w, http.StatusOK, `"type":"admin"`)
+	s.Expect(post("/api/entityAuth", token), http.StatusBadRequest, "身份认证失败")
+	// 客户端自选的随机数无效
+	s.Expect(post("/api/entityAuth", tokenAB(rb, entity.B, time.Now())), http.StatusBadRequest, "身份认证失败")
+	// 可区分标识符错误，随机数同时失效
+	rb = random()
+	s.Expect(post("/api/entityAuth", tokenAB(rb, "other", time.Now())), http.StatusBadRequest, "身份认证失败")
+	s.Expect(post("/api/entityAuth", tokenAB(rb, entity.B, time.Now())), http.StatusBadRequest, "身份认证失败")
+	// 时间戳偏差过大
+	s.Expect(post("/api/entityAuth", tokenAB(random(), entity.B, time.Now().Add(-10*time.Minute))), http.StatusBadRequest, "身份认证失败")
+	// 签名原文不包含时间戳
+	token = tokenAB(random(), entity.B, time.Now())
+	token["Ta"] = token["Ta"].(int64) + 1
+	s.Expect(post("/api/entityAuth", token), http.StatusBadRequest, "身份认证失败")
+	// 随机数过期
+	rb = random()
+	repo.DB.Model(&entity.AuthChallenge{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Second))
+	s.Expect(post("/api/entityAuth", tokenAB(rb, entity.B, time.Now())), http.StatusBadRequest, "身份认证失败")
+
+	// 上传吊销列表后，已吊销的证书不能登录与绑定
+	upload := func(name string, data []byte) *httptest.ResponseRecorder {
+		return uploadRootCert(s, name, data)
+	}
+	newCRL := func(issuer *smx509.Certificate, issuerKey *sm2.PrivateKey, revoked ...*smx509.Certificate) []byte {
+		return newSM2CRL(t, issuer, issuerKey, revoked...)
+	}
+	other, otherKey := newSM2Cert(t, "其他根证书", nil, nil)
+	s.Expect(upload("other.crl", newCRL(other, otherKey, cert)), http.StatusBadRequest, "吊销列表不是由根证书签发")
+	s.Expect(upload("root.crl", newCRL(root, rootKey)), http.StatusOK, "")
+	s.Expect(post("/api/entityAuth", tokenAB(random(), entity.B, time.Now())), http.StatusOK, `"type":"admin"`)
+	// 同名吊销列表可替换，根证书不可替换
+	s.Expect(upload("root.crl", newCRL(root, rootKey, cert)), http.StatusOK, "")
+	s.Expect(upload("root.crt", newCRL(root, rootKey, cert)), http.StatusBadRequest, "根证书已存在")
+	s.Expect(post("/api/entityAuth", tokenAB(random(), entity.B, time.Now())), http.StatusBadRequest, "证书已吊销")
+	admin, _ := repo.NewAdminRepository().FindByUsername("sec")
+	code, _, _ = repo.NewAdminRepository().IssueBindCode(admin.ID)
+	bind = tokenAB(random(), entity.B, time.Now())
+	bind["cert"] = base64.StdEncoding.EncodeToString(cert.Raw)
+	bind["code"] = code
+	s.Expect(post("/api/certBinding", bind), http.StatusBadRequest, "证书已吊销")
+	// 列表区分根证书与吊销列表
+	w = s.Do(http.MethodGet, "/api/rootCerts/list", "", s.AdminToken(0))
+	s.Expect(w, http.StatusOK, `"name":"root.crl","type":"crl"`)
+	s.Expect(w, http.StatusOK, `"name":"root.crt","type":"cert"`)
+}
+
+func TestEntityAuth_RevokedIntermediate(t *testing.T) {
+	s := controllertest.NewServer(t)
+	root, rootKey := newSM2Cert(t, "测试根证书", nil, nil)
+	inter, interKey := newSM2CA(t, "测试中间证书", root, rootKey)
+	cert, key := newSM2Cert(t, "管理员", inter, interKey)
+	s.Expect(uploadRootCert(s, "root.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})), http.StatusOK, "")
+	s.Expect(uploadRootCert(s, "inter.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: inter.Raw})), http.StatusOK, "")
+	s.Expect(uploadRootCert(s, "root.crl", newSM2CRL(t, root, rootKey)), http.StatusOK, "")
+	_, code, err := repo.NewAdminRepository().Create("sec", entity.AdminRoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(p string, token map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(token)
+		return s.Do(http.MethodPost, p, string(body), "")
+	}
+	bind := newTokenAB(t, key, "sec", authRandom(t, s), entity.B, time.Now())
+	bind["cert"] = base64.StdEncoding.EncodeToString(cert.Raw)
+	bind["code"] = code
+	s.Expect(post("/api/certBinding", bind), http.StatusOK, "")
+	s.Expect(post("/api/entityAuth", newTokenAB(t, key, "sec", authRandom(t, s), entity.B, time.Now())), http.StatusOK, `"type":"admin"`)
+
+	// 中间证书被根证书吊销后，其签发的证书同样不能登录
+	s.Expect(uploadRootCert(s, "root.crl", newSM2CRL(t, root, rootKey, inter)), http.StatusOK, "")
+	s.Expect(post("/api/entityAuth", newTokenAB(t, key, "sec", authRandom(t, s), entity.B, time.Now())), http.StatusBadRequest, "证书已吊销")
+}
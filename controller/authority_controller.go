@@ -21,13 +21,15 @@ func NewAuthorityController(router gin.IRouter) *AuthorityController {
 	// 进入项目
 	r.POST("/enterProject", User, res.enterProject)
 	// 退出项目
-	r.DELETE("/exitProject", ProjectMember, res.exitProject)
+	r.DELETE("/exitProject", User, res.exitProject)
 	return res
 }
 
 /**
 @api {POST} /api/auth/enterProject 进入项目
-@apiDescription 将projectId和role存入cookies
+@apiDescription 将projectId和role存入cookies。
+请求未通过路径（/api/projects/:projectId/...）或 X-Project-Id 请求头携带项目ID时，使用cookies中的项目。
+同时打开多个项目时应通过请求头或路径携带项目ID，避免相互覆盖。
 @apiName AuthCreate
 @apiGroup Auth
 
@@ -88,9 +90,13 @@ func (c *AuthorityController) enterProject(ctx *gin.Context) {
 	// 生成新的Token包含项目ID和项目角色
 	claims.PID = param.ProjectId
 	claims.Role = param.Role
-	token := tokenManager.GenToken(claims)
+	token, err := tokenManager.GenToken(claims)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 	fmt.Println(token)
-	ctx.SetCookie("token", token, 8*3600, "", "", false, true)
+	tokenManager.SetCookie(ctx, token)
 	ctx.JSON(200, &param)
 }
 
@@ -117,6 +123,10 @@ func (c *AuthorityController) exitProject(ctx *gin.Context) {
 	// 生成新的Token包含项目ID和项目角色
 	claims.PID = 0
 	claims.Role = 0
-	token := tokenManager.GenToken(claims)
-	ctx.SetCookie("token", token, 8*3600, "", "", false, true)
+	token, err := tokenManager.GenToken(claims)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	tokenManager.SetCookie(ctx, token)
 }
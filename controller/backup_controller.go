@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"pdm/backup"
+	"pdm/controller/dto"
+	"pdm/logg/applog"
+	"time"
+)
+
+// NewBackupController 创建备份管理控制器
+func NewBackupController(router gin.IRouter) *BackupController {
+	res := &BackupController{}
+	r := router.Group("/backup")
+	// 创建备份
+	r.POST("/create", Admin, res.create)
+	// 列表
+	r.GET("/list", Admin, res.list)
+	// 下载
+	r.GET("/download", Admin, res.download)
+	// 删除
+	r.DELETE("/remove", Admin, res.remove)
+	return res
+}
+
+// BackupController 备份管理控制器
+// 备份的恢复会覆盖所有数据，需停止服务后通过 pdm restore 命令执行。
+type BackupController struct {
+}
+
+// manager 全局备份管理，未初始化时响应错误
+func (c *BackupController) manager(ctx *gin.Context) *backup.Manager {
+	m := backup.Default()
+	if m == nil {
+		ErrIllegal(ctx, "备份功能未启用")
+	}
+	return m
+}
+
+/**
+@api {POST} /api/backup/create 创建备份
+@apiDescription 备份数据库中的所有数据以及对接文档、基础文档区、技术方案、头像、根证书等业务文件，
+备份文件保存在服务端的备份目录中，超出保留数量时删除最早的备份。
+@apiName BackupCreate
+@apiGroup Backup
+
+@apiPermission 管理员
+
+@apiParamExample 请求示例
+POST /api/backup/create
+
+@apiSuccess {String} name 备份文件名。
+@apiSuccess {Integer} size 文件大小，单位B。
+@apiSuccess {String} createdAt 备份时间，格式"YYYY-MM-DD HH:mm:ss"。
+@apiSuccess {String} dbVersion 数据库版本。
+@apiSuccess {Integer} tables 数据表数量。
+@apiSuccess {Integer} rows 数据记录总数。
+@apiSuccess {Integer} files 业务文件数量。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "name": "pdm-backup-20261017-150405.tar.gz",
+    "size": 1048576,
+    "createdAt": "2026-10-17 15:04:05",
+    "dbVersion": "2023010501",
+    "tables": 10,
+    "rows": 1024,
+    "files": 32
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+备份正在进行中，请稍后再试
+*/
+
+// create 创建备份
+func (c *BackupController) create(ctx *gin.Context) {
+	m := c.manager(ctx)
+	if m == nil {
+		return
+	}
+	applog.L(ctx, "创建备份", nil)
+
+	archive, manifest, err := m.Create()
+	if errors.Is(err, backup.ErrBusy) {
+		ErrIllegal(ctx, "备份正在进行中，请稍后再试")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.BackupResultDto{
+		BackupItemDto: backupItem(archive),
+		DBVersion:     manifest.DBVersion,
+		Tables:        len(manifest.Tables),
+		Rows:          manifest.Rows(),
+		Files:         manifest.Files(),
+	})
+}
+
+/**
+@api {GET} /api/backup/list 列表
+@apiDescription 备份目录中的所有备份文件，按备份时间由新到旧排序。
+@apiName BackupList
+@apiGroup Backup
+
+@apiPermission 管理员
+
+@apiParamExample 请求示例
+GET /api/backup/list
+
+@apiSuccess {BackupItemDto[]} Body 备份文件列表。
+
+@apiSuccess (BackupItemDto) {String} name 备份文件名。
+@apiSuccess (BackupItemDto) {Integer} size 文件大小，单位B。
+@apiSuccess (BackupItemDto) {String} createdAt 备份时间，格式"YYYY-MM-DD HH:mm:ss"。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "name": "pdm-backup-20261017-150405.tar.gz",
+        "size": 1048576,
+        "createdAt": "2026-10-17 15:04:05"
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// list 备份列表
+func (c *BackupController) list(ctx *gin.Context) {
+	m := c.manager(ctx)
+	if m == nil {
+		return
+	}
+	list, err := m.List()
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	res := make([]dto.BackupItemDto, 0, len(list))
+	for i := range list {
+		res = append(res, backupItem(&list[i]))
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {GET} /api/backup/download 下载
+@apiDescription 下载备份文件。
+@apiName BackupDownload
+@apiGroup Backup
+
+@apiPermission 管理员
+
+@apiParam {String} name 备份文件名。
+
+@apiParamExample 请求示例
+GET /api/backup/download?name=pdm-backup-20261017-150405.tar.gz
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+@apiHeader Content-Disposition
+@apiHeader Content-Type
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+备份文件不存在
+*/
+
+// download 下载备份
+func (c *BackupController) download(ctx *gin.Context) {
+	m := c.manager(ctx)
+	if m == nil {
+		return
+	}
+	name := ctx.Query("name")
+	applog.L(ctx, "下载备份", map[string]interface{}{
+		"name": name,
+	})
+
+	p, err := m.Path(name)
+	if err != nil {
+		ErrIllegal(ctx, "备份文件不存在")
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(name)))
+	ctx.Header("Content-Type", "application/gzip")
+	ctx.File(p)
+}
+
+/**
+@api {DELETE} /api/backup/remove 删除
+@apiDescription 删除备份文件。
+@apiName BackupRemove
+@apiGroup Backup
+
+@apiPermission 管理员
+
+@apiParam {String} name 备份文件名。
+
+@apiParamExample 请求示例
+DELETE /api/backup/remove?name=pdm-backup-20261017-150405.tar.gz
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+备份文件不存在
+*/
+
+// remove 删除备份
+func (c *BackupController) remove(ctx *gin.Context) {
+	m := c.manager(ctx)
+	if m == nil {
+		return
+	}
+	name := ctx.Query("name")
+	applog.L(ctx, "删除备份", map[string]interface{}{
+		"name": name,
+	})
+
+	err := m.Remove(name)
+	if errors.Is(err, backup.ErrNotFound) {
+		ErrIllegal(ctx, "备份文件不存在")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+	}
+}
+
+// backupItem 备份文件信息
+func backupItem(archive *backup.Archive) dto.BackupItemDto {
+	return dto.BackupItemDto{
+		Name:      archive.Name,
+		Size:      archive.Size,
+		CreatedAt: archive.ModTime.In(time.FixedZone("CST", 8*3600)).Format("2006-01-02 15:04:05"),
+	}
+}
@@ -5,16 +5,12 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
-	"io/fs"
 	"net/url"
-	"os"
 	"path"
-	"path/filepath"
-	"pdm/appconf/dir"
 	"pdm/controller/dto"
 	"pdm/logg/applog"
 	"pdm/reuint"
-	"runtime"
+	"pdm/storage"
 	"sort"
 	"strings"
 	"time"
@@ -89,14 +85,14 @@ HTTP/1.1 500
 func (c *BaseDocumentAreaController) attr(ctx *gin.Context) {
 	fileDir, _ := url.QueryUnescape(ctx.Query("path"))
 
-	p := filepath.Join(dir.BaseDocAreaDir, fileDir)
-	if !strings.HasPrefix(p, dir.BaseDocAreaDir) {
+	p, ok := storage.Clean(fileDir)
+	if !ok {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
 
-	info, err := os.Stat(p)
-	if os.IsNotExist(err) {
+	info, err := storage.BaseDocArea.Stat(p)
+	if errors.Is(err, storage.ErrNotExist) {
 		ErrIllegal(ctx, "文件不存在")
 		return
 	}
@@ -105,18 +101,8 @@ func (c *BaseDocumentAreaController) attr(ctx *gin.Context) {
 		return
 	}
 
-	zone := time.FixedZone("CST", 8*3600)
-	res := &dto.FileItemDto{}
-	res.Name = info.Name()
-	res.UpdatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
+	res := fileItem(info)
 	res.Path = fileDir
-	if info.IsDir() {
-		res.Type = "dir"
-	} else {
-		res.Type = "file"
-	}
-	res.Size = info.Size()
-
 	ctx.JSON(200, res)
 }
 
@@ -162,57 +148,38 @@ func (c *BaseDocumentAreaController) copy(ctx *gin.Context) {
 		return
 	}
 
-	from := filepath.Join(dir.BaseDocAreaDir, fileCopy.From)
-	if !strings.HasPrefix(from, dir.BaseDocAreaDir) || from == dir.BaseDocAreaDir {
+	from, ok := storage.Clean(fileCopy.From)
+	if !ok || from == "" {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
-	info, _ := os.Stat(from)
-	to := filepath.Join(dir.BaseDocAreaDir, fileCopy.To)
-	if !strings.HasPrefix(to, dir.BaseDocAreaDir) || to == dir.BaseDocAreaDir || (info.IsDir() && strings.HasPrefix(to, from+string(filepath.Separator))) {
-		ErrIllegal(ctx, "文件路径错误")
+	info, err := storage.BaseDocArea.Stat(from)
+	if errors.Is(err, storage.ErrNotExist) {
+		ErrIllegal(ctx, "原文件不存在")
 		return
 	}
-	_, err = os.Stat(to)
-	if err == nil {
-		ErrIllegal(ctx, "文件已存在")
+	if err != nil {
+		ErrSys(ctx, err)
 		return
 	}
-	if os.IsNotExist(err) {
-		if info.IsDir() {
-			err := reuint.CopyDir(from, to)
-			if err != nil {
-				ErrSys(ctx, err)
-				return
-			}
-			return
-		}
-		fromFile, err := os.Open(from)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
-		defer fromFile.Close()
-
-		toFile, err := os.Create(to)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
-		defer toFile.Close()
-
-		_, err = io.Copy(toFile, fromFile)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
+	to, ok := storage.Clean(fileCopy.To)
+	if !ok || to == "" || (info.IsDir && storage.IsSub(from, to)) {
+		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
+	exist, err := storage.Exist(storage.BaseDocArea, to)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-
+	if exist {
+		ErrIllegal(ctx, "文件已存在")
+		return
+	}
+	if err = storage.BaseDocArea.Copy(from, to); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 }
 
 /**
@@ -246,13 +213,13 @@ func (c *BaseDocumentAreaController) remove(ctx *gin.Context) {
 		"fileDir": fileDir,
 	})
 
-	p := filepath.Join(dir.BaseDocAreaDir, fileDir)
-	if !strings.HasPrefix(p, dir.BaseDocAreaDir) || p == dir.BaseDocAreaDir {
+	p, ok := storage.Clean(fileDir)
+	if !ok || p == "" {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
 
-	err := os.RemoveAll(p)
+	err := storage.BaseDocArea.Remove(p)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -306,26 +273,30 @@ func (c *BaseDocumentAreaController) move(ctx *gin.Context) {
 		return
 	}
 
-	param.From = filepath.Join(dir.BaseDocAreaDir, param.From)
-	param.To = filepath.Join(dir.BaseDocAreaDir, param.To)
-	if !strings.HasPrefix(param.From, dir.BaseDocAreaDir) || param.From == dir.BaseDocAreaDir {
+	from, ok := storage.Clean(param.From)
+	if !ok || from == "" {
 		ErrIllegal(ctx, "文件原路径错误")
 		return
 	}
-	info, err := os.Stat(param.From)
-	if errors.Is(err, os.ErrNotExist) {
+	info, err := storage.BaseDocArea.Stat(from)
+	if errors.Is(err, storage.ErrNotExist) {
 		ErrIllegal(ctx, "原文件不存在")
 		return
 	}
-	if !strings.HasPrefix(param.To, dir.BaseDocAreaDir) || param.To == dir.BaseDocAreaDir || (info.IsDir() && strings.HasPrefix(param.To, param.From+string(filepath.Separator))) {
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	to, ok := storage.Clean(param.To)
+	if !ok || to == "" || (info.IsDir && storage.IsSub(from, to)) {
 		ErrIllegal(ctx, "文件目标路径错误")
 		return
 	}
-	if _, err := os.Stat(param.To); err == nil {
+	if exist, _ := storage.Exist(storage.BaseDocArea, to); exist {
 		ErrIllegal(ctx, "文件已存在")
 		return
 	}
-	err = os.Rename(param.From, param.To)
+	err = storage.BaseDocArea.Rename(from, to)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -391,51 +362,26 @@ func (c *BaseDocumentAreaController) list(ctx *gin.Context) {
 		onlyDir = true
 	}
 
-	p := filepath.Join(dir.BaseDocAreaDir, baseDir)
-	if !strings.HasPrefix(p, dir.BaseDocAreaDir) {
+	p, ok := storage.Clean(baseDir)
+	if !ok {
 		ErrIllegal(ctx, "搜索基础路径错误")
 		return
 	}
-
 	res := []dto.FileItemDto{}
-	zone := time.FixedZone("CST", 8*3600)
-	_ = filepath.Walk(p, func(path string, info fs.FileInfo, err error) error {
-
-		if path == p {
-			// 忽略根路径
-			return nil
-		}
-
-		if onlyDir && !info.IsDir() {
+	items, _ := storage.BaseDocArea.List(p)
+	for i := range items {
+		info := &items[i]
+		if onlyDir && !info.IsDir {
 			// 在仅查询目录的情况忽略 文件
-			return nil
+			continue
 		}
 
-		if keyword != "" && !strings.Contains(info.Name(), keyword) {
+		if keyword != "" && !strings.Contains(info.Name, keyword) {
 			// 关键字不匹配
-			return nil
-		}
-
-		item := &dto.FileItemDto{}
-		item.Name = info.Name()
-		item.UpdatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
-		item.Path = strings.Replace(path, dir.BaseDocAreaDir, "", 1)
-		if runtime.GOOS == "windows" {
-			item.Path = strings.Replace(item.Path, "\\", "/", -1)
-		}
-		item.Size = info.Size()
-		item.Type = "file"
-		if info.IsDir() {
-			item.Type = "dir"
-		}
-		res = append(res, *item)
-
-		if info.IsDir() {
-			// 阻止递归
-			return filepath.SkipDir
+			continue
 		}
-		return nil
-	})
+		res = append(res, fileItem(info))
+	}
 	sort.Slice(res, func(i, j int) bool {
 		if res[i].Type != res[j].Type {
 			return len(res[i].Type) < len(res[j].Type)
@@ -489,32 +435,32 @@ func (c *BaseDocumentAreaController) download(ctx *gin.Context) {
 	})
 
 	for i, filename := range fileList {
-		filePath := filepath.Join(dir.BaseDocAreaDir, filename)
-		if !strings.HasPrefix(filePath, dir.BaseDocAreaDir) || filePath == dir.BaseDocAreaDir {
+		p, ok := storage.Clean(filename)
+		if !ok || p == "" {
 			ErrIllegal(ctx, "路径错误")
 			return
 		}
-		fileList[i] = filePath
+		fileList[i] = p
 	}
 
-	info, err := os.Stat(fileList[0])
+	info, err := storage.BaseDocArea.Stat(fileList[0])
 	if err != nil {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
 
 	// 单文件下载
-	if len(fileList) == 1 && !info.IsDir() {
-		file, err := os.Open(fileList[0])
+	if len(fileList) == 1 && !info.IsDir {
+		file, err := storage.BaseDocArea.Open(fileList[0])
 		if err != nil {
 			ErrSys(ctx, err)
 			return
 		}
 		defer file.Close()
 		// 下载文件名称
-		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(info.Name())))
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(info.Name)))
 		//获取文件的后缀(文件类型)
-		ctx.Header("Content-Type", reuint.GetMIME(path.Ext(info.Name())))
+		ctx.Header("Content-Type", reuint.GetMIME(path.Ext(info.Name)))
 		_, err = io.Copy(ctx.Writer, file)
 		if err != nil {
 			ErrSys(ctx, err)
@@ -524,9 +470,9 @@ func (c *BaseDocumentAreaController) download(ctx *gin.Context) {
 	}
 
 	// 多文件或目录 打包压缩下载
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", url.QueryEscape(info.Name())))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", url.QueryEscape(info.Name)))
 	ctx.Header("Content-Type", "application/zip")
-	err = reuint.Zip(ctx.Writer, fileList...)
+	err = storage.Zip(ctx.Writer, storage.BaseDocArea, fileList...)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -568,17 +514,27 @@ func (c *BaseDocumentAreaController) upload(ctx *gin.Context) {
 	applog.L(ctx, "基础文档区上传文件", map[string]interface{}{
 		"path": base,
 	})
+	baseDir, ok := storage.Clean(base)
+	if !ok {
+		ErrIllegal(ctx, "路径错误")
+		return
+	}
 	var err1 error
 	for _, file := range files {
-		_ = os.MkdirAll(filepath.Join(dir.BaseDocAreaDir, base), os.ModePerm)
-		filePath := filepath.Join(dir.BaseDocAreaDir, base, file.Filename)
-		_, err := os.Stat(filePath)
-		if err == nil {
+		filePath, ok := storage.Clean(path.Join(baseDir, file.Filename))
+		if !ok || !storage.IsSub(baseDir, filePath) {
+			err1 = errors.New(file.Filename + "文件名错误")
+			continue
+		}
+		exist, err := storage.Exist(storage.BaseDocArea, filePath)
+		if exist {
 			err1 = errors.New(file.Filename + "文件已存在")
 			continue
 			//return
 		}
-		err = ctx.SaveUploadedFile(file, filePath)
+		if err == nil {
+			err = storage.SaveUploadedFile(storage.BaseDocArea, file, filePath)
+		}
 		if err != nil {
 			err1 = err
 			continue
@@ -629,25 +585,17 @@ func (c *BaseDocumentAreaController) mkdir(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
-	p := filepath.Join(dir.BaseDocAreaDir, base)
-	if !strings.HasPrefix(p, dir.BaseDocAreaDir) || p == dir.BaseDocAreaDir {
+	p, ok := storage.Clean(base)
+	if !ok || p == "" {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
-	if runtime.GOOS == "windows" {
-		p = strings.Replace(p, "\\", "/", -1)
-	}
 
-	if err := os.MkdirAll(p, os.ModePerm); err != nil {
+	if err := storage.BaseDocArea.MkdirAll(p); err != nil {
 		ErrIllegal(ctx, "创建失败")
 		return
 	}
-	lastIndex := strings.LastIndex(p, "/")
-	var name string
-	if lastIndex != -1 {
-		name = p[lastIndex+1:]
-	}
-	ctx.JSON(200, name)
+	ctx.JSON(200, path.Base(p))
 }
 
 /**
@@ -713,39 +661,38 @@ func (c *BaseDocumentAreaController) search(ctx *gin.Context) {
 		return
 	}
 
-	p := filepath.Join(dir.BaseDocAreaDir, baseDir)
-	if !strings.HasPrefix(p, dir.BaseDocAreaDir) {
+	p, ok := storage.Clean(baseDir)
+	if !ok {
 		ErrIllegal(ctx, "搜索路径错误")
 		return
 	}
 
 	res := []dto.FileItemDto{}
-	zone := time.FixedZone("CST", 8*3600)
-	_ = filepath.Walk(p, func(path string, info fs.FileInfo, err error) error {
-		// 忽略根路径
-		if path == p {
-			return nil
-		}
-
-		if !strings.Contains(info.Name(), keyword) {
+	_ = storage.Walk(storage.BaseDocArea, p, func(info storage.FileInfo) error {
+		if !strings.Contains(info.Name, keyword) {
 			// 关键字不匹配
 			return nil
 		}
-
-		item := &dto.FileItemDto{}
-		item.Name = info.Name()
-		item.UpdatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
-		item.Path = strings.Replace(path, dir.BaseDocAreaDir, "", 1)
-		if runtime.GOOS == "windows" {
-			item.Path = strings.Replace(item.Path, "\\", "/", -1)
-		}
-		item.Size = info.Size()
-		item.Type = "file"
-		if info.IsDir() {
-			item.Type = "dir"
-		}
-		res = append(res, *item)
+		res = append(res, fileItem(&info))
 		return nil
 	})
 	ctx.JSON(200, res)
 }
+
+// fileItem 文件信息转换为文件列表项，路径为相对于存储根的绝对路径
+func fileItem(info *storage.FileInfo) dto.FileItemDto {
+	item := dto.FileItemDto{
+		Name: info.Name,
+		Path: "/" + info.Path,
+		Size: info.Size,
+		Type: "file",
+	}
+	if info.IsDir {
+		item.Type = "dir"
+	}
+	if !info.ModTime.IsZero() {
+		zone := time.FixedZone("CST", 8*3600)
+		item.UpdatedAt = info.ModTime.In(zone).Format("2006-01-02 15:04:05")
+	}
+	return item
+}
@@ -0,0 +1,179 @@
+// Package controllertest 接口测试的公共环境
+//
+// NewServer 使用临时目录下的SQLite数据库与本地文件存储注册全部路由，
+// 并提供发送请求、登录、进入项目以及签发管理员token等辅助方法。
+package controllertest
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"pdm/appconf"
+	"pdm/controller"
+	"pdm/controller/middle"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"pdm/reuint/jwt"
+	"pdm/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Server 测试使用的接口服务
+type Server struct {
+	Config  *appconf.Application
+	Handler http.Handler
+	t       *testing.T
+}
+
+// Setup 初始化测试配置、数据库与文件存储，测试结束后关闭数据库
+// opts: 初始化前修改配置
+func Setup(t *testing.T, opts ...func(cfg *appconf.Application)) *appconf.Application {
+	t.Helper()
+	cfg := &appconf.Application{
+		Port: 8010,
+		Database: appconf.Database{
+			Type: "sqlite",
+			DSN:  filepath.Join(t.TempDir(), "pdm.db"),
+		},
+		Password: appconf.Password{MinLength: 8, MinClasses: 3, BannedWords: []string{"qwerty"}, MaxAge: 90, History: 5, Iterations: 10000},
+		TOTP:     appconf.TOTP{Issuer: "PDM"},
+		JWT:      appconf.JWT{Rotation: 12, Grace: 8},
+		Throttle: appconf.Throttle{AccountFailures: 5, IPFailures: 10, Window: 15, LockTime: 10, MaxLockTime: 60},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := repo.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*storage.Storage{&storage.Doc, &storage.BaseDocArea, &storage.TechnicalProposal, &storage.Avatar, &storage.RootCert} {
+		*s, _ = storage.NewLocal(t.TempDir())
+	}
+	return cfg
+}
+
+// NewServer 初始化测试环境并注册全部路由
+func NewServer(t *testing.T, opts ...func(cfg *appconf.Application)) *Server {
+	t.Helper()
+	s := &Server{Config: Setup(t, opts...), t: t}
+	s.Reload()
+	return s
+}
+
+// Reload 重新注册路由，相当于重启服务
+func (s *Server) Reload() {
+	s.t.Helper()
+	r := gin.New()
+	if err := controller.RouteMapping(r, s.Config); err != nil {
+		s.t.Fatal(err)
+	}
+	s.Handler = r
+}
+
+// Serve 处理请求
+func (s *Server) Serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, req)
+	return w
+}
+
+// Do 发送请求
+// token: 登录token，不为空时以Cookie携带
+// opts: 发送前修改请求，如设置请求头
+func (s *Server) Do(method, path, body, token string, opts ...func(r *http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return s.Serve(req)
+}
+
+// Bearer 以个人访问令牌认证
+func Bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+// Cookie 响应中设置的登录token，未设置时返还空
+func Cookie(w *httptest.ResponseRecorder) string {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "token" && c.Value != "" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// Expect 校验响应状态码以及响应中包含的内容
+func (s *Server) Expect(w *httptest.ResponseRecorder, code int, msg string) {
+	s.t.Helper()
+	if w.Code != code || !strings.Contains(w.Body.String(), msg) {
+		s.t.Fatalf("expect %d %s, got %d %s", code, msg, w.Code, w.Body.String())
+	}
+}
+
+// CreateUser 以指定口令创建用户
+func (s *Server) CreateUser(user *entity.User, password string) {
+	s.t.Helper()
+	pwd, salt, err := reuint.GenPasswordSalt(password)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	user.Password, user.Salt = entity.Pwd(pwd), salt
+	if err = repo.DB.Create(user).Error; err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// Login 用户登录，返还登录token
+func (s *Server) Login(username, password string) string {
+	s.t.Helper()
+	w := s.Do(http.MethodPost, "/api/login", `{"username":"`+username+`","password":"`+password+`"}`, "")
+	token := Cookie(w)
+	if token == "" {
+		s.t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+	return token
+}
+
+// EnterProject 进入项目，返还包含项目信息的登录token
+func (s *Server) EnterProject(token string, projectId int) string {
+	s.t.Helper()
+	w := s.Do(http.MethodPost, "/api/auth/enterProject", fmt.Sprintf(`{"projectId":%d}`, projectId), token)
+	if token = Cookie(w); token == "" {
+		s.t.Fatalf("enterProject: %d %s", w.Code, w.Body.String())
+	}
+	return token
+}
+
+// AdminToken 创建管理员并签发登录token
+// 管理员需通过证书认证登录，测试中使用与服务相同的数据库密钥环直接签发。
+// role: 0 - 管理员 1 - 审计员
+func (s *Server) AdminToken(role int) string {
+	s.t.Helper()
+	admin := entity.Admin{Username: fmt.Sprintf("admin%d", time.Now().UnixNano()), Role: role}
+	if err := repo.DB.Create(&admin).Error; err != nil {
+		s.t.Fatal(err)
+	}
+	keys := middle.NewKeyRing(repo.NewJwtKeyRepository(), time.Duration(s.Config.JWT.Rotation)*time.Hour, time.Duration(s.Config.JWT.Grace)*time.Hour)
+	tm := middle.NewTokenFilter(keys, false, repo.NewSessionRepository(), repo.NewAccessTokenRepository())
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/entityAuth", nil)
+	claims := &jwt.Claims{Type: []string{"admin", "audit"}[role], Sub: admin.ID, Exp: time.Now().Add(time.Hour).UnixMilli()}
+	token, err := tm.Issue(ctx, claims)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return token
+}
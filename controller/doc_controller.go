@@ -11,7 +11,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"pdm/appconf/dir"
 	"pdm/controller/dto"
 	"pdm/controller/middle"
 	"pdm/logg/applog"
@@ -19,6 +18,7 @@ import (
 	"pdm/repo/entity"
 	"pdm/reuint"
 	"pdm/reuint/jwt"
+	"pdm/storage"
 	"regexp"
 	"strconv"
 	"strings"
@@ -30,27 +30,27 @@ func NewDocController(router gin.IRouter) *DocController {
 	res := &DocController{}
 	r := router.Group("/doc")
 	// 创建项目文档
-	r.POST("/create", ExceptProjectInterConnector, res.create)
+	r.POST("/create", Require(entity.PermDocWrite), res.create)
 	// 获取文档信息
-	r.GET("/info", Authed, res.info)
+	r.GET("/info", Require(entity.PermProjectRead), res.info)
 	// 获取项目文档列表
-	r.GET("/projectDocList", Authed, res.projectDocList)
+	r.GET("/projectDocList", Require(entity.PermProjectRead), res.projectDocList)
 	// 更新文档内容
-	r.POST("/content", ExceptProjectInterConnector, res.contentPost)
+	r.POST("/content", Require(entity.PermDocWrite), res.contentPost)
 	// 获取文档内容
-	r.GET("/content", Authed, res.contentGet)
+	r.GET("/content", Require(entity.PermProjectRead), res.contentGet)
 	// 上传文档资源
-	r.POST("/assert", ExceptProjectInterConnector, res.assertPost)
+	r.POST("/assert", Require(entity.PermDocWrite), res.assertPost)
 	// 下载文档资源
-	r.GET("/assert", ExceptProjectInterConnector, res.assertGet)
+	r.GET("/assert", Require(entity.PermDocExport), res.assertGet)
 	// 获取文档编辑锁
-	r.POST("/lock", ExceptProjectInterConnector, res.lock)
+	r.POST("/lock", Require(entity.PermDocWrite), res.lock)
 	// 取消编辑
-	r.POST("/cancel", ExceptProjectInterConnector, res.cancel)
+	r.POST("/cancel", Require(entity.PermDocWrite), res.cancel)
 	// 导出文档
-	r.GET("/export", ExceptProjectInterConnector, res.export)
+	r.GET("/export", Require(entity.PermDocExport), res.export)
 	// 生成技术方案
-	r.GET("/generate", ExceptProjectInterConnector, res.generate)
+	r.GET("/generate", Require(entity.PermDocExport), res.generate)
 	return res
 }
 
@@ -64,7 +64,7 @@ type DocController struct {
 @apiName DocCreate
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发
+@apiPermission 具有 doc.write 权限的项目成员
 
 @apiHeader {String} Content-type multipart/form-data 多类型表单固定值。
 
@@ -113,6 +113,9 @@ func (c *DocController) create(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !inProject(ctx, doc.ProjectId) {
+		return
+	}
 	if doc.Title == "undefined" || doc.Title == "null" || doc.Title == "" {
 		ErrIllegal(ctx, "文档名称为空")
 		return
@@ -143,8 +146,8 @@ func (c *DocController) create(ctx *gin.Context) {
 		}
 
 		// 创建文件目录
-		docPath := filepath.Join(dir.DocDir, strconv.Itoa(doc.ID))
-		err = os.MkdirAll(docPath, os.ModePerm)
+		docPath := strconv.Itoa(doc.ID)
+		err = storage.Doc.MkdirAll(docPath)
 		if err != nil {
 			return err
 		}
@@ -157,8 +160,8 @@ func (c *DocController) create(ctx *gin.Context) {
 		if doc.DocType == "markdown" {
 			filename := fmt.Sprintf("%s%s.md", now, r)
 			doc.Filename = filename
-			docFile := filepath.Join(docPath, doc.Filename)
-			_, err = os.Create(docFile)
+			docFile := path.Join(docPath, doc.Filename)
+			err = storage.WriteFile(storage.Doc, docFile, nil)
 			if err != nil {
 				return err
 			}
@@ -178,8 +181,8 @@ func (c *DocController) create(ctx *gin.Context) {
 			}
 
 			doc.Filename = filename
-			docFile := filepath.Join(docPath, doc.Filename)
-			err = ctx.SaveUploadedFile(file, docFile)
+			docFile := path.Join(docPath, doc.Filename)
+			err = storage.SaveUploadedFile(storage.Doc, file, docFile)
 			if err != nil {
 				return err
 			}
@@ -206,7 +209,7 @@ func (c *DocController) create(ctx *gin.Context) {
 @apiName DocInfo
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发、测试、维护
+@apiPermission 具有 project.read 权限的项目成员
 
 @apiParam {Integer} id 文档ID。
 @apiParam {Integer} projectId 项目ID。
@@ -263,6 +266,9 @@ func (c *DocController) info(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !inProject(ctx, projectId) || !owned(ctx, repo.ResourceDoc, id) {
+		return
+	}
 
 	err := repo.DB.Model(&doc).Where("id", id).Find(&docDto).Error
 	if err != nil {
@@ -281,7 +287,7 @@ func (c *DocController) info(ctx *gin.Context) {
 @apiName DocProjectDocList
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发、测试、维护
+@apiPermission 具有 project.read 权限的项目成员
 
 @apiParam {Integer} projectId 项目ID
 
@@ -334,6 +340,9 @@ func (c *DocController) projectDocList(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !inProject(ctx, projectId) {
+		return
+	}
 
 	err := repo.DB.Model(&doc).Where("project_id", projectId).Order("priority desc").Find(&docDtoList).Error
 	if err != nil {
@@ -353,7 +362,7 @@ func (c *DocController) projectDocList(ctx *gin.Context) {
 @apiName DocContentPOST
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发
+@apiPermission 具有 doc.write 权限的项目成员
 
 @apiHeader {String} Content-type multipart/form-data 多类型表单固定值。
 
@@ -403,6 +412,9 @@ func (c *DocController) contentPost(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !inProject(ctx, projectId) || !owned(ctx, repo.ResourceDoc, docId) {
+		return
+	}
 
 	title := ctx.PostForm("title")
 	if title == "" {
@@ -450,38 +462,25 @@ func (c *DocController) contentPost(ctx *gin.Context) {
 			}
 		}
 
-		// 打开一个存在的文件，将原来的内容覆盖掉
-		filename := filepath.Join(dir.DocDir, formDocId, doc.Filename)
-		// O_WRONLY: 只写, O_TRUNC: 清空文件
-		file, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC, 0666)
-		if err != nil {
+		// 覆盖一个存在的文件
+		filename := path.Join(strconv.Itoa(doc.ID), doc.Filename)
+		if _, err = storage.Doc.Stat(filename); err != nil {
 			ErrIllegal(ctx, "文件打开错误")
 			return
 		}
 
-		defer file.Close()
-
 		// 防止删除文件本身
 		fileContent := fmt.Sprintf("(%s &file=%s)", content, doc.Filename)
 
 		// 删除文件中未被引用的文档资源
-		err = reuint.DeleteUnreferencedFiles(fileContent, filepath.Join(dir.DocDir, strconv.Itoa(docId)))
+		err = deleteUnreferencedFiles(fileContent, strconv.Itoa(doc.ID))
 		if err != nil {
 			ErrSys(ctx, err)
 			return
 		}
 
-		// 带缓冲区的*Writer
-		writer := bufio.NewWriter(file)
-
-		_, err = writer.WriteString(content)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
-
-		// 将缓冲区中的内容写入到文件里
-		err = writer.Flush()
+		// 将原来的内容覆盖掉
+		err = storage.WriteFile(storage.Doc, filename, []byte(content))
 		if err != nil {
 			ErrSys(ctx, err)
 			return
@@ -505,8 +504,8 @@ func (c *DocController) contentPost(ctx *gin.Context) {
 
 			// 删除原有文件
 			if doc.Filename != "" {
-				removePath := filepath.Join(dir.DocDir, formDocId, doc.Filename)
-				err := os.Remove(removePath)
+				removePath := path.Join(strconv.Itoa(doc.ID), doc.Filename)
+				err := storage.Doc.Remove(removePath)
 				if err != nil {
 					ErrSys(ctx, err)
 					return
@@ -526,8 +525,8 @@ func (c *DocController) contentPost(ctx *gin.Context) {
 			}
 			doc.Filename = filename
 			// 生成文件
-			docFile := filepath.Join(dir.DocDir, strconv.Itoa(doc.ID), doc.Filename)
-			err = ctx.SaveUploadedFile(file, docFile)
+			docFile := path.Join(strconv.Itoa(doc.ID), doc.Filename)
+			err = storage.SaveUploadedFile(storage.Doc, file, docFile)
 			if err != nil {
 				ErrSys(ctx, err)
 				return
@@ -561,7 +560,7 @@ func (c *DocController) contentPost(ctx *gin.Context) {
 @apiName DocContentGet
 @apiGroup Doc
 
-@apiPermission markdown-项目负责人、开发、测试、维护 其他类型-项目负责人、开发
+@apiPermission 具有 project.read 权限的项目成员，下载非markdown文档还需具有 doc.export 权限
 
 @apiParam {Integer} docId 文档ID。
 @apiParam {Integer} projectId 项目ID。
@@ -589,12 +588,15 @@ HTTP/1.1 400 Bad Request
 func (c *DocController) contentGet(ctx *gin.Context) {
 	var doc entity.Document
 	//var docDto dto.DocDto
-	id := ctx.Query("docId")
+	id, _ := strconv.Atoi(ctx.Query("docId"))
 	projectId, _ := strconv.Atoi(ctx.Query("projectId"))
-	if projectId <= 0 {
+	if id <= 0 || projectId <= 0 {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !inProject(ctx, projectId) || !owned(ctx, repo.ResourceDoc, id) {
+		return
+	}
 
 	err := repo.DB.Where("id", id).Find(&doc).Error
 	if err != nil {
@@ -602,15 +604,9 @@ func (c *DocController) contentGet(ctx *gin.Context) {
 		return
 	}
 
-	filePath := filepath.Join(dir.DocDir, id, doc.Filename)
+	filePath := path.Join(strconv.Itoa(doc.ID), doc.Filename)
 	if doc.DocType == "markdown" {
-		file, err := os.Open(filePath)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
-		defer file.Close()
-		content, err := io.ReadAll(file)
+		content, err := storage.ReadFile(storage.Doc, filePath)
 		if err != nil {
 			ErrSys(ctx, err)
 			return
@@ -618,24 +614,17 @@ func (c *DocController) contentGet(ctx *gin.Context) {
 		ctx.JSON(200, string(content))
 	} else {
 		// 判断是否可下载
-		claimsValue, _ := ctx.Get(middle.FlagClaims)
-		claims := claimsValue.(*jwt.Claims)
-		info := &entity.ProjectMember{}
-		err := repo.DB.First(info, "project_id = ? AND user_id = ?", projectId, claims.Sub).Error
-		if err == gorm.ErrRecordNotFound {
-			ErrIllegal(ctx, "权限错误")
-			return
-		}
+		role, err := memberRole(ctx)
 		if err != nil {
 			ErrSys(ctx, err)
 			return
 		}
-		if info.Role == 1 || info.Role == 3 {
-			ErrIllegal(ctx, "权限不足")
+		if role == nil || !role.HasPermission(entity.PermDocExport) {
+			denied(ctx, map[string]interface{}{"projectId": projectId, "permission": entity.PermDocExport})
 			return
 		}
 
-		file, err := os.Open(filePath)
+		file, err := storage.Doc.Open(filePath)
 		if err != nil {
 			ErrIllegal(ctx, "文件解析失败")
 			return
@@ -672,7 +661,7 @@ func (c *DocController) contentGet(ctx *gin.Context) {
 @apiName DocAssertPOST
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发
+@apiPermission 具有 doc.write 权限的项目成员
 
 @apiHeader {String} Content-type multipart/form-data 多类型表单固定值。
 
@@ -703,6 +692,37 @@ HTTP/1.1 400 Bad Request
 参数非法，无法解析
 */
 
+// docAssertPath 文档资源在对接文档存储中的路径
+// 防止用户通过 ../../ 的方式访问到文档目录之外的文件
+func docAssertPath(docId, filename string) (string, bool) {
+	base, ok := storage.Clean(docId)
+	if !ok || base == "" {
+		return "", false
+	}
+	p, ok := storage.Clean(path.Join(base, filename))
+	return p, ok && storage.IsSub(base, p)
+}
+
+// deleteUnreferencedFiles 删除文档目录中未被文档内容引用的资源文件
+func deleteUnreferencedFiles(content string, docDir string) error {
+	items, err := storage.Doc.List(docDir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		if !item.IsDir {
+			names = append(names, item.Name)
+		}
+	}
+	for _, name := range reuint.UnreferencedFiles(content, names) {
+		if err = storage.Doc.Remove(path.Join(docDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // assertPost 上传文档资源
 func (c *DocController) assertPost(ctx *gin.Context) {
 	var docUri dto.UriDto
@@ -714,10 +734,14 @@ func (c *DocController) assertPost(ctx *gin.Context) {
 		"StageId": id,
 	})
 	projectId, _ := strconv.Atoi(ctx.PostForm("projectId"))
-	if projectId <= 0 {
+	docId, _ := strconv.Atoi(id)
+	if projectId <= 0 || docId <= 0 {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
+	if !inProject(ctx, projectId) || !owned(ctx, repo.ResourceDoc, docId) {
+		return
+	}
 
 	// 获取表单的文件
 	file, err := ctx.FormFile("file")
@@ -736,8 +760,12 @@ func (c *DocController) assertPost(ctx *gin.Context) {
 
 	filename := reuint.GenTimeFileName(file.Filename)
 
-	filePath := filepath.Join(dir.DocDir, id, filename)
-	err = ctx.SaveUploadedFile(file, filePath)
+	filePath, ok := docAssertPath(id, filename)
+	if !ok {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	err = storage.SaveUploadedFile(storage.Doc, file, filePath)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -757,7 +785,7 @@ func (c *DocController) assertPost(ctx *gin.Context) {
 @apiName DocAssertGET
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发、测试、维护
+@apiPermission 具有 doc.export 权限的项目成员
 
 @apiParam {Integer} docId 文档ID。
 @apiParam {String} file 文件名称。
@@ -777,17 +805,23 @@ func (c *DocController) assertGet(ctx *gin.Context) {
 
 	id := ctx.Query("docId")
 	filename := ctx.Query("file")
+	docId, _ := strconv.Atoi(id)
+	if docId <= 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	if !owned(ctx, repo.ResourceDoc, docId) {
+		return
+	}
 
 	// 文件路径
-	filePath := filepath.Join(dir.DocDir, id, filename)
-
-	// 防止用户通过 ../../ 的方式下载到操作系统内的重要文件
-	if !strings.HasPrefix(filePath, filepath.Join(dir.DocDir, id)) {
+	filePath, ok := docAssertPath(id, filename)
+	if !ok {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
 
-	file, err := os.Open(filePath)
+	file, err := storage.Doc.Open(filePath)
 	if err != nil {
 		ErrIllegal(ctx, "文件解析失败")
 		return
@@ -816,9 +850,9 @@ func (c *DocController) assertGet(ctx *gin.Context) {
 @apiName DocLock
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发
+@apiPermission 具有 doc.write 权限的项目成员
 
-@apiParam {Integer} userId 用户ID
+@apiParam {Integer} [userId] 用户ID，已忽略，使用当前登录用户
 @apiParam {Integer} projectId  项目ID
 @apiParam {Integer} id        文档ID
 @apiParam {String}  docType  文档类型
@@ -856,6 +890,12 @@ func (c *DocController) lock(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数解析错误")
 		return
 	}
+	if !inProject(ctx, lockDto.ProjectId) || !owned(ctx, repo.ResourceDoc, lockDto.Id) {
+		return
+	}
+	// 仅能以当前用户的身份获取锁
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	lockDto.UserId = claimsValue.(*jwt.Claims).Sub
 
 	// 获取锁信息
 	v := editLock.Query(lockDto.ProjectId, lockDto.Id, lockDto.DocType)
@@ -876,9 +916,9 @@ func (c *DocController) lock(ctx *gin.Context) {
 @apiName DocCancel
 @apiGroup Doc
 
-@apiPermission 项目负责人、开发
+@apiPermission 具有 doc.write 权限的项目成员
 
-@apiParam {Integer} userId 用户ID
+@apiParam {Integer} [userId] 用户ID，已忽略，使用当前登录用户
 @apiParam {Integer} projectId  项目ID
 @apiParam {Integer} id        文档ID
 @apiParam {String}  docType  文档类型
@@ -917,6 +957,12 @@ func (c *DocController) cancel(ctx *gin.Context) {
 		"userId": lockDto.UserId,
 		"id":     lockDto.Id,
 	})
+	if !inProject(ctx, lockDto.ProjectId) || !owned(ctx, repo.ResourceDoc, lockDto.Id) {
+		return
+	}
+	// 仅能释放当前用户持有的锁
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	lockDto.UserId = claimsValue.(*jwt.Claims).Sub
 
 	// 获取锁信息
 	v := editLock.Query(lockDto.ProjectId, lockDto.Id, lockDto.DocType)
@@ -934,14 +980,7 @@ func (c *DocController) cancel(ctx *gin.Context) {
 	}
 
 	docId := strconv.Itoa(lockDto.Id)
-	filePath := filepath.Join(dir.DocDir, docId, doc.Filename)
-	file, err := os.Open(filePath)
-	if err != nil {
-		ErrSys(ctx, err)
-		return
-	}
-	defer file.Close()
-	content, err := io.ReadAll(file)
+	content, err := storage.ReadFile(storage.Doc, path.Join(docId, doc.Filename))
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -951,7 +990,7 @@ func (c *DocController) cancel(ctx *gin.Context) {
 	fileContent := fmt.Sprintf("(%s &file=%s)", string(content), doc.Filename)
 
 	// 删除文件中未被引用的文档资源
-	err = reuint.DeleteUnreferencedFiles(fileContent, filepath.Join(dir.DocDir, strconv.Itoa(doc.ID)))
+	err = deleteUnreferencedFiles(fileContent, docId)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -969,7 +1008,7 @@ func (c *DocController) cancel(ctx *gin.Context) {
 @apiName DocExport
 @apiGroup Doc
 
-@apiPermission 项目负责人
+@apiPermission 具有 doc.export 权限的项目成员
 
 @apiParam {String} docId 文档ID。
 
@@ -991,6 +1030,10 @@ func (c *DocController) export(ctx *gin.Context) {
 	applog.L(ctx, "导出文档", map[string]interface{}{
 		"docId": docId,
 	})
+	id, _ := strconv.Atoi(docId)
+	if !owned(ctx, repo.ResourceDoc, id) {
+		return
+	}
 
 	err := repo.DB.First(&doc, "id = ?", docId).Error
 	if err != nil {
@@ -1004,8 +1047,6 @@ func (c *DocController) export(ctx *gin.Context) {
 		return
 	}
 
-	docFilePath := filepath.Join(dir.DocDir, docId)
-
 	// 生成临时文件夹 文件夹名称格式 文件名_更新时间
 	temporaryFolderName := fmt.Sprintf("%s_%s", doc.Title, doc.UpdatedAt.Format("20060102"))
 
@@ -1018,7 +1059,12 @@ func (c *DocController) export(ctx *gin.Context) {
 	// 无论导出文件是否成功，都需要删除临时文件
 	defer os.RemoveAll(temp)
 
-	err = reuint.CopyTempDir(docFilePath, temp)
+	tempStorage, err := storage.NewLocal(temp)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	err = storage.Transfer(tempStorage, "", storage.Doc, strconv.Itoa(doc.ID))
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -1085,12 +1131,13 @@ func (c *DocController) export(ctx *gin.Context) {
 /**
 @api {GET} /api/doc/generate 导出文档
 @apiDescription 生成技术方案。
-
+技术方案生成在项目的技术方案目录中，该目录在首次生成时以项目名称创建，项目改名后仍使用原目录。
+已归档的项目不可生成技术方案，响应403。
 
 @apiName DocGenerate
 @apiGroup Doc
 
-@apiPermission 项目负责人
+@apiPermission 具有 doc.export 权限的项目成员
 
 @apiParam {String} docId 文档ID。
 
@@ -1107,59 +1154,62 @@ HTTP/1.1 400 Bad Request
 // generate 生成技术方案
 func (c *DocController) generate(ctx *gin.Context) {
 	var doc entity.Document
-	var technicalProposal entity.TechnicalProposal
 	docId := ctx.Query("docId")
 
 	applog.L(ctx, "生成技术方案", map[string]interface{}{
 		"docId": docId,
 	})
+	id, _ := strconv.Atoi(docId)
+	if !owned(ctx, repo.ResourceDoc, id) {
+		return
+	}
 	if err := repo.DB.First(&doc, "id = ?", docId).Error; err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	claimsValue, _ := ctx.Get(middle.FlagClaims)
-	claims := claimsValue.(*jwt.Claims)
-	projectName, err := repo.ProjectRepo.GetProjectName(ctx)
+	projectId := middle.ProjectID(ctx)
+	// 生成技术方案会修改项目的技术方案目录
+	if !writable(ctx, projectId) {
+		return
+	}
+	// 技术方案目录在首次生成时以项目名称创建并记录，项目改名后仍使用原目录
+	dir, err := repo.NewTechnicalProposalRepository().Dir(projectId)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	tpDir := filepath.Join(dir.TechnicalProposalDir, projectName)
-	err = repo.DB.First(&technicalProposal, "project_id = ?", claims.PID).Error
-	if err == gorm.ErrRecordNotFound {
-		_ = os.MkdirAll(tpDir, os.ModePerm)
+	if dir == "" {
+		if dir, err = repo.ProjectRepo.GetProjectName(ctx); err != nil {
+			ErrSys(ctx, err)
+			return
+		}
 	}
-	if err != nil && err != gorm.ErrRecordNotFound {
+	tpDir, ok := storage.Clean(dir)
+	if !ok || tpDir == "" {
+		ErrIllegal(ctx, "文件路径错误")
+		return
+	}
+	if err = storage.TechnicalProposal.MkdirAll(tpDir); err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	docFilePath := filepath.Join(dir.DocDir, docId)
 
 	// 生成目标文件夹 文件夹名称格式 文件名_更新时间
 	filename := fmt.Sprintf("%s_%s", doc.Title, doc.UpdatedAt.Format("20060102"))
-	destPath := filepath.Join(tpDir, filename)
-
-	_ = os.MkdirAll(destPath, os.ModePerm)
-	if err = reuint.CopyDir(docFilePath, destPath); err != nil {
-		ErrSys(ctx, err)
+	destPath, ok := storage.Clean(path.Join(tpDir, filename))
+	// 防止用户通过 ../../ 的方式写入到其他项目的技术方案中
+	if !ok || !storage.IsSub(tpDir, destPath) {
+		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
-	temp := filepath.Join(destPath, doc.Filename)
-
-	dest, err := os.OpenFile(temp, os.O_RDWR, os.ModePerm)
-	if err != nil {
+	if err = storage.Transfer(storage.TechnicalProposal, destPath, storage.Doc, strconv.Itoa(doc.ID)); err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	// 读取文件
+	temp := path.Join(destPath, doc.Filename)
 
-	// 防止用户通过 ../../ 的方式下载到操作系统内的重要文件
-	if !strings.HasPrefix(dest.Name(), tpDir) {
-		ErrIllegal(ctx, "文件路径错误")
-		return
-	}
-
-	content, err := io.ReadAll(dest)
+	// 读取文件
+	content, err := storage.ReadFile(storage.TechnicalProposal, temp)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -1167,22 +1217,14 @@ func (c *DocController) generate(ctx *gin.Context) {
 	reg := regexp.MustCompile("\\/api\\/doc\\/assert\\?docId=[0-9]+(\\\\)?&file=")
 	results := reg.ReplaceAllString(string(content), "./")
 	// 将修改后的内容写入文件
-	// 带缓冲区的*Writer
-	writer := bufio.NewWriter(dest)
-	if _, err = writer.WriteString(results); err != nil {
-		ErrSys(ctx, err)
-		return
-	}
-
-	// 将缓冲区中的内容写入到文件里
-	if err = writer.Flush(); err != nil {
+	if err = storage.WriteFile(storage.TechnicalProposal, temp, []byte(results)); err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	dest.Close()
 	res := entity.TechnicalProposal{
 		Name:      doc.Filename,
-		ProjectId: claims.PID,
+		ProjectId: projectId,
+		Dir:       tpDir,
 	}
 	if err = repo.DB.Create(&res).Error; err != nil {
 		ErrSys(ctx, err)
@@ -0,0 +1,21 @@
+package dto
+
+import "pdm/repo/entity"
+
+// AccessTokenCreateDto 创建个人访问令牌
+type AccessTokenCreateDto struct {
+	Name      string   `json:"name"`      // 令牌名称
+	Scopes    []string `json:"scopes"`    // 权限范围：read、docs:write、cases:run
+	ProjectID int      `json:"projectId"` // 可访问的项目ID
+	ExpiresAt int64    `json:"expiresAt"` // 过期时间，单位Unix时间戳毫秒（ms）
+}
+
+// AccessTokenResultDto 创建的个人访问令牌
+type AccessTokenResultDto struct {
+	ID        int             `json:"id"`        // 令牌ID
+	Name      string          `json:"name"`      // 令牌名称
+	Token     string          `json:"token"`     // 令牌，仅在创建时返回一次
+	Scopes    string          `json:"scopes"`    // 权限范围，多个用","隔开
+	ProjectID int             `json:"projectId"` // 可访问的项目ID
+	ExpiresAt entity.DateTime `json:"expiresAt"` // 过期时间
+}
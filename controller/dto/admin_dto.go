@@ -0,0 +1,33 @@
+package dto
+
+import "pdm/repo/entity"
+
+// AdminCreateDto 创建管理员或审计员
+type AdminCreateDto struct {
+	Username string `json:"username"` // 用户名
+	Role     int    `json:"role"`     // 角色类型 0 - 管理员 1 - 审计员
+}
+
+// AdminIdDto 管理员ID
+type AdminIdDto struct {
+	ID int `json:"id"` // 管理员ID
+}
+
+// AdminItemDto 管理员列表项
+type AdminItemDto struct {
+	ID        int             `json:"id"`        // 管理员ID
+	CreatedAt entity.DateTime `json:"createdAt"` // 创建时间
+	Username  string          `json:"username"`  // 用户名
+	Role      int             `json:"role"`      // 角色类型 0 - 管理员 1 - 审计员
+	Disabled  int             `json:"disabled"`  // 是否禁用 0 - 启用 1 - 禁用
+	Certs     int             `json:"certs"`     // 绑定的证书数量
+	Binding   bool            `json:"binding"`   // 是否有未使用且未过期的证书绑定码
+}
+
+// AdminBindCodeDto 证书绑定码
+type AdminBindCodeDto struct {
+	ID        int             `json:"id"`        // 管理员ID
+	Username  string          `json:"username"`  // 用户名
+	BindCode  string          `json:"bindCode"`  // 证书绑定码，仅返回一次
+	ExpiresAt entity.DateTime `json:"expiresAt"` // 绑定码过期时间
+}
@@ -12,6 +12,25 @@ type LoginToDto struct {
 	Openid   string `json:"openid"` // 工号
 	Name     string `json:"name"`   // 用户姓名
 	Exp      int64  `json:"exp"`    // 会话过期时间，单位Unix时间戳毫秒（ms）
+	// MustChgPwd 需修改口令，为true时仅能调用修改口令接口
+	MustChgPwd bool `json:"mustChgPwd"`
+	// RecoveryCodes 登录时完成动态口令绑定生成的恢复码，仅返回一次
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// LoginPendingDto 口令验证通过，需继续验证动态口令
+type LoginPendingDto struct {
+	TotpRequired bool   `json:"totpRequired"` // 需验证动态口令，固定为true
+	Enrolled     bool   `json:"enrolled"`     // 是否已绑定动态口令，未绑定时需先完成绑定
+	PendingToken string `json:"pendingToken"` // 登录凭证，用于第二步验证
+	Exp          int64  `json:"exp"`          // 登录凭证过期时间，单位Unix时间戳毫秒（ms）
+}
+
+// LoginTotpDto 登录第二步验证动态口令
+type LoginTotpDto struct {
+	PendingToken string `json:"pendingToken"` // 第一步返回的登录凭证
+	Code         string `json:"code"`         // 动态口令
+	RecoveryCode string `json:"recoveryCode"` // 恢复码，无法使用身份验证器时代替动态口令
 }
 
 // Transform 将数据赋值给dto，返回前端
@@ -19,6 +38,7 @@ func (loginToDto *LoginToDto) Transform(claims *jwt.Claims) *LoginToDto {
 	loginToDto.UserType = claims.Type
 	loginToDto.ID = claims.Sub
 	loginToDto.Exp = claims.Exp
+	loginToDto.MustChgPwd = claims.MustChgPwd
 	return loginToDto
 }
 
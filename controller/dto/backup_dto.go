@@ -0,0 +1,17 @@
+package dto
+
+// BackupItemDto 备份文件
+type BackupItemDto struct {
+	Name      string `json:"name"`      // 备份文件名
+	Size      int64  `json:"size"`      // 文件大小，单位B
+	CreatedAt string `json:"createdAt"` // 备份时间格式 YYYY-MM-DD HH:mm:ss
+}
+
+// BackupResultDto 备份结果
+type BackupResultDto struct {
+	BackupItemDto
+	DBVersion string `json:"dbVersion"` // 数据库版本
+	Tables    int    `json:"tables"`    // 数据表数量
+	Rows      int64  `json:"rows"`      // 数据记录总数
+	Files     int    `json:"files"`     // 业务文件数量
+}
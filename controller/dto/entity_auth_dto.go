@@ -4,15 +4,18 @@ type EntityAuthDto struct {
 	Ra        string `json:"Ra"`        // 随机数Ra
 	Rb        string `json:"Rb"`        // 随机数Rb
 	B         string `json:"B"`         // 可区分标识符B
+	Ta        int64  `json:"Ta"`        // 时间戳TA，Unix时间戳毫秒
 	Text3     string `json:"text3"`     // 用户名
 	Signature string `json:"signature"` // 签名值
 }
 
 type CertBindingDto struct {
 	Cert      string `json:"cert"`      // 证书
+	Code      string `json:"code"`      // 证书绑定码
 	Ra        string `json:"Ra"`        // 随机数Ra
 	Rb        string `json:"Rb"`        // 随机数Rb
 	B         string `json:"B"`         // 可区分标识符B
+	Ta        int64  `json:"Ta"`        // 时间戳TA，Unix时间戳毫秒
 	Text3     string `json:"text3"`     // 用户名
 	Signature string `json:"signature"` // 签名值
 }
@@ -0,0 +1,25 @@
+package dto
+
+import "pdm/repo/entity"
+
+// LoginThrottleDto 登录失败记录
+type LoginThrottleDto struct {
+	ID          int              `json:"id"`          // 记录ID
+	Kind        string           `json:"kind"`        // 统计对象类型: user - 用户、 username - 不存在的用户名、 ip - 来源IP
+	Target      string           `json:"target"`      // 用户ID、用户名或IP
+	Name        string           `json:"name"`        // 用户姓名，仅用户类型有效
+	Failures    int              `json:"failures"`    // 统计窗口内的失败次数
+	Locks       int              `json:"locks"`       // 连续锁定次数
+	LastFailAt  entity.DateTime  `json:"lastFailAt"`  // 最近失败时间
+	LockedUntil *entity.DateTime `json:"lockedUntil"` // 锁定截止时间，从未锁定为空
+	Locked      bool             `json:"locked"`      // 当前是否处于锁定状态
+}
+
+// LoginThrottleSearchDto 登录失败记录搜索
+type LoginThrottleSearchDto struct {
+	Kind   string `form:"kind" json:"kind"`     // 统计对象类型，为空表示所有
+	Target string `form:"target" json:"target"` // 用户ID、用户名或IP，模糊匹配
+	Locked bool   `form:"locked" json:"locked"` // 仅查询处于锁定状态的记录
+	Page   int    `form:"page" json:"page"`     // 页码 1 起
+	Limit  int    `form:"limit" json:"limit"`   // 页容量，默认20
+}
@@ -11,10 +11,42 @@ type MemberDTO struct {
 
 // MemberAllDTO all接口将数据返回前端
 type MemberAllDTO struct {
-	ID     int    `json:"id"`     // 记录ID
-	UserId int    `json:"userId"` // 用户ID
-	Role   int    `json:"role"`   // 角色 角色类型包括：0 - 访客，1 - 测试，2 - 开发，3 - 维护，4-负责人
-	Name   string `json:"name"`
+	ID         int    `json:"id"`         // 记录ID
+	UserId     int    `json:"userId"`     // 用户ID
+	Role       int    `json:"role"`       // 角色编号：0 - 开发者，1 - 对接者，2 - 负责人，3 - 管理员，100及以上为项目自定义角色
+	Name       string `json:"name"`       // 姓名
+	Username   string `json:"username"`   // 用户名
+	NamePinyin string `json:"namePinyin"` // 姓名拼音缩写
+}
+
+// MemberBatchDTO 批量修改成员角色
+type MemberBatchDTO struct {
+	ProjectId int   `json:"projectId"` // 项目ID
+	Ids       []int `json:"ids"`       // 成员记录ID
+	Role      int   `json:"role"`      // 角色编号
+}
+
+// MemberTransferDTO 移交项目负责人
+type MemberTransferDTO struct {
+	ProjectId int `json:"projectId"` // 项目ID
+	UserId    int `json:"userId"`    // 新负责人的用户ID，需为项目成员
+}
+
+// MemberCandidateDTO 可添加为成员的用户
+type MemberCandidateDTO struct {
+	ID         int    `json:"id"`         // 用户ID
+	Name       string `json:"name"`       // 姓名
+	Username   string `json:"username"`   // 用户名
+	NamePinyin string `json:"namePinyin"` // 姓名拼音缩写
+}
+
+// MyProjectDTO 用户参与的项目以及在项目中的角色
+type MyProjectDTO struct {
+	ProjectId   int      `json:"projectId"`   // 项目ID
+	Name        string   `json:"name"`        // 项目名称
+	Role        int      `json:"role"`        // 角色编号
+	RoleName    string   `json:"roleName"`    // 角色名称
+	Permissions []string `json:"permissions"` // 角色具有的权限
 }
 
 // Transform 将实体数据赋值给dto返回给前端
@@ -24,6 +24,7 @@ type OplogDto struct {
 	Name      string          `json:"name"`    // 名称
 	OpName    string          `json:"opName"`  // 操作名称
 	OpParam   string          `json:"opParam"` // 操作的关键参数 可选参数，例如删除用户时，删除的用户ID，复杂参数请使用JSON对象字符串，如{id: 1}
+	TokenID   int             `json:"tokenId"` // 通过个人访问令牌操作时的令牌ID，0表示通过登录会话操作
 }
 
 // Transform 将实体数据赋值给dto返回给前端
@@ -34,6 +35,7 @@ func (o *OplogDto) Transform(log *entity.Log) *OplogDto {
 	o.UserID = log.OpId
 	o.OpName = log.OpName
 	o.OpParam = log.OpParam
+	o.TokenID = log.TokenId
 	return o
 }
 
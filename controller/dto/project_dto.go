@@ -26,9 +26,10 @@ type ProjectSearchDto struct {
 	ID        int             `gorm:"autoIncrement" json:"id"`
 	CreatedAt entity.DateTime `json:"createdAt"`
 	UpdatedAt entity.DateTime `json:"updatedAt"`
-	Name      string          `json:"name"`    // 项目名称
-	Manage    member          `json:"manager"` // 项目负责人ID
-	Version   string          `json:"version"` //版本号
+	Name      string          `json:"name"`      // 项目名称
+	Manage    member          `json:"manager"`   // 项目负责人ID
+	Version   string          `json:"version"`   //版本号
+	IsArchive int             `json:"isArchive"` // 是否归档 0 - 未归档 1 - 归档
 }
 
 type member struct {
@@ -47,9 +48,16 @@ func (p *ProjectSearchDto) Transform(c *entity.Project, u *entity.User) *Project
 		Name: u.Name,
 	}
 	p.Version = c.Version
+	p.IsArchive = c.IsArchive
 	return p
 }
 
+// ProjectInactiveDto 已归档或已删除的项目
+type ProjectInactiveDto struct {
+	ProjectSearchDto
+	IsDelete int `json:"isDelete"` // 是否删除 0 - 未删除 1 - 删除
+}
+
 // ProjectInfoDto 项目详细信息Dto
 type ProjectInfoDto struct {
 	ID          int             `gorm:"autoIncrement" json:"id"`
@@ -0,0 +1,8 @@
+package dto
+
+// ProjectRoleDto 创建或修改项目角色
+type ProjectRoleDto struct {
+	Role        int      `json:"role"`        // 角色编号，创建时忽略
+	Name        string   `json:"name"`        // 角色名称
+	Permissions []string `json:"permissions"` // 权限列表，见 entity.Permissions
+}
@@ -0,0 +1,25 @@
+package dto
+
+import "pdm/repo/entity"
+
+// SessionDto 登录会话
+type SessionDto struct {
+	ID         string          `json:"id"`         // 会话ID
+	CreatedAt  entity.DateTime `json:"createdAt"`  // 登录时间
+	UserType   string          `json:"userType"`   // 用户类型: user - 用户、 admin - 管理员、 audit - 审计员
+	UserID     int             `json:"userId"`     // 用户ID或管理员ID
+	Name       string          `json:"name"`       // 用户姓名或管理员用户名
+	IP         string          `json:"ip"`         // 登录IP
+	UserAgent  string          `json:"userAgent"`  // 客户端标识
+	LastSeenAt entity.DateTime `json:"lastSeenAt"` // 最近访问时间
+	ExpiresAt  entity.DateTime `json:"expiresAt"`  // 过期时间
+	Current    bool            `json:"current"`    // 是否为当前请求所属的会话
+}
+
+// SessionSearchDto 会话搜索
+type SessionSearchDto struct {
+	UserType string `form:"userType" json:"userType"` // 用户类型，为空表示所有
+	UserID   int    `form:"userId" json:"userId"`     // 用户ID或管理员ID，0表示所有
+	Page     int    `form:"page" json:"page"`         // 页码 1 起
+	Limit    int    `form:"limit" json:"limit"`       // 页容量，默认20
+}
@@ -0,0 +1,26 @@
+package dto
+
+// TotpCodeDto 动态口令
+type TotpCodeDto struct {
+	Code string `json:"code"` // 身份验证器App显示的6位动态口令
+}
+
+// TotpSetupDto 动态口令绑定信息
+type TotpSetupDto struct {
+	Secret string `json:"secret"` // 动态口令密钥Base32，无法扫码时手动输入
+	URI    string `json:"uri"`    // 配置URI，前端生成二维码供身份验证器App扫描
+
+	PendingToken string `json:"pendingToken,omitempty"` // 登录时绑定返回的新登录凭证
+}
+
+// TotpStatusDto 动态口令状态
+type TotpStatusDto struct {
+	Enabled       bool  `json:"enabled"`       // 是否已启用
+	Required      bool  `json:"required"`      // 策略是否要求使用动态口令
+	RecoveryCodes int64 `json:"recoveryCodes"` // 剩余可用的恢复码数量
+}
+
+// TotpRecoveryCodesDto 恢复码
+type TotpRecoveryCodesDto struct {
+	RecoveryCodes []string `json:"recoveryCodes"` // 恢复码，仅在生成时返回一次
+}
@@ -8,6 +8,7 @@ type UserCreateDto struct {
 	Openid    string          `json:"openid"`    // 工号
 	Name      string          `json:"name"`      // 姓名
 	CreatedAt entity.DateTime `json:"createdAt"` // 创建时间
+	Password  string          `json:"password"`  // 初始口令，未指定口令时为随机生成的口令，仅在创建时返回
 }
 
 // Transform 将实体数据赋值给dto返回给前端
@@ -26,6 +27,14 @@ type PasswordDto struct {
 	NewPwd entity.Pwd `json:"newPwd"` // 新口令
 }
 
+// PasswordPolicyDto 口令策略
+type PasswordPolicyDto struct {
+	MinLength  int `json:"minLength"`  // 最小长度
+	MinClasses int `json:"minClasses"` // 至少包含的字符类别数，类别包括大写字母、小写字母、数字、特殊字符
+	MaxAge     int `json:"maxAge"`     // 口令有效期（单位：天），0表示不过期
+	History    int `json:"history"`    // 新口令不能与最近使用过的几个口令相同，0表示不限制
+}
+
 // NameListDto 接口将以下数据返回给前端
 type NameListDto struct {
 	ID     int    `json:"id"`     // 用户ID
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"pdm/directory"
+	"pdm/logg/applog"
+)
+
+// NewLdapController 创建目录服务控制器
+func NewLdapController(router gin.IRouter) *LdapController {
+	res := &LdapController{}
+	r := router.Group("/ldap")
+	// 立即同步目录用户
+	r.POST("/sync", Admin, res.sync)
+	return res
+}
+
+// LdapController 目录服务控制器
+type LdapController struct {
+}
+
+/**
+@api {POST} /api/ldap/sync 同步目录用户
+@apiDescription 立即同步目录中的所有用户，同步也会按配置 ldap.syncInterval 定时执行。
+按目录属性创建或更新用户并按组映射加入项目，目录中已不存在的目录用户被删除，并注销其所有会话与访问令牌。
+目录中未找到任何用户时视为配置或目录服务异常，不删除用户。
+@apiName LdapSync
+@apiGroup Ldap
+
+@apiPermission 管理员
+
+@apiParamExample 请求示例
+POST /api/ldap/sync
+
+@apiSuccess {Integer} total 目录中的用户数。
+@apiSuccess {Integer} created 新创建的用户数。
+@apiSuccess {Integer} updated 信息或项目角色有变更的用户数。
+@apiSuccess {String[]} deleted 被删除的用户工号。
+@apiSuccess {String[]} failed 同步失败的目录用户及原因。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "total": 120,
+    "created": 2,
+    "updated": 5,
+    "deleted": ["22001"],
+    "failed": []
+}
+
+@apiErrorExample 失败响应1
+HTTP/1.1 400
+
+目录服务认证未启用
+
+@apiErrorExample 失败响应2
+HTTP/1.1 406
+
+目录同步失败
+*/
+
+// sync 同步目录用户
+func (c *LdapController) sync(ctx *gin.Context) {
+	d := directory.Default()
+	if d == nil {
+		ErrIllegal(ctx, "目录服务认证未启用")
+		return
+	}
+	applog.L(ctx, "目录同步", nil)
+
+	res, err := d.Sync(ctx.Request.Context())
+	if errors.Is(err, directory.ErrBusy) {
+		ErrIllegal(ctx, "同步正在进行中，请稍后再试")
+		return
+	}
+	if err != nil {
+		ErrNormal(ctx, "目录同步失败", err)
+		return
+	}
+	ctx.JSON(200, res)
+}
@@ -0,0 +1,109 @@
+package controller_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pdm/appconf"
+	"pdm/controller/controllertest"
+	"pdm/directory"
+	"pdm/directory/ldaptest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+)
+
+func TestLdap(t *testing.T) {
+	srv := ldaptest.NewServer()
+	defer srv.Close()
+	const group = "cn=dev,ou=groups,dc=example,dc=com"
+	srv.Add("cn=svc,dc=example,dc=com", "svc-secret", nil)
+	srv.Add("uid=2001,ou=people,dc=example,dc=com", "Dir#pass1", map[string][]string{
+		"objectClass": {"person"}, "uid": {"2001"}, "cn": {"王五"}, "mail": {"wangwu@example.com"}, "memberOf": {group},
+	})
+	s := controllertest.NewServer(t, func(cfg *appconf.Application) {
+		cfg.LDAP = appconf.LDAP{
+			Enable:       true,
+			URL:          srv.URL,
+			Timeout:      5,
+			BindDN:       "cn=svc,dc=example,dc=com",
+			BindPassword: "svc-secret",
+			BaseDN:       "dc=example,dc=com",
+			UserFilter:   "(&(objectClass=person)(uid={username}))",
+			SyncFilter:   "(objectClass=person)",
+			Attributes:   appconf.LDAPAttributes{Openid: "uid", Name: "cn", Phone: "mobile", Email: "mail", Group: "memberOf"},
+			Groups:       []appconf.LDAPGroup{{DN: "CN=dev,OU=groups,DC=example,DC=com", ProjectId: 1, Role: entity.RoleInterConnector}},
+		}
+	})
+	if err := directory.Init(&s.Config.LDAP); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(directory.Close)
+	s.CreateUser(&entity.User{Openid: "1001", Name: "张三", Username: "zhangsan"}, "Passw0rd#1")
+	if err := repo.DB.Create(&entity.Project{Name: "项目"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	login := func(username, password string) *httptest.ResponseRecorder {
+		return s.Do(http.MethodPost, "/api/login", `{"username":"`+username+`","password":"`+password+`"}`, "")
+	}
+
+	// 目录用户首次登录时创建用户并按组映射加入项目
+	s.Expect(login("2001", "Dir#pass1"), http.StatusOK, `"mustChgPwd":false`)
+	var usr entity.User
+	if err := repo.DB.Where("openid = ?", "2001").First(&usr).Error; err != nil {
+		t.Fatal(err)
+	}
+	if usr.Source != entity.UserSourceLDAP || usr.Name != "王五" || usr.Email != "wangwu@example.com" {
+		t.Fatalf("unexpected user: %+v", usr)
+	}
+	var member entity.ProjectMember
+	if err := repo.DB.Where("project_id = 1 AND user_id = ?", usr.ID).First(&member).Error; err != nil || member.Role != entity.RoleInterConnector {
+		t.Fatalf("member: %+v %v", member, err)
+	}
+	// 目录口令错误同样计数与锁定
+	for i := 0; i < 5; i++ {
+		s.Expect(login("2001", "wrong"), http.StatusBadRequest, "用户名或口令错误")
+	}
+	s.Expect(login("2001", "Dir#pass1"), http.StatusBadRequest, "用户锁定")
+	s.Expect(login("nobody", "wrong"), http.StatusBadRequest, "用户名或口令错误")
+	// 本地用户仍使用本地口令，不访问目录服务
+	binds := srv.Binds()
+	s.Expect(login("1001", "Passw0rd#1"), http.StatusOK, `"name":"张三"`)
+	if srv.Binds() != binds {
+		t.Fatal("local user should not bind to directory")
+	}
+	// 目录用户的口令不能在系统中重置
+	token := s.AdminToken(0)
+	s.Expect(s.Do(http.MethodPost, "/api/user/resetPwd", fmt.Sprintf(`{"id":%d}`, usr.ID), token), http.StatusBadRequest, "口令由目录服务管理")
+
+	// 同步创建、更新用户
+	s.Expect(s.Do(http.MethodPost, "/api/ldap/sync", "", s.AdminToken(1)), http.StatusForbidden, "")
+	srv.Add("uid=2001,ou=people,dc=example,dc=com", "Dir#pass1", map[string][]string{
+		"objectClass": {"person"}, "uid": {"2001"}, "cn": {"王六"}, "mail": {"wangwu@example.com"}, "memberOf": {group},
+	})
+	srv.Add("uid=2002,ou=people,dc=example,dc=com", "Dir#pass2", map[string][]string{
+		"objectClass": {"person"}, "uid": {"2002"}, "cn": {"赵七"},
+	})
+	s.Expect(s.Do(http.MethodPost, "/api/ldap/sync", "", token), http.StatusOK, `{"total":2,"created":1,"updated":1,"deleted":[],"failed":[]}`)
+	if err := repo.DB.First(&usr, usr.ID).Error; err != nil || usr.Name != "王六" {
+		t.Fatalf("sync update: %+v %v", usr, err)
+	}
+	// 目录中已不存在的用户被删除，本地用户不受影响
+	srv.Remove("uid=2001,ou=people,dc=example,dc=com")
+	s.Expect(s.Do(http.MethodPost, "/api/ldap/sync", "", token), http.StatusOK, `"deleted":["2001"]`)
+	if err := repo.DB.First(&usr, usr.ID).Error; err != nil || usr.IsDelete != 1 {
+		t.Fatalf("sync delete: %+v %v", usr, err)
+	}
+	var count int64
+	repo.DB.Model(&entity.User{}).Where("is_delete = 0").Count(&count)
+	if count != 2 {
+		t.Fatalf("expect 2 users, got %d", count)
+	}
+	// 目录中未找到任何用户时不删除用户
+	srv.Remove("uid=2002,ou=people,dc=example,dc=com")
+	s.Expect(s.Do(http.MethodPost, "/api/ldap/sync", "", token), http.StatusNotAcceptable, "目录同步失败")
+	repo.DB.Model(&entity.User{}).Where("is_delete = 0").Count(&count)
+	if count != 2 {
+		t.Fatalf("expect 2 users, got %d", count)
+	}
+}
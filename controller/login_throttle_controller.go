@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pdm/controller/dto"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewLoginThrottleController 创建登录锁定管理控制器
+func NewLoginThrottleController(router gin.IRouter) *LoginThrottleController {
+	res := &LoginThrottleController{}
+	r := router.Group("/throttle")
+	// 搜索登录失败记录
+	r.GET("/search", Admin, res.search)
+	// 解除登录锁定
+	r.DELETE("/clear", Admin, res.clear)
+	return res
+}
+
+// LoginThrottleController 登录锁定管理控制器
+// 登录失败次数达到上限的账号或来源IP被锁定，管理员可以查看并提前解除锁定。
+type LoginThrottleController struct {
+}
+
+/**
+@api {GET} /api/throttle/search 搜索登录失败记录
+@apiDescription 搜索账号与来源IP的登录失败记录，支持分页查询，按最近失败时间由新到旧排序。
+记录在统计窗口内未再失败且锁定结束较久后自动清理。
+@apiName ThrottleSearch
+@apiGroup Throttle
+
+@apiPermission 管理员
+
+@apiParam {String=user,username,ip} [kind] 统计对象类型：user - 用户、username - 不存在的用户名、ip - 来源IP，为空表示所有。
+@apiParam {String} [target] 用户ID、用户名或IP，模糊匹配。
+@apiParam {Boolean} [locked=false] 仅查询处于锁定状态的记录。
+@apiParam {Integer} [page=1] 分页查询页码，表示第几页，默认 1。
+@apiParam {Integer} [limit=20] 单页多少数据，默认 20。
+
+@apiParamExample 请求示例
+GET /api/throttle/search?locked=true&page=1&limit=20
+
+@apiSuccess {LoginThrottleDto[]} records 查询结果列表。
+@apiSuccess {Integer} total 记录总数。
+@apiSuccess {Integer} size 每页显示条数，默认 20。
+@apiSuccess {Integer} current 当前页。
+@apiSuccess {Integer} pages 总页数。
+
+@apiSuccess (LoginThrottleDto) {Integer} id 记录ID。
+@apiSuccess (LoginThrottleDto) {String} kind 统计对象类型。
+@apiSuccess (LoginThrottleDto) {String} target 用户ID、用户名或IP。
+@apiSuccess (LoginThrottleDto) {String} name 用户姓名，仅用户类型有效。
+@apiSuccess (LoginThrottleDto) {Integer} failures 统计窗口内的失败次数，锁定后清零。
+@apiSuccess (LoginThrottleDto) {Integer} locks 连续锁定次数。
+@apiSuccess (LoginThrottleDto) {String} lastFailAt 最近失败时间。
+@apiSuccess (LoginThrottleDto) {String} lockedUntil 锁定截止时间，从未锁定为null。
+@apiSuccess (LoginThrottleDto) {Boolean} locked 当前是否处于锁定状态。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "records": [
+        {
+            "id": 3,
+            "kind": "user",
+            "target": "12",
+            "name": "张三",
+            "failures": 0,
+            "locks": 1,
+            "lastFailAt": "2026-10-17 09:20:00",
+            "lockedUntil": "2026-10-17 09:30:00",
+            "locked": true
+        }
+    ],
+    "total": 1,
+    "size": 20,
+    "current": 1,
+    "pages": 1
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// search 搜索登录失败记录
+func (c *LoginThrottleController) search(ctx *gin.Context) {
+	var param dto.LoginThrottleSearchDto
+	param.Page = 1
+	param.Limit = 20
+	if ctx.ShouldBindQuery(&param) != nil || param.Page < 1 || param.Limit < 1 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	now := time.Now()
+	query, tx := repo.NewPageQueryFnc(repo.DB, &entity.LoginThrottle{}, param.Page, param.Limit, func(db *gorm.DB) *gorm.DB {
+		if param.Kind != "" {
+			db = db.Where("kind = ?", param.Kind)
+		}
+		if param.Target != "" {
+			db = db.Where("target LIKE ?", "%"+param.Target+"%")
+		}
+		if param.Locked {
+			db = db.Where("locked_until > ?", now)
+		}
+		return db.Order("last_fail_at desc")
+	})
+	var records []entity.LoginThrottle
+	if err := tx.Find(&records).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+
+	// 用户类型的记录关联用户姓名
+	var ids []int
+	for _, item := range records {
+		if item.Kind == entity.ThrottleKindUser {
+			id, _ := strconv.Atoi(item.Target)
+			ids = append(ids, id)
+		}
+	}
+	names := map[string]string{}
+	if len(ids) > 0 {
+		var users []entity.User
+		if err := repo.DB.Select("id", "name").Where("id IN ?", ids).Find(&users).Error; err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		for _, usr := range users {
+			names[strconv.Itoa(usr.ID)] = usr.Name
+		}
+	}
+
+	res := make([]dto.LoginThrottleDto, 0, len(records))
+	for i := range records {
+		item := &records[i]
+		d := dto.LoginThrottleDto{
+			ID:         item.ID,
+			Kind:       item.Kind,
+			Target:     item.Target,
+			Failures:   item.Failures,
+			Locks:      item.Locks,
+			LastFailAt: entity.DateTime(item.LastFailAt),
+			Locked:     item.Locked(now),
+		}
+		if item.Kind == entity.ThrottleKindUser {
+			d.Name = names[item.Target]
+		}
+		if item.LockedUntil != nil {
+			t := entity.DateTime(*item.LockedUntil)
+			d.LockedUntil = &t
+		}
+		res = append(res, d)
+	}
+	query.Records = res
+	ctx.JSON(200, query)
+}
+
+/**
+@api {DELETE} /api/throttle/clear 解除登录锁定
+@apiDescription 删除登录失败记录，被锁定的账号或IP立即可以重新登录，失败次数与锁定时长重新计算。
+@apiName ThrottleClear
+@apiGroup Throttle
+
+@apiPermission 管理员
+
+@apiParam {String} ids 记录ID序列，多个ID用","隔开。
+
+@apiParamExample 请求示例
+DELETE /api/throttle/clear?ids=3,4
+
+@apiSuccess {Integer} count 删除的记录数。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "count": 2
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+参数非法，无法解析
+*/
+
+// clear 解除登录锁定
+func (c *LoginThrottleController) clear(ctx *gin.Context) {
+	var ids []int
+	for _, item := range strings.Split(ctx.Query("ids"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || id <= 0 {
+			ErrIllegal(ctx, "参数非法，无法解析")
+			return
+		}
+		ids = append(ids, id)
+	}
+	applog.L(ctx, "解除登录锁定", map[string]interface{}{"ids": ctx.Query("ids")})
+
+	count, err := repo.NewLoginThrottleRepository(nil).Clear(ids...)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, gin.H{"count": count})
+}
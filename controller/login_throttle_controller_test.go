@@ -0,0 +1,86 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pdm/controller/controllertest"
+	"pdm/repo/entity"
+	"strings"
+	"testing"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	s := controllertest.NewServer(t)
+	for _, user := range []entity.User{
+		{Openid: "1001", Name: "张三", Username: "zhangsan"},
+		{Openid: "1002", Name: "李四", Username: "lisi"},
+	} {
+		s.CreateUser(&user, "Passw0rd#1")
+	}
+	login := func(username, password, ip string) *httptest.ResponseRecorder {
+		return s.Do(http.MethodPost, "/api/login", `{"username":"`+username+`","password":"`+password+`"}`, "", func(r *http.Request) {
+			if ip != "" {
+				r.RemoteAddr = ip + ":12345"
+			}
+		})
+	}
+
+	// 登录成功后账号失败次数清零
+	for i := 0; i < 4; i++ {
+		s.Expect(login("1001", "wrong", ""), http.StatusBadRequest, "用户名或口令错误")
+	}
+	s.Expect(login("1001", "Passw0rd#1", ""), http.StatusOK, "")
+	// 连续失败达到上限后锁定，锁定期间口令正确也无法登录
+	for i := 0; i < 5; i++ {
+		s.Expect(login("1001", "wrong", ""), http.StatusBadRequest, "用户名或口令错误")
+	}
+	s.Expect(login("1001", "Passw0rd#1", ""), http.StatusBadRequest, "用户锁定，请10分钟后再尝试")
+	// 不存在的用户名同样锁定
+	for i := 0; i < 5; i++ {
+		s.Expect(login("nobody", "wrong", "198.51.100.1"), http.StatusBadRequest, "用户名或口令错误")
+	}
+	s.Expect(login("nobody", "wrong", "198.51.100.1"), http.StatusBadRequest, "用户锁定")
+	// 同一IP对多个账号失败达到上限后锁定该IP，其他IP不受影响
+	// 该IP此前已失败9次
+	s.Expect(login("spray", "wrong", ""), http.StatusBadRequest, "用户名或口令错误")
+	s.Expect(login("1002", "Passw0rd#1", ""), http.StatusBadRequest, "登录失败次数过多")
+	s.Expect(login("1002", "Passw0rd#1", "198.51.100.2"), http.StatusOK, "")
+
+	// 管理员查看并解除锁定
+	token := s.AdminToken(0)
+	s.Expect(s.Do(http.MethodGet, "/api/throttle/search?locked=true", "", s.AdminToken(1)), http.StatusForbidden, "")
+	w := s.Do(http.MethodGet, "/api/throttle/search?locked=true&limit=50", "", token)
+	var page struct {
+		Total   int64 `json:"total"`
+		Records []struct {
+			ID          int     `json:"id"`
+			Kind        string  `json:"kind"`
+			Target      string  `json:"target"`
+			Name        string  `json:"name"`
+			Locks       int     `json:"locks"`
+			LockedUntil *string `json:"lockedUntil"`
+			Locked      bool    `json:"locked"`
+		} `json:"records"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || page.Total != 3 {
+		t.Fatalf("search: %d %s", w.Code, w.Body.String())
+	}
+	var ids []string
+	for _, item := range page.Records {
+		if !item.Locked || item.Locks != 1 || item.LockedUntil == nil {
+			t.Fatalf("unexpected record: %+v", item)
+		}
+		if item.Kind == entity.ThrottleKindUser && item.Name != "张三" {
+			t.Fatalf("unexpected user record: %+v", item)
+		}
+		if item.Kind != entity.ThrottleKindUsername {
+			ids = append(ids, fmt.Sprint(item.ID))
+		}
+	}
+	s.Expect(s.Do(http.MethodDelete, "/api/throttle/clear?ids=a", "", token), http.StatusBadRequest, "参数非法")
+	s.Expect(s.Do(http.MethodDelete, "/api/throttle/clear?ids="+strings.Join(ids, ","), "", token), http.StatusOK, `"count":2`)
+	s.Expect(login("1001", "Passw0rd#1", ""), http.StatusOK, "")
+	s.Expect(login("nobody", "wrong", "198.51.100.1"), http.StatusBadRequest, "用户锁定")
+}
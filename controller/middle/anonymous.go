@@ -8,18 +8,21 @@ import (
 const (
 	FlagAnonymous = "Anonymous" // 匿名标志
 	FlagClaims    = "Claims"    // 用户信息
+	// FlagAccessToken 通过个人访问令牌认证时的令牌信息（*entity.AccessToken）
+	FlagAccessToken = "AccessToken"
 )
 
 // Anonymous 匿名访问接口
 func Anonymous(ctx *gin.Context) {
 	dest := ctx.Request.URL.Path
-	// 静态资源
-	if strings.HasPrefix(dest, "/ui") || dest == "" || dest == "/" {
+	// 静态资源与单点登录
+	if strings.HasPrefix(dest, "/ui") || strings.HasPrefix(dest, "/api/sso/") || dest == "" || dest == "/" {
 		ctx.Set(FlagAnonymous, true)
 		return
 	}
 	switch dest {
-	case "/api/login", "/api/system/version", "/api/check", "/api/avatar", "/api/redirect", "/api/case/send", "/api/random", "/api/entityAuth", "/api/certBinding":
+	case "/healthz", "/readyz", "/metrics",
+		"/api/login", "/api/login/totp", "/api/login/totpSetup", "/api/system/version", "/api/check", "/api/avatar", "/api/random", "/api/entityAuth", "/api/certBinding":
 		ctx.Set(FlagAnonymous, true)
 		return
 	}
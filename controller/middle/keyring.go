@@ -0,0 +1,188 @@
+package middle
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm3"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kidLayout 密钥ID格式，为密钥启用时间（UTC）
+const kidLayout = "20060102T150405Z"
+
+// clockSkew 允许的实例间时钟偏差，时钟较慢的实例可以验证时钟较快的实例使用新密钥签发的token
+const clockSkew = 5 * time.Minute
+
+// ErrUnknownKey 密钥ID不存在或已过期
+var ErrUnknownKey = errors.New("未知的签名密钥")
+
+// KeySource 签名密钥来源
+// 多个实例使用同一密钥来源即可共享密钥环，同一密钥ID在所有实例上必须得到相同的密钥。
+type KeySource interface {
+	// Get 获取密钥，密钥不存在时返还 nil
+	Get(kid string) ([]byte, error)
+	// Create 创建密钥，已存在（如已被其他实例创建）时返还已存在的密钥
+	// expires 之后该密钥不再用于验证，可以被清理。
+	Create(kid string, expires time.Time) ([]byte, error)
+}
+
+// KeyRing 签名密钥环
+//
+// 时间按轮换周期划分（与Unix纪元对齐，所有实例划分一致），每个周期使用一个签名密钥，
+// 密钥ID为周期的开始时间。周期结束后该密钥不再用于签名，但在宽限期内仍可用于验证，
+// 宽限期应不小于token的有效期，否则临近轮换时签发的token会提前失效。
+// 密钥在首次使用时从密钥来源获取或创建，无需后台轮换任务，可并发使用。
+type KeyRing struct {
+	source   KeySource
+	rotation time.Duration // 轮换周期
+	grace    time.Duration // 宽限期
+	now      func() time.Time
+	mu       sync.RWMutex
+	keys     map[string][]byte // 已获取的密钥
+}
+
+// NewKeyRing 创建签名密钥环
+// rotation: 轮换周期，不小于1秒
+// grace: 轮换后继续用于验证的时间
+func NewKeyRing(source KeySource, rotation, grace time.Duration) *KeyRing {
+	if rotation < time.Second {
+		rotation = time.Second
+	}
+	return &KeyRing{
+		source:   source,
+		rotation: rotation.Truncate(time.Second),
+		grace:    grace,
+		now:      time.Now,
+		keys:     map[string][]byte{},
+	}
+}
+
+// Current 当前用于签名的密钥及其ID
+func (r *KeyRing) Current() (string, []byte, error) {
+	period := int64(r.rotation / time.Second)
+	start := time.Unix(r.now().Unix()/period*period, 0).UTC()
+	kid := start.Format(kidLayout)
+	if key := r.cached(kid); key != nil {
+		return kid, key, nil
+	}
+	key, err := r.source.Create(kid, start.Add(r.rotation+r.grace))
+	if err != nil {
+		return "", nil, err
+	}
+	r.store(kid, key)
+	return kid, key, nil
+}
+
+// Lookup 获取用于验证的密钥，密钥ID格式错误、已过宽限期或不存在时返还 ErrUnknownKey
+func (r *KeyRing) Lookup(kid string) ([]byte, error) {
+	start, err := time.Parse(kidLayout, kid)
+	if err != nil {
+		return nil, ErrUnknownKey
+	}
+	now := r.now()
+	if start.After(now.Add(clockSkew)) || !now.Before(start.Add(r.rotation+r.grace)) {
+		return nil, ErrUnknownKey
+	}
+	if key := r.cached(kid); key != nil {
+		return key, nil
+	}
+	key, err := r.source.Get(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	r.store(kid, key)
+	return key, nil
+}
+
+func (r *KeyRing) cached(kid string) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[kid]
+}
+
+// store 缓存密钥，同时清除已过宽限期的密钥
+func (r *KeyRing) store(kid string, key []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[kid] = key
+	now := r.now()
+	for k := range r.keys {
+		if start, err := time.Parse(kidLayout, k); err != nil || !now.Before(start.Add(r.rotation+r.grace)) {
+			delete(r.keys, k)
+		}
+	}
+}
+
+// FileKeySource 基于主密钥文件派生签名密钥
+// 每个密钥ID的签名密钥为 HMAC-SM3(主密钥, 密钥ID)，多个实例共享同一主密钥文件即可共享密钥环。
+// 主密钥泄露时替换主密钥文件并重启所有实例，已签发的token全部失效。
+type FileKeySource struct {
+	master []byte
+}
+
+// NewFileKeySource 读取主密钥文件，文件不存在时生成随机主密钥并写入（权限0600）
+// 文件内容为至少32字节主密钥的Hex编码。
+func NewFileKeySource(name string) (*FileKeySource, error) {
+	bin, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		bin, err = createMasterKey(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取JWT主密钥文件失败，%w", err)
+	}
+	master, err := hex.DecodeString(strings.TrimSpace(string(bin)))
+	if err != nil || len(master) < 32 {
+		return nil, fmt.Errorf("JWT主密钥文件 %s 格式错误，内容应为至少32字节密钥的Hex编码", name)
+	}
+	return &FileKeySource{master: master}, nil
+}
+
+// createMasterKey 生成主密钥文件，文件已被其他实例创建时读取已存在的文件
+// 先写入临时文件再以硬链接创建目标文件，其他实例不会读到未写完的文件。
+func createMasterKey(name string) ([]byte, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+	master := make([]byte, 32)
+	if _, err := rand.Read(master); err != nil {
+		return nil, err
+	}
+	bin := []byte(hex.EncodeToString(master) + "\n")
+	f, err := os.CreateTemp(filepath.Dir(name), ".jwt-key-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(bin)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = os.Link(f.Name(), name)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(name)
+	}
+	return bin, err
+}
+
+func (s *FileKeySource) Get(kid string) ([]byte, error) {
+	h := hmac.New(sm3.New, s.master)
+	h.Write([]byte(kid))
+	return h.Sum(nil), nil
+}
+
+func (s *FileKeySource) Create(kid string, _ time.Time) ([]byte, error) {
+	return s.Get(kid)
+}
@@ -0,0 +1,132 @@
+package middle
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memKeySource 内存中的密钥来源
+type memKeySource struct {
+	mu      sync.Mutex
+	keys    map[string][]byte
+	created int
+}
+
+func (s *memKeySource) Get(kid string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[kid], nil
+}
+
+func (s *memKeySource) Create(kid string, _ time.Time) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	s.keys[kid] = key
+	s.created++
+	return key, nil
+}
+
+func TestKeyRing(t *testing.T) {
+	source := &memKeySource{keys: map[string][]byte{}}
+	now := time.Date(2026, 10, 17, 1, 30, 0, 0, time.UTC)
+	ring := NewKeyRing(source, 12*time.Hour, 8*time.Hour)
+	ring.now = func() time.Time { return now }
+
+	kid, key, err := ring.Current()
+	if err != nil || kid != "20261017T000000Z" {
+		t.Fatalf("unexpected kid %q, %v", kid, err)
+	}
+	// 同一轮换周期内使用同一密钥，另一实例得到相同的密钥
+	now = now.Add(10 * time.Hour)
+	other := NewKeyRing(source, 12*time.Hour, 8*time.Hour)
+	other.now = ring.now
+	if kid2, key2, _ := other.Current(); kid2 != kid || !bytes.Equal(key2, key) {
+		t.Fatalf("expect same key in one period, got %q", kid2)
+	}
+
+	// 轮换后旧密钥在宽限期内仍可验证
+	now = now.Add(2 * time.Hour)
+	next, nextKey, _ := ring.Current()
+	if next != "20261017T120000Z" || bytes.Equal(nextKey, key) || source.created != 2 {
+		t.Fatalf("expect rotated key, got %q", next)
+	}
+	if old, err := other.Lookup(kid); err != nil || !bytes.Equal(old, key) {
+		t.Fatalf("expect old key within grace period, %v", err)
+	}
+	now = now.Add(8 * time.Hour)
+	if _, err = ring.Lookup(kid); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expect ErrUnknownKey after grace period, got %v", err)
+	}
+	if _, err = ring.Lookup(next); err != nil {
+		t.Fatal(err)
+	}
+
+	// 格式错误、未来周期与不存在的密钥
+	for _, k := range []string{"", "abc", "20261018T120000Z", "20261017T060000Z"} {
+		if _, err = ring.Lookup(k); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("%q: expect ErrUnknownKey, got %v", k, err)
+		}
+	}
+}
+
+func TestKeyRing_Concurrent(t *testing.T) {
+	source := &memKeySource{keys: map[string][]byte{}}
+	ring := NewKeyRing(source, time.Second, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				kid, key, err := ring.Current()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if k, err := ring.Lookup(kid); err != nil || !bytes.Equal(k, key) {
+					t.Errorf("lookup %s: %v", kid, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFileKeySource(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "keys", "jwt.key")
+	s1, err := NewFileKeySource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected key file: %v %v", info, err)
+	}
+	s2, err := NewFileKeySource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1, _ := s1.Create("20261017T000000Z", time.Time{})
+	k2, _ := s2.Get("20261017T000000Z")
+	k3, _ := s2.Get("20261017T120000Z")
+	if !bytes.Equal(k1, k2) || bytes.Equal(k1, k3) {
+		t.Fatal("expect same derived key for same kid only")
+	}
+
+	_ = os.WriteFile(name, []byte("0123"), 0600)
+	if _, err = NewFileKeySource(name); err == nil {
+		t.Fatal("expect error on short master key")
+	}
+}
@@ -0,0 +1,75 @@
+package middle
+
+import (
+	"github.com/gin-gonic/gin"
+	"pdm/reuint/jwt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderProjectId 携带当前项目ID的请求头
+	HeaderProjectId = "X-Project-Id"
+	// ParamProjectId 携带当前项目ID的路径参数，如 /api/projects/:projectId/doc/info
+	ParamProjectId = "projectId"
+	// FlagProjectId 当前请求的项目ID，由 ProjectID 解析后缓存
+	FlagProjectId = "ProjectId"
+)
+
+// ProjectID 当前请求的项目ID，没有项目上下文或项目ID非法时返还0
+// 项目ID依次取自路径参数 projectId、请求头 X-Project-Id，均未携带时使用token中的项目ID（进入项目接口写入），
+// 因此同一用户可以在多个浏览器标签页中同时操作不同的项目。
+// 绑定了项目的个人访问令牌仅能访问该项目。
+// 每个请求仅解析一次。
+func ProjectID(ctx *gin.Context) int {
+	if v, ok := ctx.Get(FlagProjectId); ok {
+		return v.(int)
+	}
+	id := resolveProjectID(ctx)
+	ctx.Set(FlagProjectId, id)
+	return id
+}
+
+// resolveProjectID 解析请求中的项目ID
+func resolveProjectID(ctx *gin.Context) int {
+	var claims *jwt.Claims
+	if v, ok := ctx.Get(FlagClaims); ok {
+		claims = v.(*jwt.Claims)
+	}
+	if claims == nil {
+		return 0
+	}
+	param := ctx.Param(ParamProjectId)
+	header := strings.TrimSpace(ctx.GetHeader(HeaderProjectId))
+	raw := param
+	if raw == "" {
+		raw = header
+	} else if header != "" && header != param {
+		// 路径与请求头中的项目不一致
+		return 0
+	}
+	if raw == "" {
+		return claims.PID
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	if _, ok := ctx.Get(FlagAccessToken); ok && claims.PID > 0 && id != claims.PID {
+		return 0
+	}
+	return id
+}
+
+// trimProjectPath 去除路径中的项目前缀，如 /api/projects/1/doc/info 返还 /api/doc/info
+func trimProjectPath(path string) string {
+	const prefix = "/api/projects/"
+	if !strings.HasPrefix(path, prefix) {
+		return path
+	}
+	_, rest, ok := strings.Cut(path[len(prefix):], "/")
+	if !ok {
+		return path
+	}
+	return "/api/" + rest
+}
@@ -0,0 +1,68 @@
+package middle
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"testing"
+)
+
+func TestProjectID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name   string
+		param  string
+		header string
+		pid    int
+		token  bool
+		expect int
+	}{
+		{name: "无项目上下文", expect: 0},
+		{name: "进入项目写入token", pid: 3, expect: 3},
+		{name: "请求头优先于token", header: "5", pid: 3, expect: 5},
+		{name: "路径参数", param: "7", pid: 3, expect: 7},
+		{name: "路径与请求头一致", param: "7", header: "7", expect: 7},
+		{name: "路径与请求头不一致", param: "7", header: "5", expect: 0},
+		{name: "非法项目ID", header: "abc", pid: 3, expect: 0},
+		{name: "访问令牌绑定的项目", header: "3", pid: 3, token: true, expect: 3},
+		{name: "访问令牌访问其他项目", header: "5", pid: 3, token: true, expect: 0},
+	}
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/doc/info", nil)
+		if c.header != "" {
+			ctx.Request.Header.Set(HeaderProjectId, c.header)
+		}
+		if c.param != "" {
+			ctx.Params = gin.Params{{Key: ParamProjectId, Value: c.param}}
+		}
+		ctx.Set(FlagClaims, &jwt.Claims{Type: "user", Sub: 1, PID: c.pid})
+		if c.token {
+			ctx.Set(FlagAccessToken, &entity.AccessToken{})
+		}
+		if got := ProjectID(ctx); got != c.expect {
+			t.Errorf("%s: expect %d, got %d", c.name, c.expect, got)
+		}
+		// 解析结果缓存在请求中
+		ctx.Request.Header.Set(HeaderProjectId, "99")
+		if got := ProjectID(ctx); got != c.expect {
+			t.Errorf("%s: expect cached %d, got %d", c.name, c.expect, got)
+		}
+	}
+}
+
+func TestAccessTokenScope_ProjectPath(t *testing.T) {
+	for path, scope := range map[string]string{
+		"/api/projects/1/doc/create":  entity.ScopeDocsWrite,
+		"/api/projects/1/case/send":   entity.ScopeCasesRun,
+		"/api/projects/1/token/list":  "",
+		"/api/projects/1":             "",
+		"/api/projects/1/project/add": "",
+	} {
+		if got := accessTokenScope(http.MethodPost, path); got != scope {
+			t.Errorf("%s: expect %q, got %q", path, scope, got)
+		}
+	}
+}
@@ -2,39 +2,63 @@ package middle
 
 import (
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+	"pdm/repo/entity"
 	"pdm/reuint/jwt"
+	"strings"
 	"time"
 )
 
+// ErrInvalidToken token签名错误、已过期或会话已失效
+var ErrInvalidToken = errors.New("无效token")
+
+// ClaimsTypePending 待完成登录的凭证类型
+// 口令验证通过但还需验证动态口令时签发，仅能用于完成登录。
+// 凭证的jti同样记录在会话存储中（用户类型为 pending），完成登录或撤销用户的会话后失效。
+const ClaimsTypePending = "pending"
+
+// SessionStore 会话存储
+// token中的jti对应服务端记录的会话，会话不存在（已撤销）或已过期时token无效。
+type SessionStore interface {
+	// Create 登录时创建会话，claims.Jti 为会话ID
+	Create(claims *jwt.Claims, ip, userAgent string) error
+	// Touch 检查会话是否有效，有效时更新最近访问时间
+	Touch(claims *jwt.Claims) (bool, error)
+	// Revoke 撤销会话
+	Revoke(jti string) error
+}
+
+// AccessTokenStore 个人访问令牌存储
+type AccessTokenStore interface {
+	// Authenticate 校验个人访问令牌，有效时返还令牌所属用户的身份信息，无效时返还 nil
+	Authenticate(token, ip string) (*jwt.Claims, *entity.AccessToken, error)
+}
+
 // TokenManager Token管理器
 type TokenManager struct {
-	key    []byte // 当前HMAC密钥
-	oldKey []byte // 过去HMAC密钥
-	ticker *time.Ticker
+	keys     *KeyRing         // 签名密钥环
+	secure   bool             // Cookie是否设置Secure标志
+	sessions SessionStore     // 会话存储
+	tokens   AccessTokenStore // 个人访问令牌存储
 }
 
 // NewTokenFilter 新建token过滤器
-func NewTokenFilter() *TokenManager {
-	res := &TokenManager{
-		key:    make([]byte, 32),
-		oldKey: make([]byte, 32),
-		ticker: time.NewTicker(time.Hour * 12),
-		//ticker: time.NewTicker(time.Second * 30),
-	}
-	_, _ = rand.Reader.Read(res.key)
-	// 12小时更新一次密钥
-	go func() {
-		for _ = range res.ticker.C {
-			zap.L().Info("JWT密钥更新")
-			copy(res.oldKey, res.key)
-			_, _ = rand.Reader.Read(res.key)
-
-		}
-	}()
-	return res
+// keys: 签名密钥环
+// secure: 是否为token Cookie设置Secure标志，启用HTTPS时应为true
+// sessions: 会话存储
+// tokens: 个人访问令牌存储
+func NewTokenFilter(keys *KeyRing, secure bool, sessions SessionStore, tokens AccessTokenStore) *TokenManager {
+	return &TokenManager{
+		keys:     keys,
+		secure:   secure,
+		sessions: sessions,
+		tokens:   tokens,
+	}
 }
 
 // Filter token校验拦截器
@@ -44,6 +68,12 @@ func (t *TokenManager) Filter(ctx *gin.Context) {
 		return
 	}
 
+	// 自动化调用通过 Authorization 请求头携带个人访问令牌
+	if auth := ctx.GetHeader("Authorization"); auth != "" {
+		t.bearer(ctx, auth)
+		return
+	}
+
 	// 从cookies中获取token
 	token, _ := ctx.Cookie("token")
 	if token == "" {
@@ -51,24 +81,212 @@ func (t *TokenManager) Filter(ctx *gin.Context) {
 		return
 	}
 	// 验证Token有效性
-	claims, err := jwt.Verify(t.key, token)
+	claims, err := t.Parse(token)
+	if errors.Is(err, ErrInvalidToken) {
+		// 清除头里失效的token
+		t.ClearCookie(ctx)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		_, _ = ctx.Writer.WriteString(err.Error())
+		return
+	}
 	if err != nil {
-		var err2 error
-		// token 密钥发生更新，尝试使用过去的密钥验证
-		claims, err2 = jwt.Verify(t.oldKey, token)
-		if err2 != nil {
-			// 清除头里失效的token
-			ctx.SetCookie("token", "", -1, "", "", false, true)
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			_, _ = ctx.Writer.WriteString(err.Error())
-			return
-		}
+		zap.L().Error("token校验失败", zap.Error(err))
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// 需修改口令的token仅能用于修改口令
+	if claims.MustChgPwd && !changePwdPaths[ctx.Request.URL.Path] {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		_, _ = ctx.Writer.WriteString("请先修改口令")
+		return
 	}
 	ctx.Set(FlagClaims, claims)
 	return
 }
 
+// changePwdPaths 需修改口令的token允许访问的接口
+var changePwdPaths = map[string]bool{
+	"/api/user/modifyPwd": true,
+	"/api/user/pwdPolicy": true,
+	"/api/logout":         true,
+}
+
+// bearer 个人访问令牌认证
+// 令牌仅能调用权限范围内的接口，见 accessTokenScope。
+func (t *TokenManager) bearer(ctx *gin.Context, auth string) {
+	scheme, token, _ := strings.Cut(auth, " ")
+	if !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(token, entity.AccessTokenPrefix) {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	claims, at, err := t.tokens.Authenticate(token, ctx.ClientIP())
+	if err != nil {
+		zap.L().Error("个人访问令牌校验失败", zap.Error(err))
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if claims == nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		_, _ = ctx.Writer.WriteString("无效的访问令牌")
+		return
+	}
+	scope := accessTokenScope(ctx.Request.Method, ctx.Request.URL.Path)
+	if scope == "" || !at.HasScope(scope) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		_, _ = ctx.Writer.WriteString("访问令牌权限不足")
+		return
+	}
+	ctx.Set(FlagClaims, claims)
+	ctx.Set(FlagAccessToken, at)
+}
+
+// accessTokenScope 通过个人访问令牌调用接口所需的权限范围，返还空字符串表示不允许通过令牌调用
+func accessTokenScope(method, path string) string {
+	path = trimProjectPath(path)
+	switch {
+	case strings.HasPrefix(path, "/api/token/"), strings.HasPrefix(path, "/api/session/"):
+		// 令牌与会话的管理需要登录后操作
+		return ""
+	case method == http.MethodGet:
+		return entity.ScopeRead
+	case strings.HasPrefix(path, "/api/doc/"):
+		return entity.ScopeDocsWrite
+	case strings.HasPrefix(path, "/api/case/"):
+		return entity.ScopeCasesRun
+	}
+	return ""
+}
+
+// Parse 验证token的签名、有效期以及对应的会话是否有效
+// token无效时返还 ErrInvalidToken，会话存储访问失败时返还其他错误
+func (t *TokenManager) Parse(token string) (*jwt.Claims, error) {
+	claims, err := t.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Jti == "" || claims.Type == ClaimsTypePending {
+		return nil, fmt.Errorf("%w，缺少会话ID", ErrInvalidToken)
+	}
+	ok, err := t.sessions.Touch(claims)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w，会话已失效", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// IssuePending 签发待完成登录的凭证，并在会话存储中记录
+// claims: 完成登录后的用户信息，凭证有效期为 ttl
+func (t *TokenManager) IssuePending(ctx *gin.Context, claims jwt.Claims, ttl time.Duration) (string, error) {
+	jti, err := newJti()
+	if err != nil {
+		return "", err
+	}
+	claims.Type = ClaimsTypePending
+	claims.Jti = jti
+	claims.Exp = time.Now().Add(ttl).UnixMilli()
+	if err = t.sessions.Create(&claims, ctx.ClientIP(), ctx.Request.UserAgent()); err != nil {
+		return "", err
+	}
+	return t.GenToken(&claims)
+}
+
+// ParsePending 验证待完成登录的凭证，无效、已过期或已使用时返还 ErrInvalidToken
+func (t *TokenManager) ParsePending(token string) (*jwt.Claims, error) {
+	claims, err := t.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != ClaimsTypePending || claims.Jti == "" {
+		return nil, fmt.Errorf("%w，不是登录凭证", ErrInvalidToken)
+	}
+	ok, err := t.sessions.Touch(claims)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w，登录凭证已失效", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// RevokePending 撤销待完成登录的凭证，凭证仅能使用一次
+func (t *TokenManager) RevokePending(claims *jwt.Claims) error {
+	return t.sessions.Revoke(claims.Jti)
+}
+
+// verify 验证token的签名与有效期
+func (t *TokenManager) verify(token string) (*jwt.Claims, error) {
+	kid, err := jwt.Kid(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w，%s", ErrInvalidToken, err.Error())
+	}
+	key, err := t.keys.Lookup(kid)
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, fmt.Errorf("%w，%s", ErrInvalidToken, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims, err := jwt.Verify(key, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w，%s", ErrInvalidToken, err.Error())
+	}
+	return claims, nil
+}
+
+// Issue 登录成功后创建会话，签发token并写入Cookie
+// claims.Jti 由该方法生成，会话记录登录IP与客户端标识。
+func (t *TokenManager) Issue(ctx *gin.Context, claims *jwt.Claims) (string, error) {
+	jti, err := newJti()
+	if err != nil {
+		return "", err
+	}
+	claims.Jti = jti
+	if err = t.sessions.Create(claims, ctx.ClientIP(), ctx.Request.UserAgent()); err != nil {
+		return "", err
+	}
+	token, err := t.GenToken(claims)
+	if err != nil {
+		return "", err
+	}
+	t.SetCookie(ctx, token)
+	return token, nil
+}
+
+// Revoke 撤销当前会话并清除Cookie中的token
+func (t *TokenManager) Revoke(ctx *gin.Context, claims *jwt.Claims) error {
+	t.ClearCookie(ctx)
+	return t.sessions.Revoke(claims.Jti)
+}
+
 // GenToken 生成新的token
-func (t *TokenManager) GenToken(claims *jwt.Claims) string {
-	return jwt.New(t.key, claims)
+// 仅用于已登录会话更新token中的信息（如进入项目），新登录应使用 Issue 创建会话。
+func (t *TokenManager) GenToken(claims *jwt.Claims) (string, error) {
+	kid, key, err := t.keys.Current()
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithKid(kid, key, claims), nil
+}
+
+// SetCookie 将token写入Cookie，有效期8小时
+func (t *TokenManager) SetCookie(ctx *gin.Context, token string) {
+	ctx.SetCookie("token", token, 8*3600, "", "", t.secure, true)
+}
+
+// ClearCookie 清除Cookie中的token
+func (t *TokenManager) ClearCookie(ctx *gin.Context) {
+	ctx.SetCookie("token", "", -1, "", "", t.secure, true)
+}
+
+// newJti 生成会话ID
+func newJti() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"pdm/logg/applog"
+	"pdm/metrics"
+	"pdm/repo"
+	"pdm/storage"
+	"time"
+)
+
+const (
+	// readyTimeout 就绪检查中单项检查的超时时间
+	readyTimeout = 3 * time.Second
+	// applogFullRatio 操作日志缓冲区使用率达到该比例时视为未就绪
+	applogFullRatio = 0.9
+)
+
+// NewMonitorController 创建监控控制器
+// 监控接口注册在根路径下，供负载均衡、容器编排与监控系统匿名访问。
+func NewMonitorController(router gin.IRouter) *MonitorController {
+	res := &MonitorController{}
+	router.GET("/healthz", res.healthz)
+	router.GET("/readyz", res.readyz)
+	router.GET("/metrics", metrics.Handler)
+	return res
+}
+
+// MonitorController 监控控制器
+type MonitorController struct {
+}
+
+// CheckResult 单项检查结果
+type CheckResult struct {
+	Status string `json:"status"`          // 检查结果：ok、fail
+	Error  string `json:"error,omitempty"` // 失败原因
+}
+
+// ReadyResult 就绪检查结果
+type ReadyResult struct {
+	Status string                 `json:"status"` // 检查结果：ok（所有检查均通过）、fail
+	Checks map[string]CheckResult `json:"checks"` // 各项检查结果
+}
+
+/**
+@api {GET} /healthz 存活检查
+@apiDescription 程序正在运行即返回200，用于容器编排的存活探针。
+@apiName MonitorHealthz
+@apiGroup Monitor
+
+@apiPermission 匿名
+
+@apiParamExample 请求示例
+GET /healthz
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+ok
+*/
+
+// healthz 存活检查
+func (c *MonitorController) healthz(ctx *gin.Context) {
+	ctx.String(http.StatusOK, "ok")
+}
+
+/**
+@api {GET} /readyz 就绪检查
+@apiDescription 检查程序是否可以正常处理请求，所有检查通过时返回200，否则返回503，用于负载均衡与容器编排的就绪探针。
+
+检查项：
+- database 数据库连接可用；
+- storage 对接文档、基础文档区、技术方案、头像、根证书各文件存储可写入；
+- applog 操作日志记录器运行中且缓冲区使用率低于90%。
+
+@apiName MonitorReadyz
+@apiGroup Monitor
+
+@apiPermission 匿名
+
+@apiParamExample 请求示例
+GET /readyz
+
+@apiSuccess {String} status 检查结果：ok、fail。
+@apiSuccess {Object} checks 各项检查结果。
+@apiSuccess {String} checks.status 检查结果：ok、fail。
+@apiSuccess {String} [checks.error] 失败原因。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "status": "ok",
+    "checks": {
+        "applog": {"status": "ok"},
+        "database": {"status": "ok"},
+        "storage": {"status": "ok"}
+    }
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 503
+
+{
+    "status": "fail",
+    "checks": {
+        "applog": {"status": "fail", "error": "操作日志缓冲区已使用 30/32"},
+        "database": {"status": "ok"},
+        "storage": {"status": "ok"}
+    }
+}
+*/
+
+// readyz 就绪检查
+func (c *MonitorController) readyz(ctx *gin.Context) {
+	res := ReadyResult{Status: "ok", Checks: map[string]CheckResult{}}
+	checks := map[string]func(ctx context.Context) error{
+		"database": checkDatabase,
+		"storage":  checkStorage,
+		"applog":   checkApplog,
+	}
+	for name, check := range checks {
+		c, cancel := context.WithTimeout(ctx.Request.Context(), readyTimeout)
+		err := check(c)
+		cancel()
+		if err != nil {
+			res.Status = "fail"
+			res.Checks[name] = CheckResult{Status: "fail", Error: err.Error()}
+			continue
+		}
+		res.Checks[name] = CheckResult{Status: "ok"}
+	}
+	status := http.StatusOK
+	if res.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, res)
+}
+
+// checkDatabase 检查数据库连接
+func checkDatabase(ctx context.Context) error {
+	if repo.DB == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	sqlDB, err := repo.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkStorage 检查各文件存储是否可写入
+// 在存储根目录写入随机命名的探测文件后立即删除。
+func checkStorage(ctx context.Context) error {
+	areas := []struct {
+		name string
+		s    storage.Storage
+	}{
+		{"doc", storage.Doc},
+		{"baseDocArea", storage.BaseDocArea},
+		{"technicalProposal", storage.TechnicalProposal},
+		{"avatar", storage.Avatar},
+		{"rootCerts", storage.RootCert},
+	}
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	probe := ".readyz-" + hex.EncodeToString(buf)
+	done := make(chan error, 1)
+	go func() {
+		for _, a := range areas {
+			if a.s == nil {
+				done <- fmt.Errorf("%s 未初始化", a.name)
+				return
+			}
+			err := storage.WriteFile(a.s, probe, []byte("ok"))
+			if err == nil {
+				err = a.s.Remove(probe)
+			}
+			if err != nil {
+				done <- fmt.Errorf("%s 无法写入，%s", a.name, err.Error())
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("文件存储写入超时")
+	}
+}
+
+// checkApplog 检查操作日志缓冲区
+func checkApplog(_ context.Context) error {
+	used, capacity, closed := applog.Usage()
+	if closed {
+		return fmt.Errorf("操作日志记录器未运行")
+	}
+	if float64(used) >= float64(capacity)*applogFullRatio {
+		return fmt.Errorf("操作日志缓冲区已使用 %d/%d", used, capacity)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pdm/controller/controllertest"
+	"pdm/logg/applog"
+	"pdm/storage"
+	"strings"
+	"testing"
+)
+
+func TestMonitorEndpoints(t *testing.T) {
+	s := controllertest.NewServer(t)
+	get := func(p string) *httptest.ResponseRecorder {
+		return s.Do(http.MethodGet, p, "", "")
+	}
+
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Fatalf("healthz: %d", w.Code)
+	}
+	// 操作日志记录器未运行
+	if w := get("/readyz"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "操作日志记录器未运行") {
+		t.Fatalf("readyz without applog: %d %s", w.Code, w.Body.String())
+	}
+	applog.InitLogger(s.Config)
+	defer applog.Close(context.Background())
+	if w := get("/readyz"); w.Code != http.StatusOK {
+		t.Fatalf("readyz: %d %s", w.Code, w.Body.String())
+	}
+	if list, _ := storage.Doc.List(""); len(list) != 0 {
+		t.Fatalf("readyz probe file left: %v", list)
+	}
+
+	// 文件存储不可写入
+	root := filepath.Join(t.TempDir(), "avatar")
+	storage.Avatar, _ = storage.NewLocal(root)
+	_ = os.Remove(root)
+	_ = os.WriteFile(root, nil, 0644)
+	if w := get("/readyz"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "avatar") {
+		t.Fatalf("readyz with broken storage: %d %s", w.Code, w.Body.String())
+	}
+
+	w := get("/metrics")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `pdm_http_requests_total{method="GET",route="/readyz",status="503"} 2`) {
+		t.Fatalf("metrics: %d\n%s", w.Code, w.Body.String())
+	}
+}
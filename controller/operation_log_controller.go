@@ -68,6 +68,7 @@ GET /api/project/search?opType=2&opName=操作&page=1&limit=20
 @apiSuccess {String} Log.OpParam 操作参数。
 @apiSuccess {Integer} Log.userId 用户ID。
 @apiSuccess {String} Log.name 姓名。
+@apiSuccess {Integer} Log.tokenId 通过个人访问令牌操作时的令牌ID，0表示通过登录会话操作。
 
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
@@ -81,7 +82,8 @@ HTTP/1.1 200 OK
 	            "userId": 2,
 	            "name": "test",
 	            "opName": "退出项目",
-	            "opParam": "{}"
+	            "opParam": "{}",
+	            "tokenId": 0
 	        },
 	    ],
 		"total": 19,
@@ -111,12 +113,12 @@ func (c *OperationLogController) search(ctx *gin.Context) {
 	}
 
 	query, tx := repo.NewPageQueryFnc(repo.DB, &entity.Log{}, param.Page, param.Limit, func(db *gorm.DB) *gorm.DB {
-		// SELECT logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,users.id AS user_id, users.name
+		// SELECT logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,logs.token_id,users.id AS user_id, users.name
 		// FROM logs LEFT JOIN users
 		// ON logs.op_id = users.id AND logs.op_type = 2
 		// WHERE
 		db = db.Table("logs").
-			Select("logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,users.id AS user_id, users.name").
+			Select("logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,logs.token_id,users.id AS user_id, users.name").
 			Joins("left join users ON logs.op_id = users.id AND logs.op_type = 2 ")
 		if param.Start != 0 && param.End != 0 {
 			db = db.Where("logs.created_at BETWEEN ? AND ? ", time.UnixMilli(param.Start), time.UnixMilli(param.End))
@@ -194,12 +196,12 @@ func (c *OperationLogController) export(ctx *gin.Context) {
 	}
 
 	// 查询条件
-	// SELECT logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,users.id AS user_id, users.name
+	// SELECT logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,logs.token_id,users.id AS user_id, users.name
 	// FROM logs LEFT JOIN users
 	// ON logs.op_id = users.id AND logs.op_type = 2
 	// WHERE
 	db := repo.DB.Table("logs").
-		Select("logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,users.id AS user_id, users.name").
+		Select("logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,logs.token_id,users.id AS user_id, users.name").
 		Joins("left join users ON logs.op_id = users.id AND logs.op_type = 2 ")
 	if param.Start != 0 && param.End != 0 {
 		db = db.Where("logs.created_at BETWEEN ? AND ? ", time.UnixMilli(param.Start), time.UnixMilli(param.End))
@@ -252,6 +254,9 @@ func (c *OperationLogController) export(ctx *gin.Context) {
 			} else if log.OpType == 2 {
 				name = log.Name
 			}
+			if log.TokenID != 0 {
+				name = fmt.Sprintf("%s（访问令牌%d）", name, log.TokenID)
+			}
 			_, err = ctx.Writer.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", createdAt, log.OpName, name, log.OpParam))
 			if err != nil {
 				ErrSys(ctx, err)
@@ -2,8 +2,10 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
-	"go.uber.org/zap"
 	"pdm/controller/middle"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
 	"pdm/reuint/jwt"
 )
 
@@ -12,53 +14,137 @@ const (
 	UserTypeAdmin = "admin" // 系统管理员 具有项目管理、用户管理权限
 	UserTypeUser  = "user"  // 普通用户
 	UserTypeAudit = "audit" // 日志审计员 查看操作日志、程序日志
-
-	// 项目角色类型
-	UserRoleProjectDeveloper      = 0 // 开发者
-	UserRoleProjectInterConnector = 1 // 对接者
-	UserRoleProjectLeader         = 2 // 项目负责人 具有项目内所有内容的管理权限
-	UserRoleProjectManager        = 3 // 项目管理员 具有项目内所有内容的管理权限
 )
 
 var (
-	Admin         = Authenticate([]string{UserTypeAdmin})                              // 管理员
-	User          = Authenticate([]string{UserTypeUser})                               // 普通用户
-	Audit         = Authenticate([]string{UserTypeAudit})                              // 日志审计员
-	Authed        = Authenticate([]string{UserTypeAdmin, UserTypeUser, UserTypeAudit}) // 所有已经认证的用户（不限角色），包括用户、管理员、审计员
-	ProjectMember = Authenticate([]string{UserTypeUser},
-		UserRoleProjectDeveloper, UserRoleProjectInterConnector, UserRoleProjectLeader, UserRoleProjectManager) // 项目成员
-	ExceptProjectInterConnector = Authenticate([]string{UserTypeUser}, UserRoleProjectLeader, UserRoleProjectManager, UserRoleProjectDeveloper) // 除对接外的成员权限
-	HighestPermission           = Authenticate([]string{UserTypeUser}, UserRoleProjectLeader, UserRoleProjectManager)                           // 项目最高权限（负责人和管理员）
+	Admin  = Authenticate([]string{UserTypeAdmin})                              // 管理员
+	User   = Authenticate([]string{UserTypeUser})                               // 普通用户
+	Audit  = Authenticate([]string{UserTypeAudit})                              // 日志审计员
+	Authed = Authenticate([]string{UserTypeAdmin, UserTypeUser, UserTypeAudit}) // 所有已经认证的用户（不限角色），包括用户、管理员、审计员
 )
 
+// flagProjectRole 当前项目中成员的角色，由 memberRole 查询后缓存
+const flagProjectRole = "ProjectRole"
+
 // Authenticate 接口调用权限鉴别
 // userType 可访问用户类型
-// role 可访问用户角色
-func Authenticate(userType []string, role ...int) func(ctx *gin.Context) {
+func Authenticate(userType []string) func(ctx *gin.Context) {
 
 	return func(ctx *gin.Context) {
 		// 获取当前用户信息
 		claimsValue, _ := ctx.Get(middle.FlagClaims)
 		claims := claimsValue.(*jwt.Claims)
 
-		zap.L().Info("接口鉴权", zap.Int("role", claims.Role))
 		// 判断用户类型是否在接口访问类型中
 		if !isTypeContain(claims.Type, userType) {
 			// 用户类型不在可访问类型中，禁止访问
-			ErrForbidden(ctx, "权限错误")
+			denied(ctx, map[string]interface{}{"userType": claims.Type})
 			return
 		}
-		if len(role) == 0 {
-			// 不需要校验角色
+	}
+}
+
+// Require 接口需要的项目权限，见 entity.Permissions
+// 仅用户可访问，用户需为当前项目（见 middle.ProjectID）的成员，且成员的角色具有该权限。
+// 项目归档后仅只读权限（见 entity.ReadOnly）有效。
+// 成员的角色在每次请求时从数据库读取，修改角色或角色的权限后立即生效。
+func Require(perm string) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		claimsValue, _ := ctx.Get(middle.FlagClaims)
+		claims := claimsValue.(*jwt.Claims)
+		projectId := middle.ProjectID(ctx)
+		if claims.Type != UserTypeUser || projectId <= 0 {
+			denied(ctx, map[string]interface{}{"userType": claims.Type, "permission": perm})
 			return
 		}
-		// 登录用户角色不在可访问角色列表中，禁止访问
-		if !isRoleContain(claims.Role, role) {
-			ErrForbidden(ctx, "权限错误")
+		role, err := memberRole(ctx)
+		if err != nil {
+			ErrSys(ctx, err)
 			return
 		}
-		return
+		if role == nil || !role.HasPermission(perm) {
+			denied(ctx, map[string]interface{}{"projectId": projectId, "permission": perm})
+			return
+		}
+		// 归档的项目只读
+		if !entity.ReadOnly(perm) {
+			writable(ctx, projectId)
+		}
+	}
+}
+
+// writable 项目是否均可修改，已归档的项目只读，响应403
+// 修改项目数据或文件的操作都需经过该检查：Require 对非只读权限检查当前项目，
+// 不经过 Require 或以只读权限修改项目文件的接口（如技术方案）需自行检查。
+func writable(ctx *gin.Context, projectIds ...int) bool {
+	for _, id := range projectIds {
+		archived, err := repo.ProjectRepo.Archived(id)
+		if err != nil {
+			ErrSys(ctx, err)
+			return false
+		}
+		if archived {
+			ErrForbidden(ctx, "项目已归档，仅可查看")
+			return false
+		}
+	}
+	return true
+}
+
+// memberRole 用户在当前项目中的角色，不是项目成员或不是用户时返还 nil
+// 每个请求仅查询一次数据库。
+func memberRole(ctx *gin.Context) (*entity.ProjectRole, error) {
+	if v, ok := ctx.Get(flagProjectRole); ok {
+		return v.(*entity.ProjectRole), nil
 	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	var role *entity.ProjectRole
+	if projectId := middle.ProjectID(ctx); claims.Type == UserTypeUser && projectId > 0 {
+		var err error
+		role, err = repo.NewProjectRoleRepository().MemberRole(projectId, claims.Sub)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ctx.Set(flagProjectRole, role)
+	return role, nil
+}
+
+// inProject 请求中的项目ID是否为当前项目，不是时响应403
+// 接口的权限由 Require 按当前项目校验，请求参数中的项目ID必须与之一致。
+func inProject(ctx *gin.Context, projectId int) bool {
+	current := middle.ProjectID(ctx)
+	if projectId <= 0 || projectId != current {
+		denied(ctx, map[string]interface{}{"projectId": current, "requestProjectId": projectId})
+		return false
+	}
+	return true
+}
+
+// owned 资源是否均属于当前项目，不属于时响应403
+// 资源不存在时同样响应403，避免通过响应判断其他项目的资源是否存在。
+// kind: 资源类型，如 repo.ResourceDoc
+func owned(ctx *gin.Context, kind string, ids ...int) bool {
+	projectId := middle.ProjectID(ctx)
+	ok, err := repo.NewResourceRepository().Belong(kind, projectId, ids...)
+	if err != nil {
+		ErrSys(ctx, err)
+		return false
+	}
+	if !ok {
+		denied(ctx, map[string]interface{}{"projectId": projectId, "resource": kind, "ids": ids})
+		return false
+	}
+	return true
+}
+
+// denied 记录越权访问日志，响应403
+func denied(ctx *gin.Context, param map[string]interface{}) {
+	param["method"] = ctx.Request.Method
+	param["path"] = ctx.Request.URL.Path
+	applog.L(ctx, "越权访问", param)
+	ErrForbidden(ctx, "权限错误")
 }
 
 // isTypeContain 判断用户是否在接口访问用户类型列表中
@@ -71,7 +157,7 @@ func isTypeContain(tye string, typList []string) bool {
 	return false
 }
 
-// isRoleContain 判断用户是否在接口访问角色列表中
+// isRoleContain 判断角色是否在角色列表中
 func isRoleContain(role int, roleList []int) bool {
 	for _, val := range roleList {
 		if val == role {
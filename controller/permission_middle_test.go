@@ -0,0 +1,149 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pdm/controller/controllertest"
+	"pdm/controller/middle"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"strings"
+	"testing"
+)
+
+func TestResourceOwnership(t *testing.T) {
+	s := controllertest.NewServer(t)
+	var users []entity.User
+	var projects []entity.Project
+	for _, openid := range []string{"1001", "1002"} {
+		user := entity.User{Openid: openid, Name: "用户" + openid, Username: "u" + openid}
+		s.CreateUser(&user, "Passw0rd")
+		project := entity.Project{Name: "项目" + openid, Manager: user.ID}
+		if err := repo.DB.Create(&project).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: user.ID, Role: entity.RoleLeader}).Error; err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+		projects = append(projects, project)
+	}
+	// 两个项目各自的文档、接口分类与用例
+	var docs []entity.Document
+	var cats []entity.ApiCategorize
+	var cases []entity.ApiCase
+	for _, p := range projects {
+		doc := entity.Document{ProjectId: p.ID, Title: "文档", DocType: "markdown"}
+		cat := entity.ApiCategorize{ProjectId: p.ID, Name: "分类"}
+		if err := repo.DB.Create(&doc).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.DB.Create(&cat).Error; err != nil {
+			t.Fatal(err)
+		}
+		c := entity.ApiCase{ProjectId: p.ID, CategorizeId: cat.ID, Name: "用例"}
+		if err := repo.DB.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+		docs, cats, cases = append(docs, doc), append(cats, cat), append(cases, c)
+	}
+	token := s.EnterProject(s.Login("1001", "Passw0rd"), projects[0].ID)
+	own, foreign := projects[0].ID, projects[1].ID
+
+	// 当前项目的资源可以访问
+	for _, p := range []string{
+		fmt.Sprintf("/api/doc/info?id=%d&projectId=%d", docs[0].ID, own),
+		fmt.Sprintf("/api/doc/projectDocList?projectId=%d", own),
+		fmt.Sprintf("/api/case/info?id=%d", cases[0].ID),
+		fmt.Sprintf("/api/categorize/list?parentId=%d", cats[0].ID),
+	} {
+		if w := s.Do(http.MethodGet, p, "", token); w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", p, w.Code, w.Body.String())
+		}
+	}
+	// 其他项目的资源、不存在的资源以及与当前项目不一致的项目ID均返回403
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, fmt.Sprintf("/api/doc/info?id=%d&projectId=%d", docs[1].ID, own), ""},
+		{http.MethodGet, fmt.Sprintf("/api/doc/info?id=%d&projectId=%d", docs[1].ID, foreign), ""},
+		{http.MethodGet, fmt.Sprintf("/api/doc/info?id=%d&projectId=%d", docs[1].ID+100, own), ""},
+		{http.MethodGet, fmt.Sprintf("/api/doc/projectDocList?projectId=%d", foreign), ""},
+		{http.MethodGet, fmt.Sprintf("/api/doc/content?docId=%d&projectId=%d", docs[1].ID, own), ""},
+		{http.MethodGet, fmt.Sprintf("/api/doc/export?docId=%d", docs[1].ID), ""},
+		{http.MethodGet, fmt.Sprintf("/api/doc/assert?docId=%d&file=a.png", docs[1].ID), ""},
+		{http.MethodPost, "/api/doc/lock", fmt.Sprintf(`{"projectId":%d,"id":%d,"docType":"doc"}`, own, docs[1].ID)},
+		{http.MethodGet, fmt.Sprintf("/api/case/info?id=%d", cases[1].ID), ""},
+		{http.MethodPost, "/api/case/edit", fmt.Sprintf(`{"id":%d,"name":"改名"}`, cases[1].ID)},
+		{http.MethodPost, "/api/case/create", fmt.Sprintf(`{"categorizeId":%d,"name":"新用例"}`, cats[1].ID)},
+		{http.MethodDelete, fmt.Sprintf("/api/case/delete?ids=%d,%d", cases[0].ID, cases[1].ID), ""},
+		{http.MethodGet, fmt.Sprintf("/api/categorize/list?parentId=%d", cats[1].ID), ""},
+		{http.MethodPost, "/api/categorize/edit", fmt.Sprintf(`{"id":%d,"name":"改名"}`, cats[1].ID)},
+		{http.MethodPost, "/api/categorize/create", fmt.Sprintf(`{"parentId":%d,"name":"子分类"}`, cats[1].ID)},
+	} {
+		if w := s.Do(tc.method, tc.path, tc.body, token); w.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: %d %s", tc.method, tc.path, w.Code, w.Body.String())
+		}
+	}
+	var count int64
+	repo.DB.Model(&entity.ApiCase{}).Where("name = ?", "用例").Count(&count)
+	if count != 2 {
+		t.Fatalf("expect cases untouched, got %d", count)
+	}
+	if w := s.Do(http.MethodDelete, fmt.Sprintf("/api/case/delete?ids=%d", cases[0].ID), "", token); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestProjectContext(t *testing.T) {
+	s := controllertest.NewServer(t)
+	user := entity.User{Openid: "1001", Name: "张三", Username: "zhangsan"}
+	s.CreateUser(&user, "Passw0rd")
+	// 同一用户在项目A中为负责人，在项目B中为对接者
+	var projects []entity.Project
+	for i, role := range []int{entity.RoleLeader, entity.RoleInterConnector} {
+		project := entity.Project{Name: fmt.Sprintf("项目%d", i), Manager: user.ID}
+		if err := repo.DB.Create(&project).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: user.ID, Role: role}).Error; err != nil {
+			t.Fatal(err)
+		}
+		projects = append(projects, project)
+	}
+	a, b := projects[0].ID, projects[1].ID
+	token := s.Login("1001", "Passw0rd")
+	do := func(method, p, body string, header int) *httptest.ResponseRecorder {
+		return s.Do(method, p, body, token, func(r *http.Request) {
+			if header > 0 {
+				r.Header.Set(middle.HeaderProjectId, fmt.Sprint(header))
+			}
+		})
+	}
+
+	// 未进入项目时没有项目上下文
+	s.Expect(do(http.MethodGet, "/api/categorize/list", "", 0), http.StatusForbidden, "")
+	// 同一token通过请求头交替访问两个项目，按各自项目中的角色鉴权
+	s.Expect(do(http.MethodPost, "/api/categorize/create", `{"name":"A"}`, a), http.StatusOK, "")
+	s.Expect(do(http.MethodPost, "/api/categorize/create", `{"name":"B"}`, b), http.StatusForbidden, "")
+	s.Expect(do(http.MethodGet, fmt.Sprintf("/api/doc/projectDocList?projectId=%d", b), "", b), http.StatusOK, "")
+	s.Expect(do(http.MethodGet, fmt.Sprintf("/api/doc/projectDocList?projectId=%d", a), "", b), http.StatusForbidden, "")
+	// 通过路径携带项目ID
+	w := do(http.MethodGet, fmt.Sprintf("/api/projects/%d/categorize/list", a), "", 0)
+	s.Expect(w, http.StatusOK, "")
+	var list []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].Name != "A" {
+		t.Fatalf("list: %s", w.Body.String())
+	}
+	w = do(http.MethodGet, fmt.Sprintf("/api/projects/%d/categorize/list", b), "", 0)
+	s.Expect(w, http.StatusOK, "")
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("list: %s", w.Body.String())
+	}
+	// 路径与请求头中的项目不一致
+	s.Expect(do(http.MethodGet, fmt.Sprintf("/api/projects/%d/categorize/list", a), "", b), http.StatusForbidden, "")
+	// 不是成员的项目
+	s.Expect(do(http.MethodGet, "/api/categorize/list", "", b+1), http.StatusForbidden, "")
+}
@@ -8,6 +8,7 @@ import (
 	"pdm/controller/dto"
 	"pdm/controller/middle"
 	"pdm/logg/applog"
+	"pdm/purge"
 	"pdm/repo"
 	"pdm/repo/entity"
 	"pdm/reuint"
@@ -20,7 +21,6 @@ import (
 func NewProjectController(router gin.IRouter) *ProjectController {
 	res := &ProjectController{}
 	r := router.Group("/project")
-	NewProjectMemberController(r)
 	// 创建项目
 	r.POST("/create", Authed, res.create)
 	// 搜索项目
@@ -31,6 +31,16 @@ func NewProjectController(router gin.IRouter) *ProjectController {
 	r.DELETE("/delete", Admin, res.delete)
 	// 查询项目信息
 	r.GET("/info", Admin, res.info)
+	// 归档项目
+	r.POST("/archive", Admin, res.archive)
+	// 恢复已归档或已删除的项目
+	r.POST("/restore", Admin, res.restore)
+	// 彻底删除项目
+	r.DELETE("/purge", Admin, res.purge)
+	// 查询彻底删除任务
+	r.GET("/purgeJob", Admin, res.purgeJob)
+	// 已归档和已删除的项目
+	r.GET("/inactive", Admin, res.inactive)
 
 	return res
 }
@@ -84,7 +94,6 @@ HTTP/1.1 400 Bad Request
 // create 创建项目
 func (c *ProjectController) create(ctx *gin.Context) {
 	var info entity.Project
-	var member entity.ProjectMember
 	err := ctx.BindJSON(&info)
 	// 记录日志
 	applog.L(ctx, "创建项目", map[string]interface{}{
@@ -131,15 +140,9 @@ func (c *ProjectController) create(ctx *gin.Context) {
 			return err
 		}
 		// 项目成员：负责人
-		member.Role = UserRoleProjectLeader
-		member.ProjectId = info.ID
-		member.UserId = info.Manager
-		if err := tx.Create(&member).Error; err != nil {
-			return err
-		}
-		return nil
+		return repo.ProjectMemberRepo.TransferLeader(tx, info.ID, info.Manager)
 	}); err != nil {
-		ErrSys(ctx, err)
+		ErrIllegalE(ctx, err)
 		return
 	}
 
@@ -180,6 +183,7 @@ GET /api/project/search?keyword=cs
 @apiSuccess {Object} [Project.manager] 负责人信息。
 @apiSuccess {Integer} [Project.manager.id] 用户ID。
 @apiSuccess {String} [Project.manager.name] 姓名。
+@apiSuccess {Integer} [Project.isArchive] 是否归档 0 - 未归档 1 - 归档，归档的项目只读。
 
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
@@ -191,7 +195,8 @@ HTTP/1.1 200 OK
 		    "updatedAt": "2020-09-26 11:29:44",
 		    "name": "测试项目",
             "version": "",
-            "manager": { "id" : 13, "name":"张三"}
+            "manager": { "id" : 13, "name":"张三"},
+            "isArchive": 0
 		}
     ],
 	"total": 19,
@@ -294,7 +299,7 @@ func (c *ProjectController) search(ctx *gin.Context) {
 @apiDescription 编辑项目，项目名称不能重复，项目描述文本即可，
 可以关键字（拼音缩写、姓名、用户名）查询项目负责人。
 在写入数据库时需要生成项目名称的拼音缩写。
-在项目负责人发生变化是同时更新项目成员表（project_members）
+在项目负责人发生变化时同时更新项目成员表（project_members），原负责人改为管理员，新负责人不是项目成员时加入项目。
 @apiName ProjectEdit
 @apiGroup Project
 
@@ -348,6 +353,10 @@ func (c *ProjectController) edit(ctx *gin.Context) {
 		ErrIllegal(ctx, "项目不存在或项目已经被删除")
 		return
 	}
+	if project.IsArchive == 1 {
+		ErrIllegal(ctx, "项目已归档，请先恢复")
+		return
+	}
 
 	// 事务处理 ， 确定 项目成员表 和 项目表 都完成更新
 	err = repo.DB.Transaction(func(tx *gorm.DB) error {
@@ -375,11 +384,9 @@ func (c *ProjectController) edit(ctx *gin.Context) {
 		// 项目描述进行修改
 		project.Description = info.Description
 
-		// 如果对项目负责人进行了修改
+		// 如果对项目负责人进行了修改，原负责人改为管理员
 		if info.Manager != project.Manager {
-			// 找到 该项目的项目负责人 并  更新项目负责人
-			err := tx.Model(&entity.ProjectMember{}).Where("project_id = ? AND role = ?", info.ID, UserRoleProjectManager).Update("user_id", info.Manager).Error
-			if err != nil {
+			if err := repo.ProjectMemberRepo.TransferLeader(tx, info.ID, info.Manager); err != nil {
 				return err
 			}
 			project.Manager = info.Manager
@@ -398,7 +405,8 @@ func (c *ProjectController) edit(ctx *gin.Context) {
 
 /**
 @api {DELETE} /api/project/delete 删除项目
-@apiDescription 删除项目，该接口仅在数据库操作异常时返回500系统错误的状态码，其他情况均返回200。
+@apiDescription 删除项目，删除的项目可以通过 POST /api/project/restore 恢复，或通过 DELETE /api/project/purge 彻底删除。
+该接口仅在数据库操作异常时返回500系统错误的状态码，其他情况均返回200。
 @apiName ProjectDelete
 @apiGroup Project
 
@@ -509,3 +517,369 @@ func (c *ProjectController) info(ctx *gin.Context) {
 
 	ctx.JSON(200, reqInfo)
 }
+
+/**
+@api {POST} /api/project/archive 归档项目
+@apiDescription 归档项目，归档后项目只读：项目成员仅可查看和导出，无法编辑文档、用例、成员与角色，
+无法生成技术方案或修改项目的技术方案目录，管理员也无法编辑项目信息，需先恢复项目。
+@apiName ProjectArchive
+@apiGroup Project
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 项目ID。
+
+@apiParamExample {json} 请求示例
+{
+    "id": 12
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400 Bad Request
+
+项目不存在或已经被删除
+*/
+
+// archive 归档项目
+func (c *ProjectController) archive(ctx *gin.Context) {
+	var info entity.Project
+	err := ctx.BindJSON(&info)
+	// 记录日志
+	applog.L(ctx, "归档项目", map[string]interface{}{
+		"id": info.ID,
+	})
+	if err != nil || info.ID <= 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+
+	res := repo.DB.Model(&entity.Project{}).Where("id = ? AND is_delete = 0", info.ID).Update("is_archive", 1)
+	if res.Error != nil {
+		ErrSys(ctx, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		exist, err := repo.ProjectRepo.Exist(info.ID)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		if !exist {
+			ErrIllegal(ctx, "项目不存在或已经被删除")
+			return
+		}
+	}
+}
+
+/**
+@api {POST} /api/project/restore 恢复项目
+@apiDescription 恢复已归档或已删除的项目，恢复后项目可正常编辑。
+已存在同名项目时无法恢复删除的项目，需先修改同名项目的名称。
+@apiName ProjectRestore
+@apiGroup Project
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 项目ID。
+
+@apiParamExample {json} 请求示例
+{
+    "id": 12
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400 Bad Request
+
+已存在同名项目，无法恢复
+*/
+
+// restore 恢复项目
+func (c *ProjectController) restore(ctx *gin.Context) {
+	var info entity.Project
+	err := ctx.BindJSON(&info)
+	// 记录日志
+	applog.L(ctx, "恢复项目", map[string]interface{}{
+		"id": info.ID,
+	})
+	if err != nil || info.ID <= 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	purging, err := repo.NewPurgeJobRepository().Running(info.ID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if purging {
+		ErrIllegal(ctx, "项目正在彻底删除，无法恢复")
+		return
+	}
+
+	project := &entity.Project{}
+	err = repo.DB.First(project, info.ID).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "项目不存在")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if project.IsDelete == 1 {
+		exist, err := repo.ProjectRepo.NameExist(project.Name)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		if exist {
+			ErrIllegal(ctx, "已存在同名项目，无法恢复")
+			return
+		}
+	}
+	err = repo.DB.Model(project).Updates(map[string]interface{}{"is_delete": 0, "is_archive": 0}).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {DELETE} /api/project/purge 彻底删除项目
+@apiDescription 彻底删除已归档或已删除的项目，删除后无法恢复。
+删除项目的文档、接口分类与用例、技术方案、成员、自定义角色以及绑定项目的个人访问令牌等所有数据记录，
+以及对接文档目录和技术方案目录（技术方案中记录的目录与以项目名称命名的目录，其他项目仍在使用的目录保留）。
+删除在后台任务中执行，接口返回任务信息，通过 GET /api/project/purgeJob 查询任务进度，
+任务完成后在操作日志中记录删除的内容。同一项目同一时间只允许一个进行中的任务。
+任务失败或因服务停止、重启中断时任务状态为失败，可重新发起。
+@apiName ProjectPurge
+@apiGroup Project
+
+@apiPermission 管理员
+
+@apiParam {String} id 项目ID。
+
+@apiParamExample 请求示例
+DELETE /api/project/purge?id=12
+
+@apiSuccess {Integer} id 任务ID。
+@apiSuccess {String} createdAt 任务创建时间，格式"YYYY-MM-DD HH:mm:ss"。
+@apiSuccess {String} updatedAt 任务更新时间，格式"YYYY-MM-DD HH:mm:ss"。
+@apiSuccess {Integer} projectId 项目ID。
+@apiSuccess {String} projectName 项目名称。
+@apiSuccess {Integer} opId 发起任务的管理员ID。
+@apiSuccess {String} status 任务状态：
+<ul>
+    <li>running - 进行中</li>
+    <li>done - 完成</li>
+    <li>failed - 失败</li>
+</ul>
+@apiSuccess {Object} removed 删除的内容，数据表名或文件目录类型（docDirs、technicalProposalDirs）与删除的数量。
+@apiSuccess {String} error 失败原因。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "id": 1,
+    "createdAt": "2026-10-17 15:04:05",
+    "updatedAt": "2026-10-17 15:04:05",
+    "projectId": 12,
+    "projectName": "数据交换系统",
+    "opId": 1,
+    "status": "running",
+    "removed": {},
+    "error": ""
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400 Bad Request
+
+仅可彻底删除已归档或已删除的项目
+*/
+
+// purge 彻底删除项目
+func (c *ProjectController) purge(ctx *gin.Context) {
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	id, _ := strconv.Atoi(ctx.Query("id"))
+	// 记录日志
+	applog.L(ctx, "彻底删除项目", map[string]interface{}{
+		"id": id,
+	})
+	if id <= 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+
+	project := &entity.Project{}
+	err := repo.DB.First(project, id).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "项目不存在")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if project.IsDelete != 1 && project.IsArchive != 1 {
+		ErrIllegal(ctx, "仅可彻底删除已归档或已删除的项目")
+		return
+	}
+	job, err := purge.Start(project, *claims)
+	if errors.Is(err, purge.ErrBusy) || errors.Is(err, purge.ErrClosed) {
+		ErrIllegalE(ctx, err)
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, job)
+}
+
+/**
+@api {GET} /api/project/purgeJob 彻底删除任务
+@apiDescription 查询项目彻底删除任务的状态与删除的内容。
+@apiName ProjectPurgeJob
+@apiGroup Project
+
+@apiPermission 管理员
+
+@apiParam {String} id 任务ID。
+
+@apiParamExample 请求示例
+GET /api/project/purgeJob?id=1
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "id": 1,
+    "createdAt": "2026-10-17 15:04:05",
+    "updatedAt": "2026-10-17 15:04:06",
+    "projectId": 12,
+    "projectName": "数据交换系统",
+    "opId": 1,
+    "status": "done",
+    "removed": {"projects": 1, "documents": 3, "docDirs": 3, "technicalProposalDirs": 1},
+    "error": ""
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400 Bad Request
+
+任务不存在
+*/
+
+// purgeJob 查询彻底删除任务
+func (c *ProjectController) purgeJob(ctx *gin.Context) {
+	id, _ := strconv.Atoi(ctx.Query("id"))
+	if id <= 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	job := &entity.ProjectPurgeJob{}
+	err := repo.DB.First(job, id).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "任务不存在")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, job)
+}
+
+/**
+@api {GET} /api/project/inactive 已归档和已删除的项目
+@apiDescription 查询已归档和已删除的项目，按更新时间由新到旧排序。
+@apiName ProjectInactive
+@apiGroup Project
+
+@apiPermission 管理员
+
+@apiParam {String} [type] 项目类型，为空时查询全部：
+<ul>
+    <li>archived - 已归档</li>
+    <li>deleted - 已删除</li>
+</ul>
+
+@apiParamExample 请求示例
+GET /api/project/inactive?type=deleted
+
+@apiSuccess {Object[]} body 项目列表。
+@apiSuccess {Integer} body.id 项目ID。
+@apiSuccess {String} body.createdAt 创建时间，格式"YYYY-MM-DD HH:mm:ss"。
+@apiSuccess {String} body.updatedAt 更新时间，格式"YYYY-MM-DD HH:mm:ss"。
+@apiSuccess {String} body.name 项目名称。
+@apiSuccess {Object} body.manager 项目负责人。
+@apiSuccess {Integer} body.manager.id 用户ID。
+@apiSuccess {String} body.manager.name 姓名。
+@apiSuccess {String} body.version 版本号。
+@apiSuccess {Integer} body.isArchive 是否归档 0 - 未归档 1 - 归档。
+@apiSuccess {Integer} body.isDelete 是否删除 0 - 未删除 1 - 删除。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "id": 12,
+        "createdAt": "2026-01-05 10:00:00",
+        "updatedAt": "2026-10-17 15:04:05",
+        "name": "数据交换系统",
+        "manager": {"id": 3, "name": "张三"},
+        "version": "",
+        "isArchive": 0,
+        "isDelete": 1
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 400 Bad Request
+
+参数非法，无法解析
+*/
+
+// inactive 已归档和已删除的项目
+func (c *ProjectController) inactive(ctx *gin.Context) {
+	tx := repo.DB.Model(&entity.Project{})
+	switch ctx.Query("type") {
+	case "":
+		tx = tx.Where("is_delete = 1 OR is_archive = 1")
+	case "archived":
+		tx = tx.Where("is_delete = 0 AND is_archive = 1")
+	case "deleted":
+		tx = tx.Where("is_delete = 1")
+	default:
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	var projects []entity.Project
+	if err := tx.Order("updated_at DESC").Find(&projects).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+
+	res := []dto.ProjectInactiveDto{}
+	for i := range projects {
+		user := entity.User{}
+		// 查询 负责人信息
+		if err := repo.DB.Select("name").Where("id", projects[i].Manager).Find(&user).Error; err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		item := dto.ProjectInactiveDto{IsDelete: projects[i].IsDelete}
+		item.Transform(&projects[i], &user)
+		res = append(res, item)
+	}
+	ctx.JSON(200, res)
+}
@@ -0,0 +1,212 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pdm/controller/controllertest"
+	"pdm/controller/dto"
+	"pdm/purge"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/storage"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestProjectLifecycle(t *testing.T) {
+	s := controllertest.NewServer(t)
+	user := entity.User{Openid: "3001", Name: "用户3001", Username: "u3001"}
+	s.CreateUser(&user, "Passw0rd")
+	project := entity.Project{Name: "归档项目", Manager: user.ID}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	member := entity.ProjectMember{ProjectId: project.ID, UserId: user.ID, Role: entity.RoleLeader}
+	doc := entity.Document{ProjectId: project.ID, Title: "文档", DocType: "markdown"}
+	cat := entity.ApiCategorize{ProjectId: project.ID, Name: "分类"}
+	other := entity.Project{Name: "其他项目", Manager: user.ID}
+	if err := repo.DB.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 技术方案目录在生成时记录，项目改名后不变；共享目录被其他项目使用
+	for _, v := range []interface{}{&member, &doc, &cat,
+		&entity.TechnicalProposal{ProjectId: project.ID, Name: "a.md", Dir: "旧名称"},
+		&entity.TechnicalProposal{ProjectId: project.ID, Name: "b.md", Dir: "共享"},
+		&entity.TechnicalProposal{ProjectId: other.ID, Name: "c.md", Dir: "共享"},
+		&entity.ProjectRole{ProjectId: project.ID, Role: entity.RoleCustomBase, Name: "测试", Permissions: entity.PermProjectRead},
+	} {
+		if err := repo.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.DB.Create(&entity.ApiCase{ProjectId: project.ID, CategorizeId: cat.ID, Name: "用例"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	docDir := strconv.Itoa(doc.ID)
+	_ = storage.WriteFile(storage.Doc, docDir+"/doc.md", []byte("# doc"))
+	_ = storage.WriteFile(storage.TechnicalProposal, "旧名称/方案.txt", []byte("tp"))
+	_ = storage.WriteFile(storage.TechnicalProposal, "共享/方案.txt", []byte("tp"))
+
+	token := s.EnterProject(s.Login("3001", "Passw0rd"), project.ID)
+	admin := s.AdminToken(0)
+	idBody := fmt.Sprintf(`{"id":%d}`, project.ID)
+	batch := fmt.Sprintf(`{"projectId":%d,"ids":[%d],"role":%d}`, project.ID, member.ID, entity.RoleManager)
+	type inactiveProject struct {
+		ID        int `json:"id"`
+		IsArchive int `json:"isArchive"`
+		IsDelete  int `json:"isDelete"`
+	}
+	inactive := func(typ string) []inactiveProject {
+		var res []inactiveProject
+		w := s.Do(http.MethodGet, "/api/project/inactive?type="+typ, "", admin)
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &res) != nil {
+			t.Fatalf("inactive %s: %d %s", typ, w.Code, w.Body.String())
+		}
+		return res
+	}
+
+	// 活动的项目不可彻底删除
+	w := s.Do(http.MethodDelete, fmt.Sprintf("/api/project/purge?id=%d", project.ID), "", admin)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("purge active: %d %s", w.Code, w.Body.String())
+	}
+
+	// 归档后只读
+	if w = s.Do(http.MethodPost, "/api/project/archive", idBody, admin); w.Code != http.StatusOK {
+		t.Fatalf("archive: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodGet, fmt.Sprintf("/api/doc/projectDocList?projectId=%d", project.ID), "", token); w.Code != http.StatusOK {
+		t.Fatalf("read archived: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodPost, "/api/project/member/batchChange", batch, token); w.Code != http.StatusForbidden {
+		t.Fatalf("write archived: %d %s", w.Code, w.Body.String())
+	}
+	w = s.Do(http.MethodPost, "/api/project/edit", fmt.Sprintf(`{"id":%d,"name":"改名","manager":%d}`, project.ID, user.ID), admin)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("edit archived: %d %s", w.Code, w.Body.String())
+	}
+	// 不经过 Require 的技术方案接口与以只读权限生成技术方案同样只读
+	if w = s.Do(http.MethodDelete, "/api/technicalProposal/remove?path=/旧名称/方案.txt", "", token); w.Code != http.StatusForbidden {
+		t.Fatalf("remove technical proposal archived: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodPost, "/api/technicalProposal/mkdir", `"/旧名称/新目录"`, token); w.Code != http.StatusForbidden {
+		t.Fatalf("mkdir technical proposal archived: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodGet, fmt.Sprintf("/api/doc/generate?projectId=%d&docId=%d", project.ID, doc.ID), "", token); w.Code != http.StatusForbidden {
+		t.Fatalf("generate archived: %d %s", w.Code, w.Body.String())
+	}
+	if res := inactive("archived"); len(res) != 1 || res[0].ID != project.ID || res[0].IsArchive != 1 {
+		t.Fatalf("inactive archived: %+v", res)
+	}
+
+	// 恢复后可写，负责人的角色不可批量修改
+	if w = s.Do(http.MethodPost, "/api/project/restore", idBody, admin); w.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodPost, "/api/project/member/batchChange", batch, token); w.Code != http.StatusBadRequest {
+		t.Fatalf("write restored: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodPost, "/api/technicalProposal/mkdir", `"/旧名称/新目录"`, token); w.Code != http.StatusOK {
+		t.Fatalf("mkdir technical proposal restored: %d %s", w.Code, w.Body.String())
+	}
+	// 项目改名后仍可见原技术方案目录
+	var items []dto.FileItemDto
+	w = s.Do(http.MethodGet, "/api/technicalProposal/list", "", token)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &items) != nil {
+		t.Fatalf("list technical proposal: %d %s", w.Code, w.Body.String())
+	}
+	names := map[string]bool{}
+	for _, item := range items {
+		names[item.Name] = true
+	}
+	if !names["旧名称"] || !names["共享"] {
+		t.Fatalf("list technical proposal: %+v", items)
+	}
+	if res := inactive(""); len(res) != 0 {
+		t.Fatalf("inactive after restore: %+v", res)
+	}
+
+	// 删除后彻底删除
+	if w = s.Do(http.MethodDelete, fmt.Sprintf("/api/project/delete?id=%d", project.ID), "", admin); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if res := inactive("deleted"); len(res) != 1 || res[0].IsDelete != 1 {
+		t.Fatalf("inactive deleted: %+v", res)
+	}
+	var job struct {
+		ID      int              `json:"id"`
+		Status  string           `json:"status"`
+		Removed map[string]int64 `json:"removed"`
+		Error   string           `json:"error"`
+	}
+	// 同一项目同一时间只允许一个进行中的任务，以数据库中的任务记录为准
+	stale := entity.ProjectPurgeJob{ProjectId: project.ID, ProjectName: project.Name, Status: entity.PurgeRunning}
+	if err := repo.DB.Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w = s.Do(http.MethodDelete, fmt.Sprintf("/api/project/purge?id=%d", project.ID), "", admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("purge running: %d %s", w.Code, w.Body.String())
+	}
+	if w = s.Do(http.MethodPost, "/api/project/restore", idBody, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("restore purging: %d %s", w.Code, w.Body.String())
+	}
+	// 启动时将中断的任务标记为失败
+	if err := purge.Init(); err != nil {
+		t.Fatal(err)
+	}
+	w = s.Do(http.MethodGet, fmt.Sprintf("/api/project/purgeJob?id=%d", stale.ID), "", admin)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &job) != nil || job.Status != entity.PurgeFailed || job.Error == "" {
+		t.Fatalf("stale job: %d %s", w.Code, w.Body.String())
+	}
+	// 停机后不再接受新的任务
+	purge.Close()
+	if w = s.Do(http.MethodDelete, fmt.Sprintf("/api/project/purge?id=%d", project.ID), "", admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("purge after close: %d %s", w.Code, w.Body.String())
+	}
+	if err := purge.Init(); err != nil {
+		t.Fatal(err)
+	}
+	w = s.Do(http.MethodDelete, fmt.Sprintf("/api/project/purge?id=%d", project.ID), "", admin)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &job) != nil || job.ID == 0 {
+		t.Fatalf("purge: %d %s", w.Code, w.Body.String())
+	}
+	for deadline := time.Now().Add(5 * time.Second); job.Status == entity.PurgeRunning; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("purge job timeout")
+		}
+		w = s.Do(http.MethodGet, fmt.Sprintf("/api/project/purgeJob?id=%d", job.ID), "", admin)
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &job) != nil {
+			t.Fatalf("purgeJob: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if job.Status != entity.PurgeDone {
+		t.Fatalf("purge job: %+v", job)
+	}
+	for k, v := range map[string]int64{"projects": 1, "documents": 1, "api_cases": 1, "api_categorizes": 1,
+		"technical_proposals": 2, "project_members": 1, "project_roles": 1, "docDirs": 1, "technicalProposalDirs": 1} {
+		if job.Removed[k] != v {
+			t.Fatalf("removed %s: expect %d, got %d", k, v, job.Removed[k])
+		}
+	}
+	for _, model := range []interface{}{&entity.Document{}, &entity.ApiCase{}, &entity.ApiCategorize{}, &entity.ProjectMember{}, &entity.ProjectRole{}} {
+		var count int64
+		repo.DB.Model(model).Where("project_id = ?", project.ID).Count(&count)
+		if count != 0 {
+			t.Fatalf("%T not purged", model)
+		}
+	}
+	if exist, _ := storage.Exist(storage.Doc, docDir); exist {
+		t.Fatal("doc dir not purged")
+	}
+	if exist, _ := storage.Exist(storage.TechnicalProposal, "旧名称"); exist {
+		t.Fatal("technical proposal dir not purged")
+	}
+	if exist, _ := storage.Exist(storage.TechnicalProposal, "共享"); !exist {
+		t.Fatal("shared technical proposal dir purged")
+	}
+	if w = s.Do(http.MethodPost, "/api/project/restore", idBody, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("restore purged: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"pdm/controller/dto"
+	"pdm/controller/middle"
 	"pdm/logg/applog"
 	"pdm/repo"
 	"pdm/repo/entity"
+	"pdm/reuint/jwt"
 	"strconv"
+	"strings"
 )
 
 // ProjectMemberController 项目成员控制器
@@ -20,14 +23,21 @@ func NewProjectMemberController(router gin.IRouter) *ProjectMemberController {
 	res := &ProjectMemberController{}
 	r := router.Group("/member")
 	// 添加成员
-	r.POST("/add", HighestPermission, res.add)
+	r.POST("/add", Require(entity.PermMemberManage), res.add)
 	// 修改角色
-	r.POST("/change", HighestPermission, res.change)
+	r.POST("/change", Require(entity.PermMemberManage), res.change)
+	// 批量修改角色
+	r.POST("/batchChange", Require(entity.PermMemberManage), res.batchChange)
+	// 移交项目负责人
+	r.POST("/transfer", Require(entity.PermMemberManage), res.transfer)
 	// 删除成员
-	r.DELETE("/delete", HighestPermission, res.delete)
+	r.DELETE("/delete", Require(entity.PermMemberManage), res.delete)
 	// 查询所有成员
-	r.GET("/all", ProjectMember, res.all)
-	// 修改成员任务描述
+	r.GET("/all", Require(entity.PermProjectRead), res.all)
+	// 查询可添加为成员的用户
+	r.GET("/candidates", Require(entity.PermMemberManage), res.candidates)
+	// 我参与的项目以及角色
+	r.GET("/mine", User, res.mine)
 	return res
 }
 
@@ -38,22 +48,22 @@ func NewProjectMemberController(router gin.IRouter) *ProjectMemberController {
 @apiName MemberAdd
 @apiGroup Member
 
-@apiPermission 项目负责人
+@apiPermission 具有 member.manage 权限的项目成员
 
-@apiParam {Integer} role 角色类型：
+@apiParam {Integer} role 角色编号，见 GET /api/role/list：
 <ul>
-    <li>0 - 访客</li>
-    <li>1 - 测试</li>
-    <li>2 - 开发</li>
-    <li>3 - 维护</li>
+    <li>0 - 开发者</li>
+    <li>1 - 对接者</li>
+    <li>3 - 管理员</li>
+    <li>100及以上 - 项目自定义角色</li>
 </ul>
 
 @apiParam {Integer} projectId 项目ID。
-@apiParam {Integer[]} userIds 用户ID。
+@apiParam {Integer[]} userId 用户ID。
 
 @apiParamExample {json} 请求示例
 {
-    "role": 2,
+    "role": 0,
     "projectId": 1,
     "userId": [2]
 }
@@ -92,11 +102,17 @@ func (c ProjectMemberController) add(ctx *gin.Context) {
 		ErrIllegal(ctx, "请添加成员名称")
 		return
 	}
+	if !inProject(ctx, info.ProjectId) {
+		return
+	}
 
-	if info.Role == entity.RoleCreator {
+	if info.Role == entity.RoleLeader {
 		ErrIllegal(ctx, "无法添加项目负责人")
 		return
 	}
+	if !c.roleExist(ctx, info.ProjectId, info.Role) {
+		return
+	}
 	// 判断项目是否存在
 	exist, err := repo.ProjectRepo.Exist(info.ProjectId)
 	if err != nil {
@@ -155,17 +171,17 @@ func (c ProjectMemberController) add(ctx *gin.Context) {
 @apiName MemberChange
 @apiGroup Member
 
-@apiPermission 项目负责人
+@apiPermission 具有 member.manage 权限的项目成员
 
 @apiParam {Integer} id 记录ID。
 @apiParam {Integer} projectId 项目ID。
 
-@apiParam {Integer} role 角色类型：
+@apiParam {Integer} role 角色编号，见 GET /api/role/list：
 <ul>
-    <li>0 - 访客</li>
-    <li>1 - 测试</li>
-    <li>2 - 开发</li>
-    <li>3 - 维护</li>
+    <li>0 - 开发者</li>
+    <li>1 - 对接者</li>
+    <li>3 - 管理员</li>
+    <li>100及以上 - 项目自定义角色</li>
 </ul>
 
 
@@ -205,10 +221,16 @@ func (c ProjectMemberController) change(ctx *gin.Context) {
 		return
 	}
 
-	if reqInfo.Role == entity.RoleCreator {
+	if reqInfo.Role == entity.RoleLeader {
 		ErrIllegal(ctx, "不可修改为项目负责人")
 		return
 	}
+	if !inProject(ctx, reqInfo.ProjectId) || !owned(ctx, repo.ResourceMember, reqInfo.ID) {
+		return
+	}
+	if !c.roleExist(ctx, reqInfo.ProjectId, reqInfo.Role) {
+		return
+	}
 
 	memberInfo := &entity.ProjectMember{}
 	err = repo.DB.First(memberInfo, "id = ? AND project_id = ?", reqInfo.ID, reqInfo.ProjectId).Error
@@ -220,8 +242,8 @@ func (c ProjectMemberController) change(ctx *gin.Context) {
 		ErrSys(ctx, err)
 		return
 	}
-	if memberInfo.Role == entity.RoleCreator {
-		ErrIllegal(ctx, "项目负责人不可修改")
+	if memberInfo.Role == entity.RoleLeader {
+		ErrIllegal(ctx, "项目负责人不可修改，请使用移交负责人")
 		return
 	}
 	memberInfo.Role = reqInfo.Role
@@ -239,7 +261,7 @@ func (c ProjectMemberController) change(ctx *gin.Context) {
 @apiName MemberDelete
 @apiGroup Member
 
-@apiPermission 项目负责人
+@apiPermission 具有 member.manage 权限的项目成员
 
 @apiParam {String} id 项目成员记录ID。
 @apiParam {String} projectId 项目ID。
@@ -277,6 +299,9 @@ func (c ProjectMemberController) delete(ctx *gin.Context) {
 	applog.L(ctx, "删除成员", map[string]interface{}{
 		"id": id,
 	})
+	if !inProject(ctx, projectId) {
+		return
+	}
 
 	res := &entity.ProjectMember{}
 	err := repo.DB.First(res, "id = ? AND project_id = ?", id, projectId).Error
@@ -289,7 +314,7 @@ func (c ProjectMemberController) delete(ctx *gin.Context) {
 		return
 	}
 	// 用户为项目负责人不进行删除操作
-	if res.Role == 4 {
+	if res.Role == entity.RoleLeader {
 		return
 	}
 	err = repo.DB.Delete(&entity.ProjectMember{}, id).Error
@@ -305,7 +330,7 @@ func (c ProjectMemberController) delete(ctx *gin.Context) {
 @apiName MemberAll
 @apiGroup Member
 
-@apiPermission 项目负责人，项目成员
+@apiPermission 具有 project.read 权限的项目成员
 
 @apiParam {String} projectId 项目ID
 @apiParam {String} keyword 用户名、姓名、姓名拼音缩写。
@@ -319,14 +344,16 @@ GET /api/project/member/all?projectId=12&keyword=zs
 @apiParam {Integer} MemberUser.userId 用户ID。
 @apiParam {Integer} MemberUser.role 成员角色。
 @apiParam {String} MemberUser.name 姓名。
+@apiParam {String} MemberUser.username 用户名。
+@apiParam {String} MemberUser.namePinyin 姓名拼音缩写。
 
 
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
 
 [
-    {"id": 12, "userId": 1, "role": 4, "name": "张三"},
-    {"id": 17, "userId": 2, "role": 2, "name": "郭小菊"}
+    {"id": 12, "userId": 1, "role": 3, "name": "张三", "username": "zhangsan", "namePinyin": "zs"},
+    {"id": 17, "userId": 2, "role": 2, "name": "郭小菊", "username": "guoxj", "namePinyin": "gxj"}
 ]
 
 @apiErrorExample 失败响应1
@@ -349,6 +376,9 @@ func (c ProjectMemberController) all(ctx *gin.Context) {
 		return
 	}
 	keyword := ctx.Query("keyword")
+	if !inProject(ctx, projectId) {
+		return
+	}
 
 	// 判断项目是否存在
 	exist, err := repo.ProjectRepo.Exist(projectId)
@@ -360,22 +390,19 @@ func (c ProjectMemberController) all(ctx *gin.Context) {
 		ErrIllegal(ctx, "该项目不存在或被删除")
 		return
 	}
-	//拼音模糊条件
-	queryPinyin := repo.DB.Where("name_pinyin like ?", fmt.Sprintf("%%%s%%", keyword))
-	//姓名模糊条件
-	queryName := repo.DB.Where("name like ?", fmt.Sprintf("%%%s%%", keyword))
-	//用户名模糊条件
-	queryUserName := repo.DB.Where("username like ?", fmt.Sprintf("%%%s%%", keyword))
-
 	// 联表后条件查询
 	//SELECT project_members.id,user_id,project_id,role,username,name,name_pinyin,is_delete
 	//	FROM `project_members` left join users
 	//	on project_members.user_id = users.id
 	//	WHERE (is_delete = 0 AND project_id = 1) AND (name_pinyin like '%zs%' OR name like '%zs%' OR username like '%zs%')
-	err = repo.DB.Table("project_members").
+	tx := repo.DB.Table("project_members").
 		Select("project_members.id,user_id,project_id,role,username,name,name_pinyin,is_delete").
 		Joins("left join users  on project_members.user_id = users.id").
-		Where("is_delete = ? AND project_id = ?", 0, projectId).Where(queryPinyin.Or(queryName).Or(queryUserName)).Find(&reqInfo).Error
+		Where("is_delete = ? AND project_id = ?", 0, projectId)
+	if keyword != "" {
+		tx = tx.Where(keywordQuery(keyword))
+	}
+	err = tx.Find(&reqInfo).Error
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -383,3 +410,320 @@ func (c ProjectMemberController) all(ctx *gin.Context) {
 
 	ctx.JSON(200, reqInfo)
 }
+
+/**
+@api {POST} /api/project/member/batchChange 批量修改角色
+@apiDescription 批量修改成员的角色，不允许修改为负责人，也不允许修改负责人的角色。
+任一成员不属于该项目或为负责人时，所有成员均不修改。
+@apiName MemberBatchChange
+@apiGroup Member
+
+@apiPermission 具有 member.manage 权限的项目成员
+
+@apiParam {Integer} projectId 项目ID。
+@apiParam {Integer[]} ids 成员记录ID。
+@apiParam {Integer} role 角色编号，见 GET /api/role/list。
+
+@apiParamExample {json} 请求示例
+{
+    "projectId": 11,
+    "ids": [2, 3, 5],
+    "role": 1
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应1
+HTTP/1.1 500
+
+系统内部错误
+
+@apiErrorExample 失败响应2
+HTTP/1.1 400
+
+项目负责人不可修改，请使用移交负责人
+*/
+
+// batchChange 批量修改角色
+func (c ProjectMemberController) batchChange(ctx *gin.Context) {
+	var info dto.MemberBatchDTO
+	err := ctx.BindJSON(&info)
+	// 记录日志
+	applog.L(ctx, "批量修改成员的角色", map[string]interface{}{
+		"projectId": info.ProjectId,
+		"ids":       info.Ids,
+		"role":      info.Role,
+	})
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	if len(info.Ids) == 0 {
+		ErrIllegal(ctx, "请选择成员")
+		return
+	}
+	if info.Role == entity.RoleLeader {
+		ErrIllegal(ctx, "不可修改为项目负责人")
+		return
+	}
+	if !inProject(ctx, info.ProjectId) || !owned(ctx, repo.ResourceMember, info.Ids...) {
+		return
+	}
+	if !c.roleExist(ctx, info.ProjectId, info.Role) {
+		return
+	}
+
+	err = repo.ProjectMemberRepo.ChangeRoles(info.ProjectId, info.Ids, info.Role)
+	if errors.Is(err, repo.ErrLeaderRole) || errors.Is(err, repo.ErrNotMember) {
+		ErrIllegalE(ctx, err)
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {POST} /api/project/member/transfer 移交项目负责人
+@apiDescription 将项目负责人移交给项目中的其他成员，仅当前负责人可以移交。
+移交后原负责人的角色改为管理员，项目的负责人（manager）同步修改。
+@apiName MemberTransfer
+@apiGroup Member
+
+@apiPermission 项目负责人
+
+@apiParam {Integer} projectId 项目ID。
+@apiParam {Integer} userId 新负责人的用户ID，需为项目成员。
+
+@apiParamExample {json} 请求示例
+{
+    "projectId": 11,
+    "userId": 5
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应1
+HTTP/1.1 500
+
+系统内部错误
+
+@apiErrorExample 失败响应2
+HTTP/1.1 400
+
+项目中不存在该成员
+*/
+
+// transfer 移交项目负责人
+func (c ProjectMemberController) transfer(ctx *gin.Context) {
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	var info dto.MemberTransferDTO
+	err := ctx.BindJSON(&info)
+	// 记录日志
+	applog.L(ctx, "移交项目负责人", map[string]interface{}{
+		"projectId": info.ProjectId,
+		"userId":    info.UserId,
+	})
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	if !inProject(ctx, info.ProjectId) {
+		return
+	}
+
+	project := &entity.Project{}
+	err = repo.DB.First(project, "id = ? AND is_delete = 0", info.ProjectId).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "项目不存在或已被删除")
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	// 仅当前负责人可以移交
+	if project.Manager != claims.Sub {
+		denied(ctx, map[string]interface{}{"projectId": info.ProjectId})
+		return
+	}
+	if info.UserId == claims.Sub {
+		ErrIllegal(ctx, "该用户已是项目负责人")
+		return
+	}
+	exist, err := repo.ProjectMemberRepo.Exist(info.ProjectId, info.UserId)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if !exist {
+		ErrIllegalE(ctx, repo.ErrNotMember)
+		return
+	}
+
+	err = repo.DB.Transaction(func(tx *gorm.DB) error {
+		return repo.ProjectMemberRepo.TransferLeader(tx, info.ProjectId, info.UserId)
+	})
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {GET} /api/project/member/candidates 可添加的用户
+@apiDescription 按用户名、姓名、姓名拼音缩写搜索尚未加入项目的用户，最多返回20条。
+@apiName MemberCandidates
+@apiGroup Member
+
+@apiPermission 具有 member.manage 权限的项目成员
+
+@apiParam {String} projectId 项目ID。
+@apiParam {String} [keyword] 用户名、姓名、姓名拼音缩写。
+
+@apiParamExample 请求示例
+GET /api/project/member/candidates?projectId=12&keyword=zs
+
+@apiSuccess {Object[]} body 用户列表。
+@apiSuccess {Integer} body.id 用户ID。
+@apiSuccess {String} body.name 姓名。
+@apiSuccess {String} body.username 用户名。
+@apiSuccess {String} body.namePinyin 姓名拼音缩写。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {"id": 3, "name": "张三", "username": "zhangsan", "namePinyin": "zs"}
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+权限错误
+*/
+
+// candidates 查询可添加为成员的用户
+func (c ProjectMemberController) candidates(ctx *gin.Context) {
+	projectId, _ := strconv.Atoi(ctx.Query("projectId"))
+	if projectId <= 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	if !inProject(ctx, projectId) {
+		return
+	}
+	keyword := ctx.Query("keyword")
+
+	res := []dto.MemberCandidateDTO{}
+	tx := repo.DB.Model(&entity.User{}).
+		Select("id,name,username,name_pinyin").
+		Where("is_delete = 0 AND id NOT IN (?)",
+			repo.DB.Model(&entity.ProjectMember{}).Select("user_id").Where("project_id = ?", projectId))
+	if keyword != "" {
+		tx = tx.Where(keywordQuery(keyword))
+	}
+	err := tx.Order("name_pinyin").Limit(20).Find(&res).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {GET} /api/project/member/mine 我参与的项目
+@apiDescription 查询当前用户参与的项目，以及在各项目中的角色和权限。
+@apiName MemberMine
+@apiGroup Member
+
+@apiPermission 用户
+
+@apiSuccess {Object[]} body 项目列表。
+@apiSuccess {Integer} body.projectId 项目ID。
+@apiSuccess {String} body.name 项目名称。
+@apiSuccess {Integer} body.role 角色编号。
+@apiSuccess {String} body.roleName 角色名称。
+@apiSuccess {String[]} body.permissions 角色具有的权限。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "projectId": 1,
+        "name": "数据交换系统",
+        "role": 2,
+        "roleName": "负责人",
+        "permissions": ["project.read", "doc.write", "doc.export", "case.write", "case.run", "member.manage", "role.manage"]
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// mine 我参与的项目以及角色
+func (c ProjectMemberController) mine(ctx *gin.Context) {
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	res := []dto.MyProjectDTO{}
+	err := repo.DB.Table("project_members").
+		Select("projects.id AS project_id,projects.name,project_members.role").
+		Joins("join projects on project_members.project_id = projects.id").
+		Where("project_members.user_id = ? AND projects.is_delete = 0", claims.Sub).
+		Order("projects.id").
+		Scan(&res).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+
+	roleRepo := repo.NewProjectRoleRepository()
+	for i := range res {
+		role, err := roleRepo.Find(res[i].ProjectId, res[i].Role)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		res[i].Permissions = []string{}
+		if role == nil {
+			continue
+		}
+		res[i].RoleName = role.Name
+		if role.Permissions != "" {
+			res[i].Permissions = strings.Split(role.Permissions, ",")
+		}
+	}
+	ctx.JSON(200, res)
+}
+
+// keywordQuery 用户名、姓名、姓名拼音缩写的模糊查询条件，拼音不区分大小写
+func keywordQuery(keyword string) *gorm.DB {
+	like := fmt.Sprintf("%%%s%%", keyword)
+	return repo.DB.Where("name_pinyin like ?", fmt.Sprintf("%%%s%%", strings.ToLower(keyword))).
+		Or("name like ?", like).
+		Or("username like ?", like)
+}
+
+// roleExist 角色是否为内置角色或项目的自定义角色，不存在时响应错误
+func (c ProjectMemberController) roleExist(ctx *gin.Context, projectId, role int) bool {
+	res, err := repo.NewProjectRoleRepository().Find(projectId, role)
+	if err != nil {
+		ErrSys(ctx, err)
+		return false
+	}
+	if res == nil {
+		ErrIllegal(ctx, "角色不存在")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pdm/controller/controllertest"
+	"pdm/controller/dto"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"strings"
+	"testing"
+)
+
+func TestProjectMembers(t *testing.T) {
+	s := controllertest.NewServer(t)
+	var users []entity.User
+	for _, u := range []struct{ openid, name, pinyin string }{
+		{"2001", "张三", "zs"}, {"2002", "李四", "ls"}, {"2003", "王五", "ww"},
+	} {
+		user := entity.User{Openid: u.openid, Name: u.name, NamePinyin: u.pinyin, Username: "u" + u.openid}
+		s.CreateUser(&user, "Passw0rd")
+		users = append(users, user)
+	}
+	project := entity.Project{Name: "成员项目", Manager: users[0].ID}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	var members []entity.ProjectMember
+	for i, role := range []int{entity.RoleLeader, entity.RoleDeveloper} {
+		m := entity.ProjectMember{ProjectId: project.ID, UserId: users[i].ID, Role: role}
+		if err := repo.DB.Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, m)
+	}
+	token := s.EnterProject(s.Login("2001", "Passw0rd"), project.ID)
+	roleOf := func(userId int) int {
+		var m entity.ProjectMember
+		if err := repo.DB.First(&m, "project_id = ? AND user_id = ?", project.ID, userId).Error; err != nil {
+			t.Fatal(err)
+		}
+		return m.Role
+	}
+
+	// 成员搜索：拼音不区分大小写，关键字为空时返回全部成员
+	var all []dto.MemberAllDTO
+	w := s.Do(http.MethodGet, fmt.Sprintf("/api/project/member/all?projectId=%d&keyword=LS", project.ID), "", token)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &all) != nil || len(all) != 1 || all[0].Username != "u2002" {
+		t.Fatalf("all keyword: %d %s", w.Code, w.Body.String())
+	}
+	w = s.Do(http.MethodGet, fmt.Sprintf("/api/project/member/all?projectId=%d", project.ID), "", token)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &all) != nil || len(all) != 2 {
+		t.Fatalf("all: %d %s", w.Code, w.Body.String())
+	}
+	// 候选用户不包含已有成员
+	var candidates []dto.MemberCandidateDTO
+	w = s.Do(http.MethodGet, fmt.Sprintf("/api/project/member/candidates?projectId=%d", project.ID), "", token)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &candidates) != nil {
+		t.Fatalf("candidates: %d %s", w.Code, w.Body.String())
+	}
+	for _, c := range candidates {
+		if c.ID == users[0].ID || c.ID == users[1].ID {
+			t.Fatalf("candidates contains member %d", c.ID)
+		}
+	}
+	w = s.Do(http.MethodGet, fmt.Sprintf("/api/project/member/candidates?projectId=%d&keyword=ww", project.ID), "", token)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &candidates) != nil || len(candidates) != 1 || candidates[0].ID != users[2].ID {
+		t.Fatalf("candidates keyword: %d %s", w.Code, w.Body.String())
+	}
+
+	// 批量修改角色：包含负责人时全部不修改
+	w = s.Do(http.MethodPost, "/api/project/member/batchChange", fmt.Sprintf(`{"projectId":%d,"ids":[%d,%d],"role":%d}`,
+		project.ID, members[0].ID, members[1].ID, entity.RoleInterConnector), token)
+	if w.Code != http.StatusBadRequest || roleOf(users[1].ID) != entity.RoleDeveloper {
+		t.Fatalf("batchChange leader: %d %s", w.Code, w.Body.String())
+	}
+	w = s.Do(http.MethodPost, "/api/project/member/batchChange", fmt.Sprintf(`{"projectId":%d,"ids":[%d],"role":%d}`,
+		project.ID, members[1].ID, entity.RoleInterConnector), token)
+	if w.Code != http.StatusOK || roleOf(users[1].ID) != entity.RoleInterConnector {
+		t.Fatalf("batchChange: %d %s", w.Code, w.Body.String())
+	}
+
+	// 移交负责人：新负责人需为项目成员
+	w = s.Do(http.MethodPost, "/api/project/member/transfer", fmt.Sprintf(`{"projectId":%d,"userId":%d}`, project.ID, users[2].ID), token)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("transfer non-member: %d %s", w.Code, w.Body.String())
+	}
+	w = s.Do(http.MethodPost, "/api/project/member/transfer", fmt.Sprintf(`{"projectId":%d,"userId":%d}`, project.ID, users[1].ID), token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("transfer: %d %s", w.Code, w.Body.String())
+	}
+	var p entity.Project
+	repo.DB.First(&p, project.ID)
+	if p.Manager != users[1].ID || roleOf(users[1].ID) != entity.RoleLeader || roleOf(users[0].ID) != entity.RoleManager {
+		t.Fatalf("transfer result: manager=%d", p.Manager)
+	}
+	// 原负责人已不是负责人，无法再移交
+	w = s.Do(http.MethodPost, "/api/project/member/transfer", fmt.Sprintf(`{"projectId":%d,"userId":%d}`, project.ID, users[0].ID), token)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("transfer by manager: %d %s", w.Code, w.Body.String())
+	}
+
+	// 我参与的项目
+	var mine []dto.MyProjectDTO
+	w = s.Do(http.MethodGet, "/api/project/member/mine", "", token)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &mine) != nil || len(mine) != 1 {
+		t.Fatalf("mine: %d %s", w.Code, w.Body.String())
+	}
+	if mine[0].ProjectId != project.ID || mine[0].Role != entity.RoleManager || mine[0].RoleName == "" || len(mine[0].Permissions) == 0 {
+		t.Fatalf("mine: %+v", mine[0])
+	}
+	// 成员接口仅注册一次，不在项目路径下重复注册
+	w = s.Do(http.MethodGet, fmt.Sprintf("/api/projects/%d/member/mine", project.ID), "", token)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("mine under project path: %d %s", w.Code, w.Body.String())
+	}
+
+	// 管理员修改项目负责人时同步项目成员，新负责人不是成员时加入项目
+	admin := s.AdminToken(0)
+	w = s.Do(http.MethodPost, "/api/project/edit", fmt.Sprintf(`{"id":%d,"name":"成员项目","manager":%d}`, project.ID, users[2].ID), admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit: %d %s", w.Code, w.Body.String())
+	}
+	var leaders int64
+	repo.DB.Model(&entity.ProjectMember{}).Where("project_id = ? AND role = ?", project.ID, entity.RoleLeader).Count(&leaders)
+	if leaders != 1 || roleOf(users[2].ID) != entity.RoleLeader || roleOf(users[1].ID) != entity.RoleManager {
+		t.Fatalf("edit leaders=%d", leaders)
+	}
+
+	// 项目负责人不可删除，移交后可删除
+	w = s.Do(http.MethodDelete, fmt.Sprintf("/api/user/delete?ids=%d,%d", users[1].ID, users[2].ID), "", admin)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "成员项目") {
+		t.Fatalf("delete leader: %d %s", w.Code, w.Body.String())
+	}
+	var deleted int64
+	repo.DB.Model(&entity.User{}).Where("is_delete = 1").Count(&deleted)
+	if deleted != 0 {
+		t.Fatalf("expect no user deleted, got %d", deleted)
+	}
+	w = s.Do(http.MethodPost, "/api/project/edit", fmt.Sprintf(`{"id":%d,"name":"成员项目","manager":%d}`, project.ID, users[1].ID), admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit: %d %s", w.Code, w.Body.String())
+	}
+	w = s.Do(http.MethodDelete, fmt.Sprintf("/api/user/delete?ids=%d", users[2].ID), "", admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete former leader: %d %s", w.Code, w.Body.String())
+	}
+}
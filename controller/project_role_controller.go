@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"pdm/controller/dto"
+	"pdm/controller/middle"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewProjectRoleController 创建项目角色与权限控制器
+func NewProjectRoleController(router gin.IRouter) *ProjectRoleController {
+	res := &ProjectRoleController{}
+	r := router.Group("/role")
+	// 所有项目权限
+	r.GET("/permissions", Authed, res.permissions)
+	// 项目可用的角色
+	r.GET("/list", Authed, res.list)
+	// 创建项目自定义角色
+	r.POST("/create", Require(entity.PermRoleManage), res.create)
+	// 修改项目自定义角色
+	r.POST("/edit", Require(entity.PermRoleManage), res.edit)
+	// 删除项目自定义角色
+	r.DELETE("/delete", Require(entity.PermRoleManage), res.delete)
+	// 修改内置角色的权限
+	r.POST("/builtin", Admin, res.builtin)
+	return res
+}
+
+// ProjectRoleController 项目角色与权限控制器
+// 接口通过权限名称声明所需的权限，角色与权限的对应关系保存在数据库中，
+// 内置角色适用于所有项目，项目可在此基础上创建自定义角色。
+type ProjectRoleController struct {
+}
+
+/**
+@api {GET} /api/role/permissions 所有项目权限
+@apiDescription 查询系统中定义的所有项目权限。
+@apiName RolePermissions
+@apiGroup Role
+
+@apiPermission 管理员，用户
+
+@apiSuccess {Permission[]} Body 权限列表。
+
+@apiSuccess (Permission) {String} name 权限名称。
+@apiSuccess (Permission) {String} desc 权限说明。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "name": "project.read",
+        "desc": "查看项目内容，包括成员、接口分类与用例"
+    },
+    {
+        "name": "doc.write",
+        "desc": "编辑对接文档"
+    }
+]
+*/
+
+// permissions 所有项目权限
+func (c *ProjectRoleController) permissions(ctx *gin.Context) {
+	ctx.JSON(200, entity.Permissions)
+}
+
+/**
+@api {GET} /api/role/list 项目可用的角色
+@apiDescription 查询项目可用的角色，包括内置角色与项目自定义角色，按角色编号排序。
+用户仅能查询自己所在项目的角色，projectId为0时仅返回内置角色。
+@apiName RoleList
+@apiGroup Role
+
+@apiPermission 管理员，项目成员
+
+@apiParam {Integer} [projectId] 项目ID，为0时仅返回内置角色，未指定时为当前项目。
+
+@apiParamExample 请求示例
+GET /api/role/list?projectId=1
+
+@apiSuccess {ProjectRole[]} Body 角色列表。
+
+@apiSuccess (ProjectRole) {Integer} id 记录ID。
+@apiSuccess (ProjectRole) {Integer} projectId 所属项目ID，内置角色为0。
+@apiSuccess (ProjectRole) {Integer} role 角色编号：
+<ul>
+    <li>0 - 开发者</li>
+    <li>1 - 对接者</li>
+    <li>2 - 负责人</li>
+    <li>3 - 管理员</li>
+    <li>100及以上 - 项目自定义角色</li>
+</ul>
+@apiSuccess (ProjectRole) {String} name 角色名称。
+@apiSuccess (ProjectRole) {String[]} permissions 角色具有的权限。
+@apiSuccess (ProjectRole) {Boolean} builtin 是否为内置角色。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "id": 1,
+        "createdAt": "2026-10-17 09:00:00",
+        "updatedAt": "2026-10-17 09:00:00",
+        "projectId": 0,
+        "role": 0,
+        "name": "开发者",
+        "permissions": ["project.read", "doc.write", "doc.export", "case.write", "case.run"],
+        "builtin": true
+    },
+    {
+        "id": 5,
+        "createdAt": "2026-10-17 09:30:00",
+        "updatedAt": "2026-10-17 09:30:00",
+        "projectId": 1,
+        "role": 100,
+        "name": "测试",
+        "permissions": ["project.read", "case.run"],
+        "builtin": false
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 403
+
+权限错误
+*/
+
+// list 项目可用的角色
+func (c *ProjectRoleController) list(ctx *gin.Context) {
+	projectId, _ := strconv.Atoi(ctx.Query("projectId"))
+	if ctx.Query("projectId") == "" {
+		// 未指定时为当前项目
+		projectId = middle.ProjectID(ctx)
+	}
+	if projectId < 0 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	if claims.Type == UserTypeUser && projectId > 0 {
+		exist, err := repo.ProjectMemberRepo.Exist(projectId, claims.Sub)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		if !exist {
+			ErrForbidden(ctx, "权限错误")
+			return
+		}
+	}
+	list, err := repo.NewProjectRoleRepository().List(projectId)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, list)
+}
+
+/**
+@api {POST} /api/role/create 创建项目自定义角色
+@apiDescription 在当前项目中创建自定义角色，角色编号由系统从100开始分配。
+@apiName RoleCreate
+@apiGroup Role
+
+@apiPermission 具有 role.manage 权限的项目成员
+
+@apiParam {String} name 角色名称，不超过64个字符。
+@apiParam {String[]} permissions 角色具有的权限，见 所有项目权限 接口。
+
+@apiParamExample {json} 请求示例
+{
+    "name": "测试",
+    "permissions": ["project.read", "case.run"]
+}
+
+@apiSuccess {ProjectRole} Body 创建的角色，字段见 项目可用的角色 接口。
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+未知的权限: doc.delete
+*/
+
+// create 创建项目自定义角色
+func (c *ProjectRoleController) create(ctx *gin.Context) {
+	var info dto.ProjectRoleDto
+	err := ctx.BindJSON(&info)
+	projectId := middle.ProjectID(ctx)
+	applog.L(ctx, "创建项目角色", map[string]interface{}{
+		"projectId":   projectId,
+		"name":        info.Name,
+		"permissions": info.Permissions,
+	})
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	perms, ok := c.check(ctx, &info)
+	if !ok {
+		return
+	}
+	role, err := repo.NewProjectRoleRepository().Create(projectId, info.Name, perms)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, role)
+}
+
+/**
+@api {POST} /api/role/edit 修改项目自定义角色
+@apiDescription 修改当前项目自定义角色的名称与权限，修改后对该角色的成员立即生效。
+内置角色的权限仅管理员可通过 修改内置角色的权限 接口修改。
+@apiName RoleEdit
+@apiGroup Role
+
+@apiPermission 具有 role.manage 权限的项目成员
+
+@apiParam {Integer} role 角色编号。
+@apiParam {String} name 角色名称，不超过64个字符。
+@apiParam {String[]} permissions 角色具有的权限。
+
+@apiParamExample {json} 请求示例
+{
+    "role": 100,
+    "name": "测试",
+    "permissions": ["project.read", "case.run", "doc.export"]
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+角色不存在
+*/
+
+// edit 修改项目自定义角色
+func (c *ProjectRoleController) edit(ctx *gin.Context) {
+	var info dto.ProjectRoleDto
+	err := ctx.BindJSON(&info)
+	projectId := middle.ProjectID(ctx)
+	applog.L(ctx, "修改项目角色", map[string]interface{}{
+		"projectId":   projectId,
+		"role":        info.Role,
+		"name":        info.Name,
+		"permissions": info.Permissions,
+	})
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	perms, ok := c.check(ctx, &info)
+	if !ok {
+		return
+	}
+	err = repo.NewProjectRoleRepository().Update(projectId, info.Role, info.Name, perms)
+	if errors.Is(err, repo.ErrRoleNotFound) {
+		ErrIllegalE(ctx, err)
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {DELETE} /api/role/delete 删除项目自定义角色
+@apiDescription 删除当前项目的自定义角色，仍有成员使用该角色时不可删除。
+@apiName RoleDelete
+@apiGroup Role
+
+@apiPermission 具有 role.manage 权限的项目成员
+
+@apiParam {Integer} role 角色编号。
+
+@apiParamExample 请求示例
+DELETE /api/role/delete?role=100
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+角色仍有成员使用，请先修改成员的角色
+*/
+
+// delete 删除项目自定义角色
+func (c *ProjectRoleController) delete(ctx *gin.Context) {
+	role, err := strconv.Atoi(ctx.Query("role"))
+	projectId := middle.ProjectID(ctx)
+	applog.L(ctx, "删除项目角色", map[string]interface{}{
+		"projectId": projectId,
+		"role":      role,
+	})
+	if err != nil || role < entity.RoleCustomBase {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	err = repo.NewProjectRoleRepository().Delete(projectId, role)
+	if errors.Is(err, repo.ErrRoleNotFound) || errors.Is(err, repo.ErrRoleInUse) {
+		ErrIllegalE(ctx, err)
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {POST} /api/role/builtin 修改内置角色的权限
+@apiDescription 修改内置角色的权限，对所有项目中该角色的成员立即生效。
+负责人始终具有所有权限，不可修改。
+@apiName RoleBuiltin
+@apiGroup Role
+
+@apiPermission 管理员
+
+@apiParam {Integer=0,1,3} role 角色编号 0 - 开发者 1 - 对接者 3 - 管理员。
+@apiParam {String[]} permissions 角色具有的权限。
+
+@apiParamExample {json} 请求示例
+{
+    "role": 1,
+    "permissions": ["project.read", "case.run", "doc.export"]
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+负责人具有所有权限，不可修改
+*/
+
+// builtin 修改内置角色的权限
+func (c *ProjectRoleController) builtin(ctx *gin.Context) {
+	var info dto.ProjectRoleDto
+	err := ctx.BindJSON(&info)
+	applog.L(ctx, "修改内置角色权限", map[string]interface{}{
+		"role":        info.Role,
+		"permissions": info.Permissions,
+	})
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	perms, ok := c.checkPermissions(ctx, info.Permissions)
+	if !ok {
+		return
+	}
+	err = repo.NewProjectRoleRepository().SetBuiltin(info.Role, perms)
+	if errors.Is(err, repo.ErrRoleNotFound) || errors.Is(err, repo.ErrRoleLeader) {
+		ErrIllegalE(ctx, err)
+		return
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+// check 校验角色名称与权限，返还去重后的权限
+func (c *ProjectRoleController) check(ctx *gin.Context, info *dto.ProjectRoleDto) ([]string, bool) {
+	info.Name = strings.TrimSpace(info.Name)
+	if info.Name == "" || utf8.RuneCountInString(info.Name) > 64 {
+		ErrIllegal(ctx, "角色名称不能为空且不超过64个字符")
+		return nil, false
+	}
+	return c.checkPermissions(ctx, info.Permissions)
+}
+
+// checkPermissions 校验权限是否均已定义，返还去重后的权限
+func (c *ProjectRoleController) checkPermissions(ctx *gin.Context, perms []string) ([]string, bool) {
+	res := make([]string, 0, len(perms))
+	seen := map[string]bool{}
+	for _, p := range perms {
+		if !entity.IsPermission(p) {
+			ErrIllegal(ctx, "未知的权限: "+p)
+			return nil, false
+		}
+		if !seen[p] {
+			seen[p] = true
+			res = append(res, p)
+		}
+	}
+	return res, true
+}
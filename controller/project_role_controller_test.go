@@ -0,0 +1,91 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+)
+
+func TestProjectRoles(t *testing.T) {
+	s := controllertest.NewServer(t)
+	var users []entity.User
+	for _, openid := range []string{"1001", "1002"} {
+		user := entity.User{Openid: openid, Name: "用户" + openid, Username: "u" + openid}
+		s.CreateUser(&user, "Passw0rd")
+		users = append(users, user)
+	}
+	project := entity.Project{Name: "测试项目", Manager: users[0].ID}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, role := range []int{entity.RoleLeader, entity.RoleInterConnector} {
+		if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: users[i].ID, Role: role}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	enter := func(openid string) string {
+		return s.EnterProject(s.Login(openid, "Passw0rd"), project.ID)
+	}
+	leader, member := enter("1001"), enter("1002")
+	categorize := fmt.Sprintf(`{"projectId":%d,"name":"分类"}`, project.ID)
+
+	// 对接者没有 case.write 与 role.manage 权限
+	s.Expect(s.Do(http.MethodPost, "/api/categorize/create", categorize, member), http.StatusForbidden, "")
+	s.Expect(s.Do(http.MethodPost, "/api/role/create", `{"name":"测试","permissions":["project.read"]}`, member), http.StatusForbidden, "")
+	s.Expect(s.Do(http.MethodGet, fmt.Sprintf("/api/role/list?projectId=%d", project.ID+1), "", member), http.StatusForbidden, "")
+
+	// 负责人创建自定义角色
+	s.Expect(s.Do(http.MethodPost, "/api/role/create", `{"name":"测试","permissions":["doc.delete"]}`, leader), http.StatusBadRequest, "")
+	w := s.Do(http.MethodPost, "/api/role/create", `{"name":"测试","permissions":["project.read","case.write","case.write"]}`, leader)
+	s.Expect(w, http.StatusOK, "")
+	var role struct {
+		Role        int      `json:"role"`
+		Permissions []string `json:"permissions"`
+		Builtin     bool     `json:"builtin"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &role); err != nil || role.Role != entity.RoleCustomBase || len(role.Permissions) != 2 || role.Builtin {
+		t.Fatalf("create: %s", w.Body.String())
+	}
+	w = s.Do(http.MethodGet, fmt.Sprintf("/api/role/list?projectId=%d", project.ID), "", member)
+	s.Expect(w, http.StatusOK, "")
+	var roles []struct {
+		Role int `json:"role"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &roles); err != nil || len(roles) != 5 || roles[4].Role != role.Role {
+		t.Fatalf("list: %s", w.Body.String())
+	}
+
+	// 成员的角色修改为自定义角色后立即生效，无需重新进入项目
+	if err := repo.DB.Model(&entity.ProjectMember{}).Where("user_id = ?", users[1].ID).Update("role", role.Role).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w = s.Do(http.MethodPost, "/api/categorize/create", categorize, member); w.Code == http.StatusForbidden {
+		t.Fatalf("custom role: %s", w.Body.String())
+	}
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/role/delete?role=%d", role.Role), "", leader), http.StatusBadRequest, "")
+	s.Expect(s.Do(http.MethodPost, "/api/role/edit", fmt.Sprintf(`{"role":%d,"name":"测试","permissions":["project.read"]}`, role.Role), leader), http.StatusOK, "")
+	s.Expect(s.Do(http.MethodPost, "/api/categorize/create", categorize, member), http.StatusForbidden, "")
+
+	// 管理员修改内置角色的权限，负责人的权限不可修改
+	admin := s.AdminToken(0)
+	s.Expect(s.Do(http.MethodPost, "/api/role/builtin", `{"role":2,"permissions":["project.read"]}`, admin), http.StatusBadRequest, "")
+	s.Expect(s.Do(http.MethodPost, "/api/role/builtin", `{"role":1,"permissions":["project.read"]}`, leader), http.StatusForbidden, "")
+	s.Expect(s.Do(http.MethodPost, "/api/role/builtin", `{"role":1,"permissions":["project.read","case.write"]}`, admin), http.StatusOK, "")
+	if err := repo.DB.Model(&entity.ProjectMember{}).Where("user_id = ?", users[1].ID).Update("role", entity.RoleInterConnector).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w = s.Do(http.MethodPost, "/api/categorize/create", categorize, member); w.Code == http.StatusForbidden {
+		t.Fatalf("builtin role: %s", w.Body.String())
+	}
+	s.Expect(s.Do(http.MethodDelete, fmt.Sprintf("/api/role/delete?role=%d", role.Role), "", leader), http.StatusOK, "")
+
+	// 项目删除后成员不再具有任何权限
+	if err := repo.DB.Model(&project).Update("is_delete", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.Expect(s.Do(http.MethodPost, "/api/categorize/create", categorize, leader), http.StatusForbidden, "")
+}
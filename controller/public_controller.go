@@ -5,9 +5,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
-	"pdm/appconf/dir"
+	"pdm/storage"
 	"strconv"
 	"strings"
 )
@@ -65,19 +63,19 @@ func (c *PublicController) avatar(ctx *gin.Context) {
 
 	avatarName := fmt.Sprintf("%s-%d", avatarType, id)
 
-	avatarPath := filepath.Join(dir.AvatarDir, avatarName)
-	// 防止用户通过 ../../ 的方式读取到操作系统内的重要文件
-	if !strings.HasPrefix(avatarPath, dir.AvatarDir) {
+	// 防止用户通过 ../../ 的方式读取到其他文件
+	avatarPath, ok := storage.Clean(avatarName)
+	if !ok || strings.Contains(avatarPath, "/") {
 		ctx.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 	// 打开头像文件
-	avatar, err := os.Open(avatarPath)
-	defer avatar.Close()
+	avatar, err := storage.Avatar.Open(avatarPath)
 	if err != nil {
 		ctx.AbortWithStatus(http.StatusNotFound)
 		return
 	}
+	defer avatar.Close()
 	_, err = io.Copy(ctx.Writer, avatar)
 	if err != nil {
 		ErrSys(ctx, err)
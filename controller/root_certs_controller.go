@@ -1,19 +1,18 @@
 package controller
 
 import (
+	"crypto/x509/pkix"
 	"fmt"
 	"github.com/emmansun/gmsm/smx509"
 	"github.com/gin-gonic/gin"
 	"io"
-	"io/fs"
 	"net/url"
-	"os"
 	"path"
-	"path/filepath"
-	"pdm/appconf/dir"
 	"pdm/controller/dto"
 	"pdm/logg/applog"
 	"pdm/reuint"
+	"pdm/reuint/revocation"
+	"pdm/storage"
 	"sort"
 	"strings"
 	"time"
@@ -53,6 +52,7 @@ GET /api/rootCerts/list
 @apiSuccess {CertItemDto[]} Body 查询结果列表。
 
 @apiSuccess (CertItemDto) {String} name 文件名。
+@apiSuccess (CertItemDto) {String} type 文件类型，cert：根证书，crl：吊销列表。
 @apiSuccess (CertItemDto) {String} createdAt 根证书上传时间，格式"YYYY-MM-DD HH:mm:ss"。
 
 @apiSuccessExample 成功响应
@@ -61,11 +61,18 @@ HTTP/1.1 200 OK
 [
     {
         "name": "RSA根证书.crt",
+        "type": "cert",
         "createdAt": "2022-12-09 16:58:57"
     },
     {
         "name": "SM2根证书.crt",
+        "type": "cert",
         "createdAt": "2022-12-09 17:41:58"
+    },
+    {
+        "name": "SM2根证书.crl",
+        "type": "crl",
+        "createdAt": "2022-12-10 09:12:30"
     }
 ]
 
@@ -79,16 +86,14 @@ HTTP/1.1 500
 func (c *RootCertsController) list(ctx *gin.Context) {
 	res := []dto.CertItemDto{}
 	zone := time.FixedZone("CST", 8*3600)
-	_ = filepath.Walk(dir.RootCertDir, func(path string, info fs.FileInfo, err error) error {
-
-		if path == dir.RootCertDir {
-			// 忽略根路径
-			return nil
-		}
-
+	_ = storage.Walk(storage.RootCert, "", func(info storage.FileInfo) error {
 		item := &dto.CertItemDto{}
-		item.Name = info.Name()
-		item.CreatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
+		item.Name = info.Name
+		item.Type = "cert"
+		if data, err := storage.ReadFile(storage.RootCert, info.Path); err == nil && revocation.ParseCRL(data) != nil {
+			item.Type = "crl"
+		}
+		item.CreatedAt = info.ModTime.In(zone).Format("2006-01-02 15:04:05")
 		res = append(res, *item)
 		return nil
 	})
@@ -102,7 +107,9 @@ func (c *RootCertsController) list(ctx *gin.Context) {
 
 /**
 @api {POST} /api/rootCerts/upload 上传
-@apiDescription 以表单的方式上传根证书。
+@apiDescription 以表单的方式上传根证书或吊销列表（CRL）。
+吊销列表需由已上传的根证书签发，用于登录时检查管理员证书的吊销状态，上传同名的吊销列表将替换原有的吊销列表，
+同一颁发者存在多个吊销列表时使用生效时间最新的。
 
 @apiName RootCertsUpload
 @apiGroup RootCerts
@@ -116,7 +123,12 @@ func (c *RootCertsController) list(ctx *gin.Context) {
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
 
-@apiErrorExample 失败响应
+@apiErrorExample 失败响应1
+HTTP/1.1 400
+
+吊销列表不是由根证书签发
+
+@apiErrorExample 失败响应2
 HTTP/1.1 500
 
 系统内部错误
@@ -132,11 +144,20 @@ func (c *RootCertsController) upload(ctx *gin.Context) {
 		"files": "上传根证书",
 	})
 
+	roots := reuint.LoadCerts()
+	pool := smx509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root)
+	}
 	for _, file := range files {
-		filePath := filepath.Join(dir.RootCertDir, file.Filename)
-		_, err := os.Stat(filePath)
-		if err == nil {
-			ErrIllegal(ctx, "根证书已存在")
+		filePath, ok := storage.Clean(file.Filename)
+		if !ok || filePath == "" || strings.Contains(filePath, "/") {
+			ErrIllegal(ctx, "文件名错误")
+			return
+		}
+		exist, err := storage.Exist(storage.RootCert, filePath)
+		if err != nil {
+			ErrSys(ctx, err)
 			return
 		}
 		open, err := file.Open()
@@ -152,17 +173,42 @@ func (c *RootCertsController) upload(ctx *gin.Context) {
 		_ = open.Close()
 		cert, err := smx509.ParseCertificate(reuint.Decode2DER(temp))
 		if err != nil {
-			ErrIllegal(ctx, "解析证书失败")
+			crl := revocation.ParseCRL(temp)
+			if crl == nil {
+				ErrIllegal(ctx, "解析证书失败")
+				return
+			}
+			if !signedByRoot(crl, roots) {
+				ErrIllegal(ctx, "吊销列表不是由根证书签发")
+				return
+			}
+			// 吊销列表可以替换，但不能替换根证书
+			if exist {
+				old, _ := storage.ReadFile(storage.RootCert, filePath)
+				if revocation.ParseCRL(old) == nil {
+					ErrIllegal(ctx, "根证书已存在")
+					return
+				}
+			}
+			if err = storage.WriteFile(storage.RootCert, filePath, temp); err != nil {
+				ErrSys(ctx, err)
+				return
+			}
+			continue
+		}
+		if exist {
+			ErrIllegal(ctx, "根证书已存在")
 			return
 		}
 		// 证书链验证
-		verify, err := cert.Verify(smx509.VerifyOptions{Roots: reuint.CertPool, KeyUsages: []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny}})
+		verify, err := cert.Verify(smx509.VerifyOptions{Roots: pool, KeyUsages: []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny}})
 		// 若存在证书链，且验证失败，则不加入证书池
 		if err != nil && len(verify) != 0 {
 			continue
 		}
-		reuint.CertPool.AddCert(cert)
-		err = ctx.SaveUploadedFile(file, filePath)
+		pool.AddCert(cert)
+		roots = append(roots, cert)
+		err = storage.WriteFile(storage.RootCert, filePath, temp)
 		if err != nil {
 			ErrSys(ctx, err)
 			return
@@ -170,6 +216,16 @@ func (c *RootCertsController) upload(ctx *gin.Context) {
 	}
 }
 
+// signedByRoot 吊销列表是否由其中的根证书签发
+func signedByRoot(crl *pkix.CertificateList, roots []*smx509.Certificate) bool {
+	for _, root := range roots {
+		if root.CheckCRLSignature(crl) == nil {
+			return true
+		}
+	}
+	return false
+}
+
 /**
 @api {GET} /api/rootCerts/download 下载
 @apiDescription 下载根证书。
@@ -202,29 +258,29 @@ func (c *RootCertsController) download(ctx *gin.Context) {
 		"name": name,
 	})
 
-	filePath := filepath.Join(dir.RootCertDir, name)
-	if !strings.HasPrefix(filePath, dir.RootCertDir) || filePath == dir.RootCertDir {
+	filePath, ok := storage.Clean(name)
+	if !ok || filePath == "" {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
-	info, err := os.Stat(filePath)
+	info, err := storage.RootCert.Stat(filePath)
 	if err != nil {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
 
 	// 单文件下载
-	if !info.IsDir() {
-		file, err := os.Open(filePath)
+	if !info.IsDir {
+		file, err := storage.RootCert.Open(filePath)
 		if err != nil {
 			ErrSys(ctx, err)
 			return
 		}
 		defer file.Close()
 		// 下载文件名称
-		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(info.Name())))
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(info.Name)))
 		//获取文件的后缀(文件类型)
-		ctx.Header("Content-Type", reuint.GetMIME(path.Ext(info.Name())))
+		ctx.Header("Content-Type", reuint.GetMIME(path.Ext(info.Name)))
 		_, err = io.Copy(ctx.Writer, file)
 		if err != nil {
 			ErrSys(ctx, err)
@@ -263,16 +319,15 @@ func (c *RootCertsController) remove(ctx *gin.Context) {
 		"name": name,
 	})
 
-	p := filepath.Join(dir.RootCertDir, name)
-	if !strings.HasPrefix(p, dir.RootCertDir) || p == dir.RootCertDir {
+	p, ok := storage.Clean(name)
+	if !ok || p == "" {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
 
-	err := os.RemoveAll(p)
+	err := storage.RootCert.Remove(p)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	reuint.LoadCertsPool()
 }
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"mime"
@@ -8,6 +9,12 @@ import (
 	"pdm/appconf"
 	"pdm/appconf/dir"
 	"pdm/controller/middle"
+	"pdm/metrics"
+	"pdm/repo"
+	"pdm/reuint"
+	"pdm/reuint/revocation"
+	"pdm/storage"
+	"time"
 )
 
 // token管理器
@@ -22,11 +29,26 @@ var (
 
 // RouteMapping HTTP路由注册
 // r: 路由注册器
-func RouteMapping(r gin.IRouter, cfg *appconf.Application) {
+func RouteMapping(r gin.IRouter, cfg *appconf.Application) error {
+	// 登录token签名密钥，未配置主密钥文件时保存在数据库中
+	var source middle.KeySource = repo.NewJwtKeyRepository()
+	if cfg.JWT.KeyFile != "" {
+		var err error
+		if source, err = middle.NewFileKeySource(dir.Abs(cfg.JWT.KeyFile)); err != nil {
+			return err
+		}
+	}
+	keys := middle.NewKeyRing(source, time.Duration(cfg.JWT.Rotation)*time.Hour, time.Duration(cfg.JWT.Grace)*time.Hour)
+	// 启动时获取当前密钥，尽早发现数据库无法访问等问题
+	if _, _, err := keys.Current(); err != nil {
+		return fmt.Errorf("获取JWT签名密钥失败，%w", err)
+	}
+
 	// 中间件 - 拦截器 按顺序依次执行
-	tokenManager = middle.NewTokenFilter()
+	tokenManager = middle.NewTokenFilter(keys, cfg.TLS.Enable, repo.NewSessionRepository(), repo.NewAccessTokenRepository())
 	editLock = middle.NewEditLock()
 	r.Use(
+		metrics.Middleware,
 		middle.Recovery(),
 		middle.Anonymous,
 		tokenManager.Filter,
@@ -41,11 +63,47 @@ func RouteMapping(r gin.IRouter, cfg *appconf.Application) {
 		context.Redirect(http.StatusMovedPermanently, "/ui/#/")
 	})
 
+	// 存活、就绪检查与监控指标
+	NewMonitorController(r)
+
+	// 用户口令策略与口令摘要迭代次数
+	if cfg.Password.Iterations >= reuint.MinPasswordIterations {
+		reuint.PasswordIterations = cfg.Password.Iterations
+	}
+	policy := &reuint.PasswordPolicy{
+		MinLength:   cfg.Password.MinLength,
+		MinClasses:  cfg.Password.MinClasses,
+		BannedWords: cfg.Password.BannedWords,
+		MaxAge:      time.Duration(cfg.Password.MaxAge) * 24 * time.Hour,
+		History:     cfg.Password.History,
+	}
+	// 登录失败限制策略
+	throttle := &repo.ThrottlePolicy{
+		AccountFailures: cfg.Throttle.AccountFailures,
+		IPFailures:      cfg.Throttle.IPFailures,
+		Window:          time.Duration(cfg.Throttle.Window) * time.Minute,
+		LockTime:        time.Duration(cfg.Throttle.LockTime) * time.Minute,
+		MaxLockTime:     time.Duration(cfg.Throttle.MaxLockTime) * time.Minute,
+	}
+	// 管理员证书吊销检查
+	revoke := revocation.New(revocation.Config{
+		Mode:    cfg.Revocation.Mode,
+		OCSP:    cfg.Revocation.OCSP,
+		Timeout: time.Duration(cfg.Revocation.Timeout) * time.Second,
+	}, storage.RootCert)
+
 	// 所有RestFul接口都以 /api开始
 	r = r.Group("/api")
-	NewLoginController(r)
-	NewUserController(r)
+	NewLoginController(r, policy, cfg.TOTP.Issuer, throttle, revoke)
+	NewLoginThrottleController(r)
+	NewSessionController(r)
+	NewAccessTokenController(r)
+	NewAdminController(r)
+	NewUserController(r, policy)
+	NewTotpController(r, cfg.TOTP.Issuer)
+	NewProjectRoleController(r)
 	NewProjectController(r)
+	NewProjectMemberController(r.Group("/project"))
 	NewSystemInfoController(r)
 	NewPublicController(r)
 	NewAuthorityController(r)
@@ -53,9 +111,19 @@ func RouteMapping(r gin.IRouter, cfg *appconf.Application) {
 	NewCasesController(r)
 	NewOperationLogController(r)
 	NewProgramLogController(r)
-	NewSsoController(r, cfg.SSOBaseUrl)
+	NewSsoController(r, cfg.SSO.Providers, cfg.TLS.Enable)
+	NewLdapController(r)
 	NewBaseDocumentAreaController(r)
 	NewRootCertsController(r)
 	NewDocController(r)
 	NewTechnicalProposalController(r)
+	NewBackupController(r)
+
+	// 项目内的接口也可通过路径携带项目ID，如 /api/projects/1/doc/info，见 middle.ProjectID
+	p := r.Group("/projects/:" + middle.ParamProjectId)
+	NewProjectRoleController(p)
+	NewCategorizeController(p)
+	NewCasesController(p)
+	NewDocController(p)
+	return nil
 }
@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pdm/controller/dto"
+	"pdm/controller/middle"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewSessionController 创建登录会话控制器
+func NewSessionController(router gin.IRouter) *SessionController {
+	res := &SessionController{}
+	r := router.Group("/session")
+	// 我的会话
+	r.GET("/list", Authed, res.list)
+	// 撤销我的会话
+	r.DELETE("/revoke", Authed, res.revoke)
+	// 搜索所有会话
+	r.GET("/search", Admin, res.search)
+	// 管理员撤销会话
+	r.DELETE("/adminRevoke", Admin, res.adminRevoke)
+	return res
+}
+
+// SessionController 登录会话控制器
+// 每次登录创建一个会话，会话撤销后对应的token立即失效。
+type SessionController struct {
+}
+
+// sessionQuery 会话查询，关联用户姓名与管理员用户名
+func sessionQuery(db *gorm.DB) *gorm.DB {
+	// SELECT sessions.*, COALESCE(users.name, admins.username) AS name
+	// FROM sessions LEFT JOIN users ON sessions.user_id = users.id AND sessions.user_type = 'user'
+	// LEFT JOIN admins ON sessions.user_id = admins.id AND sessions.user_type <> 'user'
+	// WHERE sessions.user_type <> 'pending'，待完成登录的凭证不是会话
+	return db.Table("sessions").
+		Select("sessions.id, sessions.created_at, sessions.user_type, sessions.user_id, sessions.ip, sessions.user_agent, "+
+			"sessions.last_seen_at, sessions.expires_at, COALESCE(users.name, admins.username) AS name").
+		Joins("LEFT JOIN users ON sessions.user_id = users.id AND sessions.user_type = ?", UserTypeUser).
+		Joins("LEFT JOIN admins ON sessions.user_id = admins.id AND sessions.user_type <> ?", UserTypeUser).
+		Where("sessions.expires_at > ? AND sessions.user_type <> ?", time.Now(), middle.ClaimsTypePending)
+}
+
+/**
+@api {GET} /api/session/list 我的会话
+@apiDescription 当前登录用户所有未过期的会话，按最近访问时间由新到旧排序。
+@apiName SessionList
+@apiGroup Session
+
+@apiPermission 管理员,用户,审计员
+
+@apiParamExample 请求示例
+GET /api/session/list
+
+@apiSuccess {SessionDto[]} Body 会话列表。
+
+@apiSuccess (SessionDto) {String} id 会话ID。
+@apiSuccess (SessionDto) {String} createdAt 登录时间。
+@apiSuccess (SessionDto) {String} userType 用户类型：user - 用户、admin - 管理员、audit - 审计员。
+@apiSuccess (SessionDto) {Integer} userId 用户ID或管理员ID。
+@apiSuccess (SessionDto) {String} name 用户姓名或管理员用户名。
+@apiSuccess (SessionDto) {String} ip 登录IP。
+@apiSuccess (SessionDto) {String} userAgent 客户端标识。
+@apiSuccess (SessionDto) {String} lastSeenAt 最近访问时间，精确到分钟。
+@apiSuccess (SessionDto) {String} expiresAt 过期时间。
+@apiSuccess (SessionDto) {Boolean} current 是否为当前会话。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "id": "9f1a7062905d2a4e208f92ecb56f9675",
+        "createdAt": "2026-10-17 09:00:00",
+        "userType": "user",
+        "userId": 1,
+        "name": "张三",
+        "ip": "192.168.1.10",
+        "userAgent": "Mozilla/5.0",
+        "lastSeenAt": "2026-10-17 10:30:00",
+        "expiresAt": "2026-10-17 17:00:00",
+        "current": true
+    }
+]
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// list 我的会话
+func (c *SessionController) list(ctx *gin.Context) {
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	res := []dto.SessionDto{}
+	err := sessionQuery(repo.DB).
+		Where("sessions.user_type = ? AND sessions.user_id = ?", claims.Type, claims.Sub).
+		Order("sessions.last_seen_at desc").
+		Find(&res).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	for i := range res {
+		res[i].Current = res[i].ID == claims.Jti
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {DELETE} /api/session/revoke 撤销我的会话
+@apiDescription 撤销当前登录用户的会话，撤销后该会话的token立即失效，如在其他设备上退出登录。
+撤销当前会话等同于登出。
+@apiName SessionRevoke
+@apiGroup Session
+
+@apiPermission 管理员,用户,审计员
+
+@apiParam {String} id 会话ID。
+
+@apiParamExample 请求示例
+DELETE /api/session/revoke?id=9f1a7062905d2a4e208f92ecb56f9675
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+会话不存在
+*/
+
+// revoke 撤销我的会话
+func (c *SessionController) revoke(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	applog.L(ctx, "撤销会话", map[string]interface{}{"id": id})
+
+	// 仅能撤销自己的会话
+	res := repo.DB.Where("id = ? AND user_type = ? AND user_id = ?", id, claims.Type, claims.Sub).Delete(&entity.Session{})
+	if res.Error != nil {
+		ErrSys(ctx, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		ErrIllegal(ctx, "会话不存在")
+		return
+	}
+	if id == claims.Jti {
+		tokenManager.ClearCookie(ctx)
+	}
+}
+
+/**
+@api {GET} /api/session/search 搜索会话
+@apiDescription 搜索所有未过期的会话，支持分页查询，按最近访问时间由新到旧排序。
+@apiName SessionSearch
+@apiGroup Session
+
+@apiPermission 管理员
+
+@apiParam {String=user,admin,audit} [userType] 用户类型，为空表示所有。
+@apiParam {Integer} [userId] 用户ID或管理员ID，需同时指定用户类型。
+@apiParam {Integer} [page=1] 分页查询页码，表示第几页，默认 1。
+@apiParam {Integer} [limit=20] 单页多少数据，默认 20。
+
+@apiParamExample 请求示例
+GET /api/session/search?userType=user&userId=1&page=1&limit=20
+
+@apiSuccess {SessionDto[]} records 查询结果列表，见 我的会话。
+@apiSuccess {Integer} total 记录总数。
+@apiSuccess {Integer} size 每页显示条数，默认 20。
+@apiSuccess {Integer} current 当前页。
+@apiSuccess {Integer} pages 总页数。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "records": [
+        {
+            "id": "9f1a7062905d2a4e208f92ecb56f9675",
+            "createdAt": "2026-10-17 09:00:00",
+            "userType": "user",
+            "userId": 1,
+            "name": "张三",
+            "ip": "192.168.1.10",
+            "userAgent": "Mozilla/5.0",
+            "lastSeenAt": "2026-10-17 10:30:00",
+            "expiresAt": "2026-10-17 17:00:00",
+            "current": false
+        }
+    ],
+    "total": 1,
+    "size": 20,
+    "current": 1,
+    "pages": 1
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// search 搜索会话
+func (c *SessionController) search(ctx *gin.Context) {
+	var param dto.SessionSearchDto
+	param.Page = 1
+	param.Limit = 20
+	if ctx.ShouldBindQuery(&param) != nil || param.Page < 1 || param.Limit < 1 {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+
+	query, tx := repo.NewPageQueryFnc(repo.DB, &entity.Session{}, param.Page, param.Limit, func(db *gorm.DB) *gorm.DB {
+		db = sessionQuery(db)
+		if param.UserType != "" {
+			db = db.Where("sessions.user_type = ?", param.UserType)
+		}
+		if param.UserID != 0 {
+			db = db.Where("sessions.user_id = ?", param.UserID)
+		}
+		return db.Order("sessions.last_seen_at desc")
+	})
+	res := []dto.SessionDto{}
+	if err := tx.Find(&res).Error; err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	for i := range res {
+		res[i].Current = res[i].ID == claims.Jti
+	}
+	query.Records = res
+	ctx.JSON(200, query)
+}
+
+/**
+@api {DELETE} /api/session/adminRevoke 管理员撤销会话
+@apiDescription 撤销指定的会话，或撤销某个用户的所有会话，撤销后对应的token立即失效。
+指定 ids 时按会话ID撤销，否则撤销 userType 与 userId 指定用户的所有会话。
+@apiName SessionAdminRevoke
+@apiGroup Session
+
+@apiPermission 管理员
+
+@apiParam {String} [ids] 会话ID序列，多个ID用","隔开。
+@apiParam {String=user,admin,audit} [userType] 用户类型。
+@apiParam {Integer} [userId] 用户ID或管理员ID。
+
+@apiParamExample 请求示例
+DELETE /api/session/adminRevoke?userType=user&userId=12
+
+@apiSuccess {Integer} count 撤销的会话数。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "count": 2
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+参数非法，无法解析
+*/
+
+// adminRevoke 管理员撤销会话
+func (c *SessionController) adminRevoke(ctx *gin.Context) {
+	ids := ctx.Query("ids")
+	userType := ctx.Query("userType")
+	userId, _ := strconv.Atoi(ctx.Query("userId"))
+	applog.L(ctx, "管理员撤销会话", map[string]interface{}{
+		"ids":      ids,
+		"userType": userType,
+		"userId":   userId,
+	})
+
+	var count int64
+	switch {
+	case ids != "":
+		res := repo.DB.Where("id IN ?", strings.Split(ids, ",")).Delete(&entity.Session{})
+		if res.Error != nil {
+			ErrSys(ctx, res.Error)
+			return
+		}
+		count = res.RowsAffected
+	case userType != "" && userId > 0:
+		var err error
+		count, err = repo.NewSessionRepository().RevokeUser(userType, userId)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+	default:
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	ctx.JSON(200, gin.H{"count": count})
+}
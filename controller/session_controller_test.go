@@ -0,0 +1,105 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	s := controllertest.NewServer(t)
+	user := entity.User{Openid: "1001", Name: "张三", Username: "zhangsan"}
+	s.CreateUser(&user, "Passw0rd")
+	pwd, salt := user.Password, user.Salt
+	login := func() string {
+		return s.Login("1001", "Passw0rd")
+	}
+
+	a, b := login(), login()
+
+	// 重启后签名密钥不变，已签发的token仍然有效
+	s.Reload()
+	w := s.Do(http.MethodGet, "/api/session/list", "", a)
+	var sessions []struct {
+		ID       string `json:"id"`
+		UserType string `json:"userType"`
+		UserID   int    `json:"userId"`
+		Name     string `json:"name"`
+		Current  bool   `json:"current"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil || len(sessions) != 2 {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
+	var other string
+	for _, item := range sessions {
+		if item.Name != "张三" || item.UserType != "user" || item.UserID != user.ID {
+			t.Fatalf("unexpected session: %+v", item)
+		}
+		if !item.Current {
+			other = item.ID
+		}
+	}
+	if other == "" {
+		t.Fatal("expect one current session")
+	}
+
+	// 撤销其他会话后该会话的token立即失效
+	s.Expect(s.Do(http.MethodDelete, "/api/session/revoke?id="+other, "", a), http.StatusOK, "")
+	s.Expect(s.Do(http.MethodGet, "/api/user/info", "", b), http.StatusUnauthorized, "")
+	s.Expect(s.Do(http.MethodDelete, "/api/session/revoke?id="+other, "", a), http.StatusBadRequest, "")
+	s.Expect(s.Do(http.MethodGet, "/api/check", "", a), http.StatusOK, "")
+
+	// 登出后token失效
+	s.Expect(s.Do(http.MethodDelete, "/api/logout", "", a), http.StatusOK, "")
+	s.Expect(s.Do(http.MethodGet, "/api/user/info", "", a), http.StatusUnauthorized, "")
+	s.Expect(s.Do(http.MethodGet, "/api/check", "", a), http.StatusForbidden, "")
+
+	// 重置口令、删除用户时撤销其所有会话与个人访问令牌
+	project := entity.Project{Name: "会话项目"}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: user.ID, Role: entity.RoleDeveloper}).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin := s.AdminToken(0)
+	for _, revoke := range []struct{ method, path string }{
+		{http.MethodPost, "/api/user/resetPwd"},
+		{http.MethodDelete, fmt.Sprintf("/api/user/delete?ids=%d", user.ID)},
+	} {
+		c := login()
+		w = s.Do(http.MethodPost, "/api/token/create", fmt.Sprintf(`{"name":"CI","scopes":["read"],"projectId":%d,"expiresAt":%d}`,
+			project.ID, time.Now().Add(time.Hour).UnixMilli()), c)
+		var pat struct {
+			Token string `json:"token"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &pat) != nil {
+			t.Fatalf("create token: %d %s", w.Code, w.Body.String())
+		}
+		bearer := func() int {
+			return s.Do(http.MethodGet, "/api/project/search", "", "", controllertest.Bearer(pat.Token)).Code
+		}
+		if code := bearer(); code != http.StatusOK {
+			t.Fatalf("token before %s: %d", revoke.path, code)
+		}
+
+		if w = s.Do(revoke.method, revoke.path, fmt.Sprintf(`{"id":%d}`, user.ID), admin); w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", revoke.path, w.Code, w.Body.String())
+		}
+		if w = s.Do(http.MethodGet, "/api/user/info", "", c); w.Code != http.StatusUnauthorized {
+			t.Fatalf("cookie after %s: %d", revoke.path, w.Code)
+		}
+		if code := bearer(); code != http.StatusUnauthorized {
+			t.Fatalf("token after %s: %d", revoke.path, code)
+		}
+		// 重置口令后以原口令登录需修改口令，恢复口令与状态以便继续测试
+		if err := repo.DB.Model(&user).Updates(map[string]interface{}{"password": pwd, "salt": salt, "must_chg_pwd": 0}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,105 +1,428 @@
 package controller
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
-	"io"
-	"log"
+	"go.uber.org/zap"
 	"net/http"
+	"net/url"
+	"pdm/appconf"
 	"pdm/controller/dto"
+	"pdm/logg/applog"
+	"pdm/metrics"
 	"pdm/repo"
 	"pdm/repo/entity"
+	"pdm/reuint"
 	"pdm/reuint/jwt"
+	"pdm/reuint/oidc"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	ssoStateTTL     = 10 * time.Minute          // 单点登录授权请求有效期
+	ssoStateCookie  = "sso_state"               // 保存 state 的Cookie，用于确认回调与发起登录的是同一浏览器
+	ssoDefaultRoute = "/ui/#/index/projectList" // 登录后缺省跳转的前端地址
+	ssoTotpRoute    = "/ui/#/login/totp"        // 需验证动态口令时跳转的前端地址
+)
+
 // NewSsoController 创建单点登录控制器
-func NewSsoController(router gin.IRouter, baseUrl string) *SsoController {
-	res := &SsoController{}
-	router.GET("/redirect", res.redirect)
-	res.ssoBaseUrl = baseUrl
+// providers: 身份提供方配置
+// secure: Cookie 是否仅通过HTTPS传输
+func NewSsoController(router gin.IRouter, providers []appconf.SSOProvider, secure bool) *SsoController {
+	res := &SsoController{providers: map[string]*ssoProvider{}, secure: secure}
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &metrics.Transport{Requests: metrics.SSORequests, Duration: metrics.SSODuration},
+	}
+	for _, item := range providers {
+		p := &ssoProvider{SSOProvider: item}
+		if p.DisplayName == "" {
+			p.DisplayName = p.Name
+		}
+		if len(p.Scopes) == 0 && p.Issuer != "" {
+			p.Scopes = []string{"openid", "profile", "email"}
+		}
+		for _, claim := range []struct {
+			field *string
+			value string
+		}{
+			{&p.OpenidClaim, "sub"},
+			{&p.NameClaim, "name"},
+			{&p.EmailClaim, "email"},
+			{&p.PhoneClaim, "phone_number"},
+		} {
+			if *claim.field == "" {
+				*claim.field = claim.value
+			}
+		}
+		p.client = oidc.NewProvider(oidc.Config{
+			Issuer:           p.Issuer,
+			ClientID:         p.ClientID,
+			ClientSecret:     p.ClientSecret,
+			ClientSecretPost: p.ClientSecretPost,
+			RedirectURL:      p.RedirectURL,
+			Scopes:           p.Scopes,
+			AuthURL:          p.AuthURL,
+			TokenURL:         p.TokenURL,
+			UserInfoURL:      p.UserInfoURL,
+			JWKSURL:          p.JWKSURL,
+		}, client)
+		res.providers[p.Name] = p
+		res.names = append(res.names, p.Name)
+	}
+	r := router.Group("/sso")
+	// 身份提供方列表
+	r.GET("/providers", res.list)
+	// 跳转到身份提供方登录
+	r.GET("/:name/login", res.login)
+	// 身份提供方登录后回调
+	r.GET("/:name/callback", res.callback)
 	return res
 }
 
+// ssoProvider 单点登录身份提供方
+type ssoProvider struct {
+	appconf.SSOProvider
+	client *oidc.Provider
+}
+
 // SsoController 单点登录控制器
 type SsoController struct {
-	ssoBaseUrl string
+	providers map[string]*ssoProvider // 身份提供方，键为标识
+	names     []string                // 身份提供方标识，按配置顺序排列
+	secure    bool                    // Cookie 是否仅通过HTTPS传输
 }
 
 /**
-@api {get} /api/redirect 重定向页面
+@api {GET} /api/sso/providers 单点登录身份提供方
+@apiDescription 获取配置的单点登录身份提供方，登录页面据此显示单点登录入口，未配置时返回空数组。
+@apiName SsoProviders
+@apiGroup Sso
+
+@apiPermission 匿名
 
-@apiName OauthRedirect
-@apiGroup Oauth
+@apiParamExample 请求示例
+GET /api/sso/providers
 
-@apiParam {String} code  授权码
+@apiSuccess {SsoProviderDto[]} Body 身份提供方列表。
 
-@apiParamExample {get} 请求示例
-GET /oauth/redirect?code=b9502e98e4e3adf1dd400b39c60e272f7c9458db146d22229f3796c0f503a81c
+@apiSuccess (SsoProviderDto) {String} name 标识，登录地址为 /api/sso/<name>/login。
+@apiSuccess (SsoProviderDto) {String} displayName 显示名称。
 
-@apiExample html调用示例
-<a id="login"></a>
-<script>
-	var host = "https://nantemen.hzauth.com"
-	var login = document.getElementById("login")
-	var redirect_uri = "http://example.com/"
-	var client_id = "CLIENT_ID"
-	login.href = host+"/oauth/authorize?client_id=" + client_id + "&redirect_uri=" + redirect_uri
-</script>
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+[
+    {
+        "name": "keycloak",
+        "displayName": "统一身份认证"
+    }
+]
 */
 
-// redirect 单点登录回调接口
-func (c *SsoController) redirect(ctx *gin.Context) {
-	const clientId = "14b40ad8-30bc-4ee1-b381-8a43cfcf185c"
-	const clientSecret = "2cd12ccbf873e5d491b47c3e6d75af1ba818f25a8b27580607ce20a33fbd8d96"
-	const grantType = "authorization_code"
-	code := ctx.Query("code")
-	log.Println(code)
-	// 获取access_token
-	tokenRes, _ := http.NewRequest("GET", c.ssoBaseUrl+"/oauth/token?client_id="+
-		clientId+"&client_secret="+clientSecret+"&grant_type="+grantType+"&code="+code, nil)
-	tokenResp, _ := http.DefaultClient.Do(tokenRes)
-	body, _ := io.ReadAll(tokenResp.Body)
-	defer tokenResp.Body.Close()
-	tokenInfo := dto.AccessTokenDto{}
-	if err := json.Unmarshal(body, &tokenInfo); err != nil {
-		ErrSys(ctx, err)
+// list 身份提供方列表
+func (c *SsoController) list(ctx *gin.Context) {
+	res := make([]dto.SsoProviderDto, 0, len(c.names))
+	for _, name := range c.names {
+		res = append(res, dto.SsoProviderDto{Name: name, DisplayName: c.providers[name].DisplayName})
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {GET} /api/sso/:name/login 单点登录
+@apiDescription 浏览器访问该地址后重定向到身份提供方登录，登录后身份提供方回调 /api/sso/:name/callback 完成登录。
+登录请求10分钟内有效，仅能使用一次，使用 state、nonce 与 PKCE 防止跨站请求伪造、重放与授权码截取。
+@apiName SsoLogin
+@apiGroup Sso
+
+@apiPermission 匿名
+
+@apiParam {String} name 身份提供方标识，见 单点登录身份提供方。
+@apiParam {String} [redirect] 登录后跳转的前端地址，需以 /ui/ 开头，缺省为项目列表页面。
+
+@apiParamExample 请求示例
+GET /api/sso/keycloak/login?redirect=/ui/%23/index/projectList
+
+@apiSuccessExample 成功响应
+HTTP/1.1 302 Found
+Location: https://idp.example.com/realms/pdm/protocol/openid-connect/auth?client_id=pdm&code_challenge=...
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+身份提供方不存在
+*/
+
+// login 跳转到身份提供方登录
+func (c *SsoController) login(ctx *gin.Context) {
+	p, ok := c.providers[ctx.Param("name")]
+	if !ok {
+		ErrIllegal(ctx, "身份提供方不存在")
+		return
+	}
+	// 仅允许跳转到本系统的前端页面，防止开放重定向
+	redirect := ctx.Query("redirect")
+	if redirect == "" {
+		redirect = ssoDefaultRoute
+	}
+	if !strings.HasPrefix(redirect, "/ui/") || strings.Contains(redirect, "\\") || len(redirect) > 256 {
+		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
 
-	// 获取用户信息
-	accessToken := fmt.Sprintf("Bearer %s", tokenInfo.AccessToken)
-	infoRes, _ := http.NewRequest("GET", c.ssoBaseUrl+"/info", nil)
-	infoRes.Header.Add("accept", "application/json")
-	infoRes.Header.Add("Authorization", accessToken)
-	infoResp, _ := http.DefaultClient.Do(infoRes)
-	body, _ = io.ReadAll(infoResp.Body)
-	defer infoResp.Body.Close()
-	info := dto.InfoDto{}
-	if err := json.Unmarshal(body, &info); err != nil {
+	var values [3]string
+	for i := range values {
+		s, err := oidc.RandomString()
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		values[i] = s
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	authURL, err := p.client.AuthCodeURL(ctx.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		ErrNormal(ctx, "无法访问身份提供方，请稍后重试", err)
+		return
+	}
+	now := time.Now()
+	err = repo.NewSsoStateRepository().Create(&entity.SsoState{
+		ID:        oidc.Hash(state),
+		CreatedAt: now,
+		Provider:  p.Name,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		Redirect:  redirect,
+		ExpiresAt: now.Add(ssoStateTTL),
+	})
+	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
+	// 身份提供方回调为跨站的顶级导航，需使用 Lax 才能携带Cookie
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoStateCookie, state, int(ssoStateTTL/time.Second), "/api/sso/", "", c.secure, true)
+	ctx.Redirect(http.StatusFound, authURL)
+}
 
-	openid := info.Data.Openid
-	user := entity.User{}
-	err := repo.DB.First(&user, "openid = ? AND is_delete = 0", openid).Error
-	if err == gorm.ErrRecordNotFound {
-		ErrIllegal(ctx, "用户不存在")
+/**
+@api {GET} /api/sso/:name/callback 单点登录回调
+@apiDescription 身份提供方登录后回调该地址，校验 state 后使用授权码与 PKCE code_verifier 换取令牌，
+OIDC 身份提供方校验 ID Token 的签名、签发者、受众、有效期与 nonce，然后按配置的声明匹配用户工号（openid）。
+用户不存在时，若身份提供方配置了 autoCreate 则自动创建用户，否则登录失败。
+登录成功后在cookies加入token字段并跳转到发起登录时指定的前端地址。
+已启用动态口令或策略要求使用动态口令的用户不设置token，跳转到前端的动态口令验证页面 /ui/#/login/totp，
+地址参数 pendingToken 为登录凭证、enrolled 表示是否已绑定动态口令、redirect 为完成登录后跳转的地址，
+前端使用登录凭证调用 验证动态口令（未绑定时先调用 登录时绑定动态口令）接口完成登录。
+@apiName SsoCallback
+@apiGroup Sso
+
+@apiPermission 匿名
+
+@apiParam {String} name 身份提供方标识。
+@apiParam {String} code 授权码。
+@apiParam {String} state 发起登录时生成的 state。
+@apiParam {String} [error] 身份提供方拒绝登录时的错误码。
+
+@apiParamExample 请求示例
+GET /api/sso/keycloak/callback?code=b9502e98e4e3adf1dd400b39c60e272f&state=2Yp1dYwV...
+
+@apiSuccessExample 成功响应
+HTTP/1.1 302 Found
+Location: /ui/#/index/projectList
+
+@apiSuccessExample 需验证动态口令
+HTTP/1.1 302 Found
+Location: /ui/#/login/totp?enrolled=true&pendingToken=eyJhbGciOiJITUFDLVNNMyIsInR5cCI6IkpXVCJ9...&redirect=%2Fui%2F%23%2Findex%2FprojectList
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+登录请求无效或已过期，请重新登录
+*/
+
+// callback 身份提供方登录后回调
+func (c *SsoController) callback(ctx *gin.Context) {
+	p, ok := c.providers[ctx.Param("name")]
+	if !ok {
+		ErrIllegal(ctx, "身份提供方不存在")
 		return
 	}
+	// state 需与发起登录的浏览器中保存的一致，防止攻击者诱导用户以攻击者的身份登录
+	state := ctx.Query("state")
+	cookie, _ := ctx.Cookie(ssoStateCookie)
+	ctx.SetCookie(ssoStateCookie, "", -1, "/api/sso/", "", c.secure, true)
+	if state == "" || cookie != state {
+		ErrIllegal(ctx, "登录请求无效或已过期，请重新登录")
+		return
+	}
+	rec, err := repo.NewSsoStateRepository().Consume(oidc.Hash(state), p.Name)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
+	if rec == nil {
+		ErrIllegal(ctx, "登录请求无效或已过期，请重新登录")
+		return
+	}
+	if e := ctx.Query("error"); e != "" {
+		applog.A("单点登录失败", map[string]interface{}{"provider": p.Name, "ip": ctx.ClientIP(), "reason": e})
+		ErrIllegal(ctx, "身份提供方拒绝登录")
+		return
+	}
+
+	claims, err := c.claims(ctx.Request.Context(), p, ctx.Query("code"), rec)
+	if errors.Is(err, oidc.ErrInvalidIDToken) {
+		zap.L().Warn("单点登录ID Token无效", zap.String("provider", p.Name), zap.Error(err))
+		applog.A("单点登录失败", map[string]interface{}{"provider": p.Name, "ip": ctx.ClientIP(), "reason": err.Error()})
+		ErrIllegal(ctx, "身份认证失败")
+		return
+	}
+	if err != nil {
+		ErrNormal(ctx, "单点登录失败，请稍后重试", err)
+		return
+	}
+	openid := oidc.Claim(claims, p.OpenidClaim)
+	if openid == "" {
+		ErrNormal(ctx, "身份提供方未返回用户工号", nil)
+		return
+	}
 
+	usr, ok := c.user(ctx, p, openid, claims)
+	if !ok {
+		return
+	}
 	// 生成用户token进入主页
-	claims := jwt.Claims{Type: "user", Sub: user.ID, Exp: time.Now().Add(8 * time.Hour).UnixMilli()}
-	token := tokenManager.GenToken(&claims)
-	// 设置头部 Cookies 有效时间为8小时
-	ctx.SetCookie("token", token, 8*3600, "", "", false, true)
+	claimsToken := jwt.Claims{Type: "user", Sub: usr.ID, Exp: time.Now().Add(8 * time.Hour).UnixMilli()}
+
+	// 已启用动态口令或策略要求使用动态口令的用户，与口令登录相同需验证动态口令后完成登录
+	// 登录凭证放在前端地址的片段中，不会发送到服务端，也不会出现在 Referer 中
+	required, err := totpRequired(usr)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if required {
+		pending, err := tokenManager.IssuePending(ctx, claimsToken, totpPendingTTL)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		query := url.Values{}
+		query.Set("pendingToken", pending)
+		query.Set("enrolled", strconv.FormatBool(usr.TotpEnabled == 1))
+		query.Set("redirect", rec.Redirect)
+		ctx.Redirect(http.StatusFound, ssoTotpRoute+"?"+query.Encode())
+		return
+	}
+	// 创建会话，设置头部 Cookies 有效时间为8小时
+	if _, err = tokenManager.Issue(ctx, &claimsToken); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.Redirect(http.StatusFound, rec.Redirect)
+}
+
+// claims 使用授权码换取令牌，返还用户声明
+// OIDC 身份提供方以 ID Token 中的声明为准，用户信息端点返回的其他声明作为补充；
+// 普通 OAuth2 身份提供方使用用户信息端点返回的声明。
+func (c *SsoController) claims(ctx context.Context, p *ssoProvider, code string, rec *entity.SsoState) (map[string]interface{}, error) {
+	token, err := p.client.Exchange(ctx, code, rec.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if p.client.OIDC() {
+		if claims, err = p.client.VerifyIDToken(ctx, token.IDToken, rec.Nonce); err != nil {
+			return nil, err
+		}
+	}
+	info, err := p.client.UserInfo(ctx, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims == nil {
+		return info, nil
+	}
+	// 用户信息端点返回的 sub 必须与 ID Token 一致，见 OpenID Connect Core 5.3.2
+	if info != nil && oidc.Claim(info, "sub") == oidc.Claim(claims, "sub") {
+		for k, v := range info {
+			if _, exist := claims[k]; !exist {
+				claims[k] = v
+			}
+		}
+	}
+	return claims, nil
+}
 
-	ctx.Redirect(http.StatusMovedPermanently, "/ui/#/index/projectList")
+// user 获取工号对应的用户，不存在时按配置自动创建
+// 已删除的用户不会被自动创建。
+func (c *SsoController) user(ctx *gin.Context, p *ssoProvider, openid string, claims map[string]interface{}) (*entity.User, bool) {
+	var users []entity.User
+	if err := repo.DB.Where("openid = ?", openid).Order("is_delete").Limit(1).Find(&users).Error; err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	if len(users) > 0 && users[0].IsDelete == 0 {
+		return &users[0], true
+	}
+	if len(users) > 0 || !p.AutoCreate {
+		applog.A("单点登录失败", map[string]interface{}{"provider": p.Name, "openid": openid, "ip": ctx.ClientIP(), "reason": "用户不存在"})
+		ErrIllegal(ctx, "用户不存在")
+		return nil, false
+	}
+
+	usr := &entity.User{Openid: openid, Username: openid, Name: oidc.Claim(claims, p.NameClaim)}
+	if usr.Name == "" {
+		usr.Name = openid
+	}
+	exist, err := repo.UserRepo.ExistUsername(usr.Username)
+	if err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	if exist {
+		ErrIllegal(ctx, "用户名已经存在")
+		return nil, false
+	}
+	if usr.NamePinyin, err = reuint.PinyinConversion(usr.Name); err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	// 格式错误或已被其他用户使用的手机号与邮箱不保存
+	if phone := oidc.Claim(claims, p.PhoneClaim); reuint.PhoneValidate(phone) {
+		if exist, err = repo.UserRepo.ExistPhone(phone); err == nil && !exist {
+			usr.Phone = phone
+		}
+	}
+	if email := oidc.Claim(claims, p.EmailClaim); reuint.EmailValidate(email) {
+		if exist, err = repo.UserRepo.ExistEmail(email); err == nil && !exist {
+			usr.Email = email
+		}
+	}
+	// 单点登录创建的用户使用随机口令，需要口令登录时由管理员重置口令
+	random, err := oidc.RandomString()
+	if err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	pwd, salt, err := reuint.GenPasswordSalt(random)
+	if err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	now := time.Now()
+	usr.Password = entity.Pwd(pwd)
+	usr.Salt = salt
+	usr.PwdChangedAt = &now
+	if err = repo.DB.Create(usr).Error; err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	applog.A("单点登录创建用户", map[string]interface{}{"provider": p.Name, "openid": openid, "id": usr.ID, "name": usr.Name, "ip": ctx.ClientIP()})
+	return usr, true
 }
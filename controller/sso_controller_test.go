@@ -0,0 +1,163 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pdm/appconf"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"pdm/reuint/oidc/oidctest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSso(t *testing.T) {
+	idp := oidctest.NewServer("pdm", "secret")
+	defer idp.Close()
+	s := controllertest.NewServer(t, func(cfg *appconf.Application) {
+		for _, name := range []string{"corp", "auto"} {
+			cfg.SSO.Providers = append(cfg.SSO.Providers, appconf.SSOProvider{
+				Name:         name,
+				Issuer:       idp.Issuer(),
+				ClientID:     "pdm",
+				ClientSecret: "secret",
+				RedirectURL:  "https://pdm.example.com/api/sso/" + name + "/callback",
+				AutoCreate:   name == "auto",
+			})
+		}
+	})
+	if err := repo.DB.Create(&entity.User{Openid: "1001", Name: "张三", Username: "zhangsan"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	do := func(p string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		return s.Do(http.MethodGet, p, "", "", func(r *http.Request) {
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+		})
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name && c.Value != "" {
+				return c
+			}
+		}
+		return nil
+	}
+	// start 发起登录并在身份提供方完成授权，返还回调地址与 state Cookie
+	start := func(name, redirect string) (string, *http.Cookie) {
+		w := do("/api/sso/" + name + "/login?redirect=" + url.QueryEscape(redirect))
+		state := cookie(w, "sso_state")
+		if w.Code != http.StatusFound || state == nil || !state.HttpOnly {
+			t.Fatalf("login: %d %s", w.Code, w.Body.String())
+		}
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		cb, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil || cb.Query().Get("state") != state.Value {
+			t.Fatalf("authorize: %d %v", resp.StatusCode, err)
+		}
+		return cb.RequestURI(), state
+	}
+
+	w := do("/api/sso/providers")
+	if w.Code != http.StatusOK || w.Body.String() != `[{"name":"corp","displayName":"corp"},{"name":"auto","displayName":"auto"}]` {
+		t.Fatalf("providers: %d %s", w.Code, w.Body.String())
+	}
+	s.Expect(do("/api/sso/none/login"), http.StatusBadRequest, "身份提供方不存在")
+	s.Expect(do("/api/sso/corp/login?redirect="+url.QueryEscape("https://evil.example.com/ui/")), http.StatusBadRequest, "参数非法")
+
+	// 已有用户登录后跳转到指定页面，回调不可重放
+	idp.SetUser(map[string]interface{}{"sub": "1001"})
+	cb, state := start("corp", "/ui/#/index/docs")
+	w = do(cb, state)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/ui/#/index/docs" || cookie(w, "token") == nil {
+		t.Fatalf("callback: %d %s %s", w.Code, w.Header().Get("Location"), w.Body.String())
+	}
+	s.Expect(do(cb, state), http.StatusBadRequest, "登录请求无效或已过期")
+
+	// state 与发起登录的浏览器不一致
+	cb, _ = start("corp", "")
+	s.Expect(do(cb, &http.Cookie{Name: "sso_state", Value: "other"}), http.StatusBadRequest, "登录请求无效或已过期")
+	s.Expect(do(cb), http.StatusBadRequest, "登录请求无效或已过期")
+	// state 不能用于其他身份提供方
+	cb, state = start("corp", "")
+	s.Expect(do(strings.Replace(cb, "/corp/", "/auto/", 1), state), http.StatusBadRequest, "登录请求无效或已过期")
+
+	// ID Token 无效
+	idp.SetHook(func(c map[string]interface{}) { c["aud"] = "other" })
+	cb, state = start("corp", "")
+	s.Expect(do(cb, state), http.StatusBadRequest, "身份认证失败")
+	idp.SetHook(nil)
+
+	// 未开启自动创建时用户不存在
+	idp.SetUser(map[string]interface{}{"sub": "2001", "name": "李四", "email": "lisi@example.com", "phone_number": "13800000001"})
+	cb, state = start("corp", "")
+	s.Expect(do(cb, state), http.StatusBadRequest, "用户不存在")
+
+	// 开启自动创建
+	cb, state = start("auto", "")
+	w = do(cb, state)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/ui/#/index/projectList" || cookie(w, "token") == nil {
+		t.Fatalf("auto create: %d %s", w.Code, w.Body.String())
+	}
+	var usr entity.User
+	if err := repo.DB.Where("openid = ?", "2001").First(&usr).Error; err != nil {
+		t.Fatal(err)
+	}
+	if usr.Name != "李四" || usr.Username != "2001" || usr.Email != "lisi@example.com" || usr.Phone != "13800000001" || usr.Password == "" {
+		t.Fatalf("unexpected user: %+v", usr)
+	}
+
+	// 已删除的用户不会被重新创建
+	repo.DB.Model(&usr).Update("is_delete", 1)
+	cb, state = start("auto", "")
+	s.Expect(do(cb, state), http.StatusBadRequest, "用户不存在")
+
+	// 策略要求使用动态口令的用户不设置token，跳转到动态口令验证页面，使用登录凭证完成绑定与登录
+	project := entity.Project{Name: "测试项目"}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	var zhangsan entity.User
+	repo.DB.Where("openid = ?", "1001").First(&zhangsan)
+	if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: zhangsan.ID, Role: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.NewTotpRepository().SetPolicy(&entity.TotpPolicy{Roles: []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+	idp.SetUser(map[string]interface{}{"sub": "1001"})
+	cb, state = start("corp", "/ui/#/index/docs")
+	w = do(cb, state)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusFound || !strings.HasPrefix(location, "/ui/#/login/totp?") || cookie(w, "token") != nil {
+		t.Fatalf("callback with totp: %d %s %v", w.Code, location, w.Result().Cookies())
+	}
+	query, _ := url.ParseQuery(location[strings.Index(location, "?")+1:])
+	if query.Get("pendingToken") == "" || query.Get("enrolled") != "false" || query.Get("redirect") != "/ui/#/index/docs" {
+		t.Fatalf("unexpected totp redirect: %s", location)
+	}
+	var setup struct {
+		Secret       string `json:"secret"`
+		PendingToken string `json:"pendingToken"`
+	}
+	w = s.Do(http.MethodPost, "/api/login/totpSetup", `{"pendingToken":"`+query.Get("pendingToken")+`"}`, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &setup); err != nil || setup.PendingToken == "" {
+		t.Fatalf("login setup: %d %s", w.Code, w.Body.String())
+	}
+	code, _ := reuint.TotpCode(setup.Secret, reuint.TotpStep(time.Now()))
+	w = s.Do(http.MethodPost, "/api/login/totp", `{"pendingToken":"`+setup.PendingToken+`","code":"`+code+`"}`, "")
+	if w.Code != http.StatusOK || cookie(w, "token") == nil {
+		t.Fatalf("login totp: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -5,12 +5,8 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
-	"io/fs"
 	"net/url"
-	"os"
 	"path"
-	"path/filepath"
-	"pdm/appconf/dir"
 	"pdm/controller/dto"
 	"pdm/controller/middle"
 	"pdm/logg/applog"
@@ -18,10 +14,9 @@ import (
 	"pdm/repo/entity"
 	"pdm/reuint"
 	"pdm/reuint/jwt"
-	"runtime"
+	"pdm/storage"
 	"sort"
 	"strings"
-	"time"
 )
 
 // NewTechnicalProposalController 创建技术方案
@@ -93,14 +88,14 @@ HTTP/1.1 500
 func (c *TechnicalProposalController) attr(ctx *gin.Context) {
 	fileDir, _ := url.QueryUnescape(ctx.Query("path"))
 
-	p := filepath.Join(dir.TechnicalProposalDir, fileDir)
-	if !strings.HasPrefix(p, dir.TechnicalProposalDir) {
+	p, ok := storage.Clean(fileDir)
+	if !ok {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
 
-	info, err := os.Stat(p)
-	if os.IsNotExist(err) {
+	info, err := storage.TechnicalProposal.Stat(p)
+	if errors.Is(err, storage.ErrNotExist) {
 		ErrIllegal(ctx, "文件不存在")
 		return
 	}
@@ -109,24 +104,15 @@ func (c *TechnicalProposalController) attr(ctx *gin.Context) {
 		return
 	}
 
-	zone := time.FixedZone("CST", 8*3600)
-	res := &dto.FileItemDto{}
-	res.Name = info.Name()
-	res.UpdatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
+	res := fileItem(info)
 	res.Path = fileDir
-	if info.IsDir() {
-		res.Type = "dir"
-	} else {
-		res.Type = "file"
-	}
-	res.Size = info.Size()
-
 	ctx.JSON(200, res)
 }
 
 /**
 @api {POST} /api/technicalProposal/copy 复制
 @apiDescription 复制文件/文件夹。
+已归档项目的技术方案只读，修改时响应403。
 @apiName TechnicalProposalCopy
 @apiGroup TechnicalProposal
 
@@ -166,62 +152,47 @@ func (c *TechnicalProposalController) copy(ctx *gin.Context) {
 		return
 	}
 
-	from := filepath.Join(dir.TechnicalProposalDir, fileCopy.From)
-	if !strings.HasPrefix(from, dir.TechnicalProposalDir) || from == dir.TechnicalProposalDir {
+	from, ok := storage.Clean(fileCopy.From)
+	if !ok || from == "" {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
-	info, _ := os.Stat(from)
-	to := filepath.Join(dir.TechnicalProposalDir, fileCopy.To)
-	if !strings.HasPrefix(to, dir.TechnicalProposalDir) || to == dir.TechnicalProposalDir || (info.IsDir() && strings.HasPrefix(to, from+string(filepath.Separator))) {
-		ErrIllegal(ctx, "文件路径错误")
+	info, err := storage.TechnicalProposal.Stat(from)
+	if errors.Is(err, storage.ErrNotExist) {
+		ErrIllegal(ctx, "原文件不存在")
 		return
 	}
-	_, err = os.Stat(to)
-	if err == nil {
-		ErrIllegal(ctx, "文件已存在")
+	if err != nil {
+		ErrSys(ctx, err)
 		return
 	}
-	if os.IsNotExist(err) {
-		if info.IsDir() {
-			err := reuint.CopyDir(from, to)
-			if err != nil {
-				ErrSys(ctx, err)
-				return
-			}
-			return
-		}
-		fromFile, err := os.Open(from)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
-		defer fromFile.Close()
-
-		toFile, err := os.Create(to)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
-		defer toFile.Close()
-
-		_, err = io.Copy(toFile, fromFile)
-		if err != nil {
-			ErrSys(ctx, err)
-			return
-		}
+	to, ok := storage.Clean(fileCopy.To)
+	if !ok || to == "" || (info.IsDir && storage.IsSub(from, to)) {
+		ErrIllegal(ctx, "文件路径错误")
+		return
+	}
+	if !tpWritable(ctx, to) {
 		return
 	}
+	exist, err := storage.Exist(storage.TechnicalProposal, to)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-
+	if exist {
+		ErrIllegal(ctx, "文件已存在")
+		return
+	}
+	if err = storage.TechnicalProposal.Copy(from, to); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 }
 
 /**
 @api {DELETE} /api/technicalProposal/remove 删除
 @apiDescription 删除文件或文件夹。
+已归档项目的技术方案只读，修改时响应403。
 @apiName TechnicalProposalRemove
 @apiGroup TechnicalProposal
 
@@ -250,13 +221,16 @@ func (c *TechnicalProposalController) remove(ctx *gin.Context) {
 		"fileDir": fileDir,
 	})
 
-	p := filepath.Join(dir.TechnicalProposalDir, fileDir)
-	if !strings.HasPrefix(p, dir.TechnicalProposalDir) || p == dir.TechnicalProposalDir {
+	p, ok := storage.Clean(fileDir)
+	if !ok || p == "" {
 		ErrIllegal(ctx, "文件路径错误")
 		return
 	}
+	if !tpWritable(ctx, p) {
+		return
+	}
 
-	err := os.RemoveAll(p)
+	err := storage.TechnicalProposal.Remove(p)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -266,6 +240,7 @@ func (c *TechnicalProposalController) remove(ctx *gin.Context) {
 /**
 @api {POST} /api/technicalProposal/move 移动
 @apiDescription 移动或重命名文件/文件夹。
+已归档项目的技术方案只读，修改时响应403。
 @apiName TechnicalProposalMove
 @apiGroup TechnicalProposal
 
@@ -310,26 +285,33 @@ func (c *TechnicalProposalController) move(ctx *gin.Context) {
 		return
 	}
 
-	param.From = filepath.Join(dir.TechnicalProposalDir, param.From)
-	param.To = filepath.Join(dir.TechnicalProposalDir, param.To)
-	if !strings.HasPrefix(param.From, dir.TechnicalProposalDir) || param.From == dir.TechnicalProposalDir {
+	from, ok := storage.Clean(param.From)
+	if !ok || from == "" {
 		ErrIllegal(ctx, "文件原路径错误")
 		return
 	}
-	info, err := os.Stat(param.From)
-	if errors.Is(err, os.ErrNotExist) {
+	info, err := storage.TechnicalProposal.Stat(from)
+	if errors.Is(err, storage.ErrNotExist) {
 		ErrIllegal(ctx, "原文件不存在")
 		return
 	}
-	if !strings.HasPrefix(param.To, dir.TechnicalProposalDir) || param.To == dir.TechnicalProposalDir || (info.IsDir() && strings.HasPrefix(param.To, param.From+string(filepath.Separator))) {
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	to, ok := storage.Clean(param.To)
+	if !ok || to == "" || (info.IsDir && storage.IsSub(from, to)) {
 		ErrIllegal(ctx, "文件目标路径错误")
 		return
 	}
-	if _, err := os.Stat(param.To); err == nil {
+	if !tpWritable(ctx, from, to) {
+		return
+	}
+	if exist, _ := storage.Exist(storage.TechnicalProposal, to); exist {
 		ErrIllegal(ctx, "文件已存在")
 		return
 	}
-	err = os.Rename(param.From, param.To)
+	err = storage.TechnicalProposal.Rename(from, to)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -395,11 +377,12 @@ func (c *TechnicalProposalController) list(ctx *gin.Context) {
 		onlyDir = true
 	}
 
-	p := filepath.Join(dir.TechnicalProposalDir, baseDir)
-	if !strings.HasPrefix(p, dir.TechnicalProposalDir) {
+	p, ok := storage.Clean(baseDir)
+	if !ok {
 		ErrIllegal(ctx, "搜索基础路径错误")
 		return
 	}
+
 	claimsValue, _ := ctx.Get(middle.FlagClaims)
 	claims := claimsValue.(*jwt.Claims)
 
@@ -414,51 +397,37 @@ func (c *TechnicalProposalController) list(ctx *gin.Context) {
 		ErrSys(ctx, err)
 		return
 	}
+	// 项目改名后技术方案仍在原目录中
+	var dirs []string
+	err := repo.DB.Model(&entity.TechnicalProposal{}).Distinct("dir").
+		Where("project_id IN ? AND dir IS NOT NULL AND dir <> ''", projectIdList).Pluck("dir", &dirs).Error
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	visible := map[string]bool{}
+	for _, name := range append(projectNameList, dirs...) {
+		visible[name] = true
+	}
 	res := []dto.FileItemDto{}
-	zone := time.FixedZone("CST", 8*3600)
-	_ = filepath.Walk(p, func(path string, info fs.FileInfo, err error) error {
-
-		if path == p {
-			// 忽略根路径
-			return nil
-		}
-
-		if onlyDir && !info.IsDir() {
+	items, _ := storage.TechnicalProposal.List(p)
+	for i := range items {
+		info := &items[i]
+		if onlyDir && !info.IsDir {
 			// 在仅查询目录的情况忽略 文件
-			return nil
+			continue
 		}
 
-		if keyword != "" && !strings.Contains(info.Name(), keyword) {
+		if keyword != "" && !strings.Contains(info.Name, keyword) {
 			// 关键字不匹配
-			return nil
-		}
-		if len(baseDir) <= 0 {
-			for _, val := range projectNameList {
-				if info.Name() != val && info.IsDir() {
-					return filepath.SkipDir
-				}
-			}
-		}
-		item := &dto.FileItemDto{}
-		item.Name = info.Name()
-		item.UpdatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
-		item.Path = strings.Replace(path, dir.TechnicalProposalDir, "", 1)
-		if runtime.GOOS == "windows" {
-			item.Path = strings.Replace(item.Path, "\\", "/", -1)
-		}
-		item.Size = info.Size()
-		item.Type = "file"
-		if info.IsDir() {
-			item.Type = "dir"
+			continue
 		}
-		res = append(res, *item)
-
-		if info.IsDir() {
-			// 阻止递归
-			return filepath.SkipDir
+		// 根目录下仅显示参与的项目目录
+		if len(baseDir) <= 0 && info.IsDir && !visible[info.Name] {
+			continue
 		}
-		return nil
-	})
+		res = append(res, fileItem(info))
+	}
 	sort.Slice(res, func(i, j int) bool {
 		if res[i].Type != res[j].Type {
 			return len(res[i].Type) < len(res[j].Type)
@@ -512,32 +481,32 @@ func (c *TechnicalProposalController) download(ctx *gin.Context) {
 	})
 
 	for i, filename := range fileList {
-		filePath := filepath.Join(dir.TechnicalProposalDir, filename)
-		if !strings.HasPrefix(filePath, dir.TechnicalProposalDir) || filePath == dir.TechnicalProposalDir {
+		p, ok := storage.Clean(filename)
+		if !ok || p == "" {
 			ErrIllegal(ctx, "路径错误")
 			return
 		}
-		fileList[i] = filePath
+		fileList[i] = p
 	}
 
-	info, err := os.Stat(fileList[0])
+	info, err := storage.TechnicalProposal.Stat(fileList[0])
 	if err != nil {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
 
 	// 单文件下载
-	if len(fileList) == 1 && !info.IsDir() {
-		file, err := os.Open(fileList[0])
+	if len(fileList) == 1 && !info.IsDir {
+		file, err := storage.TechnicalProposal.Open(fileList[0])
 		if err != nil {
 			ErrSys(ctx, err)
 			return
 		}
 		defer file.Close()
 		// 下载文件名称
-		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(info.Name())))
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", url.QueryEscape(info.Name)))
 		//获取文件的后缀(文件类型)
-		ctx.Header("Content-Type", reuint.GetMIME(path.Ext(info.Name())))
+		ctx.Header("Content-Type", reuint.GetMIME(path.Ext(info.Name)))
 		_, err = io.Copy(ctx.Writer, file)
 		if err != nil {
 			ErrSys(ctx, err)
@@ -547,9 +516,9 @@ func (c *TechnicalProposalController) download(ctx *gin.Context) {
 	}
 
 	// 多文件或目录 打包压缩下载
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", url.QueryEscape(info.Name())))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", url.QueryEscape(info.Name)))
 	ctx.Header("Content-Type", "application/zip")
-	err = reuint.Zip(ctx.Writer, fileList...)
+	err = storage.Zip(ctx.Writer, storage.TechnicalProposal, fileList...)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
@@ -559,6 +528,7 @@ func (c *TechnicalProposalController) download(ctx *gin.Context) {
 /**
 @api {POST} /api/technicalProposal/upload 上传
 @apiDescription 以表单的方式上传文件列表。
+已归档项目的技术方案只读，修改时响应403。
 
 @apiName TechnicalProposalUpload
 @apiGroup TechnicalProposal
@@ -591,17 +561,36 @@ func (c *TechnicalProposalController) upload(ctx *gin.Context) {
 	applog.L(ctx, "基础文档区上传文件", map[string]interface{}{
 		"path": base,
 	})
+	baseDir, ok := storage.Clean(base)
+	if !ok {
+		ErrIllegal(ctx, "路径错误")
+		return
+	}
+	targets := []string{baseDir}
+	for _, file := range files {
+		if filePath, ok := storage.Clean(path.Join(baseDir, file.Filename)); ok {
+			targets = append(targets, filePath)
+		}
+	}
+	if !tpWritable(ctx, targets...) {
+		return
+	}
 	var err1 error
 	for _, file := range files {
-		_ = os.MkdirAll(filepath.Join(dir.TechnicalProposalDir, base), os.ModePerm)
-		filePath := filepath.Join(dir.TechnicalProposalDir, base, file.Filename)
-		_, err := os.Stat(filePath)
-		if err == nil {
+		filePath, ok := storage.Clean(path.Join(baseDir, file.Filename))
+		if !ok || !storage.IsSub(baseDir, filePath) {
+			err1 = errors.New(file.Filename + "文件名错误")
+			continue
+		}
+		exist, err := storage.Exist(storage.TechnicalProposal, filePath)
+		if exist {
 			err1 = errors.New(file.Filename + "文件已存在")
 			continue
 			//return
 		}
-		err = ctx.SaveUploadedFile(file, filePath)
+		if err == nil {
+			err = storage.SaveUploadedFile(storage.TechnicalProposal, file, filePath)
+		}
 		if err != nil {
 			err1 = err
 			continue
@@ -617,6 +606,7 @@ func (c *TechnicalProposalController) upload(ctx *gin.Context) {
 /**
 @api {POST} /api/technicalProposal/mkdir 创建目录
 @apiDescription 创建目录，若包含多个级则递归创建。
+已归档项目的技术方案只读，修改时响应403。
 @apiName TechnicalProposalMkdir
 @apiGroup TechnicalProposal
 
@@ -652,25 +642,20 @@ func (c *TechnicalProposalController) mkdir(ctx *gin.Context) {
 		ErrIllegal(ctx, "参数非法，无法解析")
 		return
 	}
-	p := filepath.Join(dir.TechnicalProposalDir, base)
-	if !strings.HasPrefix(p, dir.TechnicalProposalDir) || p == dir.TechnicalProposalDir {
+	p, ok := storage.Clean(base)
+	if !ok || p == "" {
 		ErrIllegal(ctx, "路径错误")
 		return
 	}
-	if runtime.GOOS == "windows" {
-		p = strings.Replace(p, "\\", "/", -1)
+	if !tpWritable(ctx, p) {
+		return
 	}
 
-	if err := os.MkdirAll(p, os.ModePerm); err != nil {
+	if err := storage.TechnicalProposal.MkdirAll(p); err != nil {
 		ErrIllegal(ctx, "创建失败")
 		return
 	}
-	lastIndex := strings.LastIndex(p, "/")
-	var name string
-	if lastIndex != -1 {
-		name = p[lastIndex+1:]
-	}
-	ctx.JSON(200, name)
+	ctx.JSON(200, path.Base(p))
 }
 
 /**
@@ -736,39 +721,40 @@ func (c *TechnicalProposalController) search(ctx *gin.Context) {
 		return
 	}
 
-	p := filepath.Join(dir.TechnicalProposalDir, baseDir)
-	if !strings.HasPrefix(p, dir.TechnicalProposalDir) {
+	p, ok := storage.Clean(baseDir)
+	if !ok {
 		ErrIllegal(ctx, "搜索路径错误")
 		return
 	}
 
 	res := []dto.FileItemDto{}
-	zone := time.FixedZone("CST", 8*3600)
-	_ = filepath.Walk(p, func(path string, info fs.FileInfo, err error) error {
-		// 忽略根路径
-		if path == p {
-			return nil
-		}
-
-		if !strings.Contains(info.Name(), keyword) {
+	_ = storage.Walk(storage.TechnicalProposal, p, func(info storage.FileInfo) error {
+		if !strings.Contains(info.Name, keyword) {
 			// 关键字不匹配
 			return nil
 		}
-
-		item := &dto.FileItemDto{}
-		item.Name = info.Name()
-		item.UpdatedAt = info.ModTime().In(zone).Format("2006-01-02 15:04:05")
-		item.Path = strings.Replace(path, dir.TechnicalProposalDir, "", 1)
-		if runtime.GOOS == "windows" {
-			item.Path = strings.Replace(item.Path, "\\", "/", -1)
-		}
-		item.Size = info.Size()
-		item.Type = "file"
-		if info.IsDir() {
-			item.Type = "dir"
-		}
-		res = append(res, *item)
+		res = append(res, fileItem(&info))
 		return nil
 	})
 	ctx.JSON(200, res)
 }
+
+// tpWritable 技术方案路径所在的项目是否均可修改，已归档项目的技术方案只读
+// 路径的顶层目录为项目目录，见 repo.TechnicalProposalRepository。
+// paths: 经过 storage.Clean 处理的路径
+func tpWritable(ctx *gin.Context, paths ...string) bool {
+	var projectIds []int
+	for _, p := range paths {
+		top := strings.SplitN(p, "/", 2)[0]
+		if top == "" {
+			continue
+		}
+		ids, err := repo.NewTechnicalProposalRepository().Projects(top)
+		if err != nil {
+			ErrSys(ctx, err)
+			return false
+		}
+		projectIds = append(projectIds, ids...)
+	}
+	return writable(ctx, projectIds...)
+}
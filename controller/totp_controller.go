@@ -0,0 +1,528 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pdm/controller/dto"
+	"pdm/controller/middle"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"pdm/reuint/jwt"
+	"strconv"
+	"time"
+)
+
+// NewTotpController 创建动态口令控制器
+// issuer: 签发者名称，显示在身份验证器App中
+func NewTotpController(router gin.IRouter, issuer string) *TotpController {
+	res := &TotpController{issuer: issuer}
+	r := router.Group("/totp")
+	// 动态口令状态
+	r.GET("/status", User, res.status)
+	// 生成动态口令密钥
+	r.POST("/setup", User, res.setup)
+	// 启用动态口令
+	r.POST("/enable", User, res.enable)
+	// 停用动态口令
+	r.POST("/disable", User, res.disable)
+	// 重新生成恢复码
+	r.POST("/recoveryCodes", User, res.recoveryCodes)
+	// 管理员重置用户的动态口令
+	r.DELETE("/reset", Admin, res.reset)
+	// 动态口令策略
+	r.GET("/policy", Admin, res.policy)
+	// 设置动态口令策略
+	r.POST("/policy", Admin, res.setPolicy)
+	return res
+}
+
+// TotpController 动态口令控制器
+// 用户启用动态口令（RFC 6238）后，登录时除口令外还需验证身份验证器App生成的动态口令。
+type TotpController struct {
+	issuer string // 签发者名称
+}
+
+// totpSetup 为未启用动态口令的用户生成新的动态口令密钥
+// 返还 nil 表示用户已启用动态口令。
+func totpSetup(usr *entity.User, issuer string) (*dto.TotpSetupDto, error) {
+	secret, err := reuint.GenTotpSecret()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := repo.NewTotpRepository().SetSecret(usr.ID, secret)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &dto.TotpSetupDto{Secret: secret, URI: reuint.TotpURI(issuer, usr.Openid, secret)}, nil
+}
+
+// totpRequired 用户登录时是否需验证动态口令，已启用动态口令或策略要求使用动态口令时需要
+func totpRequired(usr *entity.User) (bool, error) {
+	if usr.TotpEnabled == 1 {
+		return true, nil
+	}
+	return repo.NewTotpRepository().Required(usr.ID)
+}
+
+// verifyTotpCode 验证已启用动态口令用户的动态口令，同一动态口令仅能使用一次
+func verifyTotpCode(usr *entity.User, code string) (bool, error) {
+	step, ok := reuint.VerifyTotp(usr.TotpSecret, code, time.Now(), usr.TotpStep)
+	if !ok {
+		return false, nil
+	}
+	return repo.NewTotpRepository().UseStep(usr.ID, step)
+}
+
+// currentUser 当前登录的用户
+func currentUser(ctx *gin.Context) (*entity.User, bool) {
+	claimsValue, _ := ctx.Get(middle.FlagClaims)
+	claims := claimsValue.(*jwt.Claims)
+	usr := &entity.User{}
+	err := repo.DB.First(usr, "id = ? AND is_delete = 0", claims.Sub).Error
+	if err == gorm.ErrRecordNotFound {
+		ErrIllegal(ctx, "不存在该用户")
+		return nil, false
+	}
+	if err != nil {
+		ErrSys(ctx, err)
+		return nil, false
+	}
+	return usr, true
+}
+
+/**
+@api {GET} /api/totp/status 动态口令状态
+@apiDescription 当前用户是否已启用动态口令，以及策略是否要求使用动态口令。
+@apiName TotpStatus
+@apiGroup Totp
+
+@apiPermission 用户
+
+@apiParamExample 请求示例
+GET /api/totp/status
+
+@apiSuccess {Boolean} enabled 是否已启用动态口令。
+@apiSuccess {Boolean} required 策略是否要求使用动态口令，为true时无法停用。
+@apiSuccess {Integer} recoveryCodes 剩余可用的恢复码数量。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "enabled": true,
+    "required": false,
+    "recoveryCodes": 10
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// status 动态口令状态
+func (c *TotpController) status(ctx *gin.Context) {
+	usr, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	totpRepo := repo.NewTotpRepository()
+	required, err := totpRepo.Required(usr.ID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	remaining, err := totpRepo.RemainingRecoveryCodes(usr.ID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.TotpStatusDto{Enabled: usr.TotpEnabled == 1, Required: required, RecoveryCodes: remaining})
+}
+
+/**
+@api {POST} /api/totp/setup 生成动态口令密钥
+@apiDescription 为当前用户生成动态口令密钥，前端将返回的 uri 生成二维码供身份验证器App扫描，
+扫描后调用 启用动态口令 接口完成绑定。已启用动态口令的用户需先停用。
+@apiName TotpSetup
+@apiGroup Totp
+
+@apiPermission 用户
+
+@apiParamExample 请求示例
+POST /api/totp/setup
+
+@apiSuccess {String} secret 动态口令密钥Base32，无法扫码时手动输入。
+@apiSuccess {String} uri 配置URI。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "secret": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+    "uri": "otpauth://totp/PDM:1001?algorithm=SHA1&digits=6&issuer=PDM&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+已启用动态口令
+*/
+
+// setup 生成动态口令密钥
+func (c *TotpController) setup(ctx *gin.Context) {
+	usr, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	applog.L(ctx, "生成动态口令密钥", map[string]interface{}{"userId": usr.ID})
+	res, err := totpSetup(usr, c.issuer)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if res == nil {
+		ErrIllegal(ctx, "已启用动态口令")
+		return
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {POST} /api/totp/enable 启用动态口令
+@apiDescription 验证身份验证器App生成的动态口令，通过后启用动态口令并生成10个恢复码。
+恢复码仅返回一次，用户无法使用身份验证器时可以使用恢复码代替动态口令登录，每个恢复码仅能使用一次。
+@apiName TotpEnable
+@apiGroup Totp
+
+@apiPermission 用户
+
+@apiParam {String} code 动态口令。
+
+@apiParamExample {json} 请求示例
+{
+    "code": "287082"
+}
+
+@apiSuccess {String[]} recoveryCodes 恢复码。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "recoveryCodes": ["abcde-23456", "..."]
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+动态口令错误
+*/
+
+// enable 启用动态口令
+func (c *TotpController) enable(ctx *gin.Context) {
+	var info dto.TotpCodeDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	usr, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	applog.L(ctx, "启用动态口令", map[string]interface{}{"userId": usr.ID})
+	if usr.TotpEnabled == 1 {
+		ErrIllegal(ctx, "已启用动态口令")
+		return
+	}
+	if usr.TotpSecret == "" {
+		ErrIllegal(ctx, "请先生成动态口令密钥")
+		return
+	}
+	step, ok := reuint.VerifyTotp(usr.TotpSecret, info.Code, time.Now(), 0)
+	if !ok {
+		ErrIllegal(ctx, "动态口令错误")
+		return
+	}
+	codes, err := repo.NewTotpRepository().Enable(usr.ID, step)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.TotpRecoveryCodesDto{RecoveryCodes: codes})
+}
+
+/**
+@api {POST} /api/totp/disable 停用动态口令
+@apiDescription 验证动态口令后停用动态口令，同时删除密钥与恢复码。策略要求使用动态口令的用户无法停用。
+@apiName TotpDisable
+@apiGroup Totp
+
+@apiPermission 用户
+
+@apiParam {String} code 动态口令。
+
+@apiParamExample {json} 请求示例
+{
+    "code": "287082"
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+策略要求使用动态口令，无法停用
+*/
+
+// disable 停用动态口令
+func (c *TotpController) disable(ctx *gin.Context) {
+	var info dto.TotpCodeDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	usr, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	applog.L(ctx, "停用动态口令", map[string]interface{}{"userId": usr.ID})
+	if usr.TotpEnabled != 1 {
+		ErrIllegal(ctx, "未启用动态口令")
+		return
+	}
+	totpRepo := repo.NewTotpRepository()
+	required, err := totpRepo.Required(usr.ID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if required {
+		ErrIllegal(ctx, "策略要求使用动态口令，无法停用")
+		return
+	}
+	if ok, err = verifyTotpCode(usr, info.Code); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if !ok {
+		ErrIllegal(ctx, "动态口令错误")
+		return
+	}
+	if err = totpRepo.Reset(usr.ID); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {POST} /api/totp/recoveryCodes 重新生成恢复码
+@apiDescription 验证动态口令后重新生成10个恢复码，原有的恢复码全部失效。
+@apiName TotpRecoveryCodes
+@apiGroup Totp
+
+@apiPermission 用户
+
+@apiParam {String} code 动态口令。
+
+@apiParamExample {json} 请求示例
+{
+    "code": "287082"
+}
+
+@apiSuccess {String[]} recoveryCodes 恢复码。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "recoveryCodes": ["abcde-23456", "..."]
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+动态口令错误
+*/
+
+// recoveryCodes 重新生成恢复码
+func (c *TotpController) recoveryCodes(ctx *gin.Context) {
+	var info dto.TotpCodeDto
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	usr, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	applog.L(ctx, "重新生成恢复码", map[string]interface{}{"userId": usr.ID})
+	if usr.TotpEnabled != 1 {
+		ErrIllegal(ctx, "未启用动态口令")
+		return
+	}
+	ok, err := verifyTotpCode(usr, info.Code)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if !ok {
+		ErrIllegal(ctx, "动态口令错误")
+		return
+	}
+	codes, err := repo.NewTotpRepository().RegenerateRecoveryCodes(usr.ID)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, dto.TotpRecoveryCodesDto{RecoveryCodes: codes})
+}
+
+/**
+@api {DELETE} /api/totp/reset 重置动态口令
+@apiDescription 管理员重置用户的动态口令，用于用户丢失身份验证器且恢复码用完的情况。
+重置后用户的动态口令停用，策略要求使用动态口令的用户在下次登录时需重新绑定。
+@apiName TotpReset
+@apiGroup Totp
+
+@apiPermission 管理员
+
+@apiParam {Integer} id 用户ID。
+
+@apiParamExample 请求示例
+DELETE /api/totp/reset?id=1
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+不存在该用户
+*/
+
+// reset 重置动态口令
+func (c *TotpController) reset(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	applog.L(ctx, "重置用户动态口令", map[string]interface{}{"userId": id})
+	exist, err := repo.UserRepo.Exist(id)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if !exist {
+		ErrIllegal(ctx, "不存在该用户")
+		return
+	}
+	if err = repo.NewTotpRepository().Reset(id); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
+
+/**
+@api {GET} /api/totp/policy 动态口令策略
+@apiDescription 获取动态口令策略，策略要求使用动态口令的用户在登录时必须验证动态口令，未绑定的需先完成绑定。
+@apiName TotpPolicy
+@apiGroup Totp
+
+@apiPermission 管理员
+
+@apiParamExample 请求示例
+GET /api/totp/policy
+
+@apiSuccess {Boolean} required 所有用户必须使用动态口令。
+@apiSuccess {Integer[]} roles 担任这些项目角色的用户必须使用动态口令，角色：0 - 开发者，1 - 对接者，2 - 项目负责人，3 - 项目管理员。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "required": false,
+    "roles": [1]
+}
+
+@apiErrorExample 失败响应
+HTTP/1.1 500
+
+系统内部错误
+*/
+
+// policy 动态口令策略
+func (c *TotpController) policy(ctx *gin.Context) {
+	res, err := repo.NewTotpRepository().Policy()
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if res.Roles == nil {
+		res.Roles = []int{}
+	}
+	ctx.JSON(200, res)
+}
+
+/**
+@api {POST} /api/totp/policy 设置动态口令策略
+@apiDescription 设置哪些用户必须使用动态口令，可以要求所有用户使用，或要求担任指定项目角色的用户使用。
+@apiName TotpSetPolicy
+@apiGroup Totp
+
+@apiPermission 管理员
+
+@apiParam {Boolean} required 所有用户必须使用动态口令。
+@apiParam {Integer[]} [roles] 担任这些项目角色的用户必须使用动态口令，角色：0 - 开发者，1 - 对接者，2 - 项目负责人，3 - 项目管理员。
+
+@apiParamExample {json} 请求示例
+{
+    "required": false,
+    "roles": [1]
+}
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+@apiErrorExample 失败响应
+HTTP/1.1 400
+
+未知的项目角色
+*/
+
+// setPolicy 设置动态口令策略
+func (c *TotpController) setPolicy(ctx *gin.Context) {
+	var info entity.TotpPolicy
+	if err := ctx.BindJSON(&info); err != nil {
+		ErrIllegal(ctx, "参数非法，无法解析")
+		return
+	}
+	applog.L(ctx, "设置动态口令策略", map[string]interface{}{
+		"required": info.Required,
+		"roles":    info.Roles,
+	})
+	var roles []int
+	for _, role := range info.Roles {
+		known, err := repo.NewProjectRoleRepository().Known(role)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		if !known {
+			ErrIllegal(ctx, "未知的项目角色")
+			return
+		}
+		if !isRoleContain(role, roles) {
+			roles = append(roles, role)
+		}
+	}
+	info.Roles = roles
+	if err := repo.NewTotpRepository().SetPolicy(&info); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+}
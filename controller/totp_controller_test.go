@@ -0,0 +1,180 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTotp(t *testing.T) {
+	s := controllertest.NewServer(t)
+	users := []entity.User{
+		{Openid: "1001", Name: "张三", Username: "zhangsan"},
+		{Openid: "1002", Name: "李四", Username: "lisi"},
+	}
+	for i := range users {
+		s.CreateUser(&users[i], "Passw0rd#1")
+	}
+	type loginResult struct {
+		TotpRequired  bool     `json:"totpRequired"`
+		Enrolled      bool     `json:"enrolled"`
+		PendingToken  string   `json:"pendingToken"`
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	login := func(openid string) (loginResult, string) {
+		w := s.Do(http.MethodPost, "/api/login", `{"username":"`+openid+`","password":"Passw0rd#1"}`, "")
+		var res loginResult
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("login: %d %s", w.Code, w.Body.String())
+		}
+		return res, controllertest.Cookie(w)
+	}
+	second := func(pending, field, value string) (*httptest.ResponseRecorder, loginResult) {
+		w := s.Do(http.MethodPost, "/api/login/totp", fmt.Sprintf(`{"pendingToken":"%s","%s":"%s"}`, pending, field, value), "")
+		var res loginResult
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+	var setup struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+
+	// 未启用动态口令时直接登录
+	res, token := login("1001")
+	if res.TotpRequired || token == "" {
+		t.Fatalf("unexpected login result: %+v", res)
+	}
+
+	// 绑定并启用动态口令
+	w := s.Do(http.MethodPost, "/api/totp/setup", "", token)
+	if err := json.Unmarshal(w.Body.Bytes(), &setup); err != nil || !strings.Contains(setup.URI, "secret="+setup.Secret) {
+		t.Fatalf("setup: %d %s", w.Code, w.Body.String())
+	}
+	step := reuint.TotpStep(time.Now())
+	code, _ := reuint.TotpCode(setup.Secret, step)
+	s.Expect(s.Do(http.MethodPost, "/api/totp/enable", `{"code":"000000x"}`, token), http.StatusBadRequest, "")
+	w = s.Do(http.MethodPost, "/api/totp/enable", `{"code":"`+code+`"}`, token)
+	var enabled struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &enabled); err != nil || len(enabled.RecoveryCodes) != 10 {
+		t.Fatalf("enable: %d %s", w.Code, w.Body.String())
+	}
+	s.Expect(s.Do(http.MethodPost, "/api/totp/setup", "", token), http.StatusBadRequest, "")
+
+	// 启用后登录需验证动态口令，第一步不设置token
+	res, token = login("1001")
+	if !res.TotpRequired || !res.Enrolled || res.PendingToken == "" || token != "" {
+		t.Fatalf("expect pending login: %+v", res)
+	}
+	s.Expect(s.Do(http.MethodGet, "/api/project/search", "", res.PendingToken), http.StatusUnauthorized, "")
+	if w, _ = second(res.PendingToken, "code", code); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed code: %d", w.Code)
+	}
+	next, _ := reuint.TotpCode(setup.Secret, step+1)
+	if w, _ = second(res.PendingToken, "code", next); w.Code != http.StatusOK || controllertest.Cookie(w) == "" {
+		t.Fatalf("second step: %d %s", w.Code, w.Body.String())
+	}
+	s.Expect(s.Do(http.MethodGet, "/api/project/search", "", controllertest.Cookie(w)), http.StatusOK, "")
+	// 登录凭证仅能使用一次
+	s.Expect(s.Do(http.MethodPost, "/api/login/totp", `{"pendingToken":"`+res.PendingToken+`","recoveryCode":"`+enabled.RecoveryCodes[0]+`"}`, ""),
+		http.StatusBadRequest, "登录已过期，请重新登录")
+
+	// 恢复码仅能使用一次
+	res, _ = login("1001")
+	if w, _ = second(res.PendingToken, "recoveryCode", strings.ToUpper(enabled.RecoveryCodes[0])); w.Code != http.StatusOK {
+		t.Fatalf("recovery code: %d %s", w.Code, w.Body.String())
+	}
+	res, _ = login("1001")
+	if w, _ = second(res.PendingToken, "recoveryCode", enabled.RecoveryCodes[0]); w.Code != http.StatusBadRequest {
+		t.Fatalf("reused recovery code: %d", w.Code)
+	}
+	if w, _ = second("invalid", "code", next); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid pending token: %d", w.Code)
+	}
+
+	// 撤销用户的会话时登录凭证一并失效，且不出现在会话列表中
+	var sessions int64
+	repo.DB.Model(&entity.Session{}).Where("user_type = ? AND user_id = ?", "pending", users[0].ID).Count(&sessions)
+	if sessions != 1 {
+		t.Fatalf("expect 1 pending login, got %d", sessions)
+	}
+	w = s.Do(http.MethodGet, "/api/session/search?userId="+fmt.Sprint(users[0].ID), "", s.AdminToken(entity.AdminRoleAdmin))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"pending"`) {
+		t.Fatalf("session search: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := repo.NewSessionRepository().RevokeUser("user", users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	next, _ = reuint.TotpCode(setup.Secret, step+2)
+	s.Expect(s.Do(http.MethodPost, "/api/login/totp", `{"pendingToken":"`+res.PendingToken+`","code":"`+next+`"}`, ""),
+		http.StatusBadRequest, "登录已过期，请重新登录")
+
+	// 策略要求对接者使用动态口令，未绑定的用户在登录时完成绑定
+	project := entity.Project{Name: "测试项目"}
+	if err := repo.DB.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DB.Create(&entity.ProjectMember{ProjectId: project.ID, UserId: users[1].ID, Role: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.NewTotpRepository().SetPolicy(&entity.TotpPolicy{Roles: []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+	res, token = login("1002")
+	if !res.TotpRequired || res.Enrolled || token != "" {
+		t.Fatalf("expect enrollment on login: %+v", res)
+	}
+	if w, _ = second(res.PendingToken, "code", "123456"); w.Code != http.StatusBadRequest {
+		t.Fatalf("second step before setup: %d", w.Code)
+	}
+	var loginSetup struct {
+		Secret       string `json:"secret"`
+		PendingToken string `json:"pendingToken"`
+	}
+	w = s.Do(http.MethodPost, "/api/login/totpSetup", `{"pendingToken":"`+res.PendingToken+`"}`, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &loginSetup); err != nil || loginSetup.Secret == "" || loginSetup.PendingToken == "" {
+		t.Fatalf("login setup: %d %s", w.Code, w.Body.String())
+	}
+	code, _ = reuint.TotpCode(loginSetup.Secret, reuint.TotpStep(time.Now()))
+	// 绑定后原登录凭证作废
+	if w, _ = second(res.PendingToken, "code", code); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "登录已过期") {
+		t.Fatalf("pending token before setup: %d %s", w.Code, w.Body.String())
+	}
+	setup.Secret = loginSetup.Secret
+	w, res = second(loginSetup.PendingToken, "code", code)
+	if w.Code != http.StatusOK || len(res.RecoveryCodes) != 10 {
+		t.Fatalf("enroll on login: %d %s", w.Code, w.Body.String())
+	}
+	// 策略要求使用时无法停用
+	next, _ = reuint.TotpCode(setup.Secret, reuint.TotpStep(time.Now())+1)
+	s.Expect(s.Do(http.MethodPost, "/api/totp/disable", `{"code":"`+next+`"}`, controllertest.Cookie(w)), http.StatusBadRequest, "")
+
+	// 动态口令错误计入登录失败次数，达到上限后锁定账号，正确的动态口令也无法登录
+	res, _ = login("1002")
+	for i := 0; i < 5; i++ {
+		s.Expect(s.Do(http.MethodPost, "/api/login/totp", `{"pendingToken":"`+res.PendingToken+`","code":"000000"}`, ""), http.StatusBadRequest, "动态口令错误")
+	}
+	s.Expect(s.Do(http.MethodPost, "/api/login/totp", `{"pendingToken":"`+res.PendingToken+`","code":"`+next+`"}`, ""), http.StatusBadRequest, "用户锁定")
+	var throttle entity.LoginThrottle
+	if err := repo.DB.First(&throttle, "kind = ? AND target = ?", entity.ThrottleKindUser, fmt.Sprint(users[1].ID)).Error; err != nil || throttle.LockedUntil == nil {
+		t.Fatalf("expect account locked: %+v %v", throttle, err)
+	}
+
+	// 重置后恢复为口令登录
+	if err := repo.NewTotpRepository().Reset(users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if res, token = login("1001"); res.TotpRequired || token == "" {
+		t.Fatalf("login after reset: %+v", res)
+	}
+}
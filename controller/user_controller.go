@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
-	"path/filepath"
-	"pdm/appconf/dir"
 	"pdm/controller/dto"
 	"pdm/controller/middle"
 	"pdm/logg/applog"
@@ -13,17 +11,21 @@ import (
 	"pdm/repo/entity"
 	"pdm/reuint"
 	"pdm/reuint/jwt"
+	"pdm/storage"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // UserController 用户控制器
 type UserController struct {
+	policy *reuint.PasswordPolicy // 用户口令策略
 }
 
 // NewUserController 创建用户控制器
-func NewUserController(router gin.IRouter) *UserController {
-	res := &UserController{}
+// policy: 用户口令策略
+func NewUserController(router gin.IRouter, policy *reuint.PasswordPolicy) *UserController {
+	res := &UserController{policy: policy}
 	r := router.Group("/user")
 	// 创建用户
 	r.POST("/create", Admin, res.create)
@@ -33,6 +35,8 @@ func NewUserController(router gin.IRouter) *UserController {
 	r.POST("/modifyPwd", User, res.modifyPwd)
 	// 重置口令
 	r.POST("/resetPwd", Admin, res.resetPwd)
+	// 口令策略
+	r.GET("/pwdPolicy", Authed, res.pwdPolicy)
 	// 更换头像
 	r.POST("/updateAvatar", User, res.updateAvatar)
 	// 删除用户
@@ -52,7 +56,7 @@ func NewUserController(router gin.IRouter) *UserController {
 @api {POST} /api/user/create 用户创建
 @apiDescription 创建用户，用户名不能重复。
 创建用户时要求输入工号，若输入姓名，则生成姓名的拼音缩写。
-创建时若未输入密码则生成默认密码 Gm123qwe
+创建时若未输入口令则生成满足口令策略的随机口令，初始口令仅在创建时返回一次，用户首次登录后需修改口令。
 @apiName UserCreate
 @apiGroup User
 
@@ -64,11 +68,13 @@ func NewUserController(router gin.IRouter) *UserController {
 @apiParam {String} [phone] 手机号。
 @apiParam {String} [email] 邮箱。
 @apiParam {String} [sn] 身份证号。
+@apiParam {String} [password] 初始口令，需满足口令策略，为空时随机生成。
 
 @apiSuccess {Integer} id 用户ID。
 @apiSuccess {String} openid 工号。
 @apiSuccess {String} name 用户姓名。
 @apiSuccess {String} createdAt 创建时间，格式为"YYYY-MM-DD HH:mm:ss"。
+@apiSuccess {String} password 初始口令。
 
 @apiParamExample {json} 请求示例
 {
@@ -86,7 +92,8 @@ HTTP/1.1 200 OK
     "id": 1,
 	"openid":"1001",
     "name": "张三",
-    "createdAt": "2020-08-24 16:26:16"
+    "createdAt": "2020-08-24 16:26:16",
+    "password": "Xk7#pQ2mWz9a"
 }
 
 @apiErrorExample 失败响应
@@ -97,7 +104,6 @@ HTTP/1.1 400 Bad Request
 
 // create 创建用户
 func (c *UserController) create(ctx *gin.Context) {
-	const defaultPassword = "Gm123qwe"
 	var info entity.User
 	err := ctx.BindJSON(&info)
 	applog.L(ctx, "创建用户", map[string]interface{}{
@@ -192,14 +198,28 @@ func (c *UserController) create(ctx *gin.Context) {
 		return
 	}
 
-	pwd, salt, err := reuint.GenPasswordSalt(defaultPassword)
+	// 初始口令，未指定时随机生成
+	password := info.Password.String()
+	if password == "" {
+		if password, err = c.policy.Generate(); err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+	} else if err = c.policy.Check(password, info.Openid, info.Username, info.Phone, info.Email); err != nil {
+		ErrIllegal(ctx, err.Error())
+		return
+	}
+	pwd, salt, err := reuint.GenPasswordSalt(password)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	// 密码和盐值
+	// 密码和盐值，首次登录后需修改口令
+	now := time.Now()
 	info.Password = entity.Pwd(pwd)
 	info.Salt = salt
+	info.MustChgPwd = 1
+	info.PwdChangedAt = &now
 	if err = repo.DB.Create(&info).Error; err != nil {
 		ErrSys(ctx, err)
 		return
@@ -207,6 +227,7 @@ func (c *UserController) create(ctx *gin.Context) {
 
 	reqInfo := dto.UserCreateDto{}
 	reqInfo.Transform(&info)
+	reqInfo.Password = password
 	ctx.JSON(200, reqInfo)
 }
 
@@ -299,7 +320,9 @@ func (c *UserController) search(ctx *gin.Context) {
 
 /**
 @api {POST} /api/user/modifyPwd 修改口令
-@apiDescription 用户修改口令。
+@apiDescription 用户修改口令，新口令需满足口令策略（见 口令策略），且不能与最近使用过的口令相同。
+需修改口令的用户修改口令后，当前登录token恢复正常，可以调用其他接口。
+目录用户的口令由目录服务管理，不能修改。
 @apiName UserModifyPwd
 @apiGroup User
 
@@ -307,13 +330,13 @@ func (c *UserController) search(ctx *gin.Context) {
 
 @apiParam {Integer} id 用户ID。
 @apiParam {String} oldPwd 原口令。
-@apiParam {String} newPwd 新口令，8字符以上。
+@apiParam {String} newPwd 新口令。
 
 @apiParamExample {json} 请求示例
 {
     "id": 1,
-    "oldPwd": "12345678",
-    "newPwd": "Gm123qwe"
+    "oldPwd": "Xk7#pQ2mWz9a",
+    "newPwd": "Zs#2024pass"
 }
 
 @apiSuccess {String} body 修改通过成功状态码200，否则返还错误码。
@@ -361,6 +384,10 @@ func (c *UserController) modifyPwd(ctx *gin.Context) {
 		ErrSys(ctx, err)
 		return
 	}
+	if reqInfo.Source == entity.UserSourceLDAP {
+		ErrIllegal(ctx, "口令由目录服务管理，请在目录服务中修改")
+		return
+	}
 
 	//旧口令正确性校验
 	if reuint.VerifyPasswordSalt(info.OldPwd.String(), reqInfo.Password.String(), reqInfo.Salt) == false {
@@ -368,49 +395,63 @@ func (c *UserController) modifyPwd(ctx *gin.Context) {
 		return
 	}
 
-	//新口令长度校验
-	if len(info.NewPwd.String()) < 8 {
-		ErrIllegal(ctx, "口令长度不少于8位")
+	// 新口令强度校验
+	if err = c.policy.Check(info.NewPwd.String(), reqInfo.Openid, reqInfo.Username, reqInfo.Phone, reqInfo.Email); err != nil {
+		ErrIllegal(ctx, err.Error())
 		return
 	}
-
-	pwd, salt, err := reuint.GenPasswordSalt(info.NewPwd.String())
+	used, err := repo.UserRepo.UsedPassword(reqInfo, info.NewPwd.String(), c.policy.History)
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	reqInfo.Password = entity.Pwd(pwd)
-	reqInfo.Salt = salt
+	if used {
+		ErrIllegal(ctx, fmt.Sprintf("新口令不能与最近使用过的%d个口令相同", c.policy.History))
+		return
+	}
 
-	err = repo.DB.Save(reqInfo).Error
-	if err != nil {
+	if err = repo.UserRepo.ChangePassword(reqInfo, info.NewPwd.String(), false, c.policy.History); err != nil {
 		ErrSys(ctx, err)
 		return
 	}
+	// 解除当前token的修改口令限制
+	if claims.MustChgPwd {
+		claims.MustChgPwd = false
+		token, err := tokenManager.GenToken(claims)
+		if err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+		tokenManager.SetCookie(ctx, token)
+	}
 }
 
 /**
 @api {POST} /api/user/resetPwd 重置口令
-@apiDescription 重置用户口令
+@apiDescription 重置用户口令，重置后撤销该用户的所有会话与个人访问令牌，用户需使用新口令重新登录，登录后需修改口令。
+未指定新口令时生成满足口令策略的随机口令。目录用户的口令由目录服务管理，不能重置。
 @apiName UserResetPwd
 @apiGroup User
 
 @apiPermission 管理员
 
 @apiParam {Integer} id 用户ID。
-@apiParam {String} newPwd 新口令，8字符以上。
+@apiParam {String} [newPwd] 新口令，需满足口令策略，为空时随机生成。
 
 @apiParamExample {json} 请求示例
 {
-    "id": 1,
-    "newPwd": "Gm123qwe"
+    "id": 1
 }
 
-@apiSuccess {String} body 修改通过成功状态码200，否则返还错误码。
+@apiSuccess {String} password 重置后的口令。
 
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
 
+{
+    "password": "Xk7#pQ2mWz9a"
+}
+
 @apiErrorExample 失败响应
 HTTP/1.1 500
 
@@ -430,11 +471,6 @@ func (c *UserController) resetPwd(ctx *gin.Context) {
 		"userId": info.ID,
 	})
 
-	if len(info.NewPwd) == 0 {
-		ErrIllegal(ctx, "请输入口令")
-		return
-	}
-
 	//数据库搜索用户
 	reqInfo := &entity.User{}
 	err := repo.DB.First(reqInfo, "id = ? AND is_delete = 0", info.ID).Error
@@ -446,27 +482,84 @@ func (c *UserController) resetPwd(ctx *gin.Context) {
 		ErrSys(ctx, err)
 		return
 	}
-
-	//新口令长度校验
-	if len(info.NewPwd.String()) < 8 {
-		ErrIllegal(ctx, "口令长度不少于8位")
+	if reqInfo.Source == entity.UserSourceLDAP {
+		ErrIllegal(ctx, "口令由目录服务管理，请在目录服务中重置")
 		return
+	}
 
+	// 新口令，未指定时随机生成
+	password := info.NewPwd.String()
+	if password == "" {
+		if password, err = c.policy.Generate(); err != nil {
+			ErrSys(ctx, err)
+			return
+		}
+	} else if err = c.policy.Check(password, reqInfo.Openid, reqInfo.Username, reqInfo.Phone, reqInfo.Email); err != nil {
+		ErrIllegal(ctx, err.Error())
+		return
 	}
 
-	pwd, salt, err := reuint.GenPasswordSalt(info.NewPwd.String())
-	if err != nil {
+	// 重置后用户登录需修改口令
+	if err = repo.UserRepo.ChangePassword(reqInfo, password, true, c.policy.History); err != nil {
 		ErrSys(ctx, err)
 		return
-
 	}
-	reqInfo.Password = entity.Pwd(pwd)
-	reqInfo.Salt = salt
-
-	if err = repo.DB.Save(reqInfo).Error; err != nil {
+	// 口令重置后撤销该用户的所有会话与个人访问令牌
+	if _, err = repo.NewSessionRepository().RevokeUser(UserTypeUser, reqInfo.ID); err != nil {
 		ErrSys(ctx, err)
 		return
 	}
+	if err = repo.NewAccessTokenRepository().RevokeUser(reqInfo.ID); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	ctx.JSON(200, gin.H{"password": password})
+}
+
+/**
+@api {GET} /api/user/pwdPolicy 口令策略
+@apiDescription 获取用户口令策略，用于修改口令时提示用户。
+口令还不能包含常见弱口令以及工号、用户名、手机号、邮箱等个人信息。
+需修改口令的用户同样可以调用。
+@apiName UserPwdPolicy
+@apiGroup User
+
+@apiPermission 管理员,用户,审计员
+
+@apiParamExample 请求示例
+GET /api/user/pwdPolicy
+
+@apiSuccess {Integer} minLength 口令最小长度。
+@apiSuccess {Integer} minClasses 至少包含的字符类别数，类别包括大写字母、小写字母、数字、特殊字符。
+@apiSuccess {Integer} maxAge 口令有效期（单位：天），0表示不过期。
+@apiSuccess {Integer} history 新口令不能与最近使用过的几个口令相同，0表示不限制。
+
+@apiSuccessExample 成功响应
+HTTP/1.1 200 OK
+
+{
+    "minLength": 8,
+    "minClasses": 3,
+    "maxAge": 90,
+    "history": 5
+}
+*/
+
+// pwdPolicy 口令策略
+func (c *UserController) pwdPolicy(ctx *gin.Context) {
+	res := dto.PasswordPolicyDto{
+		MinLength:  c.policy.MinLength,
+		MinClasses: c.policy.MinClasses,
+		MaxAge:     int(c.policy.MaxAge / (24 * time.Hour)),
+		History:    c.policy.History,
+	}
+	if res.MaxAge < 0 {
+		res.MaxAge = 0
+	}
+	if res.History < 0 {
+		res.History = 0
+	}
+	ctx.JSON(200, res)
 }
 
 /**
@@ -536,14 +629,13 @@ func (c *UserController) updateAvatar(ctx *gin.Context) {
 
 	avatarName := fmt.Sprintf("user-%d", id)
 	user.Avatar = avatarName
-	avatarPath := filepath.Join(dir.AvatarDir, avatarName)
 
 	// 更新头像字段
 	if err = repo.DB.Save(&user).Error; err != nil {
 		ErrSys(ctx, err)
 		return
 	}
-	if err = ctx.SaveUploadedFile(file, avatarPath); err != nil {
+	if err = storage.SaveUploadedFile(storage.Avatar, file, avatarName); err != nil {
 		ErrSys(ctx, err)
 		return
 	}
@@ -551,7 +643,8 @@ func (c *UserController) updateAvatar(ctx *gin.Context) {
 
 /**
 @api {DELETE} /api/user/delete 删除用户
-@apiDescription 删除用户，如果存在多个用户，其中某个用户删除失败，依然返回200状态码。
+@apiDescription 删除用户，同时撤销被删除用户的所有会话与个人访问令牌，如果存在多个用户，其中某个用户删除失败，依然返回200状态码。
+项目负责人不可删除，需先通过 POST /api/project/member/transfer 移交其负责的项目，否则返回400且不删除任何用户。
 该接口仅在数据库操作异常时返回500系统错误的状态码，其他情况均返回200。
 @apiName UserDelete
 @apiGroup User
@@ -566,10 +659,15 @@ DELETE /api/user/delete?ids=12,24
 @apiSuccessExample 成功响应
 HTTP/1.1 200 OK
 
-@apiErrorExample 失败响应
+@apiErrorExample 失败响应1
 HTTP/1.1 500
 
 系统内部错误
+
+@apiErrorExample 失败响应2
+HTTP/1.1 400
+
+用户为项目 pdm 的负责人，请先移交项目负责人
 */
 
 // delete 删除用户
@@ -583,12 +681,36 @@ func (c *UserController) delete(ctx *gin.Context) {
 		"ids": ids,
 	})
 
+	// 项目负责人不可删除，需先移交项目负责人
+	projects, err := repo.ProjectMemberRepo.LeadingProjects(idArray...)
+	if err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if len(projects) > 0 {
+		names := make([]string, 0, len(projects))
+		for _, p := range projects {
+			names = append(names, p.Name)
+		}
+		ErrIllegal(ctx, fmt.Sprintf("用户为项目 %s 的负责人，请先移交项目负责人", strings.Join(names, "、")))
+		return
+	}
+
 	// 将is_delete字段赋值为1
-	err := repo.DB.Model(&entity.User{}).Where("id in ?", idArray).Update("is_delete", 1).Error
+	err = repo.DB.Model(&entity.User{}).Where("id in ?", idArray).Update("is_delete", 1).Error
 	if err != nil {
 		ErrSys(ctx, err)
 		return
 	}
+	// 撤销被删除用户的所有会话与个人访问令牌
+	if _, err = repo.NewSessionRepository().RevokeUser(UserTypeUser, idArray...); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
+	if err = repo.NewAccessTokenRepository().RevokeUser(idArray...); err != nil {
+		ErrSys(ctx, err)
+		return
+	}
 
 }
 
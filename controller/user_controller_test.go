@@ -0,0 +1,65 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pdm/controller/controllertest"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	s := controllertest.NewServer(t)
+	user := entity.User{Openid: "1001", Name: "张三", Username: "zhangsan", MustChgPwd: 1}
+	s.CreateUser(&user, "Init#Pass1")
+	login := func(password string) (string, bool) {
+		w := s.Do(http.MethodPost, "/api/login", `{"username":"1001","password":"`+password+`"}`, "")
+		var res struct {
+			MustChgPwd bool `json:"mustChgPwd"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || controllertest.Cookie(w) == "" {
+			t.Fatalf("login: %d %s", w.Code, w.Body.String())
+		}
+		return controllertest.Cookie(w), res.MustChgPwd
+	}
+	modify := func(token, oldPwd, newPwd string) *httptest.ResponseRecorder {
+		return s.Do(http.MethodPost, "/api/user/modifyPwd", fmt.Sprintf(`{"id":%d,"oldPwd":"%s","newPwd":"%s"}`, user.ID, oldPwd, newPwd), token)
+	}
+
+	// 首次登录需修改口令，token仅能用于修改口令
+	token, must := login("Init#Pass1")
+	if !must {
+		t.Fatal("expect must change password on first login")
+	}
+	s.Expect(s.Do(http.MethodGet, "/api/project/search", "", token), http.StatusForbidden, "")
+	s.Expect(s.Do(http.MethodGet, "/api/user/pwdPolicy", "", token), http.StatusOK, "")
+	for _, weak := range []string{"short1!", "alllowercase", "Qwerty#2024", "Ab#1001xyz", "Init#Pass1"} {
+		if w := modify(token, "Init#Pass1", weak); w.Code != http.StatusBadRequest {
+			t.Fatalf("weak password %s: %d", weak, w.Code)
+		}
+	}
+	w := modify(token, "Init#Pass1", "Second#Pass2")
+	if w.Code != http.StatusOK || controllertest.Cookie(w) == "" {
+		t.Fatalf("modify: %d %s", w.Code, w.Body.String())
+	}
+	s.Expect(s.Do(http.MethodGet, "/api/project/search", "", controllertest.Cookie(w)), http.StatusOK, "")
+	if _, must = login("Second#Pass2"); must {
+		t.Fatal("expect no restriction after password changed")
+	}
+
+	// 最近使用过的口令不能再次使用
+	token, _ = login("Second#Pass2")
+	s.Expect(modify(token, "Second#Pass2", "Init#Pass1"), http.StatusBadRequest, "")
+
+	// 口令过期后登录需修改口令
+	if err := repo.DB.Model(&entity.User{}).Where("id = ?", user.ID).Update("pwd_changed_at", time.Now().AddDate(0, 0, -91)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, must = login("Second#Pass2"); !must {
+		t.Fatal("expect must change expired password")
+	}
+}
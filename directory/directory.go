@@ -0,0 +1,351 @@
+// Package directory 目录服务（LDAP/Active Directory）认证与用户同步
+//
+// 登录时使用服务账号按登录名查找用户，再以用户DN与口令绑定验证，验证通过后按目录属性创建或更新用户，
+// 并按组映射加入项目。定时同步更新目录中所有用户，目录中已不存在的用户被删除（软删除）。
+package directory
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"net"
+	"net/url"
+	"os"
+	"pdm/appconf"
+	"pdm/appconf/dir"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound 目录中不存在该用户
+	ErrNotFound = errors.New("directory: 目录中不存在该用户")
+	// ErrInvalidCredentials 口令错误或目录账号已停用
+	ErrInvalidCredentials = errors.New("directory: 口令错误")
+	// ErrDeleted 用户已在系统中删除，需管理员恢复后才能登录
+	ErrDeleted = errors.New("directory: 用户已删除")
+	// ErrBusy 已有同步正在进行
+	ErrBusy = errors.New("directory: 同步正在进行中，请稍后再试")
+)
+
+// Directory 目录服务
+type Directory struct {
+	cfg       appconf.LDAP
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex    // 同一时间只允许一个同步
+	stop chan struct{} // 停止定时同步
+	done chan struct{} // 定时同步精灵退出信号
+}
+
+// New 创建目录服务
+func New(cfg *appconf.LDAP) (*Directory, error) {
+	d := &Directory{
+		cfg:       *cfg,
+		tlsConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(dir.Abs(cfg.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("读取目录服务CA证书失败，%s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("目录服务CA证书 %s 格式错误", cfg.CAFile)
+		}
+		d.tlsConfig.RootCAs = pool
+	}
+	return d, nil
+}
+
+// dial 连接目录服务，配置了服务账号时以服务账号绑定
+func (d *Directory) dial(ctx context.Context) (*ldap.Conn, error) {
+	u, err := url.Parse(d.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("目录服务地址 %q 格式错误", d.cfg.URL)
+	}
+	tlsConfig := d.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	timeout := time.Duration(d.cfg.Timeout) * time.Second
+	dialer := &net.Dialer{Timeout: timeout}
+	var c net.Conn
+	switch u.Scheme {
+	case "ldap":
+		c, err = dialer.DialContext(ctx, "tcp", hostPort(u, "389"))
+	case "ldaps":
+		c, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", hostPort(u, "636"))
+	default:
+		return nil, fmt.Errorf("目录服务地址 %q 不支持的协议", d.cfg.URL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接目录服务失败，%w", err)
+	}
+	conn := ldap.NewConn(c, u.Scheme == "ldaps")
+	conn.Start()
+	conn.SetTimeout(timeout)
+	if d.cfg.StartTLS && u.Scheme == "ldap" {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("连接目录服务失败，%w", err)
+		}
+	}
+	if d.cfg.BindDN != "" {
+		if err = conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("目录服务账号绑定失败，%w", err)
+		}
+	}
+	return conn, nil
+}
+
+// hostPort 目录服务地址的主机与端口，未指定端口时使用协议的缺省端口
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// attributes 查找用户时返回的属性
+func (d *Directory) attributes() []string {
+	a := d.cfg.Attributes
+	res := []string{a.Openid, a.Name}
+	for _, name := range []string{a.Phone, a.Email, a.Group} {
+		if name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// Login 使用目录口令登录，返还创建或更新后的用户
+// 目录中不存在该用户返还 ErrNotFound，口令错误返还 ErrInvalidCredentials，用户已在系统中删除返还 ErrDeleted。
+func (d *Directory) Login(ctx context.Context, username, password string) (*entity.User, error) {
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	res, err := conn.Search(ldap.NewSearchRequest(d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		strings.ReplaceAll(d.cfg.UserFilter, "{username}", ldap.EscapeFilter(username)), d.attributes(), nil))
+	var entries []*ldap.Entry
+	if res != nil {
+		entries = res.Entries
+	}
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || len(entries) > 1 {
+		// 登录名匹配多个用户时无法确定身份，需调整 userFilter
+		zap.L().Warn("目录中登录名匹配多个用户", zap.String("username", username))
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("目录查找用户失败，%w", err)
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	entry := entries[0]
+	// 以服务账号查找用户所属组，之后连接的身份变为用户
+	groups, err := d.groups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Bind(entry.DN, password); err != nil {
+		// 49 口令错误或账号停用、过期（AD在诊断信息中区分），53 账号被禁止登录
+		if ldap.IsErrorAnyOf(err, ldap.LDAPResultInvalidCredentials, ldap.LDAPResultUnwillingToPerform) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("目录验证口令失败，%w", err)
+	}
+	usr, _, err := d.provision(entry, groups)
+	return usr, err
+}
+
+// groups 用户所属组的DN
+func (d *Directory) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	if len(d.cfg.Groups) == 0 {
+		return nil, nil
+	}
+	if d.cfg.GroupFilter == "" {
+		return entry.GetEqualFoldAttributeValues(d.cfg.Attributes.Group), nil
+	}
+	list, err := conn.SearchWithPaging(ldap.NewSearchRequest(d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		strings.ReplaceAll(d.cfg.GroupFilter, "{dn}", ldap.EscapeFilter(entry.DN)),
+		[]string{"1.1"}, // 仅返回DN（RFC 4511 4.5.1.8）
+		nil), 500)
+	if err != nil {
+		return nil, fmt.Errorf("目录查找用户所属组失败，%w", err)
+	}
+	res := make([]string, 0, len(list.Entries))
+	for _, g := range list.Entries {
+		res = append(res, g.DN)
+	}
+	return res, nil
+}
+
+// provision 按目录属性创建或更新用户，并按组映射加入项目
+// return: 用户, 是否有变更, 错误
+func (d *Directory) provision(entry *ldap.Entry, groups []string) (*entity.User, bool, error) {
+	a := d.cfg.Attributes
+	openid := strings.TrimSpace(entry.GetEqualFoldAttributeValue(a.Openid))
+	if openid == "" {
+		return nil, false, fmt.Errorf("目录用户 %s 缺少工号属性 %s", entry.DN, a.Openid)
+	}
+	name := strings.TrimSpace(entry.GetEqualFoldAttributeValue(a.Name))
+	if name == "" {
+		name = openid
+	}
+
+	var usr *entity.User
+	changed := false
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		var users []entity.User
+		if err := tx.Where("openid = ?", openid).Order("is_delete").Limit(1).Find(&users).Error; err != nil {
+			return err
+		}
+		if len(users) > 0 && users[0].IsDelete != 0 {
+			return ErrDeleted
+		}
+		updates := map[string]interface{}{}
+		if len(users) == 0 {
+			usr = &entity.User{Openid: openid, Username: openid, Source: entity.UserSourceLDAP}
+		} else {
+			usr = &users[0]
+			if usr.Source != entity.UserSourceLDAP {
+				updates["source"] = entity.UserSourceLDAP
+			}
+		}
+		if usr.Name != name {
+			pinyin, err := reuint.PinyinConversion(name)
+			if err != nil {
+				return err
+			}
+			updates["name"], updates["name_pinyin"] = name, pinyin
+		}
+		// 格式错误或已被其他用户使用的手机号与邮箱不保存
+		for _, item := range []struct {
+			column, value, current string
+			valid                  func(string) bool
+		}{
+			{"phone", entry.GetEqualFoldAttributeValue(a.Phone), usr.Phone, reuint.PhoneValidate},
+			{"email", entry.GetEqualFoldAttributeValue(a.Email), usr.Email, reuint.EmailValidate},
+		} {
+			if item.value == "" || item.value == item.current || !item.valid(item.value) {
+				continue
+			}
+			var count int64
+			if err := tx.Model(&entity.User{}).Where(item.column+" = ? AND id <> ? AND is_delete = 0", item.value, usr.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				updates[item.column] = item.value
+			}
+		}
+
+		if usr.ID == 0 {
+			var count int64
+			if err := tx.Model(&entity.User{}).Where("username = ?", openid).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("目录用户 %s 的用户名 %s 已被其他用户使用", entry.DN, openid)
+			}
+			// 目录用户使用目录口令登录，系统口令为随机值
+			buf := make([]byte, 32)
+			if _, err := rand.Read(buf); err != nil {
+				return err
+			}
+			pwd, salt, err := reuint.GenPasswordSalt(hex.EncodeToString(buf))
+			if err != nil {
+				return err
+			}
+			usr.Password, usr.Salt = entity.Pwd(pwd), salt
+			usr.Name = name
+			usr.NamePinyin, _ = updates["name_pinyin"].(string)
+			usr.Phone, _ = updates["phone"].(string)
+			usr.Email, _ = updates["email"].(string)
+			changed = true
+			if err = tx.Create(usr).Error; err != nil {
+				return err
+			}
+		} else if len(updates) > 0 {
+			changed = true
+			if err := tx.Model(usr).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		joined, err := d.join(tx, usr.ID, groups)
+		changed = changed || joined
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return usr, changed, nil
+}
+
+// join 按组映射加入项目或调整角色，项目负责人与管理员不受影响
+// return: 是否有变更, 错误
+func (d *Directory) join(tx *gorm.DB, userId int, groups []string) (bool, error) {
+	changed := false
+	done := map[int]bool{}
+	for _, g := range d.cfg.Groups {
+		if done[g.ProjectId] || !containsFold(groups, g.DN) {
+			continue
+		}
+		done[g.ProjectId] = true
+		var count int64
+		if err := tx.Model(&entity.Project{}).Where("id = ? AND is_delete = 0", g.ProjectId).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count == 0 {
+			zap.L().Warn("目录组映射的项目不存在", zap.String("group", g.DN), zap.Int("projectId", g.ProjectId))
+			continue
+		}
+		var members []entity.ProjectMember
+		if err := tx.Where("project_id = ? AND user_id = ?", g.ProjectId, userId).Limit(1).Find(&members).Error; err != nil {
+			return false, err
+		}
+		if len(members) == 0 {
+			changed = true
+			if err := tx.Create(&entity.ProjectMember{ProjectId: g.ProjectId, UserId: userId, Role: g.Role}).Error; err != nil {
+				return false, err
+			}
+			continue
+		}
+		m := members[0]
+		if m.Role != g.Role && (m.Role == entity.RoleDeveloper || m.Role == entity.RoleInterConnector) {
+			changed = true
+			if err := tx.Model(&m).Update("role", g.Role).Error; err != nil {
+				return false, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,434 @@
+// Package ldaptest 用于测试的进程内LDAP目录服务
+//
+// 支持简单绑定、搜索（含分页控制与返回数量上限）、StartTLS 与解绑，未绑定的连接不能搜索。
+// 过滤器仅支持与、或、非、相等、子串与存在匹配，客户端与过滤器编码使用 go-ldap。
+// 条目与口令保存在内存中，可在测试过程中增删。
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 进程内目录服务
+type Server struct {
+	URL         string            // 服务地址，ldap://127.0.0.1:端口 或 ldaps://127.0.0.1:端口
+	Certificate *x509.Certificate // 服务器证书，用于客户端校验
+
+	SizeLimit int // 不分页时单次搜索最多返回的条目数，0 表示不限制，用于模拟AD的1000条上限
+
+	ln        net.Listener
+	tlsConfig *tls.Config
+	mu        sync.Mutex
+	entries   []*ldap.Entry
+	passwords map[string]string // 口令，键为小写的DN
+	binds     int               // 绑定成功次数
+	conns     sync.WaitGroup
+	closed    chan struct{}
+}
+
+// NewServer 启动 ldap:// 目录服务，支持 StartTLS
+func NewServer() *Server {
+	return start(false)
+}
+
+// NewTLSServer 启动 ldaps:// 目录服务
+func NewTLSServer() *Server {
+	return start(true)
+}
+
+func start(ldaps bool) *Server {
+	s := &Server{passwords: map[string]string{}, closed: make(chan struct{})}
+	s.tlsConfig = s.generateCert()
+	var err error
+	if ldaps {
+		s.ln, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+		s.URL = "ldaps://" + s.ln.Addr().String()
+	} else {
+		s.ln, err = net.Listen("tcp", "127.0.0.1:0")
+		s.URL = "ldap://" + s.ln.Addr().String()
+	}
+	if err != nil {
+		panic(err)
+	}
+	go s.serve()
+	return s
+}
+
+// generateCert 生成 127.0.0.1 的自签名证书
+func (s *Server) generateCert() *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	if s.Certificate, err = x509.ParseCertificate(der); err != nil {
+		panic(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// CertPool 包含服务器证书的证书池
+func (s *Server) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Certificate)
+	return pool
+}
+
+// Add 添加或替换条目
+// password: 绑定口令，为空表示不能绑定
+func (s *Server) Add(dn, password string, attrs map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(dn)
+	s.entries = append(s.entries, ldap.NewEntry(dn, attrs))
+	if password != "" {
+		s.passwords[strings.ToLower(dn)] = password
+	}
+}
+
+// Remove 删除条目
+func (s *Server) Remove(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(dn)
+}
+
+func (s *Server) remove(dn string) {
+	for i, e := range s.entries {
+		if strings.EqualFold(e.DN, dn) {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	delete(s.passwords, strings.ToLower(dn))
+}
+
+// Binds 绑定成功次数
+func (s *Server) Binds() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+// Close 停止服务
+func (s *Server) Close() {
+	close(s.closed)
+	_ = s.ln.Close()
+	s.conns.Wait()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// session 连接状态
+type session struct {
+	conn  net.Conn
+	bound bool
+}
+
+func (s *Server) handle(conn net.Conn) {
+	ss := &session{conn: conn}
+	defer func() { _ = ss.conn.Close() }()
+	go func() {
+		<-s.closed
+		_ = conn.Close()
+	}()
+	for {
+		msg, err := ber.ReadPacket(ss.conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		id, _ := msg.Children[0].Value.(int64)
+		op := msg.Children[1]
+		if op.ClassType != ber.ClassApplication {
+			return
+		}
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			s.bind(ss, id, op)
+		case ldap.ApplicationSearchRequest:
+			var controls *ber.Packet
+			if len(msg.Children) > 2 {
+				controls = msg.Children[2]
+			}
+			s.search(ss, id, op, controls)
+		case ldap.ApplicationExtendedRequest:
+			if str(op.Children[0]) != oidStartTLS {
+				ss.write(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "不支持的操作"), nil)
+				continue
+			}
+			ss.write(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, ""), nil)
+			tc := tls.Server(ss.conn, s.tlsConfig)
+			if tc.Handshake() != nil {
+				return
+			}
+			ss.conn = tc
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			ss.write(id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "不支持的操作"), nil)
+		}
+	}
+}
+
+// oidStartTLS StartTLS 扩展操作（RFC 4511 4.14.1）
+const oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+func (ss *session) write(id int64, op, controls *ber.Packet) {
+	msg := ber.NewSequence("")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	msg.AppendChild(op)
+	if controls != nil {
+		msg.AppendChild(controls)
+	}
+	_, _ = ss.conn.Write(msg.Bytes())
+}
+
+// str 字符串类型的值，上下文类型的值仅保存在 Data 中
+func str(p *ber.Packet) string {
+	return p.Data.String()
+}
+
+// integer 整数与枚举类型的值
+func integer(p *ber.Packet) int64 {
+	v, _ := ber.ParseInt64(p.Data.Bytes())
+	return v
+}
+
+func result(tag ber.Tag, code uint16, message string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, ""))
+	return p
+}
+
+func (s *Server) bind(ss *session, id int64, op *ber.Packet) {
+	dn, password := str(op.Children[1]), str(op.Children[2])
+	s.mu.Lock()
+	expect, ok := s.passwords[strings.ToLower(dn)]
+	ok = ok && password != "" && password == expect
+	if ok {
+		s.binds++
+	}
+	s.mu.Unlock()
+	ss.bound = ok
+	if !ok {
+		ss.write(id, result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 52e"), nil)
+		return
+	}
+	ss.write(id, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, ""), nil)
+}
+
+func (s *Server) search(ss *session, id int64, op, controls *ber.Packet) {
+	if !ss.bound {
+		ss.write(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultOperationsError, "需要先绑定"), nil)
+		return
+	}
+	base := strings.ToLower(str(op.Children[0]))
+	scope := integer(op.Children[1])
+	sizeLimit := int(integer(op.Children[3]))
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, str(a))
+	}
+
+	s.mu.Lock()
+	var matched []*ldap.Entry
+	for _, e := range s.entries {
+		if inScope(strings.ToLower(e.DN), base, scope) && match(filter, e) {
+			matched = append(matched, e)
+		}
+	}
+	limit := s.SizeLimit
+	s.mu.Unlock()
+
+	// 分页控制，cookie 为下一页的起始位置
+	var paging *ldap.ControlPaging
+	if controls != nil {
+		for _, child := range controls.Children {
+			if c, err := ldap.DecodeControl(child); err == nil {
+				if p, ok := c.(*ldap.ControlPaging); ok {
+					paging = p
+				}
+			}
+		}
+	}
+	offset := 0
+	if paging != nil {
+		offset, _ = strconv.Atoi(string(paging.Cookie))
+		if paging.PagingSize == 0 {
+			// 分页大小为0表示放弃分页
+			ss.write(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""), nil)
+			return
+		}
+	}
+	code := uint16(ldap.LDAPResultSuccess)
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	page := matched[offset:]
+	if paging != nil && len(page) > int(paging.PagingSize) {
+		page = page[:paging.PagingSize]
+	}
+	if sizeLimit > 0 && len(page) > sizeLimit {
+		page, code = page[:sizeLimit], ldap.LDAPResultSizeLimitExceeded
+	}
+	if paging == nil && limit > 0 && len(page) > limit {
+		page, code = page[:limit], ldap.LDAPResultSizeLimitExceeded
+	}
+	for _, e := range page {
+		ss.write(id, entryPacket(e, attrs), nil)
+	}
+	var resControls *ber.Packet
+	if paging != nil {
+		cookie := ""
+		if next := offset + len(page); next < len(matched) && code == ldap.LDAPResultSuccess {
+			cookie = strconv.Itoa(next)
+		}
+		resControls = ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "")
+		resControls.AppendChild((&ldap.ControlPaging{PagingSize: uint32(len(matched)), Cookie: []byte(cookie)}).Encode())
+	}
+	ss.write(id, result(ldap.ApplicationSearchResultDone, code, ""), resControls)
+}
+
+// inScope 判断条目是否在搜索范围内，dn 与 base 均为小写
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		i := strings.IndexByte(dn, ',')
+		return i > 0 && dn[i+1:] == base
+	}
+	return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+// match 判断条目是否匹配过滤器，不支持的过滤器不匹配
+func match(f *ber.Packet, e *ldap.Entry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !match(c, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if match(c, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !match(f.Children[0], e)
+	case ldap.FilterPresent:
+		return len(e.GetEqualFoldAttributeValues(str(f))) > 0
+	case ldap.FilterEqualityMatch:
+		for _, v := range e.GetEqualFoldAttributeValues(str(f.Children[0])) {
+			if strings.EqualFold(v, str(f.Children[1])) {
+				return true
+			}
+		}
+	case ldap.FilterSubstrings:
+		for _, v := range e.GetEqualFoldAttributeValues(str(f.Children[0])) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSubstrings 按顺序匹配子串过滤器的开头、中间与结尾部分，v 为小写
+func matchSubstrings(v string, parts []*ber.Packet) bool {
+	for _, p := range parts {
+		sub := strings.ToLower(str(p))
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			v = v[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, sub)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			return strings.HasSuffix(v, sub)
+		}
+	}
+	return true
+}
+
+func entryPacket(e *ldap.Entry, attrs []string) *ber.Packet {
+	list := ber.NewSequence("")
+	for _, a := range e.Attributes {
+		if len(attrs) > 0 && !contains(attrs, a.Name) {
+			continue
+		}
+		attr := ber.NewSequence("")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a.Name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range a.Values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, ""))
+	p.AppendChild(list)
+	return p
+}
+
+func contains(list []string, name string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, name) || item == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package ldaptest_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"pdm/directory/ldaptest"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	srv := ldaptest.NewServer()
+	defer srv.Close()
+	srv.Add("cn=admin,dc=example,dc=com", "admin", map[string][]string{"cn": {"admin"}})
+	for i := 0; i < 25; i++ {
+		srv.Add(fmt.Sprintf("uid=u%02d,ou=people,dc=example,dc=com", i), "pwd", map[string][]string{
+			"objectClass": {"person"}, "uid": {fmt.Sprintf("u%02d", i)}, "cn": {fmt.Sprintf("用户%d", i)}, "mail": {"x@example.com"},
+		})
+	}
+	srv.SizeLimit = 10
+
+	for _, startTLS := range []bool{false, true} {
+		conn, err := ldap.DialURL(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if startTLS {
+			if err = conn.StartTLS(&tls.Config{RootCAs: srv.CertPool(), ServerName: "127.0.0.1"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		req := ldap.NewSearchRequest("ou=people,dc=example,dc=com", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			"(objectClass=person)", []string{"uid", "cn"}, nil)
+		if _, err = conn.Search(req); !ldap.IsErrorWithCode(err, ldap.LDAPResultOperationsError) {
+			t.Fatalf("expect bind required, got %v", err)
+		}
+		if err = conn.Bind("cn=admin,dc=example,dc=com", "wrong"); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			t.Fatalf("expect invalid credentials, got %v", err)
+		}
+		if err = conn.Bind("cn=admin,dc=example,dc=com", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		// 超过目录服务返回上限时需要分页
+		if _, err = conn.Search(req); !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			t.Fatalf("expect size limit exceeded, got %v", err)
+		}
+		res, err := conn.SearchWithPaging(req, 7)
+		if err != nil || len(res.Entries) != 25 {
+			t.Fatalf("paged search: %v %v", res, err)
+		}
+		e := res.Entries[3]
+		if e.GetEqualFoldAttributeValue("UID") != "u03" || e.GetAttributeValue("cn") != "用户3" || e.GetAttributeValue("mail") != "" {
+			t.Fatalf("unexpected entry: %+v", e)
+		}
+		// 转义后的用户输入不能改变过滤器结构
+		for filter, expect := range map[string]int{
+			"(&(objectClass=person)(uid=" + ldap.EscapeFilter("u1*") + "))": 0,
+			"(&(objectClass=person)(uid=u1*))":                              10,
+			"(&(objectClass=person)(|(uid=u01)(cn=*2*))(!(uid=u22)))":       7,
+		} {
+			req = ldap.NewSearchRequest("dc=example,dc=com", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, filter, nil, nil)
+			if res, err = conn.SearchWithPaging(req, 7); err != nil || len(res.Entries) != expect {
+				t.Fatalf("%s: %v %v", filter, res, err)
+			}
+		}
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,198 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+	"pdm/appconf"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"strings"
+	"time"
+)
+
+// syncPageSize 同步时分页获取目录用户的分页大小，小于AD缺省的单次返回上限1000
+const syncPageSize = 500
+
+// SyncResult 同步结果
+type SyncResult struct {
+	Total   int      `json:"total"`   // 目录中的用户数
+	Created int      `json:"created"` // 新创建的用户数
+	Updated int      `json:"updated"` // 信息或项目角色有变更的用户数
+	Deleted []string `json:"deleted"` // 目录中已不存在而被删除的用户工号
+	Failed  []string `json:"failed"`  // 同步失败的目录用户及原因
+}
+
+// Sync 同步目录中的所有用户
+// 创建或更新目录中的用户，删除（软删除）目录中已不存在的目录用户并注销其会话与访问令牌。
+// 目录中未找到任何用户时视为配置或目录服务异常，不删除用户。
+func (d *Directory) Sync(ctx context.Context) (*SyncResult, error) {
+	if !d.mu.TryLock() {
+		return nil, ErrBusy
+	}
+	defer d.mu.Unlock()
+
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	list, err := conn.SearchWithPaging(ldap.NewSearchRequest(d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		d.cfg.SyncFilter, d.attributes(), nil), syncPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("目录查找用户失败，%w", err)
+	}
+	entries := list.Entries
+	if len(entries) == 0 {
+		return nil, errors.New("目录中未找到用户，为防止误删用户未执行同步，请检查 ldap.baseDn 与 ldap.syncFilter")
+	}
+
+	res := &SyncResult{Total: len(entries), Deleted: []string{}, Failed: []string{}}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		// 工号为空的条目无法对应用户，不作为目录中存在的用户，也不会因此保留同工号的用户
+		if openid := strings.TrimSpace(entry.GetEqualFoldAttributeValue(d.cfg.Attributes.Openid)); openid != "" {
+			present[openid] = true
+		}
+		groups, err := d.groups(conn, entry)
+		if err != nil {
+			return nil, err
+		}
+		var users []entity.User
+		if err = repo.DB.Select("id").Where("openid = ?", entry.GetEqualFoldAttributeValue(d.cfg.Attributes.Openid)).Limit(1).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		_, changed, err := d.provision(entry, groups)
+		switch {
+		case err == ErrDeleted:
+			// 系统中已删除的用户不恢复
+		case err != nil:
+			res.Failed = append(res.Failed, fmt.Sprintf("%s: %s", entry.DN, err.Error()))
+		case len(users) == 0:
+			res.Created++
+		case changed:
+			res.Updated++
+		}
+	}
+
+	var gone []entity.User
+	err = repo.DB.Select("id", "openid").
+		Where("source = ? AND is_delete = 0", entity.UserSourceLDAP).Find(&gone).Error
+	if err != nil {
+		return nil, err
+	}
+	var missing []int
+	for _, u := range gone {
+		if !present[u.Openid] {
+			missing = append(missing, u.ID)
+		}
+	}
+	// 项目负责人不删除，需管理员先移交项目负责人
+	projects, err := repo.ProjectMemberRepo.LeadingProjects(missing...)
+	if err != nil {
+		return nil, err
+	}
+	leaders := map[int]bool{}
+	for _, p := range projects {
+		leaders[p.Manager] = true
+	}
+	var ids []int
+	for _, u := range gone {
+		if !present[u.Openid] {
+			if leaders[u.ID] {
+				res.Failed = append(res.Failed, fmt.Sprintf("%s: 目录中已不存在，但用户为项目负责人，请先移交项目负责人", u.Openid))
+				continue
+			}
+			ids = append(ids, u.ID)
+			res.Deleted = append(res.Deleted, u.Openid)
+		}
+	}
+	if len(ids) > 0 {
+		if err = repo.DB.Model(&entity.User{}).Where("id IN ?", ids).Update("is_delete", 1).Error; err != nil {
+			return nil, err
+		}
+		if _, err = repo.NewSessionRepository().RevokeUser("user", ids...); err != nil {
+			return nil, err
+		}
+		if err = repo.NewAccessTokenRepository().RevokeUser(ids...); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// schedule 定时同步精灵
+// 注意该函数不应抛出任何错误，同步失败时打印日志，继续下一个循环。
+func (d *Directory) schedule(interval time.Duration) {
+	defer close(d.done)
+	if interval <= 0 {
+		return
+	}
+	zap.L().Info("目录同步精灵 [启动]", zap.Duration("interval", interval))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			zap.L().Info("目录同步精灵 [退出]")
+			return
+		}
+		res, err := d.Sync(context.Background())
+		if err != nil {
+			zap.L().Error("目录同步失败", zap.Error(err))
+			continue
+		}
+		applog.A("目录同步", res)
+		zap.L().Info("目录同步完成",
+			zap.Int("total", res.Total),
+			zap.Int("created", res.Created),
+			zap.Int("updated", res.Updated),
+			zap.Int("deleted", len(res.Deleted)),
+			zap.Int("failed", len(res.Failed)))
+	}
+}
+
+// shutdown 停止定时同步，等待进行中的同步完成
+func (d *Directory) shutdown() {
+	select {
+	case <-d.stop:
+	default:
+		close(d.stop)
+	}
+	<-d.done
+}
+
+var _global *Directory
+
+// Init 初始化全局目录服务并启动定时同步，未启用目录服务认证时全局目录服务为 nil
+// 重复初始化时先停止之前的定时同步。
+func Init(cfg *appconf.LDAP) error {
+	Close()
+	if !cfg.Enable {
+		return nil
+	}
+	d, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	_global = d
+	go d.schedule(time.Duration(cfg.SyncInterval) * time.Minute)
+	return nil
+}
+
+// Default 全局目录服务，未启用目录服务认证时返回 nil
+func Default() *Directory {
+	return _global
+}
+
+// Close 停止定时同步
+func Close() {
+	if _global != nil {
+		_global.shutdown()
+		_global = nil
+	}
+}
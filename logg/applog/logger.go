@@ -1,7 +1,9 @@
 package applog
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"pdm/appconf"
@@ -9,6 +11,7 @@ import (
 	"pdm/repo"
 	"pdm/repo/entity"
 	"pdm/reuint/jwt"
+	"sync"
 	"time"
 )
 
@@ -18,20 +21,34 @@ var _globalL *Logger
 type Logger struct {
 	buff        chan *entity.Log // 日志缓冲区
 	maxKeepDays int              // 日志最大存储时间（单位：天），注意若该值小于等于0则表示不删除。
+
+	mu     sync.RWMutex  // 保护缓冲区关闭，写入日志持有读锁
+	closed bool          // 缓冲区是否已关闭
+	done   chan struct{} // 日志精灵退出信号
+	stop   chan struct{} // 停止超时日志清理
 }
 
 // Log 写入日志
+// 日志记录器关闭后日志仅输出到程序日志
 func (l *Logger) Log(record *entity.Log) {
 	if record == nil {
 		return
 	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		zap.L().Warn("日志记录器已关闭", zap.Any("record", record))
+		return
+	}
 	l.buff <- record
 }
 
 // daemon 日志精灵用于将缓存中的日志持久化
+// 缓冲区关闭后写完剩余日志再退出
 func (l *Logger) daemon() {
 	var err error
 	zap.L().Info("日志持久化存储精灵 [启动]")
+	defer close(l.done)
 	for item := range l.buff {
 		record := item
 		err = repo.DB.Create(item).Error
@@ -40,20 +57,47 @@ func (l *Logger) daemon() {
 			zap.L().Warn("日志写入失败", zap.Any("record", record), zap.Error(err))
 		}
 	}
+	zap.L().Info("日志持久化存储精灵 [退出]")
 }
 
 // 超时日志清理精灵
 // 注意该函数不应抛出任何错误，若有错误请手动恢复并打印，继续下一个循环。
 func (l *Logger) timeoutDeleteDaemon() {
-	if _globalL.maxKeepDays > 0 {
-		for {
-			now := time.Now().AddDate(0, 0, -_globalL.maxKeepDays).Format("2006-01-02 15:04:05")
-			repo.DB.Where("created_at < ?", now).Delete(&entity.Log{})
-			time.Sleep(24 * time.Hour)
+	if l.maxKeepDays <= 0 {
+		return
+	}
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		// 使用时间类型参数，由驱动转换为对应数据库的时间格式
+		deadline := time.Now().AddDate(0, 0, -l.maxKeepDays)
+		repo.DB.Where("created_at < ?", deadline).Delete(&entity.Log{})
+		select {
+		case <-ticker.C:
+		case <-l.stop:
+			return
 		}
 	}
 }
 
+// Close 关闭日志记录器
+// 停止接收新的日志并等待缓冲区中的日志全部写入数据库，ctx 超时则放弃等待。
+func (l *Logger) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.buff)
+		close(l.stop)
+	}
+	l.mu.Unlock()
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("等待日志写入超时，剩余 %d 条日志未写入，%w", len(l.buff), ctx.Err())
+	}
+}
+
 // InitLogger 初始化日志记录器
 func InitLogger(cfg *appconf.Application) {
 	if _globalL != nil {
@@ -62,6 +106,8 @@ func InitLogger(cfg *appconf.Application) {
 	_globalL = &Logger{
 		buff:        make(chan *entity.Log, 32),
 		maxKeepDays: cfg.LogKeepMaxDays,
+		done:        make(chan struct{}),
+		stop:        make(chan struct{}),
 	}
 	// 日志写入精灵
 	go _globalL.daemon()
@@ -84,17 +130,58 @@ func L(ctx *gin.Context, name string, param interface{}) {
 		record.OpType = 0
 	}
 	record.OpId = claims.Sub
+	// 通过个人访问令牌调用时记录令牌ID，用于区分用户本人操作与自动化调用
+	if v, ok := ctx.Get(middle.FlagAccessToken); ok {
+		record.TokenId = v.(*entity.AccessToken).ID
+	}
 	record.OpName = name
 	if param != nil {
 		marshal, _ := json.Marshal(param)
 		record.OpParam = string(marshal)
 	}
+	write(&record)
+}
 
+// A 记录匿名操作日志，用于登录失败等无法确定操作者的操作
+// 参数中应包含来源IP等用于追溯的信息。
+func A(name string, param interface{}) {
+	record := Init(entity.Log{}, "", 0, name, param)
+	write(record)
+}
+
+// By 以请求的操作者记录日志，用于请求结束后由后台任务记录的操作
+// claims: 发起操作的请求中的用户信息
+func By(claims *jwt.Claims, name string, param interface{}) {
+	record := Init(entity.Log{}, claims.Type, claims.Sub, name, param)
+	write(record)
+}
+
+// write 写入全局日志记录器，未初始化时仅输出到程序日志
+func write(record *entity.Log) {
 	if _globalL == nil {
 		zap.L().Info("日志", zap.Any("record", record))
 		return
 	}
-	_globalL.buff <- &record
+	_globalL.Log(record)
+}
+
+// Usage 全局日志记录器缓冲区中等待写入的日志数量与缓冲区容量
+// closed 为 true 表示日志记录器未初始化或已关闭，此时日志不再写入数据库
+func Usage() (used, capacity int, closed bool) {
+	if _globalL == nil {
+		return 0, 0, true
+	}
+	_globalL.mu.RLock()
+	defer _globalL.mu.RUnlock()
+	return len(_globalL.buff), cap(_globalL.buff), _globalL.closed
+}
+
+// Close 关闭全局日志记录器，等待缓冲区中的日志写入数据库
+func Close(ctx context.Context) error {
+	if _globalL == nil {
+		return nil
+	}
+	return _globalL.Close(ctx)
 }
 
 func Init(c entity.Log, claimsType string, id int, name string, param interface{}) *entity.Log {
@@ -0,0 +1,50 @@
+package applog
+
+import (
+	"context"
+	"path/filepath"
+	"pdm/appconf"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"testing"
+	"time"
+)
+
+func TestLogger_Close(t *testing.T) {
+	cfg := &appconf.Application{Database: appconf.Database{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "pdm.db"),
+	}}
+	if err := repo.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	InitLogger(cfg)
+	defer func() { _globalL = nil }()
+	// 超过缓冲区容量的日志
+	n := cap(_globalL.buff) * 3
+	for i := 0; i < n; i++ {
+		_globalL.Log(&entity.Log{OpType: 1, OpId: 1, OpName: "测试", OpParam: "{}"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	repo.DB.Model(&entity.Log{}).Count(&total)
+	if total != int64(n) {
+		t.Fatalf("expect %d logs persisted, got %d", n, total)
+	}
+
+	// 关闭后写入日志与重复关闭不应阻塞或崩溃
+	_globalL.Log(&entity.Log{OpName: "关闭后"})
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
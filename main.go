@@ -1,34 +1,141 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
 	"pdm/appconf"
 	"pdm/appconf/dir"
+	"pdm/backup"
+	"pdm/directory"
 	"pdm/logg"
 	"pdm/logg/applog"
+	"pdm/purge"
 	"pdm/repo"
+	"pdm/storage"
+	"syscall"
+	"time"
 )
 
 func main() {
 	// 初始化各级目录
 	dir.Init()
 	// 加载配置文件配置
-	appcfg := appconf.Load()
-	//fmt.Println("main appcfgACL = ", appcfg.ACL)
+	appcfg, opts, err := appconf.Load(os.Args[1:])
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		if err = appcfg.Print(os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	// 初始化日志
 	logg.InitConsole(appcfg.Debug)
 
+	if opts.ConfigPath == "" {
+		zap.L().Warn("未找到配置文件，使用缺省配置及环境变量、命令行参数中的配置")
+	} else {
+		zap.L().Info("加载配置文件", zap.String("path", opts.ConfigPath))
+	}
+	for _, w := range opts.Warnings {
+		zap.L().Warn("忽略未知的配置项，请检查配置文件", zap.String("detail", w))
+	}
+
 	// 数据库初始化
-	err := repo.Init(appcfg)
+	err = repo.Init(appcfg)
 	if err != nil {
 		zap.L().Fatal("持久层初始化失败", zap.Error(err))
 	}
+
+	// 文件存储初始化
+	if err = storage.Init(&appcfg.Storage); err != nil {
+		zap.L().Fatal("文件存储初始化失败", zap.Error(err))
+	}
+	zap.L().Info("文件存储", zap.String("type", appcfg.Storage.Type))
+
+	// 执行子命令
+	if len(opts.Args) > 0 {
+		cmd, ok := commands[opts.Args[0]]
+		if !ok {
+			zap.L().Fatal("未知的子命令", zap.String("cmd", opts.Args[0]))
+		}
+		if err = cmd(appcfg, opts.Args[1:]); err != nil {
+			zap.L().Fatal("命令执行失败", zap.String("cmd", opts.Args[0]), zap.Error(err))
+		}
+		return
+	}
+
+	// 数据库迁移
+	if err = repo.Migrate(); err != nil {
+		zap.L().Fatal("数据库迁移失败", zap.Error(err))
+	}
 	// 初始化操作日志模块
 	applog.InitLogger(appcfg)
+	// 将上次停机时中断的项目彻底删除任务标记为失败
+	if err = purge.Init(); err != nil {
+		zap.L().Fatal("项目彻底删除任务初始化失败", zap.Error(err))
+	}
+	// 初始化备份管理，启动定时备份
+	backup.Init(&appcfg.Backup)
+	// 初始化目录服务认证，启动定时同步
+	if err = directory.Init(&appcfg.LDAP); err != nil {
+		zap.L().Fatal("目录服务初始化失败", zap.Error(err))
+	}
 
 	// 启动Web服务器
-	server := NewHttpServer(appcfg)
-	if err = server.ListenAndServe(); err != nil {
-		zap.L().Fatal("服务启动失败", zap.Error(err))
+	server, err := NewHttpServer(appcfg)
+	if err != nil {
+		zap.L().Fatal("服务初始化失败", zap.Error(err))
+	}
+	// 收到中断或终止信号后优雅停机
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err = <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			zap.L().Fatal("服务启动失败", zap.Error(err))
+		}
+	case <-ctx.Done():
+		stop()
+		shutdown(server, time.Duration(appcfg.ShutdownTimeout)*time.Second)
+	}
+}
+
+// shutdown 优雅停机
+// 依次停止接受新连接并等待处理中的请求完成、取消并等待项目彻底删除任务、停止定时备份与目录同步、
+// 写入缓冲区中的操作日志、关闭数据库连接。
+// JWT签名密钥环在使用时按需获取密钥，没有后台任务，无需停止。
+func shutdown(server *HttpServer, timeout time.Duration) {
+	zap.L().Info("系统停机", zap.Duration("timeout", timeout))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		zap.L().Warn("等待请求处理完成超时，强制关闭连接", zap.Error(err))
+	}
+
+	purge.Close()
+	backup.Close()
+	directory.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := applog.Close(ctx); err != nil {
+		zap.L().Error("操作日志写入失败", zap.Error(err))
+	}
+	if err := repo.Close(); err != nil {
+		zap.L().Error("数据库关闭失败", zap.Error(err))
 	}
+	zap.L().Info("系统已停止")
+	_ = zap.L().Sync()
 }
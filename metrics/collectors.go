@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"pdm/appconf"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"strconv"
+	"time"
+)
+
+// HTTP接口
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdm_http_requests_total",
+		Help: "HTTP请求数",
+	}, []string{"method", "route", "status"})
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdm_http_request_duration_seconds",
+		Help:    "HTTP请求处理耗时（单位：秒）",
+		Buckets: DefBuckets,
+	}, []string{"method", "route"})
+	httpInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pdm_http_requests_in_flight",
+		Help: "正在处理的HTTP请求数",
+	})
+)
+
+// Middleware 统计HTTP请求数、处理耗时与响应状态码
+// route 为注册的路由路径（如 /api/case/send），未匹配路由的请求（如静态资源）统一记为 other，避免标签数量无限增长。
+func Middleware(ctx *gin.Context) {
+	start := time.Now()
+	httpInFlight.Inc()
+	defer httpInFlight.Dec()
+
+	ctx.Next()
+
+	route := ctx.FullPath()
+	if route == "" {
+		route = "other"
+	}
+	method := ctx.Request.Method
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+}
+
+// 接口测试外部请求
+var (
+	// CaseSendRequests 接口测试（/api/case/send）发送的外部请求数，status 为响应状态码，请求失败时为 error
+	CaseSendRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdm_case_send_requests_total",
+		Help: "接口测试发送的外部请求数，请求失败时 status 为 error",
+	}, []string{"method", "status"})
+	// CaseSendDuration 接口测试外部请求耗时，截至收到响应头
+	CaseSendDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdm_case_send_duration_seconds",
+		Help:    "接口测试外部请求耗时，截至收到响应头（单位：秒）",
+		Buckets: DefBuckets,
+	}, []string{"method"})
+)
+
+// 单点登录外部请求
+var (
+	// SSORequests 访问单点登录身份提供方的请求数，status 为响应状态码，请求失败时为 error
+	SSORequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdm_sso_requests_total",
+		Help: "访问单点登录身份提供方的请求数，请求失败时 status 为 error",
+	}, []string{"method", "status"})
+	// SSODuration 访问单点登录身份提供方的请求耗时，截至收到响应头
+	SSODuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdm_sso_request_duration_seconds",
+		Help:    "访问单点登录身份提供方的请求耗时，截至收到响应头（单位：秒）",
+		Buckets: DefBuckets,
+	}, []string{"method"})
+)
+
+// Transport 统计外部请求数、耗时与响应状态码的 http.RoundTripper
+type Transport struct {
+	Next     http.RoundTripper        // 实际发送请求的 RoundTripper，为空时使用 http.DefaultTransport
+	Requests *prometheus.CounterVec   // 请求数，标签为 method、status
+	Duration *prometheus.HistogramVec // 请求耗时，标签为 method
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	t.Requests.WithLabelValues(req.Method, status).Inc()
+	t.Duration.WithLabelValues(req.Method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// 数据库连接池
+var (
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_db_max_open_connections",
+		Help: "数据库最大连接数，0表示不限制",
+	}, func() float64 {
+		return float64(dbStats().MaxOpenConnections)
+	})
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_db_open_connections",
+		Help: "数据库已建立的连接数",
+	}, func() float64 {
+		return float64(dbStats().OpenConnections)
+	})
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_db_in_use_connections",
+		Help: "数据库使用中的连接数",
+	}, func() float64 {
+		return float64(dbStats().InUse)
+	})
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_db_idle_connections",
+		Help: "数据库空闲连接数",
+	}, func() float64 {
+		return float64(dbStats().Idle)
+	})
+	_ = factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "pdm_db_wait_count_total",
+		Help: "等待数据库连接的总次数",
+	}, func() float64 {
+		return float64(dbStats().WaitCount)
+	})
+	_ = factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "pdm_db_wait_duration_seconds_total",
+		Help: "等待数据库连接的总耗时（单位：秒）",
+	}, func() float64 {
+		return dbStats().WaitDuration.Seconds()
+	})
+	_ = factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "pdm_db_max_idle_closed_total",
+		Help: "因超过最大空闲连接数而关闭的连接数",
+	}, func() float64 {
+		return float64(dbStats().MaxIdleClosed)
+	})
+	_ = factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "pdm_db_max_lifetime_closed_total",
+		Help: "因超过最长存活时间而关闭的连接数",
+	}, func() float64 {
+		return float64(dbStats().MaxLifetimeClosed)
+	})
+)
+
+// dbStats 数据库连接池状态，数据库未初始化时返回零值
+func dbStats() sql.DBStats {
+	if repo.DB == nil {
+		return sql.DBStats{}
+	}
+	sqlDB, err := repo.DB.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+// 操作日志缓冲区与程序信息
+var (
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_applog_buffer_used",
+		Help: "操作日志缓冲区中等待写入数据库的日志数",
+	}, func() float64 {
+		used, _, _ := applog.Usage()
+		return float64(used)
+	})
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_applog_buffer_capacity",
+		Help: "操作日志缓冲区容量",
+	}, func() float64 {
+		_, capacity, _ := applog.Usage()
+		return float64(capacity)
+	})
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pdm_start_time_seconds",
+		Help: "程序启动时间（Unix时间戳，单位：秒）",
+	}, func() float64 {
+		return float64(startTime.Unix())
+	})
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "pdm_build_info",
+		Help:        "程序版本信息，值恒为1",
+		ConstLabels: prometheus.Labels{"version": appconf.Version},
+	}, func() float64 { return 1 })
+	startTime = time.Now()
+)
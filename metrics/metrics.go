@@ -0,0 +1,33 @@
+// Package metrics 监控指标
+//
+// 基于 Prometheus 客户端库输出HTTP接口、数据库连接池、操作日志缓冲区
+// 以及接口测试（/api/case/send）外部请求等指标，供监控系统采集与告警。
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry 指标注册表，本包中创建的指标均注册到该注册表
+// 另外包含Go运行时与进程指标。
+var Registry = prometheus.NewRegistry()
+
+// factory 创建指标并注册到 Registry
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// DefBuckets 缺省的耗时直方图分桶（单位：秒）
+var DefBuckets = prometheus.DefBuckets
+
+// Handler 以 Prometheus 格式输出 Registry 中的所有指标
+var Handler = gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
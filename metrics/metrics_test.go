@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware)
+	r.GET("/api/user/:id", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/api/user/:id", "204"))
+	others := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "other", "404"))
+	for _, p := range []string{"/api/user/1", "/api/user/2", "/none"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+	if v := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/api/user/:id", "204")); v != before+2 {
+		t.Fatalf("expect %v requests, got %v", before+2, v)
+	}
+	if v := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "other", "404")); v != others+1 {
+		t.Fatalf("expect %v unmatched requests, got %v", others+1, v)
+	}
+
+	w := httptest.NewRecorder()
+	r.GET("/metrics", Handler)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, s := range []string{
+		`pdm_http_requests_total{method="GET",route="/api/user/:id",status="204"}`,
+		`pdm_http_request_duration_seconds_count{method="GET",route="/api/user/:id"}`,
+		`pdm_build_info{version="`,
+		"# TYPE pdm_db_open_connections gauge",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(body, s) {
+			t.Fatalf("metrics output missing %q", s)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total"}, []string{"method", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_duration_seconds"}, []string{"method"})
+	client := &http.Client{Transport: &Transport{Requests: requests, Duration: duration}}
+	resp, err := client.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if _, err = client.Get("http://127.0.0.1:1/unreachable"); err == nil {
+		t.Fatal("expect connection error")
+	}
+	teapot, failed := testutil.ToFloat64(requests.WithLabelValues(http.MethodPost, "418")), testutil.ToFloat64(requests.WithLabelValues(http.MethodGet, "error"))
+	if teapot != 1 || failed != 1 {
+		t.Fatalf("unexpected counts: %v %v", teapot, failed)
+	}
+	if n := testutil.CollectAndCount(duration); n != 2 {
+		t.Fatalf("unexpected duration series: %d", n)
+	}
+}
@@ -0,0 +1,219 @@
+// Package purge 项目彻底删除任务
+//
+// 彻底删除在后台任务中执行，任务状态记录在数据库中（见 entity.ProjectPurgeJob），
+// 同一项目同一时间只允许一个进行中的任务，由数据库条件插入保证。
+// 停机时取消进行中的任务并等待其退出，中断的任务标记为失败；
+// 删除先清理文件再删除数据记录，失败的任务可以重新发起并继续清理。
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"pdm/logg/applog"
+	"pdm/repo"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"pdm/storage"
+	"strconv"
+	"sync"
+)
+
+var (
+	// ErrBusy 项目已有进行中的任务
+	ErrBusy = errors.New("项目正在彻底删除，请稍后再试")
+	// ErrClosed 服务正在停止，不再接受新的任务
+	ErrClosed = errors.New("服务正在停止，请稍后再试")
+)
+
+// 中断任务的失败原因
+const (
+	reasonRestart  = "服务重启，任务已中断，请重新发起"
+	reasonShutdown = "服务停止，任务已中断，请重新发起"
+)
+
+var (
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+)
+
+func init() {
+	ctx, cancel = context.WithCancel(context.Background())
+}
+
+// Init 将上次停机时中断的任务标记为失败
+func Init() error {
+	mu.Lock()
+	if ctx.Err() != nil {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	mu.Unlock()
+	n, err := repo.NewPurgeJobRepository().FailRunning(reasonRestart)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		zap.L().Warn("项目彻底删除任务因服务重启中断，已标记为失败", zap.Int64("count", n))
+	}
+	return nil
+}
+
+// Close 取消进行中的任务并等待任务退出
+func Close() {
+	mu.Lock()
+	cancel()
+	mu.Unlock()
+	wg.Wait()
+}
+
+// Start 创建项目的彻底删除任务并在后台执行，完成后记录操作日志
+// claims: 发起任务的管理员信息
+func Start(project *entity.Project, claims jwt.Claims) (*entity.ProjectPurgeJob, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	job := &entity.ProjectPurgeJob{
+		ProjectId:   project.ID,
+		ProjectName: project.Name,
+		OpId:        claims.Sub,
+		Status:      entity.PurgeRunning,
+	}
+	ok, err := repo.NewPurgeJobRepository().Create(job)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrBusy
+	}
+	resp := *job
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run(ctx, job, claims)
+	}()
+	return &resp, nil
+}
+
+// run 执行彻底删除任务，完成后更新任务状态并记录操作日志
+func run(ctx context.Context, job *entity.ProjectPurgeJob, claims jwt.Claims) {
+	removed, err := remove(ctx, job.ProjectId, job.ProjectName)
+	data, _ := json.Marshal(removed)
+	job.Removed = string(data)
+	job.Status = entity.PurgeDone
+	name := "彻底删除项目完成"
+	if err != nil {
+		zap.L().Error("彻底删除项目失败", zap.Int("projectId", job.ProjectId), zap.Error(err))
+		job.Status = entity.PurgeFailed
+		job.Error = err.Error()
+		if ctx.Err() != nil {
+			job.Error = reasonShutdown
+		}
+		name = "彻底删除项目失败"
+	}
+	if err = repo.NewPurgeJobRepository().Finish(job); err != nil {
+		zap.L().Error("更新彻底删除任务失败", zap.Int("jobId", job.ID), zap.Error(err))
+	}
+	applog.By(&claims, name, map[string]interface{}{
+		"jobId":     job.ID,
+		"projectId": job.ProjectId,
+		"name":      job.ProjectName,
+		"removed":   removed,
+		"error":     job.Error,
+	})
+}
+
+// remove 删除项目的文件以及所有数据记录，返还删除的内容
+// 先删除文件再删除数据记录，失败后重新执行时可以继续清理。
+func remove(ctx context.Context, projectId int, projectName string) (map[string]int64, error) {
+	removed := map[string]int64{"docDirs": 0, "technicalProposalDirs": 0}
+	// 对接文档目录，目录名为文档ID
+	var docIds []int
+	if err := repo.DB.Model(&entity.Document{}).Where("project_id = ?", projectId).Pluck("id", &docIds).Error; err != nil {
+		return removed, err
+	}
+	for _, id := range docIds {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		name := strconv.Itoa(id)
+		exist, err := storage.Exist(storage.Doc, name)
+		if err != nil {
+			return removed, err
+		}
+		if !exist {
+			continue
+		}
+		if err = storage.Doc.Remove(name); err != nil {
+			return removed, err
+		}
+		removed["docDirs"]++
+	}
+
+	// 技术方案目录，见 repo.TechnicalProposalRepository
+	dirs, err := techDirs(projectId, projectName)
+	if err != nil {
+		return removed, err
+	}
+	for _, dir := range dirs {
+		if err = ctx.Err(); err != nil {
+			return removed, err
+		}
+		if err = storage.TechnicalProposal.Remove(dir); err != nil {
+			return removed, err
+		}
+		removed["technicalProposalDirs"]++
+	}
+
+	rows, err := repo.ProjectRepo.Purge(ctx, projectId)
+	for table, n := range rows {
+		removed[table] = n
+	}
+	return removed, err
+}
+
+// techDirs 需要删除的技术方案目录
+// 包括技术方案中记录的目录以及以当前项目名称命名的目录，其他项目仍在使用的目录保留。
+func techDirs(projectId int, projectName string) ([]string, error) {
+	tpr := repo.NewTechnicalProposalRepository()
+	candidates, err := tpr.Dirs(projectId)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, projectName)
+	seen := map[string]bool{}
+	var res []string
+	for _, name := range candidates {
+		dir, ok := storage.Clean(name)
+		if !ok || dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		users, err := tpr.Projects(dir)
+		if err != nil {
+			return nil, err
+		}
+		shared := false
+		for _, id := range users {
+			if id != projectId {
+				shared = true
+				break
+			}
+		}
+		if shared {
+			continue
+		}
+		exist, err := storage.Exist(storage.TechnicalProposal, dir)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			res = append(res, dir)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/emmansun/gmsm/sm3"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"time"
+)
+
+// accessTokenTouchInterval 个人访问令牌最近使用时间的更新间隔
+const accessTokenTouchInterval = time.Minute
+
+// AccessTokenRepository 个人访问令牌支持层
+type AccessTokenRepository struct {
+}
+
+func NewAccessTokenRepository() *AccessTokenRepository {
+	return &AccessTokenRepository{}
+}
+
+// hashAccessToken 个人访问令牌的SM3摘要Hex
+func hashAccessToken(token string) string {
+	sum := sm3.Sum([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create 生成个人访问令牌并保存其摘要，返还令牌明文
+// 令牌明文仅在创建时返还一次，无法再次获取。
+func (r *AccessTokenRepository) Create(at *entity.AccessToken) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := entity.AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	at.Hash = hashAccessToken(token)
+	at.Prefix = token[:len(entity.AccessTokenPrefix)+8]
+	if err := DB.Create(at).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate 校验个人访问令牌，有效时返还令牌所属用户在令牌项目中的身份信息，并更新最近使用时间
+// 令牌不存在、已过期，或用户已被删除、不再是项目成员时返还 nil。
+func (r *AccessTokenRepository) Authenticate(token, ip string) (*jwt.Claims, *entity.AccessToken, error) {
+	var at entity.AccessToken
+	if err := DB.Limit(1).Find(&at, "hash = ?", hashAccessToken(token)).Error; err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if at.ID == 0 || !now.Before(at.ExpiresAt) {
+		return nil, nil, nil
+	}
+
+	// 每次调用时查询项目角色，用户被删除、移出项目或角色变更后立即生效
+	var roles []int
+	err := DB.Model(&entity.ProjectMember{}).
+		Joins("JOIN users ON users.id = project_members.user_id AND users.is_delete = 0").
+		Joins("JOIN projects ON projects.id = project_members.project_id AND projects.is_delete = 0").
+		Where("project_members.project_id = ? AND project_members.user_id = ?", at.ProjectID, at.UserID).
+		Limit(1).Pluck("project_members.role", &roles).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(roles) == 0 {
+		return nil, nil, nil
+	}
+
+	if at.LastUsedAt == nil || now.Sub(*at.LastUsedAt) >= accessTokenTouchInterval || at.LastUsedIP != ip {
+		at.LastUsedAt = &now
+		at.LastUsedIP = ip
+		err = DB.Model(&entity.AccessToken{}).Where("id = ?", at.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	claims := &jwt.Claims{
+		Type: "user",
+		Sub:  at.UserID,
+		Exp:  at.ExpiresAt.UnixMilli(),
+		PID:  at.ProjectID,
+		Role: roles[0],
+	}
+	return claims, &at, nil
+}
+
+// RevokeUser 撤销用户的所有个人访问令牌
+func (r *AccessTokenRepository) RevokeUser(ids ...int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Where("user_id IN ?", ids).Delete(&entity.AccessToken{}).Error
+}
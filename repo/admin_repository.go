@@ -0,0 +1,208 @@
+package repo
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/emmansun/gmsm/sm3"
+	"github.com/emmansun/gmsm/smx509"
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+	"time"
+)
+
+// AdminBindCodeTTL 证书绑定码有效期
+const AdminBindCodeTTL = 24 * time.Hour
+
+var (
+	// ErrAdminExists 用户名已存在
+	ErrAdminExists = errors.New("用户名已存在")
+	// ErrLastAdmin 操作后将没有可用的管理员
+	ErrLastAdmin = errors.New("至少保留一个启用的管理员")
+	// ErrBindCode 绑定码错误、已使用或已过期
+	ErrBindCode = errors.New("绑定码无效")
+	// ErrCertBound 证书已被绑定
+	ErrCertBound = errors.New("证书已被绑定")
+)
+
+// AdminRepository 管理员与审计员支持层
+type AdminRepository struct {
+}
+
+func NewAdminRepository() *AdminRepository {
+	return &AdminRepository{}
+}
+
+// hashBindCode 绑定码的SM3摘要Hex，忽略大小写与分隔符
+func hashBindCode(code string) string {
+	return hashRecoveryCode(code)
+}
+
+// newBindCode 生成绑定码，格式如 abcd-efgh-jkmn-pqrs
+func newBindCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 19)
+	for i, b := range buf {
+		if i > 0 && i%4 == 0 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[b%32])
+	}
+	return string(code), nil
+}
+
+// Create 创建管理员或审计员，并生成证书绑定码
+// 管理员通过证书登录，创建后需使用绑定码绑定证书。
+// return: 管理员, 绑定码明文, 错误
+func (r *AdminRepository) Create(username string, role int) (*entity.Admin, string, error) {
+	code, err := newBindCode()
+	if err != nil {
+		return nil, "", err
+	}
+	expiresAt := time.Now().Add(AdminBindCodeTTL)
+	admin := &entity.Admin{Username: username, Role: role, BindCode: hashBindCode(code), BindCodeExpiresAt: &expiresAt}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&entity.Admin{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAdminExists
+		}
+		return tx.Create(admin).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return admin, code, nil
+}
+
+// FindByUsername 按用户名查询，不存在时返还 nil
+func (r *AdminRepository) FindByUsername(username string) (*entity.Admin, error) {
+	var list []entity.Admin
+	if err := DB.Where("username = ?", username).Limit(1).Find(&list).Error; err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// IssueBindCode 重新生成证书绑定码，原有的绑定码失效
+// return: 绑定码明文, 过期时间, 错误
+func (r *AdminRepository) IssueBindCode(id int) (string, time.Time, error) {
+	code, err := newBindCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(AdminBindCodeTTL)
+	res := DB.Model(&entity.Admin{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"bind_code": hashBindCode(code), "bind_code_expires_at": expiresAt})
+	if res.Error != nil {
+		return "", time.Time{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", time.Time{}, gorm.ErrRecordNotFound
+	}
+	return code, expiresAt, nil
+}
+
+// CheckBindCode 绑定码是否有效，不使用绑定码
+func (r *AdminRepository) CheckBindCode(admin *entity.Admin, code string) bool {
+	if admin.BindCode == "" || admin.BindCodeExpiresAt == nil || time.Now().After(*admin.BindCodeExpiresAt) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(admin.BindCode), []byte(hashBindCode(code))) == 1
+}
+
+// Bind 使用绑定码为管理员绑定证书，绑定码使用后失效
+// cert: 证书信息，Cert 与 Fingerprint 等字段需已设置
+func (r *AdminRepository) Bind(adminID int, code string, cert *entity.AdminCert) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Admin{}).
+			Where("id = ? AND disabled = 0 AND bind_code = ? AND bind_code_expires_at > ?", adminID, hashBindCode(code), time.Now()).
+			Updates(map[string]interface{}{"bind_code": "", "bind_code_expires_at": nil})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrBindCode
+		}
+		var count int64
+		if err := tx.Model(&entity.AdminCert{}).Where("fingerprint = ?", cert.Fingerprint).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCertBound
+		}
+		cert.AdminID = adminID
+		return tx.Create(cert).Error
+	})
+}
+
+// NewAdminCert 由证书生成绑定记录
+// raw: 证书，BASE64编码的DER
+func NewAdminCert(raw string, cert *smx509.Certificate) *entity.AdminCert {
+	sum := sm3.Sum(cert.Raw)
+	return &entity.AdminCert{
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Serial:      cert.SerialNumber.Text(16),
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotAfter:    cert.NotAfter,
+		Cert:        raw,
+	}
+}
+
+// Certs 管理员绑定的所有证书，按绑定时间倒序
+func (r *AdminRepository) Certs(adminID int) ([]entity.AdminCert, error) {
+	list := []entity.AdminCert{}
+	err := DB.Where("admin_id = ?", adminID).Order("id DESC").Find(&list).Error
+	return list, err
+}
+
+// Unbind 解除管理员绑定的证书
+func (r *AdminRepository) Unbind(adminID int, certID int) (bool, error) {
+	res := DB.Where("id = ? AND admin_id = ?", certID, adminID).Delete(&entity.AdminCert{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// TouchCert 记录证书最近登录时间
+func (r *AdminRepository) TouchCert(certID int) error {
+	return DB.Model(&entity.AdminCert{}).Where("id = ?", certID).Update("last_used_at", time.Now()).Error
+}
+
+// SetDisabled 禁用或启用管理员，禁用时注销其所有会话
+// 不能禁用最后一个启用的管理员（角色为管理员），避免系统无人管理。
+func (r *AdminRepository) SetDisabled(id int, disabled bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var admin entity.Admin
+		if err := tx.First(&admin, id).Error; err != nil {
+			return err
+		}
+		if !disabled {
+			return tx.Model(&admin).Update("disabled", 0).Error
+		}
+		if admin.Role == entity.AdminRoleAdmin && admin.Disabled == 0 {
+			var count int64
+			err := tx.Model(&entity.Admin{}).
+				Where("id <> ? AND role = ? AND disabled = 0", id, entity.AdminRoleAdmin).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrLastAdmin
+			}
+		}
+		if err := tx.Model(&admin).Updates(map[string]interface{}{"disabled": 1, "bind_code": "", "bind_code_expires_at": nil}).Error; err != nil {
+			return err
+		}
+		typ := "admin"
+		if admin.Role == entity.AdminRoleAudit {
+			typ = "audit"
+		}
+		return tx.Where("user_type = ? AND user_id = ?", typ, id).Delete(&entity.Session{}).Error
+	})
+}
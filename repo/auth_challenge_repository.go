@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+	"time"
+)
+
+// AuthChallengeRepository 证书认证挑战支持层
+type AuthChallengeRepository struct {
+}
+
+func NewAuthChallengeRepository() *AuthChallengeRepository {
+	return &AuthChallengeRepository{}
+}
+
+// Create 创建挑战，同时清理已过期的挑战
+func (r *AuthChallengeRepository) Create(challenge *entity.AuthChallenge) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&entity.AuthChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(challenge).Error
+	})
+}
+
+// Consume 删除挑战，挑战存在且未过期时返还 true
+// 多个请求同时使用同一挑战时仅有一个能删除成功。
+func (r *AuthChallengeRepository) Consume(id string) (bool, error) {
+	var challenge entity.AuthChallenge
+	err := DB.Limit(1).Find(&challenge, "id = ?", id).Error
+	if err != nil || challenge.ID == "" {
+		return false, err
+	}
+	res := DB.Where("id = ?", id).Delete(&entity.AuthChallenge{})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	return time.Now().Before(challenge.ExpiresAt), nil
+}
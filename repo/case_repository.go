@@ -1,10 +1,20 @@
 package repo
 
 import (
+	"errors"
 	"gorm.io/gorm"
 	"pdm/repo/entity"
 )
 
+var (
+	// ErrCaseNotOrphan 用例不存在或已属于项目
+	ErrCaseNotOrphan = errors.New("用例不存在或已属于项目")
+	// ErrProjectNotFound 项目不存在或已删除
+	ErrProjectNotFound = errors.New("项目不存在或已删除")
+	// ErrCaseNameExists 项目中已存在同名的根用例
+	ErrCaseNameExists = errors.New("项目中已存在同名用例")
+)
+
 // CaseRepository 接口分类支持层
 type CaseRepository struct {
 }
@@ -13,13 +23,13 @@ func NewCaseRepository() *CaseRepository {
 	return &CaseRepository{}
 }
 
-// ExistName 检查接口用例名称在同级是否存在
-func (r *CaseRepository) ExistName(name string, categorizeId int) (bool, error) {
+// ExistName 检查接口用例名称在项目的同级中是否存在
+func (r *CaseRepository) ExistName(name string, projectId, categorizeId int) (bool, error) {
 	if name == "" {
 		return false, nil
 	}
 	res := &entity.ApiCase{}
-	err := DB.First(res, "name = ? AND categorize_id = ?", name, categorizeId).Error
+	err := DB.First(res, "name = ? AND project_id = ? AND categorize_id = ?", name, projectId, categorizeId).Error
 	if err == gorm.ErrRecordNotFound {
 		return false, nil
 	}
@@ -28,3 +38,41 @@ func (r *CaseRepository) ExistName(name string, categorizeId int) (bool, error)
 	}
 	return true, nil
 }
+
+// Orphans 不属于任何项目的根用例
+// 升级时无法确定所属项目的根用例所属项目为0，需由管理员移入项目。
+func (r *CaseRepository) Orphans() ([]entity.ApiCase, error) {
+	var res []entity.ApiCase
+	err := DB.Select("id", "name", "user_id", "created_at").
+		Where("categorize_id = 0 AND project_id = 0").Order("id").Find(&res).Error
+	return res, err
+}
+
+// MoveOrphan 将不属于任何项目的根用例移入项目
+func (r *CaseRepository) MoveOrphan(id, projectId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var c entity.ApiCase
+		err := tx.Select("id", "name").Where("id = ? AND categorize_id = 0 AND project_id = 0", id).First(&c).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrCaseNotOrphan
+		}
+		if err != nil {
+			return err
+		}
+		var count int64
+		if err = tx.Model(&entity.Project{}).Where("id = ? AND is_delete = 0", projectId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrProjectNotFound
+		}
+		err = tx.Model(&entity.ApiCase{}).Where("name = ? AND project_id = ? AND categorize_id = 0", c.Name, projectId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCaseNameExists
+		}
+		return tx.Model(&c).Update("project_id", projectId).Error
+	})
+}
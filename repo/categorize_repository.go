@@ -5,7 +5,6 @@ import (
 	"gorm.io/gorm"
 	"pdm/controller/middle"
 	"pdm/repo/entity"
-	"pdm/reuint/jwt"
 )
 
 // CategorizeRepository 接口分类支持层
@@ -21,10 +20,8 @@ func (r *CategorizeRepository) ExistName(ctx *gin.Context, name string, parentId
 	if name == "" {
 		return false, nil
 	}
-	claimsValue, _ := ctx.Get(middle.FlagClaims)
-	claims := claimsValue.(*jwt.Claims)
 	res := &entity.ApiCategorize{}
-	err := DB.First(res, "name = ? AND parent_id = ? AND project_id = ?", name, parentId, claims.PID).Error
+	err := DB.First(res, "name = ? AND parent_id = ? AND project_id = ?", name, parentId, middle.ProjectID(ctx)).Error
 	if err == gorm.ErrRecordNotFound {
 		return false, nil
 	}
@@ -33,3 +30,28 @@ func (r *CategorizeRepository) ExistName(ctx *gin.Context, name string, parentId
 	}
 	return true, nil
 }
+
+// Delete 删除项目中的分类及其所有子分类和接口用例
+// ids: 待删除的分类ID，需确保均属于该项目
+func (r *CategorizeRepository) Delete(projectId int, ids []int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		all := append([]int{}, ids...)
+		parents := ids
+		// 逐层查找子分类
+		for len(parents) > 0 {
+			var children []int
+			err := tx.Model(&entity.ApiCategorize{}).
+				Where("parent_id IN ? AND project_id = ?", parents, projectId).
+				Pluck("id", &children).Error
+			if err != nil {
+				return err
+			}
+			all = append(all, children...)
+			parents = children
+		}
+		if err := tx.Delete(&entity.ApiCase{}, "categorize_id IN ? AND project_id = ?", all, projectId).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.ApiCategorize{}, "id IN ? AND project_id = ?", all, projectId).Error
+	})
+}
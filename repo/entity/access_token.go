@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix 个人访问令牌前缀，用于区分个人访问令牌与登录token
+const AccessTokenPrefix = "pdm_"
+
+// 个人访问令牌权限范围
+const (
+	ScopeRead      = "read"       // 只读，可调用所有查询（GET）接口
+	ScopeDocsWrite = "docs:write" // 编辑对接文档，可调用 /api/doc/ 下的写接口
+	ScopeCasesRun  = "cases:run"  // 维护与执行接口测试用例，可调用 /api/case/ 下的写接口
+)
+
+// AccessToken 个人访问令牌
+// 用户为脚本、CI等自动化调用创建的令牌，通过 Authorization: Bearer 请求头认证，
+// 仅能访问指定项目中权限范围内的接口，数据库仅保存令牌的摘要。
+type AccessToken struct {
+	ID         int        `gorm:"autoIncrement" json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UserID     int        `gorm:"index" json:"userId"`          // 所属用户ID
+	Name       string     `gorm:"size:64" json:"name"`          // 令牌名称
+	Hash       string     `gorm:"size:64;uniqueIndex" json:"-"` // 令牌SM3摘要Hex
+	Prefix     string     `gorm:"size:16" json:"prefix"`        // 令牌前缀，用于识别令牌
+	Scopes     string     `gorm:"size:128" json:"scopes"`       // 权限范围，多个用","隔开
+	ProjectID  int        `json:"projectId"`                    // 可访问的项目ID
+	ExpiresAt  time.Time  `json:"expiresAt"`                    // 过期时间
+	LastUsedAt *time.Time `json:"lastUsedAt"`                   // 最近使用时间，未使用过为空
+	LastUsedIP string     `gorm:"size:64" json:"lastUsedIp"`    // 最近使用的IP
+}
+
+// HasScope 是否具有权限范围
+func (c *AccessToken) HasScope(scope string) bool {
+	for _, s := range strings.Split(c.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *AccessToken) MarshalJSON() ([]byte, error) {
+	type Alias AccessToken
+	var lastUsedAt *DateTime
+	if c.LastUsedAt != nil {
+		t := DateTime(*c.LastUsedAt)
+		lastUsedAt = &t
+	}
+	return json.Marshal(&struct {
+		*Alias
+		CreatedAt  DateTime  `json:"createdAt"`
+		ExpiresAt  DateTime  `json:"expiresAt"`
+		LastUsedAt *DateTime `json:"lastUsedAt"`
+	}{
+		(*Alias)(c),
+		DateTime(c.CreatedAt),
+		DateTime(c.ExpiresAt),
+		lastUsedAt,
+	})
+}
@@ -9,6 +9,12 @@ const (
 	B = "pdm" // 可区分标识符
 )
 
+// 管理员角色类型
+const (
+	AdminRoleAdmin = 0 // 管理员
+	AdminRoleAudit = 1 // 审计员
+)
+
 // Admin 管理员
 type Admin struct {
 	ID        int       `gorm:"autoIncrement" json:"id"`
@@ -18,7 +24,10 @@ type Admin struct {
 	Password  Pwd       `json:"password"` //口令加盐摘要Hex
 	Salt      string    `json:"-"`        // 盐值Hex
 	Role      int       `json:"role"`     // 角色类型 0 - 管理员 1 - 审计员
-	Cert      string    `json:"cert"`     // 证书
+	Disabled  int       `json:"disabled"` // 是否禁用 0 - 启用（默认值） 1 - 禁用，禁用后无法登录
+
+	BindCode          string     `gorm:"size:64" json:"-"` // 一次性证书绑定码的SM3摘要Hex，为空表示没有可用的绑定码
+	BindCodeExpiresAt *time.Time `json:"-"`                // 证书绑定码过期时间
 }
 
 func (c *Admin) MarshalJSON() ([]byte, error) {
@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AdminCert 管理员绑定的证书
+// 管理员可绑定多个证书，使用其中任意一个有效的证书登录，便于证书更新期间新旧证书同时可用。
+type AdminCert struct {
+	ID          int        `gorm:"autoIncrement" json:"id"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	AdminID     int        `gorm:"index" json:"adminId"`                   // 所属管理员ID
+	Fingerprint string     `gorm:"size:64;uniqueIndex" json:"fingerprint"` // 证书DER编码的SM3摘要Hex，同一证书只能绑定一个管理员
+	Serial      string     `gorm:"size:128" json:"serial"`                 // 证书序列号Hex
+	Subject     string     `gorm:"size:512" json:"subject"`                // 证书主题
+	Issuer      string     `gorm:"size:512" json:"issuer"`                 // 证书颁发者
+	NotAfter    time.Time  `json:"notAfter"`                               // 证书有效期截止时间
+	Cert        string     `json:"-"`                                      // 证书，BASE64编码的DER
+	LastUsedAt  *time.Time `json:"lastUsedAt"`                             // 最近登录时间，未使用过为空
+}
+
+func (c *AdminCert) MarshalJSON() ([]byte, error) {
+	type Alias AdminCert
+	var lastUsedAt *DateTime
+	if c.LastUsedAt != nil {
+		t := DateTime(*c.LastUsedAt)
+		lastUsedAt = &t
+	}
+	return json.Marshal(&struct {
+		*Alias
+		CreatedAt  DateTime  `json:"createdAt"`
+		NotAfter   DateTime  `json:"notAfter"`
+		LastUsedAt *DateTime `json:"lastUsedAt"`
+	}{
+		(*Alias)(c),
+		DateTime(c.CreatedAt),
+		DateTime(c.NotAfter),
+		lastUsedAt,
+	})
+}
@@ -23,6 +23,7 @@ type ApiCase struct {
 	Name         string    `json:"name"`         // 分类名称
 	UserId       int       `json:"userId"`       // 创建人ID
 	CategorizeId int       `json:"categorizeId"` // 所属分类ID
+	ProjectId    int       `json:"projectId"`    // 所属项目ID
 	Description  string    `json:"description"`  // 接口描述
 	Method       int       `json:"method"`       // 请求方法 0-GET，1-POST，2-PUT，3-DELETE
 	Path         string    `json:"path"`         // 请求路径
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// AuthChallenge 证书认证挑战
+// 服务端签发随机数Rb时创建，实体鉴别或证书绑定时校验并删除，每个随机数仅能使用一次。
+type AuthChallenge struct {
+	ID        string    `gorm:"primaryKey;size:64" json:"id"` // 随机数Rb的SM3摘要Hex
+	CreatedAt time.Time `json:"createdAt"`                    // 创建时间
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`       // 过期时间
+}
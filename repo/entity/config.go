@@ -0,0 +1,12 @@
+package entity
+
+const (
+	ConfigDBVersion = "db_version" // 数据库版本号配置项
+)
+
+// Config 系统配置项
+type Config struct {
+	ID       int    `gorm:"autoIncrement" json:"id"`
+	ItemName string `gorm:"size:256" json:"itemName"` // 配置项名称
+	Content  string `gorm:"size:256" json:"content"`  // 配置项内容
+}
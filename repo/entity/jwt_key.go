@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// JwtKey 登录token签名密钥
+// 多个实例共享数据库中的密钥，每个轮换周期一个密钥，过期后被清理。
+type JwtKey struct {
+	ID        string    `gorm:"primaryKey;size:32" json:"id"` // 密钥ID，为密钥启用时间
+	CreatedAt time.Time `json:"createdAt"`
+	Secret    string    `gorm:"size:64" json:"-"`       // 密钥Hex
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"` // 过期时间，过期后不再用于验证
+}
@@ -12,4 +12,5 @@ type Log struct {
 	OpId      int       `json:"opId"`    // 操作者记录ID
 	OpName    string    `json:"opName"`  // 操作名称
 	OpParam   string    `json:"opParam"` // 操作的关键参数 可选参数，例如删除用户时，删除的用户ID，复杂参数请使用JSON对象字符串，如{id: 1}
+	TokenId   int       `json:"tokenId"` // 通过个人访问令牌操作时的令牌ID，0表示通过登录会话操作
 }
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 登录失败统计对象类型
+const (
+	ThrottleKindUser     = "user"     // 用户账号，统计对象为用户ID
+	ThrottleKindUsername = "username" // 不存在的用户名，与已存在的账号同样锁定，避免通过是否锁定判断用户名是否存在
+	ThrottleKindIP       = "ip"       // 来源IP
+)
+
+// LoginThrottle 登录失败记录
+// 按账号与来源IP分别统计登录失败次数，达到上限后锁定一段时间，锁定时长随连续锁定次数加倍。
+type LoginThrottle struct {
+	ID          int        `gorm:"autoIncrement" json:"id"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	Kind        string     `gorm:"size:16;uniqueIndex:idx_login_throttles_key" json:"kind"`    // 统计对象类型，见 ThrottleKindUser 等
+	Target      string     `gorm:"size:128;uniqueIndex:idx_login_throttles_key" json:"target"` // 用户ID、用户名或IP
+	Failures    int        `json:"failures"`                                                   // 统计窗口内的失败次数，锁定后清零
+	Locks       int        `json:"locks"`                                                      // 连续锁定次数，用于计算锁定时长
+	LastFailAt  time.Time  `gorm:"index" json:"lastFailAt"`                                    // 最近失败时间
+	LockedUntil *time.Time `json:"lockedUntil"`                                                // 锁定截止时间，为空表示从未锁定
+}
+
+// Locked 当前是否处于锁定状态
+func (c *LoginThrottle) Locked(now time.Time) bool {
+	return c.LockedUntil != nil && now.Before(*c.LockedUntil)
+}
+
+func (c *LoginThrottle) MarshalJSON() ([]byte, error) {
+	type Alias LoginThrottle
+	var lockedUntil *DateTime
+	if c.LockedUntil != nil {
+		t := DateTime(*c.LockedUntil)
+		lockedUntil = &t
+	}
+	return json.Marshal(&struct {
+		*Alias
+		UpdatedAt   DateTime  `json:"updatedAt"`
+		LastFailAt  DateTime  `json:"lastFailAt"`
+		LockedUntil *DateTime `json:"lockedUntil"`
+	}{
+		(*Alias)(c),
+		DateTime(c.UpdatedAt),
+		DateTime(c.LastFailAt),
+		lockedUntil,
+	})
+}
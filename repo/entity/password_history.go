@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// PasswordHistory 用户历史口令
+// 用户修改口令时记录被替换的口令摘要，新口令不能与最近使用过的口令相同。
+type PasswordHistory struct {
+	ID        int       `gorm:"autoIncrement" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`           // 口令被替换的时间
+	UserID    int       `gorm:"index" json:"userId"` // 用户ID
+	Password  Pwd       `gorm:"size:128" json:"-"`   // 口令加盐摘要，格式见 reuint.GenPasswordSalt
+	Salt      string    `gorm:"size:64" json:"-"`    // 盐值Hex
+}
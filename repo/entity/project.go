@@ -16,6 +16,7 @@ type Project struct {
 	Manager     int       `json:"manager"`     // 项目负责人ID
 	Version     string    `json:"version"`     // 版本号
 	IsDelete    int       `json:"isDelete"`    // 是否删除 0 - 未删除（默认值） 1 - 删除
+	IsArchive   int       `json:"isArchive"`   // 是否归档 0 - 未归档（默认值） 1 - 归档，归档的项目只读
 }
 
 func (c *Project) MarshalJson() ([]byte, error) {
@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 项目彻底删除任务状态
+const (
+	PurgeRunning = "running" // 进行中
+	PurgeDone    = "done"    // 完成
+	PurgeFailed  = "failed"  // 失败，可重新发起
+)
+
+// ProjectPurgeJob 项目彻底删除任务
+// 彻底删除项目的所有数据记录以及对接文档、技术方案目录，任务记录在项目删除后保留。
+type ProjectPurgeJob struct {
+	ID          int       `gorm:"autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	ProjectId   int       `gorm:"index" json:"projectId"`      // 项目ID
+	ProjectName string    `gorm:"size:256" json:"projectName"` // 项目名称
+	OpId        int       `json:"opId"`                        // 发起任务的管理员ID
+	Status      string    `gorm:"size:16" json:"status"`       // 任务状态，见 PurgeRunning
+	Removed     string    `gorm:"size:1024" json:"removed"`    // 删除的内容，JSON对象，如 {"documents":3,"docDirs":3}
+	Error       string    `gorm:"size:512" json:"error"`       // 失败原因
+}
+
+func (c *ProjectPurgeJob) MarshalJSON() ([]byte, error) {
+	type Alias ProjectPurgeJob
+	removed := map[string]int64{}
+	if c.Removed != "" {
+		_ = json.Unmarshal([]byte(c.Removed), &removed)
+	}
+	return json.Marshal(&struct {
+		*Alias
+		CreatedAt DateTime         `json:"createdAt"`
+		UpdatedAt DateTime         `json:"updatedAt"`
+		Removed   map[string]int64 `json:"removed"`
+	}{
+		(*Alias)(c),
+		DateTime(c.CreatedAt),
+		DateTime(c.UpdatedAt),
+		removed,
+	})
+}
@@ -0,0 +1,123 @@
+package entity
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// 项目权限
+const (
+	PermProjectRead  = "project.read"  // 查看项目内容，包括成员、接口分类与用例
+	PermDocWrite     = "doc.write"     // 编辑对接文档
+	PermDocExport    = "doc.export"    // 导出与生成对接文档
+	PermCaseWrite    = "case.write"    // 维护接口分类与用例
+	PermCaseRun      = "case.run"      // 执行接口用例
+	PermMemberManage = "member.manage" // 管理项目成员
+	PermRoleManage   = "role.manage"   // 管理项目自定义角色
+)
+
+// Permission 项目权限说明
+type Permission struct {
+	Name string `json:"name"` // 权限名称
+	Desc string `json:"desc"` // 权限说明
+}
+
+// Permissions 所有项目权限
+var Permissions = []Permission{
+	{PermProjectRead, "查看项目内容，包括成员、接口分类与用例"},
+	{PermDocWrite, "编辑对接文档"},
+	{PermDocExport, "导出与生成对接文档"},
+	{PermCaseWrite, "维护接口分类与用例"},
+	{PermCaseRun, "执行接口用例"},
+	{PermMemberManage, "管理项目成员"},
+	{PermRoleManage, "管理项目自定义角色"},
+}
+
+// IsPermission 是否为已定义的项目权限
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnly 是否为只读权限，归档的项目中仅只读权限有效
+func ReadOnly(perm string) bool {
+	return perm == PermProjectRead || perm == PermDocExport
+}
+
+// 内置项目角色编号
+const (
+	RoleDeveloper      = 0   // 开发者
+	RoleInterConnector = 1   // 对接者
+	RoleLeader         = 2   // 负责人，即项目的 Manager，每个项目仅有一个，具有所有权限
+	RoleManager        = 3   // 管理员
+	RoleCustomBase     = 100 // 项目自定义角色编号的起始值
+)
+
+// ProjectRole 项目角色
+// 内置角色的 ProjectId 为0，适用于所有项目；自定义角色仅在所属项目中可用。
+type ProjectRole struct {
+	ID          int       `gorm:"autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	ProjectId   int       `gorm:"uniqueIndex:idx_project_role" json:"projectId"` // 所属项目ID，内置角色为0
+	Role        int       `gorm:"uniqueIndex:idx_project_role" json:"role"`      // 角色编号，即 ProjectMember.Role
+	Name        string    `gorm:"size:64" json:"name"`                           // 角色名称
+	Permissions string    `gorm:"size:512" json:"permissions"`                   // 权限，多个用","隔开
+}
+
+// Builtin 是否为内置角色
+func (c *ProjectRole) Builtin() bool {
+	return c.ProjectId == 0
+}
+
+// HasPermission 是否具有权限
+func (c *ProjectRole) HasPermission(perm string) bool {
+	for _, p := range strings.Split(c.Permissions, ",") {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ProjectRole) MarshalJSON() ([]byte, error) {
+	type Alias ProjectRole
+	perms := []string{}
+	if c.Permissions != "" {
+		perms = strings.Split(c.Permissions, ",")
+	}
+	return json.Marshal(&struct {
+		*Alias
+		CreatedAt   DateTime `json:"createdAt"`
+		UpdatedAt   DateTime `json:"updatedAt"`
+		Permissions []string `json:"permissions"`
+		Builtin     bool     `json:"builtin"`
+	}{
+		(*Alias)(c),
+		DateTime(c.CreatedAt),
+		DateTime(c.UpdatedAt),
+		perms,
+		c.Builtin(),
+	})
+}
+
+// BuiltinRoles 内置角色的缺省权限
+func BuiltinRoles() []ProjectRole {
+	all := make([]string, 0, len(Permissions))
+	for _, p := range Permissions {
+		all = append(all, p.Name)
+	}
+	return []ProjectRole{
+		{Role: RoleDeveloper, Name: "开发者", Permissions: strings.Join([]string{
+			PermProjectRead, PermDocWrite, PermDocExport, PermCaseWrite, PermCaseRun}, ",")},
+		{Role: RoleInterConnector, Name: "对接者", Permissions: strings.Join([]string{
+			PermProjectRead, PermCaseRun}, ",")},
+		{Role: RoleLeader, Name: "负责人", Permissions: strings.Join(all, ",")},
+		{Role: RoleManager, Name: "管理员", Permissions: strings.Join(all, ",")},
+	}
+}
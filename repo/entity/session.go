@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Session 登录会话
+// 每次登录创建一个会话，会话ID即token中的jti，会话被撤销（删除）或过期后对应的token失效。
+type Session struct {
+	ID         string    `gorm:"primaryKey;size:32" json:"id"`                    // 会话ID
+	CreatedAt  time.Time `json:"createdAt"`                                       // 登录时间
+	UserType   string    `gorm:"size:16;index:idx_sessions_user" json:"userType"` // 用户类型: user - 用户、 admin - 管理员、 audit - 审计员
+	UserID     int       `gorm:"index:idx_sessions_user" json:"userId"`           // 用户ID或管理员ID
+	IP         string    `gorm:"size:64" json:"ip"`                               // 登录IP
+	UserAgent  string    `gorm:"size:256" json:"userAgent"`                       // 客户端标识
+	LastSeenAt time.Time `json:"lastSeenAt"`                                      // 最近访问时间
+	ExpiresAt  time.Time `gorm:"index" json:"expiresAt"`                          // 过期时间
+}
+
+func (c *Session) MarshalJSON() ([]byte, error) {
+	type Alias Session
+	return json.Marshal(&struct {
+		*Alias
+		CreatedAt  DateTime `json:"createdAt"`
+		LastSeenAt DateTime `json:"lastSeenAt"`
+		ExpiresAt  DateTime `json:"expiresAt"`
+	}{
+		(*Alias)(c),
+		DateTime(c.CreatedAt),
+		DateTime(c.LastSeenAt),
+		DateTime(c.ExpiresAt),
+	})
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// SsoState 单点登录授权请求
+// 跳转到身份提供方前创建，回调时校验并删除，每个 state 仅能使用一次。
+type SsoState struct {
+	ID        string    `gorm:"primaryKey;size:64" json:"id"` // state 的SM3摘要Hex，不保存 state 原文
+	CreatedAt time.Time `json:"createdAt"`                    // 创建时间
+	Provider  string    `gorm:"size:32" json:"provider"`      // 身份提供方标识
+	Nonce     string    `gorm:"size:64" json:"-"`             // 写入 ID Token 的 nonce
+	Verifier  string    `gorm:"size:64" json:"-"`             // PKCE code_verifier
+	Redirect  string    `gorm:"size:256" json:"redirect"`     // 登录后跳转的前端地址
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`       // 过期时间
+}
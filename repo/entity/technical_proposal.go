@@ -9,4 +9,5 @@ type TechnicalProposal struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 	Name      string    `json:"name"` // 技术方案文件夹名称
 	ProjectId int       `json:"projectId"`
+	Dir       string    `gorm:"size:512" json:"dir"` // 技术方案所在的项目目录，生成时记录，项目改名后不变
 }
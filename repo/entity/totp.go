@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ConfigTotpPolicy 动态口令策略配置项，内容为 TotpPolicy 的JSON
+const ConfigTotpPolicy = "totp_policy"
+
+// TotpPolicy 动态口令策略
+// 策略要求使用动态口令的用户，未绑定时需在登录时先完成绑定。
+type TotpPolicy struct {
+	Required bool  `json:"required"` // 所有用户必须使用动态口令
+	Roles    []int `json:"roles"`    // 担任这些项目角色的用户必须使用动态口令，如对接者可以访问客户的对接文档
+}
+
+// TotpRecoveryCode 动态口令恢复码
+// 用户无法使用身份验证器时，可以使用恢复码代替动态口令登录，每个恢复码仅能使用一次。
+type TotpRecoveryCode struct {
+	ID        int        `gorm:"autoIncrement" json:"id"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UserID    int        `gorm:"index" json:"userId"` // 用户ID
+	Hash      string     `gorm:"size:64" json:"-"`    // 恢复码SM3摘要Hex
+	UsedAt    *time.Time `json:"usedAt"`              // 使用时间，未使用为空
+}
+
+func (c *TotpRecoveryCode) MarshalJSON() ([]byte, error) {
+	type Alias TotpRecoveryCode
+	var usedAt *DateTime
+	if c.UsedAt != nil {
+		t := DateTime(*c.UsedAt)
+		usedAt = &t
+	}
+	return json.Marshal(&struct {
+		*Alias
+		CreatedAt DateTime  `json:"createdAt"`
+		UsedAt    *DateTime `json:"usedAt"`
+	}{
+		(*Alias)(c),
+		DateTime(c.CreatedAt),
+		usedAt,
+	})
+}
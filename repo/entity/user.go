@@ -6,33 +6,49 @@ import (
 )
 
 type User struct {
-	ID           int       `gorm:"autoIncrement" json:"id"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
-	Openid       string    `json:"openid"` // 开放ID 用于关联三方系统，可以是工号
-	Name         string    `json:"name"`
-	NamePinyin   string    `json:"namePinyin"`
-	Password     Pwd       `json:"password"`      //口令加盐摘要Hex
-	Salt         string    `json:"-"`             // 盐值Hex
-	Username     string    `json:"username"`      // 用户名【唯一】
-	Phone        string    `json:"phone"`         // 手机号
-	Email        string    `json:"email"`         // 邮箱
-	Sn           string    `json:"sn"`            // 身份证号
-	QQOpenid     string    `json:"qq_openid"`     // QQ Openid
-	WechatOpenid string    `json:"wechat_openid"` // 微信 Openid
-	Avatar       string    `json:"avatar"`        // 头像 文件名
-	IsDelete     int       `json:"isDelete"`      // 是否删除 0 - 未删除（默认值） 1 - 删除
+	ID           int        `gorm:"autoIncrement" json:"id"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	Openid       string     `json:"openid"` // 开放ID 用于关联三方系统，可以是工号
+	Name         string     `json:"name"`
+	NamePinyin   string     `json:"namePinyin"`
+	Password     Pwd        `json:"password"`              // 口令加盐摘要，格式见 reuint.GenPasswordSalt
+	Salt         string     `json:"-"`                     // 盐值Hex
+	Username     string     `json:"username"`              // 用户名【唯一】
+	Phone        string     `json:"phone"`                 // 手机号
+	Email        string     `json:"email"`                 // 邮箱
+	Sn           string     `json:"sn"`                    // 身份证号
+	QQOpenid     string     `json:"qq_openid"`             // QQ Openid
+	WechatOpenid string     `json:"wechat_openid"`         // 微信 Openid
+	Avatar       string     `json:"avatar"`                // 头像 文件名
+	IsDelete     int        `json:"isDelete"`              // 是否删除 0 - 未删除（默认值） 1 - 删除
+	MustChgPwd   int        `json:"mustChgPwd"`            // 是否需修改口令 0 - 否（默认值） 1 - 是，创建用户与重置口令后为1，修改口令后为0
+	PwdChangedAt *time.Time `json:"pwdChangedAt"`          // 口令修改时间，用于判断口令是否过期
+	TotpEnabled  int        `json:"totpEnabled"`           // 是否已启用动态口令 0 - 否（默认值） 1 - 是
+	TotpSecret   string     `gorm:"size:64" json:"-"`      // 动态口令密钥Base32，绑定过程中生成，启用后登录时需验证动态口令
+	TotpStep     int64      `json:"-"`                     // 上次验证通过的动态口令时间步，用于防止动态口令重放
+	Source       string     `gorm:"size:16" json:"source"` // 用户来源 空 - 本地用户（默认值） ldap - 目录服务，目录用户使用目录口令登录
 }
 
+// UserSourceLDAP 目录服务创建或同步的用户
+const UserSourceLDAP = "ldap"
+
 func (c *User) MarshalJSON() ([]byte, error) {
 	type Alias User
+	var pwdChangedAt *DateTime
+	if c.PwdChangedAt != nil {
+		t := DateTime(*c.PwdChangedAt)
+		pwdChangedAt = &t
+	}
 	return json.Marshal(&struct {
 		*Alias
-		CreatedAt DateTime `json:"createdAt"`
-		UpdatedAt DateTime `json:"updatedAt"`
+		CreatedAt    DateTime  `json:"createdAt"`
+		UpdatedAt    DateTime  `json:"updatedAt"`
+		PwdChangedAt *DateTime `json:"pwdChangedAt"`
 	}{
 		(*Alias)(c),
 		DateTime(c.CreatedAt),
 		DateTime(c.UpdatedAt),
+		pwdChangedAt,
 	})
 }
@@ -2,11 +2,14 @@ package repo
 
 import (
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"log"
+	"os"
+	"path/filepath"
 	"pdm/appconf"
 	"strings"
 	"time"
@@ -27,7 +30,7 @@ var (
 func Init(config *appconf.Application) error {
 	var err error
 	zap.L().Info("连接数据库",
-		zap.String("dsn", config.Database.DSN),
+		zap.String("dsn", appconf.RedactDSN(config.Database.DSN)),
 		zap.String("type", config.Database.Type))
 	config.Database.Type = strings.ToLower(config.Database.Type)
 
@@ -46,6 +49,8 @@ func Init(config *appconf.Application) error {
 	switch config.Database.Type {
 	case "mysql", "mariadb":
 		dialector = mysql.Open(config.Database.DSN)
+	case "sqlite", "sqlite3":
+		dialector = sqlite.Open(sqliteDSN(config.Database.DSN))
 	default:
 		err = fmt.Errorf("未知的数据库类型: %s", config.Database.Type)
 	}
@@ -66,3 +71,36 @@ func Init(config *appconf.Application) error {
 	CaseRepo = NewCaseRepository()
 	return nil
 }
+
+// Close 关闭数据库连接
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// sqliteDSN 规范化SQLite连接地址
+// 相对路径的数据库文件以可执行程序所在目录为基础，
+// 未指定连接参数时默认开启WAL日志模式并设置锁等待时间，避免日志精灵与业务请求并发写入时出现 database is locked。
+func sqliteDSN(dsn string) string {
+	if dsn == "" {
+		dsn = "pdm.db"
+	}
+	file, query, _ := strings.Cut(dsn, "?")
+	if file != ":memory:" && !strings.HasPrefix(file, "file:") && !filepath.IsAbs(file) {
+		base, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+		file = filepath.Join(base, file)
+	}
+	if !strings.Contains(query, "_pragma") {
+		if query != "" {
+			query += "&"
+		}
+		query += "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	}
+	return file + "?" + query
+}
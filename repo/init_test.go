@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"pdm/appconf"
+	"pdm/repo/entity"
+	"testing"
+	"time"
+)
+
+// initSqlite 使用临时目录下的SQLite数据库初始化持久层
+func initSqlite(t *testing.T) {
+	t.Helper()
+	cfg := &appconf.Application{Database: appconf.Database{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "pdm.db"),
+	}}
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := DB.DB()
+		_ = sqlDB.Close()
+	})
+}
+
+// execScript 执行SQL脚本
+func execScript(t *testing.T, name string) {
+	t.Helper()
+	script, err := os.ReadFile(filepath.Join("..", "sql", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = DB.Exec(string(script)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInit_Sqlite(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+
+	user := entity.User{Openid: "1001", Name: "张三", NamePinyin: "zs", Username: "zhangsan"}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	logs := []entity.Log{
+		{OpType: 2, OpId: user.ID, OpName: "创建项目", OpParam: "{}"},
+		{OpType: 1, OpId: 1, OpName: "删除用户", OpParam: "{}"},
+	}
+	if err := DB.Create(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 操作日志联表查询
+	type oplog struct {
+		ID     int
+		OpType int
+		UserID int
+		Name   string
+		OpName string
+	}
+	var res []oplog
+	err := DB.Table("logs").
+		Select("logs.id AS log_id,logs.created_at,logs.op_type,logs.op_id,logs.op_name,logs.op_param,users.id AS user_id, users.name").
+		Joins("left join users ON logs.op_id = users.id AND logs.op_type = 2 ").
+		Where("logs.created_at BETWEEN ? AND ? ", now.Add(-time.Minute), now.Add(time.Minute)).
+		Where("logs.op_name like ?", "%项目%").
+		Order("logs.created_at desc").
+		Find(&res).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].UserID != user.ID || res[0].Name != "张三" {
+		t.Fatalf("unexpected oplog result: %+v", res)
+	}
+
+	// 超时日志清理
+	if err = DB.Where("created_at < ?", now.Add(time.Minute)).Delete(&entity.Log{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	DB.Model(&entity.Log{}).Count(&total)
+	if total != 0 {
+		t.Fatalf("expect all logs deleted, but %d left", total)
+	}
+
+	// 用户模糊查询
+	exist, err := UserRepo.ExistOpenid("1001")
+	if err != nil || !exist {
+		t.Fatalf("expect openid exist, err: %v", err)
+	}
+	var names []entity.User
+	queryPinyin := DB.Where("name_pinyin like ?", "%z%")
+	queryName := DB.Where("name like ?", "%z%")
+	err = DB.Model(&entity.User{}).Where("is_delete", 0).Where(queryPinyin.Or(queryName)).Find(&names).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expect 1 user, got %d", len(names))
+	}
+}
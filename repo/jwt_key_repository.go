@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pdm/repo/entity"
+	"time"
+)
+
+// JwtKeyRepository 登录token签名密钥支持层
+// 密钥保存在数据库中，多个实例共享同一密钥环。
+type JwtKeyRepository struct {
+}
+
+func NewJwtKeyRepository() *JwtKeyRepository {
+	return &JwtKeyRepository{}
+}
+
+// Get 获取密钥，密钥不存在时返还 nil
+func (r *JwtKeyRepository) Get(kid string) ([]byte, error) {
+	var key entity.JwtKey
+	if err := DB.Limit(1).Find(&key, "id = ?", kid).Error; err != nil {
+		return nil, err
+	}
+	if key.ID == "" {
+		return nil, nil
+	}
+	return hex.DecodeString(key.Secret)
+}
+
+// Create 创建密钥，同时清理已过期的密钥
+// 多个实例同时创建同一密钥时仅第一个写入的密钥生效，均返还生效的密钥。
+func (r *JwtKeyRepository) Create(kid string, expires time.Time) ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := &entity.JwtKey{ID: kid, Secret: hex.EncodeToString(secret), ExpiresAt: expires}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&entity.JwtKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(kid)
+}
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"bytes"
+	"pdm/repo/entity"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJwtKeyRepository(t *testing.T) {
+	initSqlite(t)
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewJwtKeyRepository()
+	if key, err := r.Get("20261017T000000Z"); err != nil || key != nil {
+		t.Fatalf("expect no key, got %x %v", key, err)
+	}
+
+	// 多个实例同时创建同一密钥，均得到第一个写入的密钥
+	keys := make([][]byte, 4)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if keys[i], err = r.Create("20261017T000000Z", time.Now().Add(time.Hour)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, key := range keys[1:] {
+		if len(key) != 32 || !bytes.Equal(key, keys[0]) {
+			t.Fatalf("expect same key, got %x and %x", key, keys[0])
+		}
+	}
+
+	// 创建新密钥时清理已过期的密钥
+	DB.Model(&entity.JwtKey{}).Where("id = ?", "20261017T000000Z").Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := r.Create("20261017T120000Z", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := r.Get("20261017T000000Z"); key != nil {
+		t.Fatal("expired key not removed")
+	}
+}
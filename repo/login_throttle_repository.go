@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pdm/repo/entity"
+	"time"
+)
+
+// ThrottlePolicy 登录失败限制策略
+type ThrottlePolicy struct {
+	AccountFailures int           // 同一账号连续失败次数上限
+	IPFailures      int           // 同一IP失败次数上限
+	Window          time.Duration // 统计窗口，超过该时间未再失败则失败次数清零
+	LockTime        time.Duration // 首次锁定时长
+	MaxLockTime     time.Duration // 最长锁定时长，锁定结束后超过该时间未再锁定则连续锁定次数清零
+}
+
+// LockDuration 第 locks 次连续锁定的锁定时长，每次加倍，不超过最长锁定时长
+func (p *ThrottlePolicy) LockDuration(locks int) time.Duration {
+	d := p.LockTime
+	for i := 1; i < locks && d < p.MaxLockTime; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockTime {
+		d = p.MaxLockTime
+	}
+	return d
+}
+
+// LoginThrottleRepository 登录失败记录支持层
+type LoginThrottleRepository struct {
+	policy *ThrottlePolicy
+	now    func() time.Time
+}
+
+func NewLoginThrottleRepository(policy *ThrottlePolicy) *LoginThrottleRepository {
+	return &LoginThrottleRepository{policy: policy, now: time.Now}
+}
+
+// LockedUntil 查询锁定截止时间，未锁定时返还 nil
+// kind: 统计对象类型，见 entity.ThrottleKindUser 等
+// target: 用户ID、用户名或IP
+func (r *LoginThrottleRepository) LockedUntil(kind, target string) (*time.Time, error) {
+	var record entity.LoginThrottle
+	err := DB.Where("kind = ? AND target = ?", kind, target).Limit(1).Find(&record).Error
+	if err != nil || !record.Locked(r.now()) {
+		return nil, err
+	}
+	return record.LockedUntil, nil
+}
+
+// Fail 记录一次登录失败，返还失败后的记录，失败次数达到上限时锁定
+// 同时清理已过统计窗口且不再影响锁定时长的记录。
+func (r *LoginThrottleRepository) Fail(kind, target string) (*entity.LoginThrottle, error) {
+	now := r.now()
+	limit := r.policy.AccountFailures
+	if kind == entity.ThrottleKindIP {
+		limit = r.policy.IPFailures
+	}
+	res := &entity.LoginThrottle{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 多个实例同时记录同一对象的首次失败时，仅有一个能创建成功
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&entity.LoginThrottle{Kind: kind, Target: target, LastFailAt: now}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("kind = ? AND target = ?", kind, target).First(res).Error
+		if err != nil {
+			return err
+		}
+		if now.Sub(res.LastFailAt) > r.policy.Window {
+			res.Failures = 0
+		}
+		if res.LockedUntil != nil && now.Sub(*res.LockedUntil) > r.policy.MaxLockTime {
+			res.Locks = 0
+		}
+		res.Failures++
+		res.LastFailAt = now
+		if res.Failures >= limit {
+			res.Failures = 0
+			res.Locks++
+			until := now.Add(r.policy.LockDuration(res.Locks))
+			res.LockedUntil = &until
+		}
+		return tx.Model(res).Select("failures", "locks", "last_fail_at", "locked_until").Updates(res).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Where("last_fail_at < ? AND (locked_until IS NULL OR locked_until < ?)",
+		now.Add(-r.policy.Window), now.Add(-r.policy.MaxLockTime)).Delete(&entity.LoginThrottle{}).Error
+	return res, err
+}
+
+// Succeed 登录成功，清除账号的失败记录
+func (r *LoginThrottleRepository) Succeed(kind, target string) error {
+	return DB.Where("kind = ? AND target = ?", kind, target).Delete(&entity.LoginThrottle{}).Error
+}
+
+// Clear 解除锁定，删除失败记录，返还删除的记录数
+func (r *LoginThrottleRepository) Clear(ids ...int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := DB.Where("id IN ?", ids).Delete(&entity.LoginThrottle{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"pdm/repo/entity"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleRepository_Fail(t *testing.T) {
+	initSqlite(t)
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.Local)
+	r := NewLoginThrottleRepository(&ThrottlePolicy{
+		AccountFailures: 3,
+		IPFailures:      5,
+		Window:          15 * time.Minute,
+		LockTime:        10 * time.Minute,
+		MaxLockTime:     30 * time.Minute,
+	})
+	r.now = func() time.Time { return now }
+	fail := func(n int, kind, target string) *entity.LoginThrottle {
+		var res *entity.LoginThrottle
+		var err error
+		for i := 0; i < n; i++ {
+			if res, err = r.Fail(kind, target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	locked := func(kind, target string) time.Duration {
+		until, err := r.LockedUntil(kind, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if until == nil {
+			return 0
+		}
+		return until.Sub(now)
+	}
+
+	// 未达到上限不锁定，超过统计窗口后重新计数
+	fail(2, entity.ThrottleKindUser, "1")
+	now = now.Add(16 * time.Minute)
+	if res := fail(2, entity.ThrottleKindUser, "1"); res.Failures != 2 || locked(entity.ThrottleKindUser, "1") != 0 {
+		t.Fatalf("unexpected record: %+v", res)
+	}
+	// 达到上限锁定，锁定时长逐次加倍，不超过最长锁定时长
+	for _, expect := range []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute, 30 * time.Minute} {
+		fail(1, entity.ThrottleKindUser, "1")
+		if d := locked(entity.ThrottleKindUser, "1"); d != expect {
+			t.Fatalf("expect locked %v, got %v", expect, d)
+		}
+		now = now.Add(expect)
+		if d := locked(entity.ThrottleKindUser, "1"); d != 0 {
+			t.Fatalf("expect unlocked, got %v", d)
+		}
+		fail(2, entity.ThrottleKindUser, "1")
+	}
+	// 锁定结束后超过最长锁定时长未再锁定，锁定时长恢复
+	now = now.Add(31 * time.Minute)
+	if res := fail(3, entity.ThrottleKindUser, "1"); res.Locks != 1 || locked(entity.ThrottleKindUser, "1") != 10*time.Minute {
+		t.Fatalf("unexpected record: %+v", res)
+	}
+
+	// IP与账号分别统计
+	fail(4, entity.ThrottleKindIP, "10.0.0.1")
+	if locked(entity.ThrottleKindIP, "10.0.0.1") != 0 || locked(entity.ThrottleKindUser, "2") != 0 {
+		t.Fatal("unexpected lock")
+	}
+	if res := fail(1, entity.ThrottleKindIP, "10.0.0.1"); res.Locks != 1 {
+		t.Fatalf("unexpected record: %+v", res)
+	}
+
+	// 登录成功清除账号记录，过期记录被清理
+	if err := r.Succeed(entity.ThrottleKindUser, "1"); err != nil {
+		t.Fatal(err)
+	}
+	fail(1, entity.ThrottleKindUsername, "nobody")
+	now = now.Add(time.Hour)
+	fail(1, entity.ThrottleKindUsername, "other")
+	var records []entity.LoginThrottle
+	DB.Order("id").Find(&records)
+	if len(records) != 1 || records[0].Target != "other" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if n, err := r.Clear(records[0].ID); err != nil || n != 1 {
+		t.Fatalf("clear: %d %v", n, err)
+	}
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+)
+
+// Migration 数据库版本迁移
+// 每个迁移都必须是幂等的，即重复执行不会产生副作用，
+// 因为部分数据库（如MySQL）的DDL语句无法回滚，迁移中途失败后需要能够重新执行。
+type Migration struct {
+	Version string                  // 版本号 格式 YYYYMMDDNN，按字符串顺序递增
+	Desc    string                  // 迁移描述
+	Up      func(tx *gorm.DB) error // 升级操作
+}
+
+// ErrDBVersionTooNew 数据库版本高于程序版本
+var ErrDBVersionTooNew = errors.New("数据库版本高于程序支持的版本，请升级程序")
+
+// LatestVersion 程序支持的最新数据库版本号
+func LatestVersion() string {
+	return migrations[len(migrations)-1].Version
+}
+
+// CurrentVersion 获取数据库当前版本号，未记录版本号时返还空字符串
+func CurrentVersion() (string, error) {
+	if !DB.Migrator().HasTable(&entity.Config{}) {
+		return "", nil
+	}
+	var cfg entity.Config
+	err := DB.First(&cfg, "item_name = ?", entity.ConfigDBVersion).Error
+	if err == gorm.ErrRecordNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return cfg.Content, nil
+}
+
+// Migrate 将数据库升级到最新版本
+// 若数据库版本高于程序支持的版本则拒绝执行并返还 ErrDBVersionTooNew
+func Migrate() error {
+	current, err := CurrentVersion()
+	if err != nil {
+		return err
+	}
+	latest := LatestVersion()
+	if current > latest {
+		return fmt.Errorf("%w，数据库版本: %s 程序版本: %s", ErrDBVersionTooNew, current, latest)
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		zap.L().Info("数据库迁移", zap.String("version", m.Version), zap.String("desc", m.Desc))
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return setVersion(tx, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("数据库迁移 %s 失败，%w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// setVersion 记录数据库版本号
+func setVersion(tx *gorm.DB, version string) error {
+	var cfg entity.Config
+	err := tx.First(&cfg, "item_name = ?", entity.ConfigDBVersion).Error
+	if err == gorm.ErrRecordNotFound {
+		return tx.Create(&entity.Config{ItemName: entity.ConfigDBVersion, Content: version}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Model(&cfg).Update("content", version).Error
+}
+
+// createTables 创建不存在的表，已存在的表不做修改
+func createTables(tx *gorm.DB, models ...interface{}) error {
+	for _, model := range models {
+		if tx.Migrator().HasTable(model) {
+			continue
+		}
+		if err := tx.Migrator().CreateTable(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumns 为已存在的表添加缺失的字段
+// fields: 结构体字段名称
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package repo
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+	"math/big"
+	"pdm/repo/entity"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	initSqlite(t)
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	version, err := CurrentVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != LatestVersion() {
+		t.Fatalf("expect version %s, got %s", LatestVersion(), version)
+	}
+	var admins int64
+	DB.Model(&entity.Admin{}).Count(&admins)
+	if admins != 2 {
+		t.Fatalf("expect 2 default admins, got %d", admins)
+	}
+
+	// 重复执行不产生副作用
+	DB.Model(&entity.Config{}).Where("item_name = ?", entity.ConfigDBVersion).Update("content", "")
+	if err = Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	DB.Model(&entity.Admin{}).Count(&admins)
+	if admins != 2 {
+		t.Fatalf("expect 2 default admins after rerun, got %d", admins)
+	}
+	var versions int64
+	DB.Model(&entity.Config{}).Where("item_name = ?", entity.ConfigDBVersion).Count(&versions)
+	if versions != 1 {
+		t.Fatalf("expect 1 version record, got %d", versions)
+	}
+
+	// 数据库版本高于程序版本
+	DB.Model(&entity.Config{}).Where("item_name = ?", entity.ConfigDBVersion).Update("content", "9999999999")
+	if err = Migrate(); !errors.Is(err, ErrDBVersionTooNew) {
+		t.Fatalf("expect ErrDBVersionTooNew, got %v", err)
+	}
+}
+
+func TestMigrate_FromScript(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var admins int64
+	DB.Model(&entity.Admin{}).Count(&admins)
+	if admins != 2 {
+		t.Fatalf("expect 2 admins, got %d", admins)
+	}
+}
+
+func TestMigrate_AdminCert(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	// 早期版本管理员表的单个证书字段
+	key, _ := sm2.GenerateKey(rand.Reader)
+	tmpl := &smx509.Certificate{
+		SerialNumber: big.NewInt(10),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := smx509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := base64.StdEncoding.EncodeToString(der)
+	if err = DB.Exec("ALTER TABLE admins ADD COLUMN cert TEXT").Error; err != nil {
+		t.Fatal(err)
+	}
+	DB.Exec("UPDATE admins SET cert = ? WHERE id = 1", raw)
+	DB.Exec("UPDATE admins SET cert = 'invalid' WHERE id = 2")
+
+	if err = Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if DB.Migrator().HasColumn(&entity.Admin{}, "cert") {
+		t.Fatal("expect cert column dropped")
+	}
+	var certs []entity.AdminCert
+	DB.Find(&certs)
+	if len(certs) != 1 || certs[0].AdminID != 1 || certs[0].Cert != raw || certs[0].Serial != "a" || certs[0].Subject != "CN=admin" {
+		t.Fatalf("unexpected certs: %+v", certs)
+	}
+	var admins int64
+	DB.Model(&entity.Admin{}).Where("disabled = 0").Count(&admins)
+	if admins != 2 {
+		t.Fatalf("expect 2 enabled admins, got %d", admins)
+	}
+}
+
+func TestMigrate_ProjectRole(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	// 未定义的角色编号不做修改
+	DB.Exec("INSERT INTO projects (id, name, manager, is_delete) VALUES (1, 'p', 3, 0)")
+	DB.Exec("INSERT INTO project_members (project_id, user_id, role) VALUES (1, 3, 2), (1, 4, 1), (1, 6, 4)")
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	roles, err := NewProjectRoleRepository().List(1)
+	if err != nil || len(roles) != 4 {
+		t.Fatalf("unexpected roles: %+v %v", roles, err)
+	}
+	leader, err := NewProjectRoleRepository().MemberRole(1, 3)
+	if err != nil || leader == nil || leader.Role != entity.RoleLeader || !leader.HasPermission(entity.PermRoleManage) {
+		t.Fatalf("unexpected leader role: %+v %v", leader, err)
+	}
+	member, err := NewProjectRoleRepository().MemberRole(1, 4)
+	if err != nil || member == nil || member.HasPermission(entity.PermDocWrite) || !member.HasPermission(entity.PermCaseRun) {
+		t.Fatalf("unexpected member role: %+v %v", member, err)
+	}
+	if role, _ := NewProjectRoleRepository().MemberRole(1, 5); role != nil {
+		t.Fatal("expect nil role for non-member")
+	}
+	unknown, err := NewProjectRoleRepository().MemberRole(1, 6)
+	if err != nil || unknown == nil || unknown.Role != 4 || unknown.HasPermission(entity.PermProjectRead) {
+		t.Fatalf("expect unknown role kept without permission: %+v %v", unknown, err)
+	}
+}
+
+func TestMigrate_CaseProject(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	DB.Exec("ALTER TABLE api_cases DROP COLUMN project_id")
+	DB.Exec("INSERT INTO projects (id, name, manager, is_delete) VALUES (7, 'a', 3, 0), (8, 'b', 4, 0), (9, 'c', 0, 1)")
+	DB.Exec("INSERT INTO project_members (project_id, user_id, role) VALUES (8, 4, 2), (9, 4, 0)")
+	DB.Exec("INSERT INTO api_categorizes (id, name, project_id) VALUES (1, 'c', 7)")
+	// 根用例由创建人唯一所在的项目补全，已删除的项目不计入
+	DB.Exec("INSERT INTO api_cases (id, name, categorize_id, user_id) VALUES (1, 'a', 1, 4), (2, 'b', 0, 3), (3, 'c', 0, 4)")
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var cases []entity.ApiCase
+	DB.Order("id").Find(&cases)
+	if len(cases) != 3 || cases[0].ProjectId != 7 || cases[1].ProjectId != 7 || cases[2].ProjectId != 8 {
+		t.Fatalf("unexpected cases: %+v", cases)
+	}
+	ok, err := NewResourceRepository().Belong(ResourceCase, 7, 1, 2)
+	if err != nil || !ok {
+		t.Fatalf("expect case 1, 2 belongs to project 7: %v", err)
+	}
+	if ok, _ = NewResourceRepository().Belong(ResourceCase, 7, 1, 3); ok {
+		t.Fatal("expect case 3 not belongs to project 7")
+	}
+}
+
+func TestMigrate_CaseProjectUnresolved(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	DB.Exec("ALTER TABLE api_cases DROP COLUMN project_id")
+	DB.Exec("INSERT INTO projects (id, name, manager, is_delete) VALUES (7, 'a', 3, 0), (8, 'b', 0, 0)")
+	DB.Exec("INSERT INTO project_members (project_id, user_id, role) VALUES (8, 3, 0)")
+	// 创建人属于多个项目、无创建人的根用例无法确定项目，迁移不中止，所属项目为0
+	DB.Exec("INSERT INTO api_cases (id, name, categorize_id, user_id) VALUES (1, 'a', 0, 3), (2, 'b', 0, 0)")
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	cases := NewCaseRepository()
+	list, err := cases.Orphans()
+	if err != nil || len(list) != 2 || list[0].ID != 1 || list[1].ID != 2 {
+		t.Fatalf("expect orphan cases [1 2], got %+v %v", list, err)
+	}
+
+	// 管理员移入项目后可在项目中访问
+	for _, c := range []struct {
+		id, projectId int
+		err           error
+	}{
+		{1, 9, ErrProjectNotFound},
+		{3, 8, ErrCaseNotOrphan},
+		{1, 8, nil},
+		{1, 7, ErrCaseNotOrphan},
+	} {
+		if err = cases.MoveOrphan(c.id, c.projectId); err != c.err {
+			t.Fatalf("move %d to %d: expect %v, got %v", c.id, c.projectId, c.err, err)
+		}
+	}
+	DB.Exec("UPDATE api_cases SET name = 'a' WHERE id = 2")
+	if err = cases.MoveOrphan(2, 8); err != ErrCaseNameExists {
+		t.Fatalf("expect ErrCaseNameExists, got %v", err)
+	}
+	ok, err := NewResourceRepository().Belong(ResourceCase, 8, 1)
+	if err != nil || !ok {
+		t.Fatalf("expect case belongs to project 8: %v", err)
+	}
+	if list, _ = cases.Orphans(); len(list) != 1 || list[0].ID != 2 {
+		t.Fatalf("expect orphan case [2], got %+v", list)
+	}
+}
+
+func TestMigrate_ProjectLeader(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	// 项目1 缺少负责人成员记录，项目2 存在两个负责人
+	DB.Exec("INSERT INTO projects (id, name, manager, is_delete) VALUES (1, 'a', 3, 0), (2, 'b', 4, 0)")
+	DB.Exec("INSERT INTO project_members (project_id, user_id, role) VALUES (1, 3, 0), (2, 4, 2), (2, 5, 2)")
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ projectId, userId, role int }{
+		{1, 3, entity.RoleLeader}, {2, 4, entity.RoleLeader}, {2, 5, entity.RoleManager},
+	} {
+		var m entity.ProjectMember
+		if err := DB.First(&m, "project_id = ? AND user_id = ?", c.projectId, c.userId).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.Role != c.role {
+			t.Fatalf("project %d user %d: expect role %d, got %d", c.projectId, c.userId, c.role, m.Role)
+		}
+	}
+}
+
+func TestMigrate_ProjectArchive(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	DB.Exec("ALTER TABLE projects DROP COLUMN is_archive")
+	DB.Exec("INSERT INTO projects (id, name, manager, is_delete) VALUES (1, 'a', 0, 0)")
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := ProjectRepo.Archived(1)
+	if err != nil || archived {
+		t.Fatalf("expect project not archived: %v", err)
+	}
+	var count int64
+	DB.Model(&entity.Project{}).Where("is_archive = 0").Count(&count)
+	if count != 1 {
+		t.Fatalf("expect is_archive backfilled, got %d", count)
+	}
+	if !DB.Migrator().HasTable(&entity.ProjectPurgeJob{}) {
+		t.Fatal("expect project_purge_jobs table")
+	}
+}
+
+func TestMigrate_TechnicalProposalDir(t *testing.T) {
+	initSqlite(t)
+	execScript(t, "sqlite.sql")
+	DB.Exec("ALTER TABLE technical_proposals DROP COLUMN dir")
+	DB.Exec("INSERT INTO projects (id, name, manager, is_delete) VALUES (1, 'a', 0, 0)")
+	DB.Exec("INSERT INTO technical_proposals (id, name, project_id) VALUES (1, 'x.md', 1)")
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	// 此前技术方案目录即为项目名称，改名后仍使用原目录
+	DB.Exec("UPDATE projects SET name = 'b' WHERE id = 1")
+	dir, err := NewTechnicalProposalRepository().Dir(1)
+	if err != nil || dir != "a" {
+		t.Fatalf("expect dir a, got %q %v", dir, err)
+	}
+	ids, err := NewTechnicalProposalRepository().Projects("a")
+	if err != nil || len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("unexpected projects of dir a: %v %v", ids, err)
+	}
+	ids, err = NewTechnicalProposalRepository().Projects("b")
+	if err != nil || len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("unexpected projects of dir b: %v %v", ids, err)
+	}
+}
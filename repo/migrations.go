@@ -0,0 +1,336 @@
+package repo
+
+import (
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"time"
+)
+
+// Models 所有持久化的实体模型，备份与恢复按该列表导出和导入数据表
+// 新增数据表时需要同时追加到该列表中
+var Models = []interface{}{
+	&entity.Admin{},
+	&entity.User{},
+	&entity.Project{},
+	&entity.ProjectMember{},
+	&entity.ApiCategorize{},
+	&entity.ApiCase{},
+	&entity.Document{},
+	&entity.TechnicalProposal{},
+	&entity.Log{},
+	&entity.Config{},
+	&entity.Session{},
+	&entity.JwtKey{},
+	&entity.AccessToken{},
+	&entity.PasswordHistory{},
+	&entity.TotpRecoveryCode{},
+	&entity.LoginThrottle{},
+	&entity.SsoState{},
+	&entity.AuthChallenge{},
+	&entity.AdminCert{},
+	&entity.ProjectRole{},
+	&entity.ProjectPurgeJob{},
+}
+
+// migrations 数据库迁移列表，按版本号升序排列，新的迁移只能追加在末尾
+var migrations = []Migration{
+	{
+		Version: "2023010501",
+		Desc:    "初始化数据库表结构",
+		Up: func(tx *gorm.DB) error {
+			err := createTables(tx,
+				&entity.Admin{},
+				&entity.User{},
+				&entity.Project{},
+				&entity.ProjectMember{},
+				&entity.ApiCategorize{},
+				&entity.ApiCase{},
+				&entity.Document{},
+				&entity.TechnicalProposal{},
+				&entity.Log{},
+				&entity.Config{},
+			)
+			if err != nil {
+				return err
+			}
+			// 早期的建表脚本缺少第三方账号字段
+			if err = addColumns(tx, &entity.User{}, "QQOpenid", "WechatOpenid"); err != nil {
+				return err
+			}
+			// 初始化默认的管理员和审计员
+			var total int64
+			if err = tx.Model(&entity.Admin{}).Count(&total).Error; err != nil {
+				return err
+			}
+			if total > 0 {
+				return nil
+			}
+			return tx.Create([]entity.Admin{
+				{
+					Username: "admin",
+					Password: "ba182cee746bc776a9bec5c73293dc730d517acf4a5f9c88213184739ef54693",
+					Salt:     "a79e9fc93a41399c0e2a87971434655f",
+					Role:     0,
+				},
+				{
+					Username: "audit",
+					Password: "9f1a7062905d2a4e208f92ecb56f967569762bdbd09f7e020414736e79067893",
+					Salt:     "9946f8047b368c6219ec246e3f4638cb",
+					Role:     1,
+				},
+			}).Error
+		},
+	},
+	{
+		Version: "2026101701",
+		Desc:    "新增登录会话表",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &entity.Session{})
+		},
+	},
+	{
+		Version: "2026101702",
+		Desc:    "新增登录token签名密钥表",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &entity.JwtKey{})
+		},
+	},
+	{
+		Version: "2026101703",
+		Desc:    "新增个人访问令牌表，操作日志记录令牌ID",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &entity.AccessToken{}); err != nil {
+				return err
+			}
+			return addColumns(tx, &entity.Log{}, "TokenId")
+		},
+	},
+	{
+		Version: "2026101704",
+		Desc:    "新增用户历史口令表，用户记录口令修改时间与是否需修改口令",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &entity.PasswordHistory{}); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &entity.User{}, "MustChgPwd", "PwdChangedAt"); err != nil {
+				return err
+			}
+			// 已有用户的口令有效期从升级时开始计算
+			return tx.Model(&entity.User{}).Where("pwd_changed_at IS NULL").
+				Update("pwd_changed_at", time.Now()).Error
+		},
+	},
+	{
+		Version: "2026101705",
+		Desc:    "历史口令摘要字段加长，用于保存PBKDF2格式的口令摘要",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AlterColumn(&entity.PasswordHistory{}, "Password")
+		},
+	},
+	{
+		Version: "2026101706",
+		Desc:    "新增动态口令恢复码表，用户记录动态口令密钥",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &entity.TotpRecoveryCode{}); err != nil {
+				return err
+			}
+			return addColumns(tx, &entity.User{}, "TotpEnabled", "TotpSecret", "TotpStep")
+		},
+	},
+	{
+		Version: "2026101707",
+		Desc:    "新增登录失败记录表",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &entity.LoginThrottle{})
+		},
+	},
+	{
+		Version: "2026101708",
+		Desc:    "新增单点登录授权请求表",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &entity.SsoState{})
+		},
+	},
+	{
+		Version: "2026101709",
+		Desc:    "用户记录来源，区分本地用户与目录服务用户",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &entity.User{}, "Source")
+		},
+	},
+	{
+		Version: "2026101710",
+		Desc:    "新增证书认证挑战表",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &entity.AuthChallenge{})
+		},
+	},
+	{
+		Version: "2026101711",
+		Desc:    "新增管理员证书表，管理员可绑定多个证书，管理员记录是否禁用与证书绑定码",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &entity.AdminCert{}); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &entity.Admin{}, "Disabled", "BindCode", "BindCodeExpiresAt"); err != nil {
+				return err
+			}
+			if !tx.Migrator().HasColumn(&entity.Admin{}, "cert") {
+				return nil
+			}
+			// 原有的单个证书迁移至管理员证书表，无法解析的证书丢弃，需重新绑定
+			var rows []struct {
+				ID   int
+				Cert string
+			}
+			if err := tx.Table("admins").Select("id", "cert").Where("cert IS NOT NULL AND cert <> ''").Scan(&rows).Error; err != nil {
+				return err
+			}
+			for _, row := range rows {
+				cert, err := reuint.ParseCert(row.Cert)
+				if err != nil || cert == nil {
+					continue
+				}
+				item := NewAdminCert(row.Cert, cert)
+				item.AdminID = row.ID
+				if err = tx.Create(item).Error; err != nil {
+					return err
+				}
+			}
+			// SQLite 的 Migrator().DropColumn 通过重建表实现，无法处理建表脚本中带注释的表结构
+			return tx.Exec("ALTER TABLE admins DROP COLUMN cert").Error
+		},
+	},
+	{
+		Version: "2026101712",
+		Desc:    "新增项目角色表，初始化内置角色的权限",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &entity.ProjectRole{}); err != nil {
+				return err
+			}
+			for _, role := range entity.BuiltinRoles() {
+				var count int64
+				if err := tx.Model(&entity.ProjectRole{}).Where("project_id = 0 AND role = ?", role.Role).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					continue
+				}
+				if err := tx.Create(&role).Error; err != nil {
+					return err
+				}
+			}
+			// 此前仅有内置角色，其他角色编号的成员没有任何权限，不做修改，仅提示管理员处理
+			var unknown []entity.ProjectMember
+			err := tx.Where("role NOT IN ?", []int{entity.RoleDeveloper, entity.RoleInterConnector, entity.RoleLeader, entity.RoleManager}).
+				Find(&unknown).Error
+			if err != nil {
+				return err
+			}
+			for _, m := range unknown {
+				zap.L().Warn("项目成员的角色编号未定义，该成员没有任何权限，请修改其角色",
+					zap.Int("id", m.ID), zap.Int("projectId", m.ProjectId), zap.Int("userId", m.UserId), zap.Int("role", m.Role))
+			}
+			return nil
+		},
+	},
+	{
+		Version: "2026101713",
+		Desc:    "接口用例新增所属项目ID，由所属分类补全，根用例由创建人所在项目补全",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &entity.ApiCase{}, "ProjectId"); err != nil {
+				return err
+			}
+			err := tx.Exec("UPDATE api_cases SET project_id = " +
+				"(SELECT project_id FROM api_categorizes WHERE api_categorizes.id = api_cases.categorize_id) " +
+				"WHERE categorize_id > 0 AND (project_id IS NULL OR project_id = 0)").Error
+			if err != nil {
+				return err
+			}
+			return backfillRootCases(tx)
+		},
+	},
+	{
+		Version: "2026101714",
+		Desc:    "修正项目负责人，每个项目有且仅有一个负责人且与项目的负责人字段一致",
+		Up: func(tx *gorm.DB) error {
+			var projects []entity.Project
+			if err := tx.Select("id", "manager").Where("is_delete = 0 AND manager > 0").Find(&projects).Error; err != nil {
+				return err
+			}
+			for _, p := range projects {
+				if err := setLeader(tx, p.ID, p.Manager); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: "2026101715",
+		Desc:    "项目归档字段与项目彻底删除任务表",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &entity.Project{}, "IsArchive"); err != nil {
+				return err
+			}
+			if err := tx.Model(&entity.Project{}).Where("is_archive IS NULL").Update("is_archive", 0).Error; err != nil {
+				return err
+			}
+			return createTables(tx, &entity.ProjectPurgeJob{})
+		},
+	},
+	{
+		Version: "2026101716",
+		Desc:    "技术方案记录所在的项目目录，由项目名称补全",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &entity.TechnicalProposal{}, "Dir"); err != nil {
+				return err
+			}
+			// 此前技术方案目录即为项目名称
+			return tx.Exec("UPDATE technical_proposals SET dir = " +
+				"(SELECT name FROM projects WHERE projects.id = technical_proposals.project_id) " +
+				"WHERE dir IS NULL OR dir = ''").Error
+		},
+	},
+}
+
+// backfillRootCases 补全根用例（未归属分类）的所属项目
+// 根用例没有分类可以推导项目，若创建人仅属于一个未删除的项目（成员或负责人）则归属该项目；
+// 无法确定的用例所属项目保持为0，不属于任何项目，逐个记录警告，由管理员通过 pdm admin movecase 移入项目。
+func backfillRootCases(tx *gorm.DB) error {
+	var cases []entity.ApiCase
+	err := tx.Select("id", "user_id").
+		Where("categorize_id = 0 AND (project_id IS NULL OR project_id = 0)").
+		Find(&cases).Error
+	if err != nil {
+		return err
+	}
+	projects := map[int][]int{}
+	for _, c := range cases {
+		ids, ok := projects[c.UserId]
+		if !ok {
+			err = tx.Model(&entity.Project{}).Distinct("projects.id").
+				Joins("LEFT JOIN project_members ON project_members.project_id = projects.id AND project_members.user_id = ?", c.UserId).
+				Where("projects.is_delete = 0 AND (projects.manager = ? OR project_members.id IS NOT NULL)", c.UserId).
+				Pluck("projects.id", &ids).Error
+			if err != nil {
+				return err
+			}
+			projects[c.UserId] = ids
+		}
+		if c.UserId <= 0 || len(ids) != 1 {
+			zap.L().Warn("无法确定根接口用例的所属项目，该用例不属于任何项目，请使用 pdm admin movecase 移入项目",
+				zap.Int("id", c.ID), zap.Int("userId", c.UserId), zap.Ints("projectIds", ids))
+			if err = tx.Model(&entity.ApiCase{}).Where("id = ?", c.ID).Update("project_id", 0).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err = tx.Model(&entity.ApiCase{}).Where("id = ?", c.ID).Update("project_id", ids[0]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
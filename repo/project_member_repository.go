@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"pdm/controller/middle"
@@ -8,6 +9,16 @@ import (
 	"pdm/reuint/jwt"
 )
 
+var (
+	// ErrNotMember 用户不是项目成员
+	ErrNotMember = errors.New("项目中不存在该成员")
+	// ErrLeaderRole 负责人角色仅能通过移交负责人变更
+	ErrLeaderRole = errors.New("项目负责人不可修改，请使用移交负责人")
+)
+
+// ProjectMemberRepository 项目成员支持层
+// 每个项目有且仅有一个负责人（entity.RoleLeader），且与 Project.Manager 一致，
+// 负责人仅能通过 TransferLeader 变更。
 type ProjectMemberRepository struct {
 }
 
@@ -35,13 +46,13 @@ func (r *ProjectMemberRepository) HeadRole(ctx *gin.Context) (bool, error) {
 	// 获取当前用户信息
 	claimsValue, _ := ctx.Get(middle.FlagClaims)
 	claims := claimsValue.(*jwt.Claims)
-	projectId := claims.PID
+	projectId := middle.ProjectID(ctx)
 
 	if projectId <= 0 || claims.Sub <= 0 {
 		return false, nil
 	}
 	res := &entity.ProjectMember{}
-	err := DB.First(res, "project_id = ? AND user_id = ? AND role = ?", projectId, claims.Sub, 4).Error
+	err := DB.First(res, "project_id = ? AND user_id = ? AND role = ?", projectId, claims.Sub, entity.RoleLeader).Error
 	if err == gorm.ErrRecordNotFound {
 		return false, nil
 	}
@@ -62,5 +73,79 @@ func (r *ProjectMemberRepository) IsProjectManager(projectId, userId int) (bool,
 	if err != nil {
 		return false, err
 	}
-	return entity.RoleCreator == role, nil
+	return entity.RoleManager == role, nil
+}
+
+// TransferLeader 将项目负责人移交给用户，原负责人改为管理员
+// 用户不是项目成员时加入项目，并同步修改项目的 Manager。
+// tx: 事务，与项目的其他修改在同一事务中完成
+func (r *ProjectMemberRepository) TransferLeader(tx *gorm.DB, projectId, userId int) error {
+	var count int64
+	if err := tx.Model(&entity.User{}).Where("id = ? AND is_delete = 0", userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("用户不存在或被删除")
+	}
+	if err := setLeader(tx, projectId, userId); err != nil {
+		return err
+	}
+	return tx.Model(&entity.Project{}).Where("id = ?", projectId).Update("manager", userId).Error
+}
+
+// LeadingProjects 用户担任负责人的未删除项目（含已归档项目）
+// 负责人不可被删除，删除用户前需先移交其负责的项目。
+func (r *ProjectMemberRepository) LeadingProjects(userIds ...int) ([]entity.Project, error) {
+	var res []entity.Project
+	if len(userIds) == 0 {
+		return res, nil
+	}
+	err := DB.Select("id", "name", "manager").Where("manager IN ? AND is_delete = 0", userIds).Find(&res).Error
+	return res, err
+}
+
+// ChangeRoles 批量修改成员的角色，任一成员不存在或为负责人时均不修改
+// ids: 成员记录ID
+func (r *ProjectMemberRepository) ChangeRoles(projectId int, ids []int, role int) error {
+	if role == entity.RoleLeader {
+		return ErrLeaderRole
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var members []entity.ProjectMember
+		if err := tx.Where("project_id = ? AND id IN ?", projectId, ids).Find(&members).Error; err != nil {
+			return err
+		}
+		found := map[int]bool{}
+		for _, m := range members {
+			if m.Role == entity.RoleLeader {
+				return ErrLeaderRole
+			}
+			found[m.ID] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				return ErrNotMember
+			}
+		}
+		return tx.Model(&entity.ProjectMember{}).Where("project_id = ? AND id IN ?", projectId, ids).Update("role", role).Error
+	})
+}
+
+// setLeader 设置项目负责人的成员记录，其他负责人改为管理员，用户不是项目成员时加入项目
+func setLeader(tx *gorm.DB, projectId, userId int) error {
+	err := tx.Model(&entity.ProjectMember{}).
+		Where("project_id = ? AND role = ? AND user_id <> ?", projectId, entity.RoleLeader, userId).
+		Update("role", entity.RoleManager).Error
+	if err != nil {
+		return err
+	}
+	var count int64
+	if err = tx.Model(&entity.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectId, userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return tx.Create(&entity.ProjectMember{ProjectId: projectId, UserId: userId, Role: entity.RoleLeader}).Error
+	}
+	return tx.Model(&entity.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectId, userId).
+		Update("role", entity.RoleLeader).Error
 }
@@ -1,11 +1,11 @@
 package repo
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"pdm/controller/middle"
 	"pdm/repo/entity"
-	"pdm/reuint/jwt"
 )
 
 // ProjectRepository 项目支持层
@@ -46,9 +46,7 @@ func (r *ProjectRepository) NameExist(name string) (bool, error) {
 
 func (r *ProjectRepository) GetProjectName(ctx *gin.Context) (string, error) {
 	res := entity.Project{}
-	claimsValue, _ := ctx.Get(middle.FlagClaims)
-	claims := claimsValue.(*jwt.Claims)
-	err := DB.First(&res, "id = ? AND is_delete = 0", claims.PID).Error
+	err := DB.First(&res, "id = ? AND is_delete = 0", middle.ProjectID(ctx)).Error
 	if err == gorm.ErrRecordNotFound {
 		return "", err
 	}
@@ -58,6 +56,47 @@ func (r *ProjectRepository) GetProjectName(ctx *gin.Context) (string, error) {
 	return res.Name, nil
 }
 
+// Archived 判断项目是否已归档，归档的项目只读
+func (r *ProjectRepository) Archived(id int) (bool, error) {
+	var count int64
+	err := DB.Model(&entity.Project{}).Where("id = ? AND is_archive = 1", id).Count(&count).Error
+	return count > 0, err
+}
+
+// Purge 删除项目以及项目的所有数据记录，返还各数据表删除的记录数
+// 项目的文件由调用者在删除记录前清理。ctx 取消时回滚事务。
+func (r *ProjectRepository) Purge(ctx context.Context, projectId int) (map[string]int64, error) {
+	removed := map[string]int64{}
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&entity.Document{},
+			&entity.ApiCase{},
+			&entity.ApiCategorize{},
+			&entity.TechnicalProposal{},
+			&entity.ProjectMember{},
+			&entity.ProjectRole{},
+			&entity.AccessToken{},
+		} {
+			res := tx.Where("project_id = ?", projectId).Delete(model)
+			if res.Error != nil {
+				return res.Error
+			}
+			stmt := &gorm.Statement{DB: tx}
+			if err := stmt.Parse(model); err != nil {
+				return err
+			}
+			removed[stmt.Schema.Table] = res.RowsAffected
+		}
+		res := tx.Delete(&entity.Project{}, projectId)
+		if res.Error != nil {
+			return res.Error
+		}
+		removed["projects"] = res.RowsAffected
+		return nil
+	})
+	return removed, err
+}
+
 func NewProjectRepository() *ProjectRepository {
 	return &ProjectRepository{}
 }
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+	"strings"
+)
+
+var (
+	// ErrRoleNotFound 角色不存在
+	ErrRoleNotFound = errors.New("角色不存在")
+	// ErrRoleInUse 角色仍有成员使用
+	ErrRoleInUse = errors.New("角色仍有成员使用，请先修改成员的角色")
+	// ErrRoleLeader 负责人的权限不可修改
+	ErrRoleLeader = errors.New("负责人具有所有权限，不可修改")
+)
+
+// ProjectRoleRepository 项目角色与权限支持层
+type ProjectRoleRepository struct {
+}
+
+func NewProjectRoleRepository() *ProjectRoleRepository {
+	return &ProjectRoleRepository{}
+}
+
+// normalize 负责人始终具有所有权限，包括新增的权限
+func normalize(role *entity.ProjectRole) {
+	if role.Builtin() && role.Role == entity.RoleLeader {
+		all := make([]string, 0, len(entity.Permissions))
+		for _, p := range entity.Permissions {
+			all = append(all, p.Name)
+		}
+		role.Permissions = strings.Join(all, ",")
+	}
+}
+
+// List 项目可用的角色，包括内置角色与项目自定义角色，按角色编号排序
+// projectId: 项目ID，为0时仅返还内置角色
+func (r *ProjectRoleRepository) List(projectId int) ([]entity.ProjectRole, error) {
+	list := []entity.ProjectRole{}
+	err := DB.Where("project_id IN ?", []int{0, projectId}).Order("role").Find(&list).Error
+	for i := range list {
+		normalize(&list[i])
+	}
+	return list, err
+}
+
+// Find 查询项目中可用的角色，不存在时返还 nil
+func (r *ProjectRoleRepository) Find(projectId, role int) (*entity.ProjectRole, error) {
+	var list []entity.ProjectRole
+	err := DB.Where("project_id IN ? AND role = ?", []int{0, projectId}, role).Limit(1).Find(&list).Error
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	normalize(&list[0])
+	return &list[0], nil
+}
+
+// Known 角色编号是否为内置角色或任一项目的自定义角色
+func (r *ProjectRoleRepository) Known(role int) (bool, error) {
+	var count int64
+	err := DB.Model(&entity.ProjectRole{}).Where("role = ?", role).Count(&count).Error
+	return count > 0, err
+}
+
+// MemberRole 用户在未删除的项目中的角色，不是项目成员时返还 nil
+func (r *ProjectRoleRepository) MemberRole(projectId, userId int) (*entity.ProjectRole, error) {
+	var roles []int
+	err := DB.Model(&entity.ProjectMember{}).
+		Joins("JOIN projects ON projects.id = project_members.project_id AND projects.is_delete = 0").
+		Where("project_members.project_id = ? AND project_members.user_id = ?", projectId, userId).
+		Limit(1).Pluck("project_members.role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return nil, err
+	}
+	role, err := r.Find(projectId, roles[0])
+	if err != nil || role != nil {
+		return role, err
+	}
+	// 成员的角色已不存在时没有任何权限
+	return &entity.ProjectRole{ProjectId: projectId, Role: roles[0]}, nil
+}
+
+// Create 创建项目自定义角色，角色编号从 entity.RoleCustomBase 开始递增
+func (r *ProjectRoleRepository) Create(projectId int, name string, perms []string) (*entity.ProjectRole, error) {
+	role := &entity.ProjectRole{ProjectId: projectId, Name: name, Permissions: strings.Join(perms, ",")}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var max []int
+		err := tx.Model(&entity.ProjectRole{}).Where("project_id = ?", projectId).
+			Order("role DESC").Limit(1).Pluck("role", &max).Error
+		if err != nil {
+			return err
+		}
+		role.Role = entity.RoleCustomBase
+		if len(max) > 0 && max[0] >= entity.RoleCustomBase {
+			role.Role = max[0] + 1
+		}
+		return tx.Create(role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Update 修改项目自定义角色的名称与权限
+func (r *ProjectRoleRepository) Update(projectId, role int, name string, perms []string) error {
+	res := DB.Model(&entity.ProjectRole{}).Where("project_id = ? AND role = ?", projectId, role).
+		Updates(map[string]interface{}{"name": name, "permissions": strings.Join(perms, ",")})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// SetBuiltin 修改内置角色的权限，负责人的权限不可修改
+func (r *ProjectRoleRepository) SetBuiltin(role int, perms []string) error {
+	if role == entity.RoleLeader {
+		return ErrRoleLeader
+	}
+	res := DB.Model(&entity.ProjectRole{}).Where("project_id = 0 AND role = ?", role).
+		Update("permissions", strings.Join(perms, ","))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// Delete 删除项目自定义角色，仍有成员使用时不可删除
+func (r *ProjectRoleRepository) Delete(projectId, role int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&entity.ProjectMember{}).Where("project_id = ? AND role = ?", projectId, role).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleInUse
+		}
+		res := tx.Where("project_id = ? AND role = ?", projectId, role).Delete(&entity.ProjectRole{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRoleNotFound
+		}
+		return nil
+	})
+}
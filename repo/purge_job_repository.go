@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"pdm/repo/entity"
+	"time"
+)
+
+// PurgeJobRepository 项目彻底删除任务支持层
+type PurgeJobRepository struct {
+}
+
+func NewPurgeJobRepository() *PurgeJobRepository {
+	return &PurgeJobRepository{}
+}
+
+// Create 创建进行中的任务，项目不存在或已有进行中的任务时不创建并返还 false
+// 以条件插入的方式由数据库保证同一项目同一时间只有一个进行中的任务。
+func (r *PurgeJobRepository) Create(job *entity.ProjectPurgeJob) (bool, error) {
+	now := time.Now()
+	res := DB.Exec("INSERT INTO project_purge_jobs "+
+		"(created_at, updated_at, project_id, project_name, op_id, status, removed, error) "+
+		"SELECT ?, ?, ?, ?, ?, ?, '', '' FROM projects WHERE id = ? AND NOT EXISTS "+
+		"(SELECT 1 FROM project_purge_jobs WHERE project_id = ? AND status = ?)",
+		now, now, job.ProjectId, job.ProjectName, job.OpId, entity.PurgeRunning,
+		job.ProjectId, job.ProjectId, entity.PurgeRunning)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	err := DB.Order("id DESC").First(job, "project_id = ? AND status = ?", job.ProjectId, entity.PurgeRunning).Error
+	return err == nil, err
+}
+
+// Running 项目是否有进行中的任务
+func (r *PurgeJobRepository) Running(projectId int) (bool, error) {
+	var count int64
+	err := DB.Model(&entity.ProjectPurgeJob{}).
+		Where("project_id = ? AND status = ?", projectId, entity.PurgeRunning).Count(&count).Error
+	return count > 0, err
+}
+
+// Finish 记录任务的结果
+func (r *PurgeJobRepository) Finish(job *entity.ProjectPurgeJob) error {
+	return DB.Select("status", "removed", "error").Updates(job).Error
+}
+
+// FailRunning 将所有进行中的任务标记为失败，返还标记的任务数量
+// 服务启动时调用，此时进行中的任务均为上次停机时中断的任务。
+func (r *PurgeJobRepository) FailRunning(reason string) (int64, error) {
+	res := DB.Model(&entity.ProjectPurgeJob{}).Where("status = ?", entity.PurgeRunning).
+		Updates(map[string]interface{}{"status": entity.PurgeFailed, "error": reason})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"fmt"
+	"pdm/repo/entity"
+)
+
+// 项目资源类型
+const (
+	ResourceDoc        = "doc"        // 项目文档
+	ResourceCase       = "case"       // 接口用例
+	ResourceCategorize = "categorize" // 接口分类
+	ResourceMember     = "member"     // 项目成员记录
+)
+
+// ResourceRepository 项目资源归属支持层
+type ResourceRepository struct {
+}
+
+func NewResourceRepository() *ResourceRepository {
+	return &ResourceRepository{}
+}
+
+// Belong 资源是否均属于项目，任一资源不存在或属于其他项目时返还 false
+// kind: 资源类型，如 ResourceDoc
+func (r *ResourceRepository) Belong(kind string, projectId int, ids ...int) (bool, error) {
+	var model interface{}
+	switch kind {
+	case ResourceDoc:
+		model = &entity.Document{}
+	case ResourceCase:
+		model = &entity.ApiCase{}
+	case ResourceCategorize:
+		model = &entity.ApiCategorize{}
+	case ResourceMember:
+		model = &entity.ProjectMember{}
+	default:
+		return false, fmt.Errorf("未知的资源类型: %s", kind)
+	}
+	seen := map[int]bool{}
+	uniq := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			return false, nil
+		}
+		if !seen[id] {
+			seen[id] = true
+			uniq = append(uniq, id)
+		}
+	}
+	if len(uniq) == 0 || projectId <= 0 {
+		return false, nil
+	}
+	var count int64
+	err := DB.Model(model).Where("id IN ? AND project_id = ?", uniq, projectId).Count(&count).Error
+	return count == int64(len(uniq)), err
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"gorm.io/gorm"
+	"pdm/controller/middle"
+	"pdm/repo/entity"
+	"pdm/reuint/jwt"
+	"time"
+)
+
+// sessionTouchInterval 会话最近访问时间的更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// SessionRepository 登录会话支持层
+type SessionRepository struct {
+}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{}
+}
+
+// Create 创建会话，同时清理已过期的会话
+func (r *SessionRepository) Create(claims *jwt.Claims, ip, userAgent string) error {
+	now := time.Now()
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+	session := &entity.Session{
+		ID:         claims.Jti,
+		CreatedAt:  now,
+		UserType:   claims.Type,
+		UserID:     claims.Sub,
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+		ExpiresAt:  time.UnixMilli(claims.Exp),
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", now).Delete(&entity.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(session).Error
+	})
+}
+
+// Touch 检查会话是否有效，有效时更新最近访问时间
+// 会话需存在、未过期且属于token中的用户。
+func (r *SessionRepository) Touch(claims *jwt.Claims) (bool, error) {
+	var session entity.Session
+	err := DB.Limit(1).Find(&session, "id = ?", claims.Jti).Error
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if session.ID == "" || session.UserType != claims.Type || session.UserID != claims.Sub || !now.Before(session.ExpiresAt) {
+		return false, nil
+	}
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		err = DB.Model(&entity.Session{}).Where("id = ?", session.ID).Update("last_seen_at", now).Error
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Revoke 撤销会话
+func (r *SessionRepository) Revoke(jti string) error {
+	return DB.Where("id = ?", jti).Delete(&entity.Session{}).Error
+}
+
+// RevokeUser 撤销用户的所有会话，返还撤销的会话数
+// 用户待完成登录的凭证（见 middle.ClaimsTypePending）一并撤销。
+// userType: 用户类型，见 jwt.Claims.Type
+// ids: 用户ID或管理员ID
+func (r *SessionRepository) RevokeUser(userType string, ids ...int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	types := []string{userType}
+	if userType == "user" {
+		types = append(types, middle.ClaimsTypePending)
+	}
+	res := DB.Where("user_type IN ? AND user_id IN ?", types, ids).Delete(&entity.Session{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+	"time"
+)
+
+// SsoStateRepository 单点登录授权请求支持层
+type SsoStateRepository struct {
+}
+
+func NewSsoStateRepository() *SsoStateRepository {
+	return &SsoStateRepository{}
+}
+
+// Create 创建授权请求，同时清理已过期的请求
+func (r *SsoStateRepository) Create(state *entity.SsoState) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&entity.SsoState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(state).Error
+	})
+}
+
+// Consume 取出并删除授权请求，不存在、已被使用、已过期或不属于该身份提供方时返还 nil
+// 多个实例同时回调同一 state 时仅有一个能取出成功。
+func (r *SsoStateRepository) Consume(id, provider string) (*entity.SsoState, error) {
+	var state entity.SsoState
+	err := DB.Limit(1).Find(&state, "id = ?", id).Error
+	if err != nil || state.ID == "" {
+		return nil, err
+	}
+	res := DB.Where("id = ?", id).Delete(&entity.SsoState{})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	if state.Provider != provider || !time.Now().Before(state.ExpiresAt) {
+		return nil, nil
+	}
+	return &state, nil
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"pdm/repo/entity"
+)
+
+// TechnicalProposalRepository 技术方案支持层
+// 技术方案存储的顶层目录为项目目录，首次生成技术方案时以项目名称创建并记录在技术方案中（见 entity.TechnicalProposal.Dir），
+// 项目改名后仍使用原目录。
+type TechnicalProposalRepository struct {
+}
+
+func NewTechnicalProposalRepository() *TechnicalProposalRepository {
+	return &TechnicalProposalRepository{}
+}
+
+// Dir 项目的技术方案目录，项目未生成过技术方案时返还空字符串
+func (r *TechnicalProposalRepository) Dir(projectId int) (string, error) {
+	var dirs []string
+	err := DB.Model(&entity.TechnicalProposal{}).
+		Where("project_id = ? AND dir IS NOT NULL AND dir <> ''", projectId).
+		Order("id").Limit(1).Pluck("dir", &dirs).Error
+	if err != nil || len(dirs) == 0 {
+		return "", err
+	}
+	return dirs[0], nil
+}
+
+// Dirs 项目的技术方案中记录的所有目录
+func (r *TechnicalProposalRepository) Dirs(projectId int) ([]string, error) {
+	var dirs []string
+	err := DB.Model(&entity.TechnicalProposal{}).Distinct("dir").
+		Where("project_id = ? AND dir IS NOT NULL AND dir <> ''", projectId).
+		Pluck("dir", &dirs).Error
+	return dirs, err
+}
+
+// Projects 使用技术方案目录的项目ID
+// 包括技术方案中记录了该目录的项目，以及尚未生成技术方案、名称与目录相同的项目。
+func (r *TechnicalProposalRepository) Projects(dir string) ([]int, error) {
+	var recorded []int
+	err := DB.Model(&entity.TechnicalProposal{}).Distinct("project_id").
+		Where("dir = ?", dir).Pluck("project_id", &recorded).Error
+	if err != nil {
+		return nil, err
+	}
+	var named []int
+	if err = DB.Model(&entity.Project{}).Where("name = ?", dir).Pluck("id", &named).Error; err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	res := make([]int, 0, len(recorded)+len(named))
+	for _, id := range append(recorded, named...) {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
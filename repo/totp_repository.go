@@ -0,0 +1,180 @@
+package repo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/emmansun/gmsm/sm3"
+	"gorm.io/gorm"
+	"pdm/repo/entity"
+	"strings"
+	"time"
+)
+
+// totpRecoveryCodeCount 每次生成的恢复码数量
+const totpRecoveryCodeCount = 10
+
+// recoveryCodeAlphabet 恢复码字符集，共32个字符，去除了容易混淆的字符 i l o 1
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+// TotpRepository 动态口令支持层
+type TotpRepository struct {
+}
+
+func NewTotpRepository() *TotpRepository {
+	return &TotpRepository{}
+}
+
+// hashRecoveryCode 恢复码的SM3摘要Hex，忽略大小写与分隔符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sm3.Sum([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Policy 获取动态口令策略，未设置时所有用户可选使用动态口令
+func (r *TotpRepository) Policy() (*entity.TotpPolicy, error) {
+	res := &entity.TotpPolicy{}
+	var cfg entity.Config
+	err := DB.Where("item_name = ?", entity.ConfigTotpPolicy).Limit(1).Find(&cfg).Error
+	if err != nil || cfg.Content == "" {
+		return res, err
+	}
+	if err = json.Unmarshal([]byte(cfg.Content), res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SetPolicy 设置动态口令策略
+func (r *TotpRepository) SetPolicy(policy *entity.TotpPolicy) error {
+	bin, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Config{}).Where("item_name = ?", entity.ConfigTotpPolicy).Update("content", string(bin))
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		return tx.Create(&entity.Config{ItemName: entity.ConfigTotpPolicy, Content: string(bin)}).Error
+	})
+}
+
+// Required 策略是否要求用户使用动态口令
+// 所有用户必须使用，或用户在未删除的项目中担任策略指定的角色时需要使用。
+func (r *TotpRepository) Required(userID int) (bool, error) {
+	policy, err := r.Policy()
+	if err != nil {
+		return false, err
+	}
+	if policy.Required {
+		return true, nil
+	}
+	if len(policy.Roles) == 0 {
+		return false, nil
+	}
+	var count int64
+	err = DB.Model(&entity.ProjectMember{}).
+		Joins("JOIN projects ON projects.id = project_members.project_id AND projects.is_delete = 0").
+		Where("project_members.user_id = ? AND project_members.role IN ?", userID, policy.Roles).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SetSecret 保存绑定过程中生成的动态口令密钥，已启用动态口令的用户不能重新生成
+func (r *TotpRepository) SetSecret(userID int, secret string) (bool, error) {
+	res := DB.Model(&entity.User{}).Where("id = ? AND totp_enabled = 0", userID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_step": 0})
+	return res.RowsAffected > 0, res.Error
+}
+
+// UseStep 记录验证通过的动态口令时间步，时间步不大于上次记录的时间步时返还false（重放）
+func (r *TotpRepository) UseStep(userID int, step int64) (bool, error) {
+	res := DB.Model(&entity.User{}).Where("id = ? AND totp_step < ?", userID, step).Update("totp_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+// Enable 启用动态口令并生成恢复码，返还恢复码明文
+// step: 绑定时验证通过的时间步
+func (r *TotpRepository) Enable(userID int, step int64) ([]string, error) {
+	var codes []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.User{}).Where("id = ? AND totp_enabled = 0 AND totp_secret <> ''", userID).
+			Updates(map[string]interface{}{"totp_enabled": 1, "totp_step": step})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("动态口令未绑定或已启用")
+		}
+		var err error
+		codes, err = createRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，原有的恢复码全部失效
+func (r *TotpRepository) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	var codes []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = createRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// createRecoveryCodes 删除用户原有的恢复码并生成新的恢复码，格式如 abcde-23456
+func createRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&entity.TotpRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, totpRecoveryCodeCount)
+	records := make([]entity.TotpRecoveryCode, totpRecoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := make([]byte, len(buf))
+		for j, b := range buf {
+			code[j] = recoveryCodeAlphabet[b%32]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		records[i] = entity.TotpRecoveryCode{UserID: userID, Hash: hashRecoveryCode(codes[i])}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode 使用恢复码，恢复码不存在或已使用时返还false
+func (r *TotpRepository) UseRecoveryCode(userID int, code string) (bool, error) {
+	res := DB.Model(&entity.TotpRecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+// RemainingRecoveryCodes 未使用的恢复码数量
+func (r *TotpRepository) RemainingRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	err := DB.Model(&entity.TotpRecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// Reset 停用动态口令，清除密钥与恢复码
+func (r *TotpRepository) Reset(userID int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": 0, "totp_secret": "", "totp_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.TotpRecoveryCode{}).Error
+	})
+}
@@ -5,7 +5,9 @@ import (
 	"gorm.io/gorm"
 	"pdm/controller/middle"
 	"pdm/repo/entity"
+	"pdm/reuint"
 	"pdm/reuint/jwt"
+	"time"
 )
 
 // UserRepository 用户支持层
@@ -109,6 +111,69 @@ func (r *UserRepository) IsValid(ctx *gin.Context) (bool, error) {
 	return false, nil
 }
 
+// UsedPassword 口令是否为用户最近使用过的口令
+// history: 检查最近使用过的口令个数（包括当前口令），小于等于0表示不检查
+func (r *UserRepository) UsedPassword(user *entity.User, password string, history int) (bool, error) {
+	if history <= 0 {
+		return false, nil
+	}
+	if reuint.VerifyPasswordSalt(password, user.Password.String(), user.Salt) {
+		return true, nil
+	}
+	var olds []entity.PasswordHistory
+	err := DB.Where("user_id = ?", user.ID).Order("id desc").Limit(history - 1).Find(&olds).Error
+	if err != nil {
+		return false, err
+	}
+	for _, old := range olds {
+		if reuint.VerifyPasswordSalt(password, old.Password.String(), old.Salt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ChangePassword 修改用户口令，被替换的口令记入历史口令
+// mustChg: 用户登录后是否需修改口令，管理员重置口令时为true
+// history: 保留最近使用过的口令个数（包括当前口令），超出的历史口令被删除
+func (r *UserRepository) ChangePassword(user *entity.User, password string, mustChg bool, history int) error {
+	pwd, salt, err := reuint.GenPasswordSalt(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	// 历史口令仅保留最近的 history-1 个，加上当前口令即最近使用过的 history 个口令
+	keep := history - 1
+	if keep < 0 {
+		keep = 0
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if user.Password != "" && keep > 0 {
+			old := &entity.PasswordHistory{UserID: user.ID, Password: user.Password, Salt: user.Salt}
+			if err := tx.Create(old).Error; err != nil {
+				return err
+			}
+		}
+		var ids []int
+		if err := tx.Model(&entity.PasswordHistory{}).Where("user_id = ?", user.ID).Order("id desc").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > keep {
+			if err := tx.Where("id IN ?", ids[keep:]).Delete(&entity.PasswordHistory{}).Error; err != nil {
+				return err
+			}
+		}
+		user.Password = entity.Pwd(pwd)
+		user.Salt = salt
+		user.MustChgPwd = 0
+		if mustChg {
+			user.MustChgPwd = 1
+		}
+		user.PwdChangedAt = &now
+		return tx.Model(user).Select("password", "salt", "must_chg_pwd", "pwd_changed_at").Updates(user).Error
+	})
+}
+
 func NewUserRepository() *UserRepository {
 	return &UserRepository{}
 }
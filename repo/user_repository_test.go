@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"pdm/repo/entity"
+	"pdm/reuint"
+	"testing"
+)
+
+func TestUserRepository_ChangePassword(t *testing.T) {
+	initSqlite(t)
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	old := reuint.PasswordIterations
+	defer func() { reuint.PasswordIterations = old }()
+	reuint.PasswordIterations = reuint.MinPasswordIterations
+	r := NewUserRepository()
+	user := &entity.User{Openid: "1001", Name: "张三", Username: "zhangsan"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ChangePassword(user, "Passw0rd#1", true, 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, pwd := range []string{"Passw0rd#2", "Passw0rd#3", "Passw0rd#4"} {
+		if err := r.ChangePassword(user, pwd, false, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := &entity.User{}
+	if err := DB.First(saved, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.MustChgPwd != 0 || saved.PwdChangedAt == nil {
+		t.Fatalf("unexpected user: %+v", saved)
+	}
+	var count int64
+	DB.Model(&entity.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 2 {
+		t.Fatalf("expect 2 password histories, got %d", count)
+	}
+	// 最近3个口令不能再使用，更早的口令可以再次使用
+	for pwd, used := range map[string]bool{
+		"Passw0rd#4": true,
+		"Passw0rd#3": true,
+		"Passw0rd#2": true,
+		"Passw0rd#1": false,
+	} {
+		if res, err := r.UsedPassword(saved, pwd, 3); err != nil || res != used {
+			t.Fatalf("UsedPassword(%s) = %v %v, expect %v", pwd, res, err, used)
+		}
+	}
+	if res, _ := r.UsedPassword(saved, "Passw0rd#4", 0); res {
+		t.Fatal("expect no check when history disabled")
+	}
+}
@@ -7,4 +7,7 @@ type Claims struct {
 	Exp  int64  `json:"exp"`  // 过期时间，Unix 毫秒数
 	PID  int    `json:"pid"`  // 项目ID
 	Role int    `json:"role"` // 角色
+	Jti  string `json:"jti"`  // 会话ID，登录时生成，对应服务端记录的会话
+	// MustChgPwd 需修改口令，首次登录或口令过期时为true，此时token仅能用于修改口令
+	MustChgPwd bool `json:"mcp,omitempty"`
 }
@@ -14,8 +14,47 @@ import (
 // JWT头部 Base64-URL-Encoded: {"alg":"HMAC-SM3","typ":"JWT"}
 const header = "eyJhbGciOiJITUFDLVNNMyIsInR5cCI6IkpXVCJ9"
 
+// 签名算法
+const alg = "HMAC-SM3"
+
+// Header JWT头部
+type Header struct {
+	Alg string `json:"alg"`           // 签名算法，固定为 HMAC-SM3
+	Typ string `json:"typ"`           // 类型，固定为 JWT
+	Kid string `json:"kid,omitempty"` // 签名密钥ID
+}
+
 // New 创建Token
 func New(key []byte, claims *Claims) string {
+	return sign(header, key, claims)
+}
+
+// NewWithKid 创建头部携带签名密钥ID的Token
+func NewWithKid(kid string, key []byte, claims *Claims) string {
+	bin, _ := json.Marshal(&Header{Alg: alg, Typ: "JWT", Kid: kid})
+	return sign(base64.URLEncoding.EncodeToString(bin), key, claims)
+}
+
+// Kid 解析Token头部中的签名密钥ID，未携带密钥ID时返还空字符串
+// 仅解析头部，不验证Token是否有效。
+func Kid(token string) (string, error) {
+	end := strings.IndexByte(token, '.')
+	if end == -1 {
+		return "", fmt.Errorf("非法token")
+	}
+	bin, err := base64.URLEncoding.DecodeString(token[:end])
+	if err != nil {
+		return "", fmt.Errorf("非法token")
+	}
+	var h Header
+	if err = json.Unmarshal(bin, &h); err != nil || h.Alg != alg {
+		return "", fmt.Errorf("非法token")
+	}
+	return h.Kid, nil
+}
+
+// sign 使用已编码的头部创建Token
+func sign(header string, key []byte, claims *Claims) string {
 	if claims == nil || len(key) == 0 {
 		return ""
 	}
@@ -24,3 +24,25 @@ func TestNew(t *testing.T) {
 	fmt.Println(token)
 	fmt.Printf("%+v\n", cc)
 }
+
+func TestNewWithKid(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	claims := &Claims{Sub: 1, Exp: time.Now().UnixMilli() + 1000}
+	token := NewWithKid("20261017T000000Z", key, claims)
+	kid, err := Kid(token)
+	if err != nil || kid != "20261017T000000Z" {
+		t.Fatalf("unexpected kid %q, %v", kid, err)
+	}
+	if _, err = Verify(key, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Verify([]byte("another key"), token); err == nil {
+		t.Fatal("token verified with wrong key")
+	}
+	if kid, err = Kid(New(key, claims)); err != nil || kid != "" {
+		t.Fatalf("unexpected kid %q of token without kid, %v", kid, err)
+	}
+	if _, err = Kid("bm90IGpzb24." + token); err == nil {
+		t.Fatal("expect error on malformed header")
+	}
+}
@@ -0,0 +1,282 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew 校验 ID Token 有效期时允许的时钟偏差
+const clockSkew = time.Minute
+
+// jwksRefreshInterval 遇到未知 kid 时重新获取公钥集的最小间隔，防止伪造的 kid 导致频繁请求身份提供方
+const jwksRefreshInterval = time.Minute
+
+// ErrInvalidIDToken ID Token 无效
+var ErrInvalidIDToken = errors.New("ID Token 无效")
+
+// algorithms 支持的签名算法
+var algorithms = map[string]struct {
+	hash crypto.Hash
+	kty  string
+}{
+	"RS256": {crypto.SHA256, "RSA"},
+	"RS384": {crypto.SHA384, "RSA"},
+	"RS512": {crypto.SHA512, "RSA"},
+	"ES256": {crypto.SHA256, "EC"},
+	"ES384": {crypto.SHA384, "EC"},
+	"ES512": {crypto.SHA512, "EC"},
+}
+
+// jwk JSON Web Key，仅解析签名验证需要的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 解析公钥，不支持的密钥类型返还 nil
+func (k *jwk) publicKey() (interface{}, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("RSA公钥指数错误")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("EC公钥不在曲线 %s 上", k.Crv)
+		}
+		return pub, nil
+	}
+	return nil, nil
+}
+
+// key 获取签名公钥，公钥集中没有该 kid 时重新获取公钥集（身份提供方轮换了密钥）
+// kid 为空时公钥集中需仅有一个公钥。
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	if p.keys != nil && p.now().Sub(p.keysAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("%w，未知的签名密钥 %q", ErrInvalidIDToken, kid)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.cfg.JWKSURL, "", &set); err != nil {
+		return nil, fmt.Errorf("获取签名公钥集失败，%w", err)
+	}
+	keys := map[string]interface{}{}
+	for i := range set.Keys {
+		pub, err := set.Keys[i].publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("签名公钥 %q 格式错误，%w", set.Keys[i].Kid, err)
+		}
+		if pub != nil {
+			keys[set.Keys[i].Kid] = pub
+		}
+	}
+	p.keys = keys
+	p.keysAt = p.now()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w，未知的签名密钥 %q", ErrInvalidIDToken, kid)
+}
+
+func (p *Provider) lookup(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// VerifyIDToken 校验 ID Token 的签名、签发者、受众、有效期与 nonce，返还其中的声明
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (map[string]interface{}, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w，格式错误", ErrInvalidIDToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w，头部格式错误", ErrInvalidIDToken)
+	}
+	// 仅接受非对称签名算法，拒绝 none 与 HMAC 等算法
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w，不支持的签名算法 %q", ErrInvalidIDToken, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w，签名格式错误", ErrInvalidIDToken)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	h := alg.hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err = verifySignature(key, alg.kty, alg.hash, h.Sum(nil), sig); err != nil {
+		return nil, fmt.Errorf("%w，%s", ErrInvalidIDToken, err.Error())
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w，荷载格式错误", ErrInvalidIDToken)
+	}
+	if err = p.validate(claims, nonce); err != nil {
+		return nil, fmt.Errorf("%w，%s", ErrInvalidIDToken, err.Error())
+	}
+	return claims, nil
+}
+
+// validate 校验 ID Token 声明，见 OpenID Connect Core 3.1.3.7
+func (p *Provider) validate(claims map[string]interface{}, nonce string) error {
+	if iss := Claim(claims, "iss"); iss != p.cfg.Issuer {
+		return fmt.Errorf("签发者 %q 错误", iss)
+	}
+	if Claim(claims, "sub") == "" {
+		return errors.New("缺少 sub")
+	}
+	var aud []string
+	switch v := claims["aud"].(type) {
+	case string:
+		aud = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	found := false
+	for _, item := range aud {
+		found = found || item == p.cfg.ClientID
+	}
+	if !found {
+		return errors.New("受众不包含本客户端")
+	}
+	if azp := Claim(claims, "azp"); (len(aud) > 1 || azp != "") && azp != p.cfg.ClientID {
+		return fmt.Errorf("授权方 %q 错误", azp)
+	}
+	now := p.now()
+	exp, ok := numericDate(claims, "exp")
+	if !ok || !now.Before(exp.Add(clockSkew)) {
+		return errors.New("已过期")
+	}
+	if iat, ok := numericDate(claims, "iat"); ok && iat.After(now.Add(clockSkew)) {
+		return errors.New("签发时间晚于当前时间")
+	}
+	if Claim(claims, "nonce") != nonce {
+		return errors.New("nonce 不匹配")
+	}
+	return nil
+}
+
+// numericDate 解析以Unix秒数表示的时间声明
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// verifySignature 验证签名，ES 签名为 R||S 定长格式（RFC 7518 3.4）
+func verifySignature(key interface{}, kty string, hash crypto.Hash, digest, sig []byte) error {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if kty != "RSA" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			return errors.New("签名错误")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if kty != "EC" {
+			break
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("签名长度错误")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("签名错误")
+		}
+		return nil
+	}
+	return errors.New("签名算法与公钥类型不匹配")
+}
+
+// decodeSegment 解析 Base64URL 编码的JSON，数值保留为 json.Number
+func decodeSegment(seg string, v interface{}) error {
+	bin, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(bin)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
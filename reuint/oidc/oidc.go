@@ -0,0 +1,291 @@
+// Package oidc OAuth2/OpenID Connect 授权码模式客户端
+//
+// 支持 OIDC 发现、PKCE（S256）、state 与 nonce，以及 ID Token 签名（RS256/RS384/RS512/ES256/ES384/ES512）
+// 与荷载校验。未配置签发者的提供方按普通 OAuth2 处理，需配置各端点地址，用户信息从用户信息端点获取。
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/sm3"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodySize 身份提供方响应的最大长度
+const maxBodySize = 1 << 20
+
+// Config 身份提供方配置
+type Config struct {
+	Issuer           string   // OIDC签发者，发现文档地址为 签发者/.well-known/openid-configuration；为空表示普通 OAuth2
+	ClientID         string   // 客户端ID
+	ClientSecret     string   // 客户端密钥，为空表示公开客户端（仅使用PKCE）
+	ClientSecretPost bool     // 在请求体中传递客户端密钥（client_secret_post），缺省使用HTTP基本认证（client_secret_basic）
+	RedirectURL      string   // 回调地址，需与在身份提供方注册的一致
+	Scopes           []string // 申请的权限范围，OIDC 需包含 openid
+	AuthURL          string   // 授权端点，为空时从发现文档获取
+	TokenURL         string   // 令牌端点，为空时从发现文档获取
+	UserInfoURL      string   // 用户信息端点，为空时从发现文档获取
+	JWKSURL          string   // 签名公钥集地址，为空时从发现文档获取
+}
+
+// Token 令牌端点响应
+type Token struct {
+	AccessToken string `json:"access_token"` // 访问令牌
+	TokenType   string `json:"token_type"`   // 令牌类型，一般为 Bearer
+	ExpiresIn   int64  `json:"expires_in"`   // 有效期（单位：秒）
+	IDToken     string `json:"id_token"`     // ID Token，仅 OIDC
+}
+
+// metadata OIDC发现文档
+type metadata struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	UserInfo string `json:"userinfo_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+// Provider 身份提供方客户端，可并发使用
+// 发现文档在首次使用时获取，获取失败时下次使用重试，身份提供方不可用不影响程序启动。
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu         sync.Mutex
+	discovered bool                   // 是否已获取发现文档
+	keys       map[string]interface{} // 签名公钥，键为 kid
+	keysAt     time.Time              // 最近获取公钥集的时间
+}
+
+// NewProvider 创建身份提供方客户端
+// client: 访问身份提供方使用的HTTP客户端，为空时使用 http.DefaultClient
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{cfg: cfg, client: client, now: time.Now}
+}
+
+// OIDC 是否为 OpenID Connect 提供方，是则登录时需校验 ID Token
+func (p *Provider) OIDC() bool {
+	return p.cfg.Issuer != ""
+}
+
+// RandomString 生成URL安全的随机字符串，用于 state、nonce 与 PKCE code_verifier
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge PKCE S256 code_challenge
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// discover 获取发现文档，补全未配置的端点地址
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered || !p.OIDC() {
+		return nil
+	}
+	var doc metadata
+	u := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, u, "", &doc); err != nil {
+		return fmt.Errorf("获取OIDC发现文档失败，%w", err)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return fmt.Errorf("OIDC发现文档中的签发者 %q 与配置 %q 不一致", doc.Issuer, p.cfg.Issuer)
+	}
+	for _, item := range []struct {
+		field *string
+		value string
+	}{
+		{&p.cfg.AuthURL, doc.AuthURL},
+		{&p.cfg.TokenURL, doc.TokenURL},
+		{&p.cfg.UserInfoURL, doc.UserInfo},
+		{&p.cfg.JWKSURL, doc.JWKSURL},
+	} {
+		if *item.field == "" {
+			*item.field = item.value
+		}
+	}
+	if p.cfg.AuthURL == "" || p.cfg.TokenURL == "" || p.cfg.JWKSURL == "" {
+		return errors.New("OIDC发现文档缺少授权端点、令牌端点或公钥集地址")
+	}
+	p.discovered = true
+	return nil
+}
+
+// AuthCodeURL 授权地址，浏览器重定向到该地址进行登录
+// state: 防止跨站请求伪造，回调时原样返回
+// nonce: 写入 ID Token，防止重放，仅 OIDC
+// verifier: PKCE code_verifier，令牌端点换取令牌时提交
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"state":                 {state},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.cfg.Scopes) > 0 {
+		q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	}
+	if p.OIDC() {
+		q.Set("nonce", nonce)
+	}
+	sep := "?"
+	if strings.Contains(p.cfg.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.cfg.AuthURL + sep + q.Encode(), nil
+}
+
+// Exchange 使用授权码换取令牌，OIDC 提供方必须返回 ID Token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" || p.cfg.ClientSecretPost {
+		form.Set("client_id", p.cfg.ClientID)
+		if p.cfg.ClientSecret != "" {
+			form.Set("client_secret", p.cfg.ClientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" && !p.cfg.ClientSecretPost {
+		// RFC 6749 2.3.1 客户端ID与密钥需先进行URL编码
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	var token Token
+	if err = p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("获取访问令牌失败，%w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("获取访问令牌失败，响应中缺少访问令牌")
+	}
+	if p.OIDC() && token.IDToken == "" {
+		return nil, errors.New("获取访问令牌失败，响应中缺少ID Token")
+	}
+	return &token, nil
+}
+
+// UserInfo 从用户信息端点获取用户信息，未配置用户信息端点时返还 nil
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+	if p.cfg.UserInfoURL == "" {
+		return nil, nil
+	}
+	var res map[string]interface{}
+	if err := p.getJSON(ctx, p.cfg.UserInfoURL, accessToken, &res); err != nil {
+		return nil, fmt.Errorf("获取用户信息失败，%w", err)
+	}
+	return res, nil
+}
+
+// getJSON 发送GET请求并解析JSON响应
+// accessToken: 不为空时作为 Bearer 令牌
+func (p *Provider) getJSON(ctx context.Context, u, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return p.do(req, v)
+}
+
+// do 发送请求并解析JSON响应，非2xx响应返还身份提供方的错误信息
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return fmt.Errorf("HTTP %d %s %s", resp.StatusCode, e.Error, e.Description)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != "" && ct != "application/json" && !strings.HasSuffix(ct, "+json") {
+		return fmt.Errorf("不支持的响应类型 %s", ct)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Claim 按路径获取声明的字符串值，路径中用"."分隔嵌套对象，如 data.openid
+// 数值与布尔值转换为字符串，不存在或为对象、数组时返还空字符串。
+func Claim(claims map[string]interface{}, path string) string {
+	var cur interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur = m[name]
+	}
+	switch v := cur.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Hash 随机字符串的SM3摘要Hex，服务端仅保存 state 的摘要
+func Hash(s string) string {
+	sum := sm3.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
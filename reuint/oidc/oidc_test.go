@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"pdm/reuint/oidc/oidctest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authorize 访问授权地址，返还重定向到回调地址的授权码与 state
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("authorize: %d %v", resp.StatusCode, err)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestProvider(t *testing.T) {
+	idp := oidctest.NewServer("pdm", "secret")
+	defer idp.Close()
+	p := NewProvider(Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "pdm",
+		ClientSecret: "secret",
+		RedirectURL:  "http://127.0.0.1/api/sso/test/callback",
+		Scopes:       []string{"openid", "profile"},
+	}, nil)
+	ctx := context.Background()
+
+	// login 完成一次授权码登录，返还 ID Token 校验结果
+	login := func(nonce string) (map[string]interface{}, *Token, error) {
+		verifier, _ := RandomString()
+		u, err := p.AuthCodeURL(ctx, "state1", "nonce1", verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(u, "code_challenge="+Challenge(verifier)) || !strings.Contains(u, "scope=openid+profile") {
+			t.Fatalf("unexpected auth url: %s", u)
+		}
+		code, state := authorize(t, u)
+		if state != "state1" {
+			t.Fatalf("unexpected state %q", state)
+		}
+		token, err := p.Exchange(ctx, code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := p.VerifyIDToken(ctx, token.IDToken, nonce)
+		return claims, token, err
+	}
+
+	idp.SetUser(map[string]interface{}{"sub": "u1", "employee": map[string]interface{}{"no": 22001}, "name": "张三"})
+	claims, token, err := login("nonce1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Claim(claims, "sub") != "u1" || Claim(claims, "employee.no") != "22001" || Claim(claims, "name") != "张三" || Claim(claims, "employee.none") != "" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+	info, err := p.UserInfo(ctx, token.AccessToken)
+	if err != nil || Claim(info, "sub") != "u1" {
+		t.Fatalf("userinfo: %v %v", info, err)
+	}
+	if _, err = p.UserInfo(ctx, "invalid"); err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Fatalf("expect userinfo error, got %v", err)
+	}
+
+	// 授权码仅能使用一次，PKCE code_verifier 需匹配
+	verifier, _ := RandomString()
+	u, _ := p.AuthCodeURL(ctx, "s", "n", verifier)
+	code, _ := authorize(t, u)
+	if _, err = p.Exchange(ctx, code, "wrong"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expect invalid_grant, got %v", err)
+	}
+
+	// 异常的 ID Token
+	cases := map[string]func(map[string]interface{}){
+		"签发者错误": func(c map[string]interface{}) { c["iss"] = "https://evil" },
+		"受众错误":  func(c map[string]interface{}) { c["aud"] = []string{"other"} },
+		"授权方错误": func(c map[string]interface{}) { c["aud"] = []string{"pdm", "other"}; c["azp"] = "other" },
+		"已过期":   func(c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"未来签发":  func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"缺少sub": func(c map[string]interface{}) { delete(c, "sub") },
+	}
+	for name, hook := range cases {
+		idp.SetHook(hook)
+		if _, _, err = login("nonce1"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: expect invalid id token, got %v", name, err)
+		}
+	}
+	idp.SetHook(nil)
+	if _, _, err = login("other"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("nonce mismatch: %v", err)
+	}
+
+	// 签名被篡改或使用不安全的算法
+	_, token, _ = login("nonce1")
+	parts := strings.Split(token.IDToken, ".")
+	forged := []string{
+		parts[0] + "." + parts[1] + "." + parts[2][:len(parts[2])-4] + "AAAA",
+		"eyJhbGciOiJub25lIn0." + parts[1] + ".",
+		"eyJhbGciOiJIUzI1NiJ9." + parts[1] + "." + parts[2],
+	}
+	for _, raw := range forged {
+		if _, err = p.VerifyIDToken(ctx, raw, "nonce1"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("expect invalid id token for %s, got %v", raw[:20], err)
+		}
+	}
+
+	// 身份提供方轮换密钥后重新获取公钥集，未知的 kid 在刷新间隔内不重复获取
+	p.keysAt = time.Now().Add(-jwksRefreshInterval)
+	idp.RotateKey()
+	if _, _, err = login("nonce1"); err != nil {
+		t.Fatalf("after key rotation: %v", err)
+	}
+	p.keysAt = time.Now()
+	idp.RotateKey()
+	if _, _, err = login("nonce1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expect unknown key within refresh interval, got %v", err)
+	}
+}
+
+func TestProvider_Discovery(t *testing.T) {
+	idp := oidctest.NewServer("pdm", "")
+	defer idp.Close()
+	ctx := context.Background()
+	p := NewProvider(Config{Issuer: idp.Issuer() + "/", ClientID: "pdm"}, nil)
+	if _, err := p.AuthCodeURL(ctx, "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Fatalf("expect issuer mismatch, got %v", err)
+	}
+	p = NewProvider(Config{Issuer: "http://127.0.0.1:1", ClientID: "pdm"}, nil)
+	if _, err := p.AuthCodeURL(ctx, "s", "n", "v"); err == nil {
+		t.Fatal("expect discovery error")
+	}
+
+	// 普通 OAuth2 不获取发现文档，不传递 nonce；公开客户端在请求体中传递客户端ID
+	p = NewProvider(Config{
+		ClientID:    "pdm",
+		RedirectURL: "http://127.0.0.1/cb",
+		AuthURL:     idp.URL + "/authorize?tenant=1",
+		TokenURL:    idp.URL + "/token",
+		UserInfoURL: idp.URL + "/userinfo",
+	}, nil)
+	verifier, _ := RandomString()
+	u, err := p.AuthCodeURL(ctx, "s", "n", verifier)
+	if err != nil || strings.Contains(u, "nonce=") || !strings.Contains(u, "?tenant=1&") {
+		t.Fatalf("unexpected auth url: %s %v", u, err)
+	}
+	code, _ := authorize(t, u)
+	token, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := p.UserInfo(ctx, token.AccessToken)
+	if err != nil || Claim(info, "sub") != "1001" {
+		t.Fatalf("userinfo: %v %v", info, err)
+	}
+}
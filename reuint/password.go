@@ -3,15 +3,33 @@
 package reuint
 
 import (
-	"bytes"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"github.com/emmansun/gmsm/sm3"
+	"golang.org/x/crypto/pbkdf2"
+	"strconv"
+	"strings"
 )
 
+// 口令摘要格式
+//
+// 当前格式为 pbkdf2-sm3$迭代次数$摘要Hex，摘要为 PBKDF2-HMAC-SM3(口令, 盐值, 迭代次数) 输出的32字节；
+// 早期版本的格式为 SM3(口令 || 盐值) 的Hex，不含前缀。两种格式的盐值均单独保存。
+const (
+	pwdSchemePBKDF2 = "pbkdf2-sm3"
+	pwdKeyLen       = 32
+	// MinPasswordIterations 允许配置的最小迭代次数
+	MinPasswordIterations = 10000
+)
+
+// PasswordIterations 生成口令摘要时PBKDF2的迭代次数，启动时根据配置设置
+// 调大迭代次数后，已有用户在下次登录时自动按新的迭代次数重新计算摘要。
+var PasswordIterations = 100000
+
 // GenPasswordSalt 通过明文和随机源生产口令+加盐
-// return: 口令加盐摘要Hex, 盐值Hex, 错误
+// return: 口令加盐摘要, 盐值Hex, 错误
 func GenPasswordSalt(password string) (string, string, error) {
 	if password == "" {
 		return "", "", fmt.Errorf("password 为空")
@@ -22,36 +40,62 @@ func GenPasswordSalt(password string) (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
-	// 拼接 口令 + 盐值
-	plaintext := append([]byte(password), salt...)
-	hash := sm3.New()
-	hash.Write(plaintext)
-	pwdHash := hash.Sum(nil)
-	return hex.EncodeToString(pwdHash), hex.EncodeToString(salt), nil
+	iter := PasswordIterations
+	key := pbkdf2.Key([]byte(password), salt, iter, pwdKeyLen, sm3.New)
+	return fmt.Sprintf("%s$%d$%s", pwdSchemePBKDF2, iter, hex.EncodeToString(key)), hex.EncodeToString(salt), nil
 }
 
-// VerifyPasswordSalt 验证口令是否有效
+// VerifyPasswordSalt 验证口令是否有效，兼容早期版本的SM3摘要格式
 // password: 待验证的口令
-// pwdSaltHex: 口令加盐Hash值
+// pwdSaltHex: 口令加盐摘要
 // saltHex: 盐值
 func VerifyPasswordSalt(password, pwdSaltHex, saltHex string) bool {
 	if password == "" || pwdSaltHex == "" || saltHex == "" {
 		return false
 	}
-	// 期望的处理结果
-	exp, err := hex.DecodeString(pwdSaltHex)
-	if err != nil {
-		// 无法解码
-		return false
-	}
 	salt, err := hex.DecodeString(saltHex)
 	if err != nil {
 		return false
 	}
 
-	plaintext := append([]byte(password), salt...)
-	hash := sm3.New()
-	hash.Write(plaintext)
-	actual := hash.Sum(nil)
-	return bytes.Equal(exp, actual)
+	var exp, actual []byte
+	if iter, digest, ok := parsePBKDF2(pwdSaltHex); ok {
+		exp = digest
+		actual = pbkdf2.Key([]byte(password), salt, iter, len(digest), sm3.New)
+	} else {
+		// 早期版本 SM3(口令 || 盐值)
+		if exp, err = hex.DecodeString(pwdSaltHex); err != nil {
+			// 无法解码
+			return false
+		}
+		plaintext := append([]byte(password), salt...)
+		hash := sm3.New()
+		hash.Write(plaintext)
+		actual = hash.Sum(nil)
+	}
+	return subtle.ConstantTimeCompare(exp, actual) == 1
+}
+
+// NeedsRehash 口令摘要是否需要重新计算
+// 早期版本格式的摘要，或迭代次数小于当前配置的摘要，需要在验证口令通过后重新计算。
+func NeedsRehash(pwdSaltHex string) bool {
+	iter, _, ok := parsePBKDF2(pwdSaltHex)
+	return !ok || iter < PasswordIterations
+}
+
+// parsePBKDF2 解析 pbkdf2-sm3$迭代次数$摘要Hex 格式的口令摘要
+func parsePBKDF2(s string) (int, []byte, bool) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 || parts[0] != pwdSchemePBKDF2 {
+		return 0, nil, false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter < 1 {
+		return 0, nil, false
+	}
+	digest, err := hex.DecodeString(parts[2])
+	if err != nil || len(digest) == 0 {
+		return 0, nil, false
+	}
+	return iter, digest, true
 }
@@ -0,0 +1,124 @@
+package reuint
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PasswordPolicy 口令策略
+type PasswordPolicy struct {
+	MinLength   int           // 最小长度
+	MinClasses  int           // 至少包含的字符类别数，类别包括大写字母、小写字母、数字、特殊字符
+	BannedWords []string      // 禁用词，口令中不能包含（不区分大小写）
+	MaxAge      time.Duration // 有效期，小于等于0表示不过期
+	History     int           // 新口令不能与最近使用过的几个口令相同，小于等于0表示不限制
+}
+
+// 生成随机口令使用的字符集，去除了容易混淆的字符 I l 1 O 0
+const (
+	pwdUpper   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	pwdLower   = "abcdefghijkmnpqrstuvwxyz"
+	pwdDigit   = "23456789"
+	pwdSpecial = "!@#$%^&*-_=+?"
+)
+
+// Check 检查口令是否满足策略，不满足时返还原因
+// personal: 用户个人信息，如工号、用户名、手机号，口令中不能包含（不区分大小写，忽略3个字符以下的信息）
+func (p *PasswordPolicy) Check(password string, personal ...string) error {
+	if password == "" {
+		return errors.New("口令不能为空")
+	}
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("口令长度不少于%d位", p.MinLength)
+	} else if n > 64 {
+		return errors.New("口令长度不超过64位")
+	}
+	if PasswordClasses(password) < p.MinClasses {
+		return fmt.Errorf("口令需至少包含大写字母、小写字母、数字、特殊字符中的%d类", p.MinClasses)
+	}
+	lower := strings.ToLower(password)
+	for _, word := range p.BannedWords {
+		if word != "" && strings.Contains(lower, strings.ToLower(word)) {
+			return fmt.Errorf("口令不能包含常见弱口令 %s", word)
+		}
+	}
+	for _, word := range personal {
+		if utf8.RuneCountInString(word) >= 3 && strings.Contains(lower, strings.ToLower(word)) {
+			return errors.New("口令不能包含工号、用户名、手机号等个人信息")
+		}
+	}
+	return nil
+}
+
+// Expired 口令是否已过期
+// changedAt: 口令修改时间，为空表示未知，视为未过期
+func (p *PasswordPolicy) Expired(changedAt *time.Time, now time.Time) bool {
+	return p.MaxAge > 0 && changedAt != nil && !now.Before(changedAt.Add(p.MaxAge))
+}
+
+// Generate 生成满足策略的随机口令，长度不小于12位，包含所有字符类别
+func (p *PasswordPolicy) Generate() (string, error) {
+	length := p.MinLength
+	if length < 12 {
+		length = 12
+	}
+	classes := []string{pwdUpper, pwdLower, pwdDigit, pwdSpecial}
+	all := strings.Join(classes, "")
+	for {
+		buf := make([]byte, length)
+		for i := range buf {
+			set := all
+			// 前4位依次取自各字符类别，保证包含所有类别
+			if i < len(classes) {
+				set = classes[i]
+			}
+			c, err := randByte(set)
+			if err != nil {
+				return "", err
+			}
+			buf[i] = c
+		}
+		// 打乱顺序
+		for i := len(buf) - 1; i > 0; i-- {
+			j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+			if err != nil {
+				return "", err
+			}
+			buf[i], buf[j.Int64()] = buf[j.Int64()], buf[i]
+		}
+		if p.Check(string(buf)) == nil {
+			return string(buf), nil
+		}
+	}
+}
+
+func randByte(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
+
+// PasswordClasses 口令包含的字符类别数，类别包括大写字母、小写字母、数字、特殊字符
+func PasswordClasses(password string) int {
+	var upper, lower, digit, special int
+	for _, r := range password {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = 1
+		case r >= 'a' && r <= 'z':
+			lower = 1
+		case r >= '0' && r <= '9':
+			digit = 1
+		default:
+			special = 1
+		}
+	}
+	return upper + lower + digit + special
+}
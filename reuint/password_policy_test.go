@@ -0,0 +1,59 @@
+package reuint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 8, MinClasses: 3, BannedWords: []string{"qwerty", "Admin"}}
+	cases := map[string]bool{
+		"":             false,
+		"Ab1!":         false, // 长度不足
+		"abcdefgh":     false, // 类别不足
+		"abcdefg1":     false,
+		"abcdef1!":     true,
+		"Abcdefg1":     true,
+		"Qwerty12!":    false, // 禁用词
+		"myADMIN#2024": false,
+		"Zs1001#pass":  false, // 个人信息
+		"Zs#2024pass":  true,
+	}
+	for pwd, ok := range cases {
+		if err := p.Check(pwd, "1001", "zs"); (err == nil) != ok {
+			t.Errorf("Check(%q) = %v, expect ok %v", pwd, err, ok)
+		}
+	}
+}
+
+func TestPasswordPolicy_Generate(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 16, MinClasses: 4, BannedWords: []string{"ab"}}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		pwd, err := p.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pwd) != 16 || p.Check(pwd) != nil || seen[pwd] {
+			t.Fatalf("unexpected password %q", pwd)
+		}
+		seen[pwd] = true
+	}
+}
+
+func TestPasswordPolicy_Expired(t *testing.T) {
+	now := time.Now()
+	changed := now.Add(-91 * 24 * time.Hour)
+	p := &PasswordPolicy{MaxAge: 90 * 24 * time.Hour}
+	if !p.Expired(&changed, now) || p.Expired(nil, now) {
+		t.Fatal("unexpected expired result")
+	}
+	recent := now.Add(-time.Hour)
+	if p.Expired(&recent, now) {
+		t.Fatal("recent password should not expire")
+	}
+	p.MaxAge = 0
+	if p.Expired(&changed, now) {
+		t.Fatal("password should not expire when max age disabled")
+	}
+}
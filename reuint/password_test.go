@@ -2,6 +2,7 @@ package reuint
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +33,37 @@ func TestPasswordProcess_Verify(t *testing.T) {
 		t.Fatalf("Expect Password not right, but it pass")
 	}
 }
+
+func TestPasswordProcess_PBKDF2(t *testing.T) {
+	old := PasswordIterations
+	defer func() { PasswordIterations = old }()
+	PasswordIterations = MinPasswordIterations
+
+	pwdHash, saltHex, err := GenPasswordSalt("Passw0rd#1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(pwdHash, "pbkdf2-sm3$10000$") {
+		t.Fatalf("unexpected hash format %s", pwdHash)
+	}
+	if !VerifyPasswordSalt("Passw0rd#1", pwdHash, saltHex) || VerifyPasswordSalt("Passw0rd#2", pwdHash, saltHex) {
+		t.Fatal("unexpected verify result")
+	}
+	if NeedsRehash(pwdHash) {
+		t.Fatal("current hash should not need rehash")
+	}
+	// 调大迭代次数后需要重新计算，原摘要仍可验证
+	PasswordIterations = 2 * MinPasswordIterations
+	if !NeedsRehash(pwdHash) || !VerifyPasswordSalt("Passw0rd#1", pwdHash, saltHex) {
+		t.Fatal("expect rehash after iterations increased")
+	}
+	// 早期版本格式
+	if !NeedsRehash("ebb4cb79911b6c71937e3b0b5aa9de4732178f162429472a111f1850ed047b68") {
+		t.Fatal("legacy hash should need rehash")
+	}
+	for _, bad := range []string{"pbkdf2-sm3$0$00", "pbkdf2-sm3$abc$00", "pbkdf2-sm3$10000$", "pbkdf2-sm3$10000$zz"} {
+		if VerifyPasswordSalt("Passw0rd#1", bad, saltHex) {
+			t.Fatalf("malformed hash %q should not verify", bad)
+		}
+	}
+}
@@ -10,13 +10,29 @@ import (
 // DeleteUnreferencedFiles 删除文件夹中未被引用的文件
 // - content 文档内容 - docType 文档类型 - id 文档ID - exp 额外参数
 func DeleteUnreferencedFiles(content string, filePath string) error {
+	files, _ := os.ReadDir(filePath)
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	for _, name := range UnreferencedFiles(content, names) {
+		removePath := filepath.Join(filePath, name)
+		err := os.Remove(removePath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// UnreferencedFiles 返回文件名列表中未被文档内容以 "&file=文件名)" 形式引用的文件
+func UnreferencedFiles(content string, names []string) []string {
 	reg := regexp.MustCompile("\\&file=.*?\\)")
 	results := reg.FindAllString(content, -1)
 
-	files, _ := os.ReadDir(filePath)
-	for _, f := range files {
-		name := fmt.Sprintf("&file=%s)", f.Name())
+	var res []string
+	for _, n := range names {
+		name := fmt.Sprintf("&file=%s)", n)
 		removeFlag := true
 		for _, result := range results {
 			if result == name {
@@ -24,13 +40,8 @@ func DeleteUnreferencedFiles(content string, filePath string) error {
 			}
 		}
 		if removeFlag {
-			removePath := filepath.Join(filePath, f.Name())
-			err := os.Remove(removePath)
-			if err != nil {
-				return err
-			}
+			res = append(res, n)
 		}
-
 	}
-	return nil
+	return res
 }
@@ -0,0 +1,246 @@
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/smx509"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ocspSkew OCSP响应时间与本地时间允许的最大偏差
+const ocspSkew = 5 * time.Minute
+
+// OCSP（RFC 6960）报文结构，仅包含查询单个证书状态需要的部分
+var (
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasic     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidSignatureAlgs = []struct {
+		oid  asn1.ObjectIdentifier
+		algo smx509.SignatureAlgorithm
+	}{
+		{asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}, smx509.SM2WithSM3},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, smx509.ECDSAWithSHA256},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, smx509.ECDSAWithSHA384},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, smx509.ECDSAWithSHA512},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, smx509.SHA256WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, smx509.SHA384WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, smx509.SHA512WithRSA},
+	}
+)
+
+type certID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest struct {
+		RequestList []struct {
+			Cert certID
+		}
+	}
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type basicResponse struct {
+	TBSResponseData    responseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []singleResponse
+}
+
+type singleResponse struct {
+	CertID     certID
+	Good       asn1.Flag   `asn1:"tag:0,optional"`
+	Revoked    revokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag   `asn1:"tag:2,optional"`
+	ThisUpdate time.Time   `asn1:"generalized"`
+	NextUpdate time.Time   `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// newCertID 按 RFC 6960 4.1.1 使用SHA-1计算颁发者名称与公钥的摘要
+func newCertID(cert, issuer *smx509.Certificate) (certID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return certID{}, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return certID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      nameHash[:],
+		IssuerKeyHash: keyHash[:],
+		SerialNumber:  cert.SerialNumber,
+	}, nil
+}
+
+// checkOCSP 依次查询证书中的OCSP服务，结果缓存至响应中的 nextUpdate
+// return: 是否吊销, 错误
+func (c *Checker) checkOCSP(ctx context.Context, cert, issuer *smx509.Certificate) (bool, error) {
+	id, err := newCertID(cert, issuer)
+	if err != nil {
+		return false, err
+	}
+	key := hex.EncodeToString(id.IssuerKeyHash) + ":" + cert.SerialNumber.Text(16)
+	c.mu.Lock()
+	res, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(res.until) {
+		return res.revoked, nil
+	}
+
+	var req ocspRequest
+	req.TBSRequest.RequestList = append(req.TBSRequest.RequestList, struct{ Cert certID }{id})
+	body, err := asn1.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+	var errs []string
+	for _, server := range cert.OCSPServer {
+		res, err := c.query(ctx, server, body, id, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("OCSP服务 %s：%s", server, err.Error()))
+			continue
+		}
+		c.mu.Lock()
+		if !res.until.IsZero() {
+			c.cache[key] = res
+		} else {
+			delete(c.cache, key)
+		}
+		c.mu.Unlock()
+		return res.revoked, nil
+	}
+	return false, errors.New(strings.Join(errs, "；"))
+}
+
+// query 查询OCSP服务并验证响应
+func (c *Checker) query(ctx context.Context, server string, body []byte, id certID, issuer *smx509.Certificate) (ocspResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(body))
+	if err != nil {
+		return ocspResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return ocspResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ocspResult{}, fmt.Errorf("响应状态 %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ocspResult{}, err
+	}
+	return parseResponse(data, id, issuer, time.Now())
+}
+
+// parseResponse 解析并验证OCSP响应
+// 响应需由颁发者签名，或由颁发者签发的具有OCSP签名扩展密钥用途的证书签名。
+func parseResponse(data []byte, id certID, issuer *smx509.Certificate, now time.Time) (ocspResult, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(data, &resp); err != nil || len(rest) > 0 {
+		return ocspResult{}, errors.New("响应格式错误")
+	}
+	if resp.Status != 0 {
+		return ocspResult{}, fmt.Errorf("响应状态码 %d", resp.Status)
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidOCSPBasic) {
+		return ocspResult{}, errors.New("不支持的响应类型")
+	}
+	var basic basicResponse
+	if rest, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil || len(rest) > 0 {
+		return ocspResult{}, errors.New("响应格式错误")
+	}
+
+	algo := smx509.UnknownSignatureAlgorithm
+	for _, item := range oidSignatureAlgs {
+		if item.oid.Equal(basic.SignatureAlgorithm.Algorithm) {
+			algo = item.algo
+		}
+	}
+	signers := []*smx509.Certificate{issuer}
+	for _, raw := range basic.Certificates {
+		cert, err := smx509.ParseCertificate(raw.FullBytes)
+		if err != nil || cert.CheckSignatureFrom(issuer) != nil || !hasOCSPSigning(cert) {
+			continue
+		}
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			continue
+		}
+		signers = append(signers, cert)
+	}
+	verified := false
+	for _, signer := range signers {
+		if signer.CheckSignature(algo, basic.TBSResponseData.Raw, basic.Signature.RightAlign()) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return ocspResult{}, errors.New("响应签名验证失败")
+	}
+
+	for _, r := range basic.TBSResponseData.Responses {
+		if r.CertID.SerialNumber == nil || r.CertID.SerialNumber.Cmp(id.SerialNumber) != 0 ||
+			!bytes.Equal(r.CertID.NameHash, id.NameHash) || !bytes.Equal(r.CertID.IssuerKeyHash, id.IssuerKeyHash) {
+			continue
+		}
+		if r.ThisUpdate.After(now.Add(ocspSkew)) || (!r.NextUpdate.IsZero() && r.NextUpdate.Before(now)) {
+			return ocspResult{}, errors.New("响应已过期或尚未生效")
+		}
+		switch {
+		case bool(r.Good):
+			return ocspResult{until: r.NextUpdate}, nil
+		case !r.Revoked.RevocationTime.IsZero():
+			return ocspResult{revoked: true, until: r.NextUpdate}, nil
+		}
+		return ocspResult{}, errors.New("OCSP服务不知道该证书")
+	}
+	return ocspResult{}, errors.New("响应中没有该证书的状态")
+}
+
+func hasOCSPSigning(cert *smx509.Certificate) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == smx509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+// Package revocation 证书吊销状态检查
+//
+// 优先使用根证书目录中由证书颁发者签发的有效吊销列表（CRL），没有有效的吊销列表时，
+// 可向证书颁发机构信息访问扩展（AIA）中的OCSP服务查询。吊销列表按文件修改时间缓存解析结果，
+// OCSP查询结果缓存至响应中的 nextUpdate。
+package revocation
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"github.com/emmansun/gmsm/smx509"
+	"go.uber.org/zap"
+	"net/http"
+	"pdm/reuint"
+	"pdm/storage"
+	"sync"
+	"time"
+)
+
+// 检查模式
+const (
+	ModeOff  = "off"  // 不检查
+	ModeSoft = "soft" // 无法确认证书状态时允许并记录日志
+	ModeHard = "hard" // 无法确认证书状态时拒绝
+)
+
+var (
+	// ErrRevoked 证书已被吊销
+	ErrRevoked = errors.New("revocation: 证书已吊销")
+	// ErrUnknown 无法确认证书状态，没有有效的吊销列表且OCSP查询失败或未启用
+	ErrUnknown = errors.New("revocation: 无法确认证书状态")
+)
+
+// Config 吊销检查配置
+type Config struct {
+	Mode    string        // 检查模式，见 ModeOff 等，为空时同 ModeSoft
+	OCSP    bool          // 没有有效的吊销列表时查询OCSP服务
+	Timeout time.Duration // OCSP查询超时时间
+}
+
+// Checker 证书吊销状态检查
+type Checker struct {
+	cfg    Config
+	store  storage.Storage // 吊销列表所在的存储，与根证书相同
+	client *http.Client
+
+	mu    sync.Mutex
+	crls  map[string]*crlFile   // 已解析的吊销列表，键为文件路径
+	cache map[string]ocspResult // OCSP查询结果，键为 issuerKeyHash:序列号
+}
+
+// crlFile 已解析的吊销列表文件，非吊销列表的文件 list 为空，避免重复解析
+type crlFile struct {
+	modTime time.Time
+	size    int64
+	list    *pkix.CertificateList
+	revoked map[string]bool // 被吊销证书的序列号
+}
+
+// ocspResult 缓存的OCSP查询结果
+type ocspResult struct {
+	revoked bool
+	until   time.Time
+}
+
+// New 创建吊销状态检查
+// store: 吊销列表所在的存储，通常为根证书存储 storage.RootCert
+func New(cfg Config, store storage.Storage) *Checker {
+	return &Checker{
+		cfg:    cfg,
+		store:  store,
+		client: &http.Client{Timeout: cfg.Timeout},
+		crls:   map[string]*crlFile{},
+		cache:  map[string]ocspResult{},
+	}
+}
+
+// Verify 按检查模式检查证书的吊销状态
+// 证书被吊销时返还 ErrRevoked；无法确认状态时，hard 模式返还 ErrUnknown，soft 模式仅记录日志。
+// issuer: 签发证书的CA证书，通常为证书链验证结果中的第二个证书
+func (c *Checker) Verify(ctx context.Context, cert, issuer *smx509.Certificate) error {
+	if c == nil || c.cfg.Mode == ModeOff {
+		return nil
+	}
+	err := c.Check(ctx, cert, issuer)
+	if err == nil || errors.Is(err, ErrRevoked) {
+		return err
+	}
+	if c.cfg.Mode == ModeHard {
+		return err
+	}
+	zap.L().Warn("无法确认证书吊销状态，允许使用",
+		zap.String("subject", cert.Subject.String()),
+		zap.String("serial", cert.SerialNumber.Text(16)),
+		zap.Error(err))
+	return nil
+}
+
+// Check 检查证书的吊销状态，未吊销返还 nil，被吊销返还 ErrRevoked，无法确认状态返还包装了 ErrUnknown 的错误
+func (c *Checker) Check(ctx context.Context, cert, issuer *smx509.Certificate) error {
+	revoked, found, err := c.checkCRL(cert, issuer)
+	if err != nil {
+		return fmt.Errorf("%w，读取吊销列表失败：%s", ErrUnknown, err.Error())
+	}
+	if found {
+		if revoked {
+			return ErrRevoked
+		}
+		return nil
+	}
+	if !c.cfg.OCSP || len(cert.OCSPServer) == 0 {
+		return fmt.Errorf("%w，没有颁发者 %s 的有效吊销列表", ErrUnknown, issuer.Subject.String())
+	}
+	revoked, err = c.checkOCSP(ctx, cert, issuer)
+	if err != nil {
+		return fmt.Errorf("%w，%s", ErrUnknown, err.Error())
+	}
+	if revoked {
+		return ErrRevoked
+	}
+	return nil
+}
+
+// checkCRL 使用颁发者签发的最新有效吊销列表检查
+// return: 是否吊销, 是否找到有效的吊销列表, 错误
+func (c *Checker) checkCRL(cert, issuer *smx509.Certificate) (bool, bool, error) {
+	if c.store == nil {
+		return false, false, nil
+	}
+	items, err := c.store.List("")
+	if err != nil {
+		return false, false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var latest *crlFile
+	seen := map[string]bool{}
+	for _, item := range items {
+		if item.IsDir {
+			continue
+		}
+		seen[item.Path] = true
+		f := c.crls[item.Path]
+		if f == nil || !f.modTime.Equal(item.ModTime) || f.size != item.Size {
+			data, err := storage.ReadFile(c.store, item.Path)
+			if err != nil {
+				return false, false, err
+			}
+			f = parseFile(data)
+			f.modTime, f.size = item.ModTime, item.Size
+			c.crls[item.Path] = f
+		}
+		if f.list == nil {
+			continue
+		}
+		tbs := f.list.TBSCertList
+		// 已过期或尚未生效的吊销列表不可用
+		if tbs.ThisUpdate.After(now) || (!tbs.NextUpdate.IsZero() && tbs.NextUpdate.Before(now)) {
+			continue
+		}
+		if latest != nil && !tbs.ThisUpdate.After(latest.list.TBSCertList.ThisUpdate) {
+			continue
+		}
+		if issuer.CheckCRLSignature(f.list) != nil {
+			continue
+		}
+		latest = f
+	}
+	// 清理已删除文件的缓存
+	for p := range c.crls {
+		if !seen[p] {
+			delete(c.crls, p)
+		}
+	}
+	if latest == nil {
+		return false, false, nil
+	}
+	return latest.revoked[cert.SerialNumber.String()], true, nil
+}
+
+// parseFile 解析吊销列表文件，非吊销列表时 list 为空
+func parseFile(data []byte) *crlFile {
+	f := &crlFile{list: ParseCRL(data)}
+	if f.list == nil {
+		return f
+	}
+	f.revoked = make(map[string]bool, len(f.list.TBSCertList.RevokedCertificates))
+	for _, item := range f.list.TBSCertList.RevokedCertificates {
+		f.revoked[item.SerialNumber.String()] = true
+	}
+	return f
+}
+
+// ParseCRL 解析吊销列表，支持DER、PEM、BASE64与16进制格式，不是吊销列表时返还 nil
+func ParseCRL(data []byte) *pkix.CertificateList {
+	der := reuint.Decode2DER(data)
+	if der == nil {
+		return nil
+	}
+	list, err := smx509.ParseDERCRL(der)
+	if err != nil {
+		return nil
+	}
+	return list
+}
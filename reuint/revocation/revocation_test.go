@@ -0,0 +1,248 @@
+package revocation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"pdm/storage"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCA 测试用SM2证书颁发机构
+type testCA struct {
+	cert   *smx509.Certificate
+	key    *sm2.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	t.Helper()
+	ca := &testCA{serial: 1}
+	ca.cert, ca.key = ca.issue(t, &smx509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		KeyUsage:              smx509.KeyUsageCertSign | smx509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte(cn),
+	})
+	return ca
+}
+
+// issue 签发证书，CA证书为空时签发自签名证书
+func (ca *testCA) issue(t *testing.T, tmpl *smx509.Certificate) (*smx509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	tmpl.SerialNumber = big.NewInt(ca.serial)
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+	parent, parentKey := ca.cert, ca.key
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := smx509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := smx509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// crl 签发吊销列表，PEM格式
+func (ca *testCA) crl(t *testing.T, thisUpdate, nextUpdate time.Time, revoked ...*smx509.Certificate) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{Number: big.NewInt(time.Now().UnixNano()), ThisUpdate: thisUpdate, NextUpdate: nextUpdate}
+	for _, c := range revoked {
+		tmpl.RevokedCertificates = append(tmpl.RevokedCertificates, pkix.RevokedCertificate{SerialNumber: c.SerialNumber, RevocationTime: thisUpdate})
+	}
+	der, err := smx509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+// ocspResponder 返还由签名证书签名的OCSP响应，revoked 中的序列号为已吊销
+func (ca *testCA) ocspResponder(t *testing.T, signer *smx509.Certificate, signerKey *sm2.PrivateKey, revoked map[int64]bool, nextUpdate time.Duration, count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		body, _ := io.ReadAll(r.Body)
+		var req ocspRequest
+		if _, err := asn1.Unmarshal(body, &req); err != nil || len(req.TBSRequest.RequestList) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id := req.TBSRequest.RequestList[0].Cert
+		single := singleResponse{CertID: id, ThisUpdate: time.Now().Add(-time.Minute).UTC().Truncate(time.Second)}
+		if nextUpdate > 0 {
+			single.NextUpdate = time.Now().Add(nextUpdate).UTC().Truncate(time.Second)
+		}
+		if revoked[id.SerialNumber.Int64()] {
+			single.Revoked.RevocationTime = single.ThisUpdate
+		} else {
+			single.Good = true
+		}
+		tbs, err := asn1.Marshal(responseData{
+			ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: signer.RawSubject},
+			ProducedAt:  time.Now().UTC().Truncate(time.Second),
+			Responses:   []singleResponse{single},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sig, err := signerKey.Sign(rand.Reader, tbs, sm2.NewSM2SignerOption(true, nil))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		basic := basicResponse{
+			TBSResponseData:    responseData{Raw: tbs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSignatureAlgs[0].oid},
+			Signature:          asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+		}
+		if signer != ca.cert {
+			basic.Certificates = []asn1.RawValue{{FullBytes: signer.Raw}}
+		}
+		basicDER, _ := asn1.Marshal(basic)
+		var resp ocspResponse
+		resp.ResponseBytes.ResponseType = oidOCSPBasic
+		resp.ResponseBytes.Response = basicDER
+		data, _ := asn1.Marshal(resp)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(data)
+	}))
+}
+
+func TestChecker_CRL(t *testing.T) {
+	ca, other := newTestCA(t, "测试根证书"), newTestCA(t, "其他根证书")
+	good, _ := ca.issue(t, &smx509.Certificate{Subject: pkix.Name{CommonName: "管理员"}})
+	revoked, _ := ca.issue(t, &smx509.Certificate{Subject: pkix.Name{CommonName: "已吊销"}})
+	store, _ := storage.NewLocal(t.TempDir())
+	_ = storage.WriteFile(store, "root.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+	ctx := context.Background()
+
+	hard := New(Config{Mode: ModeHard}, store)
+	soft := New(Config{Mode: ModeSoft}, store)
+	// 没有吊销列表
+	if err := hard.Verify(ctx, good, ca.cert); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("hard without crl: %v", err)
+	}
+	if err := soft.Verify(ctx, good, ca.cert); err != nil {
+		t.Fatalf("soft without crl: %v", err)
+	}
+	if err := New(Config{Mode: ModeOff}, store).Verify(ctx, revoked, ca.cert); err != nil {
+		t.Fatalf("off: %v", err)
+	}
+
+	// 其他颁发者签发的吊销列表不可用
+	_ = storage.WriteFile(store, "other.crl", other.crl(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), revoked))
+	if err := hard.Verify(ctx, revoked, ca.cert); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("other issuer crl: %v", err)
+	}
+	// 过期的吊销列表不可用
+	_ = storage.WriteFile(store, "ca.crl", ca.crl(t, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour), revoked))
+	if err := hard.Verify(ctx, revoked, ca.cert); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("expired crl: %v", err)
+	}
+	// 更新吊销列表后立即生效，soft 模式同样拒绝已吊销的证书
+	_ = storage.WriteFile(store, "ca.crl", ca.crl(t, time.Now().Add(-time.Minute), time.Now().Add(time.Hour), revoked))
+	for _, c := range []*Checker{hard, soft} {
+		if err := c.Verify(ctx, revoked, ca.cert); !errors.Is(err, ErrRevoked) {
+			t.Fatalf("revoked: %v", err)
+		}
+		if err := c.Verify(ctx, good, ca.cert); err != nil {
+			t.Fatalf("good: %v", err)
+		}
+	}
+	// 删除吊销列表
+	_ = store.Remove("ca.crl")
+	if err := hard.Verify(ctx, revoked, ca.cert); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("removed crl: %v", err)
+	}
+
+	if ParseCRL(ca.crl(t, time.Now(), time.Now().Add(time.Hour))) == nil || ParseCRL(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})) != nil {
+		t.Fatal("ParseCRL")
+	}
+}
+
+func TestChecker_OCSP(t *testing.T) {
+	ca := newTestCA(t, "测试根证书")
+	responder, responderKey := ca.issue(t, &smx509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP"},
+		ExtKeyUsage: []smx509.ExtKeyUsage{smx509.ExtKeyUsageOCSPSigning},
+	})
+	var count int32
+	revokedSerials := map[int64]bool{}
+	srv := ca.ocspResponder(t, responder, responderKey, revokedSerials, time.Hour, &count)
+	defer srv.Close()
+	good, _ := ca.issue(t, &smx509.Certificate{Subject: pkix.Name{CommonName: "管理员"}, OCSPServer: []string{srv.URL}})
+	revoked, _ := ca.issue(t, &smx509.Certificate{Subject: pkix.Name{CommonName: "已吊销"}, OCSPServer: []string{srv.URL}})
+	revokedSerials[revoked.SerialNumber.Int64()] = true
+	store, _ := storage.NewLocal(t.TempDir())
+	ctx := context.Background()
+
+	// 未启用OCSP
+	if err := New(Config{Mode: ModeHard}, store).Verify(ctx, good, ca.cert); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("ocsp disabled: %v", err)
+	}
+	c := New(Config{Mode: ModeHard, OCSP: true, Timeout: 5 * time.Second}, store)
+	if err := c.Verify(ctx, good, ca.cert); err != nil {
+		t.Fatalf("good: %v", err)
+	}
+	if err := c.Verify(ctx, revoked, ca.cert); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked: %v", err)
+	}
+	// 结果缓存至 nextUpdate
+	if err := c.Verify(ctx, good, ca.cert); err != nil || atomic.LoadInt32(&count) != 2 {
+		t.Fatalf("cache: %v %d", err, count)
+	}
+
+	// 未被颁发者授权的签名证书
+	other := newTestCA(t, "其他根证书")
+	fake, fakeKey := other.issue(t, &smx509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP"},
+		ExtKeyUsage: []smx509.ExtKeyUsage{smx509.ExtKeyUsageOCSPSigning},
+	})
+	forged := ca.ocspResponder(t, fake, fakeKey, nil, time.Hour, &count)
+	defer forged.Close()
+	cert, _ := ca.issue(t, &smx509.Certificate{Subject: pkix.Name{CommonName: "伪造"}, OCSPServer: []string{forged.URL}})
+	if err := c.Verify(ctx, cert, ca.cert); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("forged responder: %v", err)
+	}
+	// 颁发者直接签名，没有 nextUpdate 时不缓存
+	direct := ca.ocspResponder(t, ca.cert, ca.key, nil, 0, &count)
+	defer direct.Close()
+	cert, _ = ca.issue(t, &smx509.Certificate{Subject: pkix.Name{CommonName: "直接签名"}, OCSPServer: []string{direct.URL}})
+	before := atomic.LoadInt32(&count)
+	for i := 0; i < 2; i++ {
+		if err := c.Verify(ctx, cert, ca.cert); err != nil {
+			t.Fatalf("issuer signed: %v", err)
+		}
+	}
+	if atomic.LoadInt32(&count)-before != 2 {
+		t.Fatalf("expect no cache without nextUpdate, got %d", count-before)
+	}
+	// 吊销列表优先于OCSP
+	_ = storage.WriteFile(store, "ca.crl", ca.crl(t, time.Now().Add(-time.Minute), time.Now().Add(time.Hour), cert))
+	if err := c.Verify(ctx, cert, ca.cert); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("crl before ocsp: %v", err)
+	}
+}
@@ -1,30 +1,60 @@
 package reuint
 
 import (
+	"bytes"
 	"github.com/emmansun/gmsm/smx509"
-	"os"
-	"path/filepath"
-	"pdm/appconf/dir"
+	"pdm/storage"
 )
 
-var (
-	CertPool *smx509.CertPool // 根证书池
-)
+// LoadCertsPool 从根证书存储中读取所有根证书，返回新的信任锚与中间证书池
+// 多个实例共享根证书存储，因此在验证证书前重新加载，以获取其他实例上传或删除的根证书。
+// 自签名证书作为信任锚；能验证到信任锚的其他证书作为中间证书，使证书链包含中间证书以便逐级检查吊销状态；
+// 上级证书未上传的证书仍作为信任锚。
+func LoadCertsPool() (roots, intermediates *smx509.CertPool) {
+	roots, intermediates = smx509.NewCertPool(), smx509.NewCertPool()
+	others := smx509.NewCertPool()
+	var list []*smx509.Certificate
+	for _, cert := range LoadCerts() {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			roots.AddCert(cert)
+			continue
+		}
+		others.AddCert(cert)
+		list = append(list, cert)
+	}
+	anchors := roots.Clone()
+	for _, cert := range list {
+		opts := smx509.VerifyOptions{Roots: anchors, Intermediates: others, KeyUsages: []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny}}
+		if _, err := cert.Verify(opts); err == nil {
+			intermediates.AddCert(cert)
+		} else {
+			roots.AddCert(cert)
+		}
+	}
+	return roots, intermediates
+}
 
-// LoadCertsPool 初始化证书池 将根证书加入到证书池
-func LoadCertsPool() {
-	CertPool = smx509.NewCertPool()
-	base, _ := filepath.Abs(dir.RootCertDir)
+// LoadCerts 从根证书存储中读取所有根证书，跳过吊销列表等非证书文件
+func LoadCerts() []*smx509.Certificate {
+	var res []*smx509.Certificate
+	if storage.RootCert == nil {
+		return res
+	}
 	// 读取文件夹
-	readDir, err := os.ReadDir(base)
+	items, err := storage.RootCert.List("")
 	if err != nil {
-		return
+		return res
 	}
-	// 根证书加入证书池
-	for _, file := range readDir {
-		path := filepath.Join(base, file.Name())
-		temp, _ := os.ReadFile(path)
-		cert, _ := smx509.ParseCertificate(Decode2DER(temp))
-		CertPool.AddCert(cert)
+	for _, item := range items {
+		if item.IsDir {
+			continue
+		}
+		temp, _ := storage.ReadFile(storage.RootCert, item.Path)
+		cert, err := smx509.ParseCertificate(Decode2DER(temp))
+		if err != nil {
+			continue
+		}
+		res = append(res, cert)
 	}
+	return res
 }
@@ -0,0 +1,59 @@
+package reuint
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B测试向量（SHA1，取后6位）
+func TestTotpCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, exp := range cases {
+		code, err := TotpCode(secret, TotpStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != exp {
+			t.Errorf("TotpCode(%d) = %s, expect %s", unix, code, exp)
+		}
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	secret, err := GenTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	step := TotpStep(now)
+	prev, _ := TotpCode(secret, step-1)
+	if s, ok := VerifyTotp(secret, prev, now, 0); !ok || s != step-1 {
+		t.Fatal("expect previous step accepted")
+	}
+	// 重放
+	if _, ok := VerifyTotp(secret, prev, now, step-1); ok {
+		t.Fatal("expect replayed code rejected")
+	}
+	old, _ := TotpCode(secret, step-3)
+	if _, ok := VerifyTotp(secret, old, now, 0); ok {
+		t.Fatal("expect expired code rejected")
+	}
+	if _, ok := VerifyTotp(secret, "12345", now, 0); ok {
+		t.Fatal("expect malformed code rejected")
+	}
+
+	uri := TotpURI("PDM", "1001", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/PDM:1001?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+}
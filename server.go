@@ -1,15 +1,32 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/tjfoc/gmsm/gmtls"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
 	"pdm/appconf"
+	"pdm/appconf/dir"
 	"pdm/controller"
+	"strconv"
+	"strings"
 )
 
-func NewHttpServer(config *appconf.Application) *http.Server {
+// HttpServer Web服务器
+// 启用HTTPS时根据配置提供标准TLS、TLCP或两者自动识别的服务，并可在重定向端口将HTTP请求重定向到HTTPS
+// TLCP（国密SSL）协议由 github.com/tjfoc/gmsm/gmtls 实现
+type HttpServer struct {
+	*http.Server
+	tlsConfig  *tls.Config   // 标准TLS配置，仅配置标准证书时使用
+	tlcpConfig *gmtls.Config // TLCP配置，同时配置标准证书时与TLS自动切换
+	redirect   *http.Server  // HTTP重定向服务
+}
+
+func NewHttpServer(config *appconf.Application) (*HttpServer, error) {
 	var r *gin.Engine
 	if config.Debug {
 		r = gin.Default()
@@ -17,10 +34,140 @@ func NewHttpServer(config *appconf.Application) *http.Server {
 		r = gin.New()
 	}
 	// 注册路路由
-	controller.RouteMapping(r, config)
-	zap.L().Info("系统启动", zap.Int("port", config.Port))
-	return &http.Server{
-		Addr:    fmt.Sprintf(":%d", config.Port),
-		Handler: r,
+	if err := controller.RouteMapping(r, config); err != nil {
+		return nil, err
+	}
+	res := &HttpServer{
+		Server: &http.Server{
+			Addr:    fmt.Sprintf(":%d", config.Port),
+			Handler: r,
+		},
+	}
+	if !config.TLS.Enable {
+		zap.L().Info("系统启动", zap.Int("port", config.Port))
+		return res, nil
+	}
+
+	if config.TLS.SM2() {
+		sign, err := gmtls.LoadX509KeyPair(dir.Abs(config.TLS.SignCertFile), dir.Abs(config.TLS.SignKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("加载SM2签名证书失败，%s", err.Error())
+		}
+		enc, err := gmtls.LoadX509KeyPair(dir.Abs(config.TLS.EncCertFile), dir.Abs(config.TLS.EncKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("加载SM2加密证书失败，%s", err.Error())
+		}
+		if !config.TLS.Standard() {
+			res.tlcpConfig = &gmtls.Config{
+				GMSupport:    gmtls.NewGMSupport(),
+				Certificates: []gmtls.Certificate{sign, enc},
+			}
+		} else {
+			cert, err := gmtls.LoadX509KeyPair(dir.Abs(config.TLS.CertFile), dir.Abs(config.TLS.KeyFile))
+			if err != nil {
+				return nil, fmt.Errorf("加载服务器证书失败，%s", err.Error())
+			}
+			res.tlcpConfig, err = gmtls.NewBasicAutoSwitchConfig(&sign, &enc, &cert)
+			if err != nil {
+				return nil, err
+			}
+			// 自动切换模式下TLS客户端同样限制最低版本为TLS 1.2
+			std := &gmtls.Config{
+				Certificates: []gmtls.Certificate{cert},
+				MinVersion:   gmtls.VersionTLS12,
+				NextProtos:   []string{"http/1.1"},
+			}
+			res.tlcpConfig.GetConfigForClient = func(info *gmtls.ClientHelloInfo) (*gmtls.Config, error) {
+				for _, v := range info.SupportedVersions {
+					if v == gmtls.VersionGMSSL {
+						return nil, nil
+					}
+				}
+				return std, nil
+			}
+		}
+	} else if config.TLS.Standard() {
+		cert, err := tls.LoadX509KeyPair(dir.Abs(config.TLS.CertFile), dir.Abs(config.TLS.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("加载服务器证书失败，%s", err.Error())
+		}
+		res.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			NextProtos:   []string{"http/1.1"},
+		}
+	}
+	if config.TLS.RedirectPort > 0 {
+		res.redirect = &http.Server{
+			Addr:    fmt.Sprintf(":%d", config.TLS.RedirectPort),
+			Handler: redirectHandler(config.Port),
+		}
+	}
+	zap.L().Info("系统启动",
+		zap.Int("port", config.Port),
+		zap.Bool("tls", res.tlsConfig != nil),
+		zap.Bool("tlcp", res.tlcpConfig != nil),
+		zap.Int("redirectPort", config.TLS.RedirectPort))
+	return res, nil
+}
+
+// ListenAndServe 监听端口并提供服务
+func (s *HttpServer) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
 	}
+	if s.redirect != nil {
+		go func() {
+			if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				zap.L().Error("HTTP重定向服务启动失败", zap.Error(err))
+			}
+		}()
+	}
+	return s.Serve(s.wrap(ln))
+}
+
+// wrap 根据HTTPS配置包装监听器
+func (s *HttpServer) wrap(ln net.Listener) net.Listener {
+	switch {
+	case s.tlcpConfig != nil:
+		return gmtls.NewListener(ln, s.tlcpConfig)
+	case s.tlsConfig != nil:
+		return tls.NewListener(ln, s.tlsConfig)
+	}
+	return ln
+}
+
+// Shutdown 停止接受新的连接，并等待处理中的请求完成
+// ctx 超时后强制关闭剩余连接
+func (s *HttpServer) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		_ = s.redirect.Shutdown(ctx)
+	}
+	err := s.Server.Shutdown(ctx)
+	if err != nil {
+		_ = s.Server.Close()
+	}
+	return err
+}
+
+// redirectHandler 将HTTP请求重定向到HTTPS端口
+func redirectHandler(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
 }
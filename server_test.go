@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/emmansun/gmsm/sm2"
+	"github.com/emmansun/gmsm/smx509"
+	"github.com/tjfoc/gmsm/gmtls"
+	gmx509 "github.com/tjfoc/gmsm/x509"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pdm/controller/controllertest"
+	"testing"
+	"time"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		method string
+		port   int
+		url    string
+		code   int
+		expect string
+	}{
+		{http.MethodGet, 8443, "http://example.com:8080/ui/?a=1", http.StatusMovedPermanently, "https://example.com:8443/ui/?a=1"},
+		{http.MethodPost, 443, "http://example.com/api/login", http.StatusPermanentRedirect, "https://example.com/api/login"},
+		{http.MethodGet, 443, "http://[::1]:8080/", http.StatusMovedPermanently, "https://[::1]/"},
+		{http.MethodGet, 8443, "http://[::1]/", http.StatusMovedPermanently, "https://[::1]:8443/"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		redirectHandler(c.port).ServeHTTP(w, httptest.NewRequest(c.method, c.url, nil))
+		if w.Code != c.code || w.Header().Get("Location") != c.expect {
+			t.Errorf("%s %s: got %d %s, expect %d %s", c.method, c.url, w.Code, w.Header().Get("Location"), c.code, c.expect)
+		}
+	}
+}
+
+// TestNewHttpServer 服务的创建与路由注册，各接口的测试见 controller 包
+func TestNewHttpServer(t *testing.T) {
+	cfg := controllertest.Setup(t)
+	server, err := NewHttpServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Addr != ":8010" || server.redirect != nil || server.tlsConfig != nil || server.tlcpConfig != nil {
+		t.Fatalf("unexpected server: %+v", server)
+	}
+	// 路由已注册，中间件按顺序执行
+	for _, c := range []struct {
+		path string
+		code int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/api/user/info", http.StatusUnauthorized},
+		{"/", http.StatusMovedPermanently},
+	} {
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.code {
+			t.Errorf("%s: expect %d, got %d %s", c.path, c.code, w.Code, w.Body.String())
+		}
+	}
+	// 密钥文件格式错误时启动失败
+	cfg.JWT.KeyFile = filepath.Join(t.TempDir(), "jwt.key")
+	if err := os.WriteFile(cfg.JWT.KeyFile, []byte("bad"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewHttpServer(cfg); err == nil {
+		t.Fatal("expect error with malformed key file")
+	}
+}
+
+// writeServerCert 由 ca 签发 localhost 服务器证书，证书与私钥写入临时目录，返回文件路径
+// ca 为空时生成自签名证书，key 为 *sm2.PrivateKey 时使用SM2签名
+func writeServerCert(t *testing.T, name string, usage x509.KeyUsage, key interface{}, ca *x509.Certificate, caKey interface{}) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              usage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ca == nil {
+		tmpl.IsCA, tmpl.KeyUsage = true, usage|x509.KeyUsageCertSign
+		ca, caKey = tmpl, key
+	}
+	var der, keyDER []byte
+	var err error
+	if k, ok := key.(*sm2.PrivateKey); ok {
+		der, err = smx509.CreateCertificate(rand.Reader, tmpl, ca, &k.PublicKey, caKey)
+		if err == nil {
+			keyDER, err = smx509.MarshalPKCS8PrivateKey(k)
+		}
+	} else {
+		k := key.(*ecdsa.PrivateKey)
+		der, err = x509.CreateCertificate(rand.Reader, tmpl, ca, &k.PublicKey, caKey)
+		if err == nil {
+			keyDER, err = x509.MarshalPKCS8PrivateKey(k)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(t.TempDir(), name+".crt"), filepath.Join(t.TempDir(), name+".key")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := smx509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, (*x509.Certificate)(c)
+}
+
+// TestHttpServerTLCP 仅配置SM2双证书时提供TLCP服务，同时配置标准证书时同一端口自动识别TLS与TLCP
+func TestHttpServerTLCP(t *testing.T) {
+	cfg := controllertest.Setup(t)
+	caKey, _ := sm2.GenerateKey(rand.Reader)
+	_, _, ca := writeServerCert(t, "ca", x509.KeyUsageCRLSign, caKey, nil, nil)
+	signKey, _ := sm2.GenerateKey(rand.Reader)
+	encKey, _ := sm2.GenerateKey(rand.Reader)
+	cfg.TLS.Enable = true
+	cfg.TLS.SignCertFile, cfg.TLS.SignKeyFile, _ = writeServerCert(t, "sign", x509.KeyUsageDigitalSignature, signKey, ca, caKey)
+	cfg.TLS.EncCertFile, cfg.TLS.EncKeyFile, _ = writeServerCert(t, "enc", x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment, encKey, ca, caKey)
+	roots := gmx509.NewCertPool()
+	roots.AddCert(mustParseGM(t, ca.Raw))
+
+	// serve 启动服务并返回监听地址
+	serve := func() string {
+		server, err := NewHttpServer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = server.Serve(server.wrap(ln)) }()
+		t.Cleanup(func() { _ = server.Close() })
+		return ln.Addr().String()
+	}
+	// healthz 通过已建立的连接请求健康检查接口
+	healthz := func(conn net.Conn) {
+		t.Helper()
+		defer conn.Close()
+		_, _ = io.WriteString(conn, "GET /healthz HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		body, err := io.ReadAll(conn)
+		if err != nil || len(body) < 12 || string(body[9:12]) != "200" {
+			t.Fatalf("healthz: %v %q", err, body)
+		}
+	}
+	tlcp := func(addr string) {
+		t.Helper()
+		conn, err := gmtls.Dial("tcp", addr, &gmtls.Config{GMSupport: gmtls.NewGMSupport(), RootCAs: roots, ServerName: "localhost"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		healthz(conn)
+	}
+
+	addr := serve()
+	tlcp(addr)
+	if conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}); err == nil {
+		conn.Close()
+		t.Fatal("expect tls handshake failure without standard certificate")
+	}
+
+	stdKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var std *x509.Certificate
+	cfg.TLS.CertFile, cfg.TLS.KeyFile, std = writeServerCert(t, "std", x509.KeyUsageDigitalSignature, stdKey, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(std)
+	addr = serve()
+	tlcp(addr)
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthz(conn)
+	if conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, ServerName: "localhost", MaxVersion: tls.VersionTLS11}); err == nil {
+		conn.Close()
+		t.Fatal("expect tls 1.1 rejected")
+	}
+}
+
+func mustParseGM(t *testing.T, der []byte) *gmx509.Certificate {
+	t.Helper()
+	cert, err := gmx509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -9,18 +9,20 @@ CREATE TABLE admins
     password   VARCHAR(512),                       -- 口令加盐Hash结果 16进制字符串
     salt       VARCHAR(512),                       -- 盐值 16进制字符串
     role       TINYINT,                            -- 角色类型
-    cert       TEXT                                -- 证书
+    disabled   TINYINT DEFAULT 0,                  -- 是否禁用 0 - 启用 1 - 禁用
+    bind_code  VARCHAR(64),                        -- 证书绑定码SM3摘要 16进制字符串
+    bind_code_expires_at DATETIME                  -- 证书绑定码过期时间
 );
 -- 创建admin
 INSERT INTO `admins`
 VALUES (1, '2022-11-07 09:19:44', '2022-11-07 03:25:36', 'admin',
         'ba182cee746bc776a9bec5c73293dc730d517acf4a5f9c88213184739ef54693', 'a79e9fc93a41399c0e2a87971434655f',
-        0,NULL);
+        0, 0, NULL, NULL);
 
 INSERT INTO `admins`
 VALUES (2, '2022-11-07 09:19:44', '2022-11-07 10:25:36', 'audit',
         '9f1a7062905d2a4e208f92ecb56f967569762bdbd09f7e020414736e79067893', '9946f8047b368c6219ec246e3f4638cb',
-        1,NULL);
+        1, 0, NULL, NULL);
 
 -- 创建用户表
 DROP TABLE IF EXISTS users;
@@ -38,8 +40,16 @@ CREATE TABLE users
     phone       VARCHAR(256),                       -- 手机号
     email       VARCHAR(256),                       -- 邮箱
     sn			VARCHAR(128),												-- 身份证号
+    qq_openid   VARCHAR(256),                       -- QQ Openid
+    wechat_openid VARCHAR(256),                     -- 微信 Openid
     avatar      VARCHAR(512),												-- 头像文件名
-    is_delete   TINYINT-- 是否删除 0 - 未删除（默认值） 1 - 删除
+    is_delete   TINYINT,                            -- 是否删除 0 - 未删除（默认值） 1 - 删除
+    must_chg_pwd TINYINT DEFAULT 0,                 -- 是否需修改口令 0 - 否（默认值） 1 - 是
+    pwd_changed_at DATETIME NULL,                   -- 口令修改时间
+    totp_enabled TINYINT DEFAULT 0,                 -- 是否已启用动态口令 0 - 否（默认值） 1 - 是
+    totp_secret VARCHAR(64),                        -- 动态口令密钥Base32
+    totp_step   BIGINT DEFAULT 0,                   -- 上次验证通过的动态口令时间步
+    source      VARCHAR(16)                         -- 用户来源 空 - 本地用户（默认值） ldap - 目录服务
 );
 
 -- 创建项目表
@@ -54,7 +64,8 @@ CREATE TABLE projects
     description   VARCHAR(256),-- 简介
     manager       INTEGER,-- 项目负责人ID
     version       VARCHAR(256),-- 版本号 默认为空表示没有，在发布版本时更新该字段
-    is_delete     TINYINT-- 是否删除 0 - 未删除（默认值） 1 - 删除
+    is_delete     TINYINT,-- 是否删除 0 - 未删除（默认值） 1 - 删除
+    is_archive    TINYINT-- 是否归档 0 - 未归档（默认值） 1 - 归档，归档的项目只读
 );
 
 
@@ -93,6 +104,7 @@ CREATE TABLE api_cases
     name       VARCHAR(512) NOT NULL, -- 接口名称
     user_id  INTEGER, -- 创建人ID
     categorize_id  INTEGER, -- 所属分类ID
+    project_id  INTEGER, -- 所属项目ID
     description TEXT, -- 接口描述
     method INTEGER ,-- 请求方法 0-GET，1-POST，2-PUT，3-DELETE
     path VARCHAR(512),-- 请求路径
@@ -140,7 +152,8 @@ CREATE TABLE technical_proposals
     created_at DATETIME,                           -- 创建时间
     updated_at DATETIME,                           -- 更新时间
     project_id  INTEGER,                            -- 项目ID
-    name       VARCHAR(512) NOT NULL              -- 技术方案名称
+    name       VARCHAR(512) NOT NULL,             -- 技术方案名称
+    dir        VARCHAR(512)                       -- 技术方案所在的项目目录
 );
 
 -- 创建日志表
@@ -152,7 +165,8 @@ CREATE TABLE logs
     op_type    TINYINT,                            -- 操作者类型 类型如下包括：0 - 匿名，1 - 管理员，2 - 用户 若不知道用户或没有用户信息，则使用匿名。
     op_id      INTEGER,                            -- 操作者记录ID 0 表示匿名
     op_name    VARCHAR(512) NOT NULL,              -- 操作名称
-    op_param   TEXT NULL                           -- 操作的关键参数 可选参数，例如删除用户时，删除的用户ID，复杂参数请使用JSON对象字符串，如{id: 1}
+    op_param   TEXT NULL,                          -- 操作的关键参数 可选参数，例如删除用户时，删除的用户ID，复杂参数请使用JSON对象字符串，如{id: 1}
+    token_id   INTEGER DEFAULT 0                   -- 访问令牌ID 通过个人访问令牌调用时记录，0 表示未使用令牌
 );
 
 
@@ -166,5 +180,6 @@ CREATE TABLE configs
 );
 
 -- 创建版本号记录
+-- 版本号由程序启动时的数据库迁移维护（见 repo/migrations.go），导入本脚本后启动程序或执行 pdm migrate 即可补齐
 -- INSERT INTO configs(item_name, content)
 -- VALUES ("db_version", "2023010501");
\ No newline at end of file
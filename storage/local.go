@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Local 本地文件系统存储
+type Local struct {
+	root string // 存储根目录
+}
+
+// NewLocal 创建本地文件系统存储，根目录不存在时自动创建
+func NewLocal(root string) (*Local, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Local{root: root}, nil
+}
+
+// Root 存储根目录
+func (l *Local) Root() string {
+	return l.root
+}
+
+// abs 转换为本地文件系统的绝对路径
+func (l *Local) abs(name string) (string, string, error) {
+	p, ok := Clean(name)
+	if !ok {
+		return "", "", ErrInvalidPath
+	}
+	return p, filepath.Join(l.root, filepath.FromSlash(p)), nil
+}
+
+func (l *Local) info(p string, fi fs.FileInfo) FileInfo {
+	res := FileInfo{
+		Name:    fi.Name(),
+		Path:    p,
+		ModTime: fi.ModTime(),
+		IsDir:   fi.IsDir(),
+	}
+	if !res.IsDir {
+		res.Size = fi.Size()
+	}
+	return res
+}
+
+func (l *Local) Stat(name string) (*FileInfo, error) {
+	p, abs, err := l.abs(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	res := l.info(p, fi)
+	if p == "" {
+		res.Name = ""
+	}
+	return &res, nil
+}
+
+func (l *Local) List(dir string) ([]FileInfo, error) {
+	p, abs, err := l.abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			// 遍历过程中被删除
+			continue
+		}
+		res = append(res, l.info(path.Join(p, entry.Name()), fi))
+	}
+	sortInfos(res)
+	return res, nil
+}
+
+func (l *Local) Open(name string) (io.ReadCloser, error) {
+	_, abs, err := l.abs(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		_ = f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	return f, nil
+}
+
+// Put 先写入同目录下的临时文件再重命名，避免读取到写入一半的文件
+func (l *Local) Put(name string, r io.Reader, size int64) error {
+	p, abs, err := l.abs(name)
+	if err != nil {
+		return err
+	}
+	if p == "" {
+		return ErrInvalidPath
+	}
+	if err = os.MkdirAll(filepath.Dir(abs), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(abs), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), abs)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (l *Local) Remove(name string) error {
+	p, abs, err := l.abs(name)
+	if err != nil {
+		return err
+	}
+	if p == "" {
+		return ErrInvalidPath
+	}
+	return os.RemoveAll(abs)
+}
+
+func (l *Local) Rename(from, to string) error {
+	fp, fromAbs, err := l.abs(from)
+	if err != nil {
+		return err
+	}
+	tp, toAbs, err := l.abs(to)
+	if err != nil {
+		return err
+	}
+	if fp == "" || tp == "" {
+		return ErrInvalidPath
+	}
+	if err = os.MkdirAll(filepath.Dir(toAbs), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(fromAbs, toAbs)
+}
+
+func (l *Local) Copy(from, to string) error {
+	fp, _, err := l.abs(from)
+	if err != nil {
+		return err
+	}
+	tp, _, err := l.abs(to)
+	if err != nil {
+		return err
+	}
+	if fp == "" || tp == "" || IsSub(fp, tp) {
+		return ErrInvalidPath
+	}
+	return Transfer(l, tp, l, fp)
+}
+
+func (l *Local) MkdirAll(name string) error {
+	_, abs, err := l.abs(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(abs, os.ModePerm)
+}
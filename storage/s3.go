@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// S3 S3兼容的对象存储
+// 对象键为 "前缀/相对路径"，目录以 "/" 结尾的空对象表示，
+// 没有目录对象但存在子对象的前缀同样视为目录。
+type S3 struct {
+	client *S3Client
+	prefix string // 对象键前缀，不以 "/" 结尾，空表示存储桶根
+}
+
+// NewS3 创建对象存储，prefix 为该存储在存储桶中的对象键前缀
+func NewS3(client *S3Client, prefix string) *S3 {
+	return &S3{client: client, prefix: strings.Trim(prefix, "/")}
+}
+
+// key 相对路径对应的对象键
+func (s *S3) key(p string) string {
+	if s.prefix == "" {
+		return p
+	}
+	if p == "" {
+		return s.prefix
+	}
+	return s.prefix + "/" + p
+}
+
+// dirKey 目录对应的对象键前缀，以 "/" 结尾
+func (s *S3) dirKey(p string) string {
+	k := s.key(p)
+	if k == "" {
+		return ""
+	}
+	return k + "/"
+}
+
+func (s *S3) Stat(name string) (*FileInfo, error) {
+	p, ok := Clean(name)
+	if !ok {
+		return nil, ErrInvalidPath
+	}
+	if p == "" {
+		return &FileInfo{IsDir: true}, nil
+	}
+	obj, err := s.client.headObject(s.key(p))
+	if err == nil {
+		return &FileInfo{Name: path.Base(p), Path: p, Size: obj.Size, ModTime: obj.LastModified}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	prefix := s.dirKey(p)
+	objects, prefixes, err := s.client.listObjects(prefix, "/", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 && len(prefixes) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	res := &FileInfo{Name: path.Base(p), Path: p, IsDir: true}
+	if len(objects) > 0 && objects[0].Key == prefix {
+		res.ModTime = objects[0].LastModified
+	}
+	return res, nil
+}
+
+func (s *S3) List(dir string) ([]FileInfo, error) {
+	p, ok := Clean(dir)
+	if !ok {
+		return nil, ErrInvalidPath
+	}
+	prefix := s.dirKey(p)
+	objects, prefixes, err := s.client.listObjects(prefix, "/", 0)
+	if err != nil {
+		return nil, err
+	}
+	found := p == "" || len(objects) > 0 || len(prefixes) > 0
+	if !found {
+		if _, err = s.Stat(p); err != nil {
+			return nil, err
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: errors.New("not a directory")}
+	}
+	res := make([]FileInfo, 0, len(objects)+len(prefixes))
+	for _, obj := range objects {
+		name := strings.TrimPrefix(obj.Key, prefix)
+		if name == "" {
+			// 目录对象本身
+			continue
+		}
+		res = append(res, FileInfo{
+			Name:    name,
+			Path:    path.Join(p, name),
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+	for _, item := range prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(item, prefix), "/")
+		if name == "" {
+			continue
+		}
+		res = append(res, FileInfo{Name: name, Path: path.Join(p, name), IsDir: true})
+	}
+	sortInfos(res)
+	return res, nil
+}
+
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	p, ok := Clean(name)
+	if !ok || p == "" {
+		return nil, ErrInvalidPath
+	}
+	return s.client.getObject(s.key(p))
+}
+
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	p, ok := Clean(name)
+	if !ok || p == "" {
+		return ErrInvalidPath
+	}
+	if size < 0 {
+		// 对象存储上传需要预先知道内容长度
+		bin, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(bin), int64(len(bin))
+	}
+	return s.client.putObject(s.key(p), r, size)
+}
+
+func (s *S3) Remove(name string) error {
+	p, ok := Clean(name)
+	if !ok || p == "" {
+		return ErrInvalidPath
+	}
+	if err := s.client.deleteObject(s.key(p)); err != nil {
+		return err
+	}
+	objects, _, err := s.client.listObjects(s.dirKey(p), "", 0)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err = s.client.deleteObject(obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename 对象存储不支持重命名，复制后删除原对象
+func (s *S3) Rename(from, to string) error {
+	if err := s.Copy(from, to); err != nil {
+		return err
+	}
+	return s.Remove(from)
+}
+
+func (s *S3) Copy(from, to string) error {
+	fp, ok1 := Clean(from)
+	tp, ok2 := Clean(to)
+	if !ok1 || !ok2 || fp == "" || tp == "" || IsSub(fp, tp) {
+		return ErrInvalidPath
+	}
+	info, err := s.Stat(fp)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return s.client.copyObject(s.key(fp), s.key(tp))
+	}
+	if err = s.MkdirAll(tp); err != nil {
+		return err
+	}
+	fromPrefix, toPrefix := s.dirKey(fp), s.dirKey(tp)
+	objects, _, err := s.client.listObjects(fromPrefix, "", 0)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if obj.Key == fromPrefix {
+			continue
+		}
+		if err = s.client.copyObject(obj.Key, toPrefix+strings.TrimPrefix(obj.Key, fromPrefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirAll 创建目录对象，上级目录由对象键前缀隐含表示
+func (s *S3) MkdirAll(name string) error {
+	p, ok := Clean(name)
+	if !ok {
+		return ErrInvalidPath
+	}
+	if p == "" {
+		return nil
+	}
+	return s.client.putObject(s.dirKey(p), nil, 0)
+}
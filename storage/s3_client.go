@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"pdm/appconf"
+	"strings"
+	"time"
+)
+
+// S3Client S3兼容的对象存储客户端
+// 基于 minio-go 实现文件存储所需的对象操作，所有操作均在配置的存储桶中进行。
+type S3Client struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Client 创建对象存储客户端
+func NewS3Client(cfg *appconf.S3) (*S3Client, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("storage: 对象存储服务地址 %q 无效", cfg.Endpoint)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	lookup := minio.BucketLookupPath
+	if cfg.VirtualHostStyle {
+		lookup = minio.BucketLookupDNS
+	}
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       u.Scheme == "https",
+		Region:       region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: 创建对象存储客户端失败，%w", err)
+	}
+	return &S3Client{client: client, bucket: cfg.Bucket}, nil
+}
+
+// s3Object 对象信息
+type s3Object struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+// s3Error 转换对象存储返回的错误，对象不存在时与 fs.ErrNotExist 等价
+func s3Error(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	res := minio.ToErrorResponse(err)
+	if res.StatusCode == http.StatusNotFound || res.Code == "NoSuchKey" {
+		return &fs.PathError{Op: "s3", Path: key, Err: fs.ErrNotExist}
+	}
+	return fmt.Errorf("storage: 对象存储请求失败，%w", err)
+}
+
+// headObject 获取对象信息
+func (c *S3Client) headObject(key string) (*s3Object, error) {
+	info, err := c.client.StatObject(context.Background(), c.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(key, err)
+	}
+	return &s3Object{Key: key, Size: info.Size, LastModified: info.LastModified}, nil
+}
+
+// getObject 读取对象内容
+func (c *S3Client) getObject(key string) (io.ReadCloser, error) {
+	obj, err := c.client.GetObject(context.Background(), c.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(key, err)
+	}
+	// GetObject 在首次读取时才发送请求，预先获取对象信息以便及时返回不存在等错误
+	if _, err = obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, s3Error(key, err)
+	}
+	return obj, nil
+}
+
+// putObject 上传对象
+func (c *S3Client) putObject(key string, r io.Reader, size int64) error {
+	if r == nil {
+		r = strings.NewReader("")
+	}
+	_, err := c.client.PutObject(context.Background(), c.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		// 与原有实现一致单次上传，且不对请求体签名，避免上传时缓存整个文件计算摘要
+		DisableMultipart:     true,
+		DisableContentSha256: true,
+	})
+	return s3Error(key, err)
+}
+
+// copyObject 服务端复制对象
+func (c *S3Client) copyObject(from, to string) error {
+	_, err := c.client.CopyObject(context.Background(),
+		minio.CopyDestOptions{Bucket: c.bucket, Object: to},
+		minio.CopySrcOptions{Bucket: c.bucket, Object: from})
+	return s3Error(from, err)
+}
+
+// deleteObject 删除对象，不存在时不报错
+func (c *S3Client) deleteObject(key string) error {
+	err := s3Error(key, c.client.RemoveObject(context.Background(), c.bucket, key, minio.RemoveObjectOptions{}))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// listObjects 列出指定前缀的对象
+// delimiter 非空时返回以 "/" 分隔的公共前缀（即子目录）；limit 大于0时最多返回limit个对象
+func (c *S3Client) listObjects(prefix, delimiter string, limit int) ([]s3Object, []string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var objects []s3Object
+	var prefixes []string
+	for info := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: delimiter == "",
+		MaxKeys:   limit,
+	}) {
+		if info.Err != nil {
+			return nil, nil, s3Error(prefix, info.Err)
+		}
+		// 非递归列表中以 "/" 结尾的键为公共前缀，前缀本身为目录对象
+		if delimiter != "" && info.Key != prefix && strings.HasSuffix(info.Key, "/") {
+			prefixes = append(prefixes, info.Key)
+		} else {
+			objects = append(objects, s3Object{Key: info.Key, LastModified: info.LastModified, Size: info.Size})
+		}
+		if limit > 0 && len(objects)+len(prefixes) >= limit {
+			break
+		}
+	}
+	return objects, prefixes, nil
+}
@@ -0,0 +1,227 @@
+// Package storage 文件存储
+//
+// 对接文档、基础文档区、技术方案、头像以及根证书等业务文件均通过 Storage 接口访问，
+// 支持本地文件系统与 S3 兼容的对象存储（如 MinIO）两种驱动，
+// 使用对象存储时多个 pdm 实例可以共享同一份文件。
+//
+// 接口中的路径均为相对于存储根的 "/" 分隔路径，如 "标准/国密标准/电子签章.pdf"，
+// 空字符串表示存储根，越出存储根的路径返回 ErrInvalidPath。
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"path"
+	"pdm/appconf"
+	"pdm/appconf/dir"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidPath 路径非法，如越出存储根
+	ErrInvalidPath = errors.New("storage: 文件路径错误")
+	// ErrNotExist 文件不存在
+	ErrNotExist = fs.ErrNotExist
+	// SkipDir 在 Walk 回调中返回时跳过该目录
+	SkipDir = fs.SkipDir
+)
+
+// FileInfo 文件信息
+type FileInfo struct {
+	Name    string    // 文件名
+	Path    string    // 相对于存储根的路径
+	Size    int64     // 文件大小（单位 B），目录为0
+	ModTime time.Time // 最后修改时间，对象存储中的目录可能为零值
+	IsDir   bool      // 是否为目录
+}
+
+// Storage 文件存储
+type Storage interface {
+	// Stat 获取文件或目录信息，不存在时返回 ErrNotExist
+	Stat(name string) (*FileInfo, error)
+	// List 列出目录下的直接子文件与子目录，按名称排序
+	List(dir string) ([]FileInfo, error)
+	// Open 打开文件读取
+	Open(name string) (io.ReadCloser, error)
+	// Put 写入文件，已存在时覆盖，上级目录不存在时自动创建
+	// size 为内容长度，未知时传 -1
+	Put(name string, r io.Reader, size int64) error
+	// Remove 删除文件或目录（包括目录下所有文件），不存在时不报错
+	Remove(name string) error
+	// Rename 移动或重命名文件、目录
+	Rename(from, to string) error
+	// Copy 复制文件或目录
+	Copy(from, to string) error
+	// MkdirAll 递归创建目录
+	MkdirAll(name string) error
+}
+
+// 各业务文件存储，由 Init 初始化
+var (
+	Doc               Storage // 对接文档文件存储
+	BaseDocArea       Storage // 基础文档区存储
+	TechnicalProposal Storage // 技术方案存储
+	Avatar            Storage // 头像存储
+	RootCert          Storage // 根证书存储
+)
+
+// Init 根据配置初始化各业务文件存储
+// 本地存储使用 dir 包中的存储目录；对象存储在同一个存储桶中以目录名区分。
+func Init(cfg *appconf.Storage) error {
+	roots := []struct {
+		s     *Storage
+		local string
+		name  string
+	}{
+		{&Doc, dir.DocDir, "doc"},
+		{&BaseDocArea, dir.BaseDocAreaDir, "baseDocArea"},
+		{&TechnicalProposal, dir.TechnicalProposalDir, "technicalProposal"},
+		{&Avatar, dir.AvatarDir, "avatar"},
+		{&RootCert, dir.RootCertDir, "rootCerts"},
+	}
+	switch cfg.Type {
+	case "", "local":
+		for _, root := range roots {
+			s, err := NewLocal(root.local)
+			if err != nil {
+				return err
+			}
+			*root.s = s
+		}
+	case "s3":
+		client, err := NewS3Client(&cfg.S3)
+		if err != nil {
+			return err
+		}
+		for _, root := range roots {
+			*root.s = NewS3(client, path.Join(cfg.S3.Prefix, root.name))
+		}
+	default:
+		return fmt.Errorf("storage: 不支持的存储类型 %s", cfg.Type)
+	}
+	return nil
+}
+
+// Clean 清理用户传入的路径，返回相对于存储根的路径
+// 路径越出存储根时 ok 为 false，存储根本身返回空字符串。
+func Clean(name string) (p string, ok bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.TrimLeft(name, "/")
+	p = path.Clean(name)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	if p == "." {
+		p = ""
+	}
+	return p, true
+}
+
+// IsSub 判断 name 是否为 parent 的子路径（不含 parent 本身）
+func IsSub(parent, name string) bool {
+	return parent == "" && name != "" || strings.HasPrefix(name, parent+"/")
+}
+
+// WalkFunc Walk 回调，返回 SkipDir 跳过目录
+type WalkFunc func(info FileInfo) error
+
+// Walk 深度优先遍历目录下所有文件与子目录（不含目录本身）
+func Walk(s Storage, root string, fn WalkFunc) error {
+	items, err := s.List(root)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		err = fn(item)
+		if item.IsDir && err == SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if item.IsDir {
+			if err = Walk(s, item.Path, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFile 读取文件全部内容
+func ReadFile(s Storage, name string) ([]byte, error) {
+	r, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WriteFile 写入文件，已存在时覆盖
+func WriteFile(s Storage, name string, data []byte) error {
+	return s.Put(name, bytes.NewReader(data), int64(len(data)))
+}
+
+// SaveUploadedFile 保存表单上传的文件
+func SaveUploadedFile(s Storage, file *multipart.FileHeader, name string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.Put(name, src, file.Size)
+}
+
+// Exist 文件或目录是否存在
+func Exist(s Storage, name string) (bool, error) {
+	_, err := s.Stat(name)
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Transfer 将 src 中的文件或目录复制到 dst 中
+// 用于不同存储之间的复制，同一存储内请使用 Storage.Copy
+func Transfer(dst Storage, dstName string, src Storage, srcName string) error {
+	info, err := src.Stat(srcName)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return transferFile(dst, dstName, src, srcName, info.Size)
+	}
+	if err = dst.MkdirAll(dstName); err != nil {
+		return err
+	}
+	return Walk(src, srcName, func(item FileInfo) error {
+		target := path.Join(dstName, strings.TrimPrefix(item.Path, srcName))
+		if item.IsDir {
+			return dst.MkdirAll(target)
+		}
+		return transferFile(dst, target, src, item.Path, item.Size)
+	})
+}
+
+func transferFile(dst Storage, dstName string, src Storage, srcName string, size int64) error {
+	r, err := src.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(dstName, r, size)
+}
+
+// sortInfos 目录列表按名称排序
+func sortInfos(items []FileInfo) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+}
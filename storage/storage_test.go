@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"pdm/appconf"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStorage 各存储驱动通用的测试用例
+func testStorage(t *testing.T, s Storage) {
+	put := func(name, content string) {
+		t.Helper()
+		if err := WriteFile(s, name, []byte(content)); err != nil {
+			t.Fatalf("put %s: %v", name, err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		bin, err := ReadFile(s, name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		return string(bin)
+	}
+	notExist := func(name string) {
+		t.Helper()
+		if _, err := s.Stat(name); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s: expect not exist, got %v", name, err)
+		}
+	}
+
+	put("标准/国密 标准(1)/电子签章+v2.pdf", "pdf")
+	put("标准/readme.md", "hello")
+	put("/标准/readme.md", "hello world")
+	if err := s.MkdirAll("空目录/子目录"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("空文件.txt", strings.NewReader(""), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("未知长度.txt", strings.NewReader("stream"), -1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 文件信息
+	info, err := s.Stat("标准/readme.md")
+	if err != nil || info.IsDir || info.Size != 11 || info.Name != "readme.md" || info.Path != "标准/readme.md" {
+		t.Fatalf("stat file: %+v %v", info, err)
+	}
+	if info.ModTime.IsZero() || time.Since(info.ModTime) > time.Hour {
+		t.Fatalf("stat file: unexpected modTime %v", info.ModTime)
+	}
+	for _, name := range []string{"标准", "标准/国密 标准(1)", "空目录/子目录", "/空目录/", ""} {
+		if info, err = s.Stat(name); err != nil || !info.IsDir {
+			t.Fatalf("stat dir %s: %+v %v", name, info, err)
+		}
+	}
+	notExist("不存在")
+	notExist("标准/read")
+	if read("标准/readme.md") != "hello world" || read("标准/国密 标准(1)/电子签章+v2.pdf") != "pdf" ||
+		read("空文件.txt") != "" || read("未知长度.txt") != "stream" {
+		t.Fatal("content not match")
+	}
+	if _, err = s.Open("不存在.txt"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("open: expect not exist, got %v", err)
+	}
+
+	// 目录列表
+	list, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := infoNames(list); names != "未知长度.txt,标准/,空文件.txt,空目录/" {
+		t.Fatalf("list root: %s", names)
+	}
+	list, err = s.List("标准")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := infoNames(list); names != "readme.md,国密 标准(1)/" || list[1].Path != "标准/国密 标准(1)" {
+		t.Fatalf("list dir: %s", names)
+	}
+	if list, err = s.List("空目录/子目录"); err != nil || len(list) != 0 {
+		t.Fatalf("list empty dir: %v %v", list, err)
+	}
+	if _, err = s.List("不存在"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("list: expect not exist, got %v", err)
+	}
+
+	// 遍历
+	var walked []string
+	err = Walk(s, "", func(info FileInfo) error {
+		walked = append(walked, info.Path)
+		if info.Name == "空目录" {
+			return SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(walked)
+	if strings.Join(walked, ",") != "未知长度.txt,标准,标准/readme.md,标准/国密 标准(1),标准/国密 标准(1)/电子签章+v2.pdf,空文件.txt,空目录" {
+		t.Fatalf("walk: %v", walked)
+	}
+
+	// 复制
+	if err = s.Copy("标准", "备份/标准"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Copy("标准/readme.md", "备份/readme.md"); err != nil {
+		t.Fatal(err)
+	}
+	if read("备份/标准/国密 标准(1)/电子签章+v2.pdf") != "pdf" || read("备份/readme.md") != "hello world" {
+		t.Fatal("copy content not match")
+	}
+	if err = s.Copy("标准", "标准/国密 标准(1)/标准"); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("copy into itself: expect invalid path, got %v", err)
+	}
+
+	// 移动
+	if err = s.Rename("备份/标准", "归档"); err != nil {
+		t.Fatal(err)
+	}
+	notExist("备份/标准")
+	if read("归档/国密 标准(1)/电子签章+v2.pdf") != "pdf" {
+		t.Fatal("rename content not match")
+	}
+	if err = s.Rename("备份/readme.md", "归档/说明.md"); err != nil {
+		t.Fatal(err)
+	}
+	if read("归档/说明.md") != "hello world" {
+		t.Fatal("rename file content not match")
+	}
+
+	// 压缩
+	var buf bytes.Buffer
+	if err = Zip(&buf, s, "归档", "标准/readme.md"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, f := range zr.File {
+		entries = append(entries, f.Name)
+	}
+	sort.Strings(entries)
+	if strings.Join(entries, ",") != "readme.md,归档/,归档/readme.md,归档/国密 标准(1)/,归档/国密 标准(1)/电子签章+v2.pdf,归档/说明.md" {
+		t.Fatalf("zip entries: %v", entries)
+	}
+
+	// 删除
+	if err = s.Remove("归档"); err != nil {
+		t.Fatal(err)
+	}
+	notExist("归档")
+	notExist("归档/说明.md")
+	if err = s.Remove("归档"); err != nil {
+		t.Fatalf("remove not exist: %v", err)
+	}
+
+	// 越界访问
+	for _, name := range []string{"..", "../etc/passwd", "标准/../../etc"} {
+		if _, err = s.Stat(name); !errors.Is(err, ErrInvalidPath) {
+			t.Fatalf("stat %s: expect invalid path, got %v", name, err)
+		}
+		if err = WriteFile(s, name, nil); !errors.Is(err, ErrInvalidPath) {
+			t.Fatalf("put %s: expect invalid path, got %v", name, err)
+		}
+	}
+	if err = s.Remove(""); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("remove root: expect invalid path, got %v", err)
+	}
+}
+
+// infoNames 列表中的文件名，目录以 "/" 结尾
+func infoNames(list []FileInfo) string {
+	var names []string
+	for _, item := range list {
+		if item.IsDir {
+			names = append(names, item.Name+"/")
+		} else {
+			names = append(names, item.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func TestLocal(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
+
+func TestS3(t *testing.T) {
+	srv := newFakeS3(t, "pdm", "minio", "minio-secret")
+	client, err := NewS3Client(&appconf.S3{
+		Endpoint:  srv.URL,
+		Bucket:    "pdm",
+		AccessKey: "minio",
+		SecretKey: "minio-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, NewS3(client, "test/doc"))
+	// 同一存储桶中的其他前缀互不影响
+	other := NewS3(client, "test/doc2")
+	if list, err := other.List(""); err != nil || len(list) != 0 {
+		t.Fatalf("other prefix: %v %v", list, err)
+	}
+
+	// 密钥错误
+	client, err = NewS3Client(&appconf.S3{Endpoint: srv.URL, Bucket: "pdm", AccessKey: "minio", SecretKey: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewS3(client, "").Stat("标准"); err == nil {
+		t.Fatal("expect signature error")
+	}
+}
+
+// TestS3_MinIO 在设置了 PDM_TEST_S3_ENDPOINT 等环境变量时使用真实的对象存储服务测试
+func TestS3_MinIO(t *testing.T) {
+	cfg := &appconf.S3{
+		Endpoint:  os.Getenv("PDM_TEST_S3_ENDPOINT"),
+		Bucket:    os.Getenv("PDM_TEST_S3_BUCKET"),
+		AccessKey: os.Getenv("PDM_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("PDM_TEST_S3_SECRET_KEY"),
+	}
+	if cfg.Endpoint == "" {
+		t.Skip("PDM_TEST_S3_ENDPOINT not set")
+	}
+	client, err := NewS3Client(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewS3(client, fmt.Sprintf("pdm-test-%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		list, _ := s.List("")
+		for _, item := range list {
+			_ = s.Remove(item.Path)
+		}
+	})
+	testStorage(t, s)
+}
+
+func TestTransfer(t *testing.T) {
+	srv := newFakeS3(t, "pdm", "minio", "minio-secret")
+	client, _ := NewS3Client(&appconf.S3{Endpoint: srv.URL, Bucket: "pdm", AccessKey: "minio", SecretKey: "minio-secret"})
+	remote := NewS3(client, "")
+	local, _ := NewLocal(t.TempDir())
+
+	_ = WriteFile(local, "1/a.md", []byte("a"))
+	_ = WriteFile(local, "1/img/b.png", []byte("b"))
+	_ = local.MkdirAll("1/empty")
+	if err := Transfer(remote, "方案/1", local, "1"); err != nil {
+		t.Fatal(err)
+	}
+	back, _ := NewLocal(t.TempDir())
+	if err := Transfer(back, "", remote, "方案/1"); err != nil {
+		t.Fatal(err)
+	}
+	if bin, _ := ReadFile(back, "img/b.png"); string(bin) != "b" {
+		t.Fatal("transfer content not match")
+	}
+	if info, err := back.Stat("empty"); err != nil || !info.IsDir {
+		t.Fatalf("transfer empty dir: %v", err)
+	}
+}
+
+func TestClean(t *testing.T) {
+	cases := map[string]string{
+		"":           "",
+		"/":          "",
+		"/a/b/":      "a/b",
+		"a//b/./c":   "a/b/c",
+		"a/../b":     "b",
+		"\\a\\b":     "a/b",
+		"/a/../../b": "!",
+		"..":         "!",
+		"../a":       "!",
+		"..a":        "..a",
+	}
+	for name, expect := range cases {
+		p, ok := Clean(name)
+		if !ok {
+			p = "!"
+		}
+		if p != expect {
+			t.Errorf("Clean(%q) = %q, expect %q", name, p, expect)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+	"strings"
+)
+
+// Zip 将存储中的文件或目录压缩并输出到流
+// 每个待压缩路径以其文件名作为压缩包中的顶层条目，目录递归压缩。
+// out: 输出流，应由调用者负责关闭该流。
+func Zip(out io.Writer, s Storage, names ...string) error {
+	archive := zip.NewWriter(out)
+	for _, name := range names {
+		info, err := s.Stat(name)
+		if err != nil {
+			return err
+		}
+		parent := path.Dir(info.Path)
+		if parent == "." {
+			parent = ""
+		}
+		if err = zipEntry(archive, s, parent, *info); err != nil {
+			return err
+		}
+		if !info.IsDir {
+			continue
+		}
+		err = Walk(s, info.Path, func(item FileInfo) error {
+			return zipEntry(archive, s, parent, item)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// zipEntry 写入压缩条目，条目名称为相对于 parent 的路径
+func zipEntry(archive *zip.Writer, s Storage, parent string, info FileInfo) error {
+	header := &zip.FileHeader{
+		Name:     strings.TrimPrefix(strings.TrimPrefix(info.Path, parent), "/"),
+		Modified: info.ModTime,
+		Method:   zip.Deflate,
+	}
+	if info.IsDir {
+		// 目录条目需以 "/" 结尾
+		header.Name += "/"
+		header.Method = zip.Store
+	}
+	writer, err := archive.CreateHeader(header)
+	if err != nil || info.IsDir {
+		return err
+	}
+	r, err := s.Open(info.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(writer, r)
+	return err
+}